@@ -0,0 +1,75 @@
+package graph
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	gql_model "github.com/maxeth/go-account-api/graph/model"
+	"github.com/maxeth/go-account-api/model"
+)
+
+// requireAdmin returns an error unless the user of the request is an active admin.
+// The role is read from the database rather than the access token, so that revoking it takes effect immediately
+func (r *Resolver) requireAdmin(ctx context.Context) error {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return model.NewAuthorization("not signed in")
+	}
+
+	admin, err := loadersFromContext(ctx).User.Load(user.UID)
+	if err != nil || admin.CheckActive() != nil || admin.Role != model.RoleAdmin {
+		return model.NewForbidden("Admin role required.")
+	}
+
+	return nil
+}
+
+func (r *mutationResolver) setUserStatus(ctx context.Context, uid string, status string) (*gql_model.AdminUser, error) {
+	if err := r.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	id, err := parseUID(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := r.AdminService.SetStatus(ctx, id, status)
+	if err != nil {
+		return nil, err
+	}
+
+	return adminUserFromModel(u), nil
+}
+
+func parseUID(uid string) (uuid.UUID, error) {
+	id, err := uuid.Parse(uid)
+	if err != nil {
+		return uuid.UUID{}, model.NewValidation("uid", "Expected the uid as uuid.")
+	}
+	return id, nil
+}
+
+func adminUserFromModel(u *model.User) *gql_model.AdminUser {
+	var lockedUntil *string
+	if u.LockedUntil != nil && u.LockedUntil.After(time.Now()) {
+		l := u.LockedUntil.Format(time.RFC3339)
+		lockedUntil = &l
+	}
+
+	return &gql_model.AdminUser{
+		UID:          u.UID.String(),
+		Email:        u.Email,
+		PendingEmail: &u.PendingEmail,
+		Name:         &u.Name,
+		ImageURL:     &u.ImageURL,
+		Website:      &u.Website,
+		Role:         u.Role,
+		Status:       gql_model.UserStatus(strings.ToUpper(u.Status)),
+		CreatedAt:    u.CreatedAt.Format(time.RFC3339),
+		FailedLogins: u.FailedLogins,
+		LockedUntil:  lockedUntil,
+	}
+}
@@ -0,0 +1,135 @@
+package graph
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+
+import (
+	"context"
+	"strings"
+
+	gql_model "github.com/maxeth/go-account-api/graph/model"
+	"github.com/maxeth/go-account-api/model"
+)
+
+func (r *mutationResolver) SuspendUser(ctx context.Context, uid string) (*gql_model.AdminUser, error) {
+	return r.setUserStatus(ctx, uid, model.StatusSuspended)
+}
+
+func (r *mutationResolver) UnsuspendUser(ctx context.Context, uid string) (*gql_model.AdminUser, error) {
+	return r.setUserStatus(ctx, uid, model.StatusActive)
+}
+
+func (r *mutationResolver) SetUserRole(ctx context.Context, uid string, role string) (*gql_model.AdminUser, error) {
+	if err := r.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	id, err := parseUID(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := r.AdminService.SetRole(ctx, id, role)
+	if err != nil {
+		return nil, err
+	}
+
+	return adminUserFromModel(u), nil
+}
+
+func (r *mutationResolver) ForcePasswordReset(ctx context.Context, uid string) (bool, error) {
+	if err := r.requireAdmin(ctx); err != nil {
+		return false, err
+	}
+
+	id, err := parseUID(uid)
+	if err != nil {
+		return false, err
+	}
+
+	if err := r.AdminService.ForcePasswordReset(ctx, id); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) RevokeSessions(ctx context.Context, uid string) (bool, error) {
+	if err := r.requireAdmin(ctx); err != nil {
+		return false, err
+	}
+
+	id, err := parseUID(uid)
+	if err != nil {
+		return false, err
+	}
+
+	if err := r.AdminService.RevokeSessions(ctx, id); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *queryResolver) Users(ctx context.Context, filter *gql_model.UserFilter, first *int, after *string) (*gql_model.UserConnection, error) {
+	if err := r.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	f := model.UserFilter{}
+	if filter != nil && filter.Search != nil {
+		f.Search = *filter.Search
+	}
+	if filter != nil && filter.Status != nil {
+		f.Status = strings.ToLower(filter.Status.String())
+	}
+	if first != nil {
+		f.Limit = *first
+	}
+	if after != nil {
+		f.After = *after
+	}
+
+	page, err := r.AdminService.ListUsers(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &gql_model.UserConnection{
+		Edges: make([]*gql_model.UserEdge, len(page.Users)),
+		PageInfo: &gql_model.PageInfo{
+			HasNextPage: page.NextCursor != "",
+		},
+	}
+
+	for i, u := range page.Users {
+		conn.Edges[i] = &gql_model.UserEdge{
+			Cursor: u.Cursor(),
+			Node:   adminUserFromModel(u),
+		}
+	}
+
+	if len(conn.Edges) > 0 {
+		conn.PageInfo.EndCursor = &conn.Edges[len(conn.Edges)-1].Cursor
+	}
+
+	return conn, nil
+}
+
+func (r *queryResolver) AdminUser(ctx context.Context, uid string) (*gql_model.AdminUser, error) {
+	if err := r.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	id, err := parseUID(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := r.AdminService.GetUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return adminUserFromModel(u), nil
+}
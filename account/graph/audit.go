@@ -0,0 +1,107 @@
+package graph
+
+import (
+	"strconv"
+	"time"
+
+	gql_model "github.com/maxeth/go-account-api/graph/model"
+	"github.com/maxeth/go-account-api/model"
+)
+
+// auditService returns the AuditService, or an error if the audit log isn't available
+func (r *Resolver) auditService() (model.AuditService, error) {
+	if r.AuditService == nil {
+		return nil, model.NewBadRequest("The audit log is not available.")
+	}
+
+	return r.AuditService, nil
+}
+
+// auditFilterFromInput converts the filter and pagination arguments of auditEvents
+func auditFilterFromInput(filter *gql_model.AuditEventFilter, first *int, after *string) (model.AuditEventFilter, error) {
+	f := model.AuditEventFilter{}
+	if first != nil {
+		f.Limit = *first
+	}
+	if after != nil {
+		before, err := strconv.ParseInt(*after, 10, 64)
+		if err != nil || before < 1 {
+			return f, model.NewValidation("after", "Invalid cursor.")
+		}
+		f.Before = before
+	}
+	if filter == nil {
+		return f, nil
+	}
+
+	if filter.UID != nil {
+		uid, err := parseUID(*filter.UID)
+		if err != nil {
+			return f, err
+		}
+		f.UID = &uid
+	}
+	f.Types = filter.Types
+
+	var err error
+	if f.From, err = parseTimestamp("from", filter.From); err != nil {
+		return f, err
+	}
+	if f.To, err = parseTimestamp("to", filter.To); err != nil {
+		return f, err
+	}
+
+	return f, nil
+}
+
+// parseTimestamp parses an optional RFC 3339 timestamp, nil becomes the zero time
+func parseTimestamp(field string, value *string) (time.Time, error) {
+	if value == nil {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, *value)
+	if err != nil {
+		return time.Time{}, model.NewValidation(field, "Expected an RFC 3339 timestamp.")
+	}
+	return t, nil
+}
+
+func auditEventFromModel(e *model.AuditEvent) *gql_model.AuditEvent {
+	event := &gql_model.AuditEvent{
+		ID:        strconv.FormatInt(e.ID, 10),
+		Type:      e.Type,
+		IP:        e.IP,
+		UserAgent: e.UserAgent,
+		RequestID: e.RequestID,
+		Details:   e.Details,
+		CreatedAt: e.CreatedAt.Format(time.RFC3339),
+	}
+	if event.Details == nil {
+		event.Details = map[string]interface{}{}
+	}
+	if e.ActorUID != nil {
+		uid := e.ActorUID.String()
+		event.ActorUID = &uid
+	}
+	if e.SubjectUID != nil {
+		uid := e.SubjectUID.String()
+		event.SubjectUID = &uid
+	}
+
+	return event
+}
+
+func activityFromModel(a *model.Activity) *gql_model.Activity {
+	activity := &gql_model.Activity{
+		ID:        strconv.FormatInt(a.ID, 10),
+		Type:      a.Type,
+		Details:   a.Details,
+		CreatedAt: a.CreatedAt.Format(time.RFC3339),
+	}
+	if activity.Details == nil {
+		activity.Details = map[string]interface{}{}
+	}
+
+	return activity
+}
@@ -0,0 +1,73 @@
+package graph
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+
+import (
+	"context"
+	"strconv"
+
+	gql_model "github.com/maxeth/go-account-api/graph/model"
+)
+
+func (r *queryResolver) RecentActivity(ctx context.Context) ([]*gql_model.Activity, error) {
+	user, _ := UserFromContext(ctx)
+
+	as, err := r.auditService()
+	if err != nil {
+		return nil, err
+	}
+
+	activity, err := as.RecentActivity(ctx, user.UID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*gql_model.Activity, len(activity))
+	for i, a := range activity {
+		res[i] = activityFromModel(a)
+	}
+
+	return res, nil
+}
+
+func (r *queryResolver) AuditEvents(ctx context.Context, filter *gql_model.AuditEventFilter, first *int, after *string) (*gql_model.AuditEventConnection, error) {
+	if err := r.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	as, err := r.auditService()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := auditFilterFromInput(filter, first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := as.Query(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &gql_model.AuditEventConnection{
+		Edges: make([]*gql_model.AuditEventEdge, len(page.Events)),
+		PageInfo: &gql_model.PageInfo{
+			HasNextPage: page.NextCursor != "",
+		},
+	}
+
+	for i, e := range page.Events {
+		conn.Edges[i] = &gql_model.AuditEventEdge{
+			Cursor: strconv.FormatInt(e.ID, 10),
+			Node:   auditEventFromModel(e),
+		}
+	}
+
+	if len(conn.Edges) > 0 {
+		conn.PageInfo.EndCursor = &conn.Edges[len(conn.Edges)-1].Cursor
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,90 @@
+package graph
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/maxeth/go-account-api/model"
+)
+
+type contextKey struct {
+	name string
+}
+
+var (
+	userCtxKey      = &contextKey{"user"}
+	authErrorCtxKey = &contextKey{"authError"}
+	clientIPCtxKey  = &contextKey{"clientIP"}
+	httpCtxKey      = &contextKey{"http"}
+)
+
+// WithUser returns a copy of ctx holding the authenticated user of the request
+func WithUser(ctx context.Context, u *model.User) context.Context {
+	return context.WithValue(ctx, userCtxKey, u)
+}
+
+// UserFromContext returns the authenticated user of the request, if there is one
+func UserFromContext(ctx context.Context) (*model.User, bool) {
+	u, ok := ctx.Value(userCtxKey).(*model.User)
+	return u, ok
+}
+
+// WithAuthError returns a copy of ctx holding the reason the request couldn't be authenticated
+func WithAuthError(ctx context.Context, err *model.Error) context.Context {
+	return context.WithValue(ctx, authErrorCtxKey, err)
+}
+
+// authError returns the reason the request isn't authenticated
+func authError(ctx context.Context) *model.Error {
+	if err, ok := ctx.Value(authErrorCtxKey).(*model.Error); ok {
+		return err
+	}
+	return model.NewAuthorization("not signed in")
+}
+
+// WithClientIP returns a copy of ctx holding the ip of the client that sent the request
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPCtxKey, ip)
+}
+
+// clientIP returns the ip of the client that sent the request
+func clientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPCtxKey).(string)
+	return ip
+}
+
+// httpExchange is the http request an operation has been sent with, along with its response
+type httpExchange struct {
+	w http.ResponseWriter
+	r *http.Request
+}
+
+// WithHTTP returns a copy of ctx holding the http request and response of the operation, which gives resolvers access to cookies
+func WithHTTP(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+	return context.WithValue(ctx, httpCtxKey, &httpExchange{w: w, r: r})
+}
+
+// cookie returns the value of the cookie sent with the request, or an empty string if there is none
+func cookie(ctx context.Context, name string) string {
+	e, ok := ctx.Value(httpCtxKey).(*httpExchange)
+	if !ok {
+		return ""
+	}
+
+	c, err := e.r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return c.Value
+}
+
+// setCookie adds the cookie to the response. Returns an error if the operation hasn't been sent over http
+func setCookie(ctx context.Context, c *http.Cookie) error {
+	e, ok := ctx.Value(httpCtxKey).(*httpExchange)
+	if !ok {
+		return model.NewBadRequest("Cookies can only be set for operations sent over http.")
+	}
+
+	http.SetCookie(e.w, c)
+	return nil
+}
@@ -0,0 +1,37 @@
+package graph
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/maxeth/go-account-api/graph/generated"
+	gql_model "github.com/maxeth/go-account-api/graph/model"
+	"github.com/maxeth/go-account-api/model"
+)
+
+func (r *entityResolver) FindUserByUID(ctx context.Context, uid string) (*gql_model.User, error) {
+	id, err := parseUID(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	// the users of all representations have been loaded at once by PrimeEntities
+	u, err := loadersFromContext(ctx).User.Load(id)
+	if err != nil {
+		if model.Status(err) == http.StatusNotFound {
+			// references to deleted users resolve to null
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return userFromModel(u), nil
+}
+
+// Entity returns generated.EntityResolver implementation.
+func (r *Resolver) Entity() generated.EntityResolver { return &entityResolver{r} }
+
+type entityResolver struct{ *Resolver }
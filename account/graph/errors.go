@@ -0,0 +1,158 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/google/uuid"
+	gql_model "github.com/maxeth/go-account-api/graph/model"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// ErrorPresenter exposes the type and field of a model.Error as extensions.code and extensions.field,
+// and when rate limited clients may try again as extensions.retryAfter.
+// Internal and unknown errors are hidden behind a generic message and a correlation id, which is logged with the actual error
+func ErrorPresenter(ctx context.Context, err error) *gqlerror.Error {
+	gqlErr := graphql.DefaultErrorPresenter(ctx, err)
+
+	var appErr *model.Error
+	if !errors.As(err, &appErr) {
+		if gqlErr.Unwrap() == nil {
+			// created by gqlgen itself, the message is meant for the client
+			return gqlErr
+		}
+		appErr = model.NewInternal()
+	}
+
+	gqlErr.Extensions = map[string]interface{}{
+		"code": appErr.Type,
+	}
+
+	if appErr.Type == model.Internal {
+		correlationID := uuid.New().String()
+		log.Printf("GraphQL internal error at %v, correlation id: %v. Error: %v\n", gqlErr.Path, correlationID, err)
+
+		gqlErr.Message = model.NewInternal().Message
+		gqlErr.Extensions["correlationId"] = correlationID
+		return gqlErr
+	}
+
+	gqlErr.Message = appErr.Message
+	if appErr.Field != "" {
+		gqlErr.Extensions["field"] = appErr.Field
+	}
+	if appErr.RetryAfter > 0 {
+		gqlErr.Extensions["retryAfter"] = appErr.RetryAfter
+	}
+	if len(appErr.InvalidArgs) > 0 {
+		gqlErr.Extensions["invalidArgs"] = appErr.InvalidArgs
+	}
+
+	return gqlErr
+}
+
+// inputErrors collects the field-level validation errors of the inputs of each field during an operation
+type inputErrors struct {
+	mu   sync.Mutex
+	errs map[*graphql.FieldContext][]*model.Error
+}
+
+var inputErrorsCtxKey = &contextKey{"inputErrors"}
+
+// CollectInputErrors lets the validation directives of an operation report their errors in the
+// errors field of Response payloads, instead of failing the whole field
+func CollectInputErrors(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	return next(context.WithValue(ctx, inputErrorsCtxKey, &inputErrors{
+		errs: make(map[*graphql.FieldContext][]*model.Error),
+	}))
+}
+
+// reportInputError records the validation error of an input of the current field and continues with the next input.
+// Without a collector in the context, the field fails with the error
+func reportInputError(ctx context.Context, err *model.Error, next graphql.Resolver) (interface{}, error) {
+	c, ok := ctx.Value(inputErrorsCtxKey).(*inputErrors)
+	if !ok {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	fc := graphql.GetFieldContext(ctx)
+	c.errs[fc] = append(c.errs[fc], err)
+	c.mu.Unlock()
+
+	return next(ctx)
+}
+
+// ReturnInputErrors is a field middleware which doesn't run resolvers whose inputs failed validation.
+// Fields returning a Response payload get the errors in its errors field, any other field fails with the first error.
+// Field-level validation errors returned by the resolvers themselves, like a conflicting email or a password violating
+// the password policy, are reported the same way
+func ReturnInputErrors(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	fc := graphql.GetFieldContext(ctx)
+
+	var errs []*model.Error
+	if c, ok := ctx.Value(inputErrorsCtxKey).(*inputErrors); ok {
+		c.mu.Lock()
+		errs = c.errs[fc]
+		delete(c.errs, fc)
+		c.mu.Unlock()
+	}
+
+	if len(errs) == 0 {
+		res, err := next(ctx)
+
+		var appErr *model.Error
+		if err == nil || !errors.As(err, &appErr) || appErr.Field == "" || (appErr.Type != model.BadRequest && appErr.Type != model.Conflict) {
+			return res, err
+		}
+		errs = []*model.Error{appErr}
+
+		// every rule an argument violates, like those of the password policy, is reported as an error of its own
+		if len(appErr.InvalidArgs) > 0 {
+			errs = make([]*model.Error, len(appErr.InvalidArgs))
+			for i, arg := range appErr.InvalidArgs {
+				errs[i] = model.NewValidation(arg.Field, arg.Message)
+			}
+		}
+	}
+
+	if res := responseWithErrors(fc.Field.Definition.Type.Name(), errs); res != nil {
+		return res, nil
+	}
+
+	return nil, errs[0]
+}
+
+// responseWithErrors returns the Response payload of the named type holding the errors,
+// or nil if the type doesn't implement Response
+func responseWithErrors(typeName string, errs []*model.Error) interface{} {
+	respErrs := make([]*gql_model.ResponseError, len(errs))
+	for i, err := range errs {
+		field := err.Field
+		respErrs[i] = &gql_model.ResponseError{
+			Field: &field,
+			Error: err.Message,
+		}
+	}
+
+	switch typeName {
+	case "SignUpResponse":
+		return &gql_model.SignUpResponse{Errors: respErrs}
+	case "SignInResponse":
+		return &gql_model.SignInResponse{Errors: respErrs}
+	case "TokensResponse":
+		return &gql_model.TokensResponse{Errors: respErrs}
+	case "UserResponse":
+		return &gql_model.UserResponse{Errors: respErrs}
+	case "TotpEnrollmentResponse":
+		return &gql_model.TotpEnrollmentResponse{Errors: respErrs}
+	case "RecoveryCodesResponse":
+		return &gql_model.RecoveryCodesResponse{Errors: respErrs}
+	}
+
+	return nil
+}
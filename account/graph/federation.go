@@ -0,0 +1,38 @@
+package graph
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/google/uuid"
+)
+
+// PrimeEntities loads the users of all representations of an _entities query at once.
+// The generated _entities resolver resolves the representations one after another,
+// so without priming every user would be fetched on its own
+func PrimeEntities(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	fc := graphql.GetFieldContext(ctx)
+	if fc.Object != "Query" || fc.Field.Name != "_entities" {
+		return next(ctx)
+	}
+
+	representations, _ := fc.Args["representations"].([]map[string]interface{})
+
+	var uids []uuid.UUID
+	for _, rep := range representations {
+		if rep["__typename"] != "User" {
+			continue
+		}
+
+		// invalid uids are reported by the entity resolver
+		if uid, ok := rep["uid"].(string); ok {
+			if id, err := uuid.Parse(uid); err == nil {
+				uids = append(uids, id)
+			}
+		}
+	}
+
+	loadersFromContext(ctx).User.Prime(uids)
+
+	return next(ctx)
+}
@@ -0,0 +1,160 @@
+package graph
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/maxeth/go-account-api/graph/generated"
+	gql_model "github.com/maxeth/go-account-api/graph/model"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// NewComplexityRoot returns the complexity functions of fields returning lists, which cost as much as the number of items requested
+func NewComplexityRoot() generated.ComplexityRoot {
+	c := generated.ComplexityRoot{}
+
+	c.Query.Users = func(childComplexity int, filter *gql_model.UserFilter, first *int, after *string) int {
+		n := 20
+		if first != nil && *first > 0 {
+			n = *first
+		}
+		return n * childComplexity
+	}
+
+	return c
+}
+
+// DepthLimit rejects operations whose selections are nested deeper than Limit.
+// Introspection fields aren't counted, they are turned off in production instead
+type DepthLimit struct {
+	Limit int
+}
+
+var _ interface {
+	graphql.OperationContextMutator
+	graphql.HandlerExtension
+} = DepthLimit{}
+
+func (d DepthLimit) ExtensionName() string {
+	return "DepthLimit"
+}
+
+func (d DepthLimit) Validate(schema graphql.ExecutableSchema) error {
+	if d.Limit <= 0 {
+		return fmt.Errorf("DepthLimit.Limit must be positive")
+	}
+	return nil
+}
+
+func (d DepthLimit) MutateOperationContext(ctx context.Context, rc *graphql.OperationContext) *gqlerror.Error {
+	op := rc.Doc.Operations.ForName(rc.OperationName)
+	if op == nil {
+		return nil
+	}
+
+	if depth := selectionDepth(op.SelectionSet); depth > d.Limit {
+		err := gqlerror.Errorf("operation has depth %d, which exceeds the limit of %d", depth, d.Limit)
+		errcode.Set(err, "DEPTH_LIMIT_EXCEEDED")
+		return err
+	}
+
+	return nil
+}
+
+func selectionDepth(set ast.SelectionSet) int {
+	max := 0
+	for _, sel := range set {
+		depth := 0
+
+		switch sel := sel.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(sel.Name, "__") {
+				continue
+			}
+			depth = 1 + selectionDepth(sel.SelectionSet)
+		case *ast.InlineFragment:
+			depth = selectionDepth(sel.SelectionSet)
+		case *ast.FragmentSpread:
+			// fragment cycles have already been rejected by the validation of the operation
+			if sel.Definition != nil {
+				depth = selectionDepth(sel.Definition.SelectionSet)
+			}
+		}
+
+		if depth > max {
+			max = depth
+		}
+	}
+
+	return max
+}
+
+// QueryAllowlist only accepts operations whose query has one of the allowlisted sha256 hashes,
+// either sent as automatic persisted query or along with the full query
+type QueryAllowlist struct {
+	Hashes map[string]bool
+}
+
+var _ interface {
+	graphql.OperationParameterMutator
+	graphql.HandlerExtension
+} = QueryAllowlist{}
+
+func (a QueryAllowlist) ExtensionName() string {
+	return "QueryAllowlist"
+}
+
+func (a QueryAllowlist) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (a QueryAllowlist) MutateOperationParameters(ctx context.Context, rawParams *graphql.RawParams) *gqlerror.Error {
+	var hash string
+	if pq, ok := rawParams.Extensions["persistedQuery"].(map[string]interface{}); ok {
+		hash, _ = pq["sha256Hash"].(string)
+	}
+	if hash == "" {
+		// the automatic persisted query extension verifies sent hashes against the query
+		h := sha256.Sum256([]byte(rawParams.Query))
+		hash = hex.EncodeToString(h[:])
+	}
+
+	if !a.Hashes[hash] {
+		err := gqlerror.Errorf("operation is not allowlisted")
+		errcode.Set(err, "PERSISTED_QUERY_NOT_ALLOWED")
+		return err
+	}
+
+	return nil
+}
+
+// persistedQueryCache lets automatic persisted queries be shared by all instances through the PersistedQueryRepository
+type persistedQueryCache struct {
+	PersistedQueryRepository model.PersistedQueryRepository
+}
+
+func NewPersistedQueryCache(r model.PersistedQueryRepository) graphql.Cache {
+	return &persistedQueryCache{
+		PersistedQueryRepository: r,
+	}
+}
+
+func (c *persistedQueryCache) Get(ctx context.Context, hash string) (interface{}, bool) {
+	query, err := c.PersistedQueryRepository.GetQuery(ctx, hash)
+	if err != nil {
+		return nil, false
+	}
+	return query, true
+}
+
+func (c *persistedQueryCache) Add(ctx context.Context, hash string, query interface{}) {
+	// a failure is logged by the repository, the client registers the query again on its next request
+	_ = c.PersistedQueryRepository.SetQuery(ctx, hash, query.(string))
+}
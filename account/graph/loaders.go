@@ -0,0 +1,157 @@
+package graph
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+)
+
+var loadersCtxKey = &contextKey{"loaders"}
+
+const (
+	userLoaderWait     = 2 * time.Millisecond // how long a batch collects uids before it is fetched
+	userLoaderMaxBatch = 100                  // a batch is fetched right away once it holds this many uids
+)
+
+// Loaders batch the lookups of the resolvers during a single operation
+type Loaders struct {
+	User *UserLoader
+}
+
+// WithLoaders attaches new loaders to the context of every operation. The loaders cache their results,
+// so they are created per operation rather than per request, which can be a long-lived websocket connection
+func WithLoaders(us model.UserService) graphql.OperationMiddleware {
+	return func(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+		ctx = context.WithValue(ctx, loadersCtxKey, &Loaders{
+			User: NewUserLoader(ctx, us),
+		})
+
+		return next(ctx)
+	}
+}
+
+// loadersFromContext returns the loaders of the operation
+func loadersFromContext(ctx context.Context) *Loaders {
+	return ctx.Value(loadersCtxKey).(*Loaders)
+}
+
+// UserLoader collects the uids loaded by concurrently running resolvers and fetches them with a single call
+type UserLoader struct {
+	ctx         context.Context
+	UserService model.UserService
+	wait        time.Duration
+	maxBatch    int
+
+	mu    sync.Mutex
+	cache map[uuid.UUID]*userBatch // the batch every uid has been loaded with
+	batch *userBatch               // the batch that is still collecting uids
+}
+
+type userBatch struct {
+	uids  []uuid.UUID
+	done  chan struct{}
+	users map[uuid.UUID]*model.User
+	err   error
+}
+
+// NewUserLoader creates a loader that fetches users with UserService.GetMany, using ctx for all fetches
+func NewUserLoader(ctx context.Context, us model.UserService) *UserLoader {
+	return &UserLoader{
+		ctx:         ctx,
+		UserService: us,
+		wait:        userLoaderWait,
+		maxBatch:    userLoaderMaxBatch,
+		cache:       make(map[uuid.UUID]*userBatch),
+	}
+}
+
+// Load returns the user with the uid once the batch it has been added to is fetched.
+// Missing users result in the same NotFound error as UserService.Get
+func (l *UserLoader) Load(uid uuid.UUID) (*model.User, error) {
+	b := l.add(uid)
+	<-b.done
+
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	u, ok := b.users[uid]
+	if !ok {
+		return nil, model.NewNotFound("uid", uid.String())
+	}
+
+	return u, nil
+}
+
+// Prime loads all uids with as few fetches as possible, so that subsequent calls of Load don't have to wait for a batch
+func (l *UserLoader) Prime(uids []uuid.UUID) {
+	batches := make([]*userBatch, len(uids))
+	for i, uid := range uids {
+		batches[i] = l.add(uid)
+	}
+
+	for _, b := range batches {
+		<-b.done
+	}
+}
+
+// add returns the batch the uid is fetched with, adding it to the current batch unless it has been loaded before
+func (l *UserLoader) add(uid uuid.UUID) *userBatch {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.cache[uid]; ok {
+		return b
+	}
+
+	if l.batch == nil {
+		b := &userBatch{done: make(chan struct{})}
+		l.batch = b
+
+		go func() {
+			time.Sleep(l.wait)
+
+			l.mu.Lock()
+			if l.batch != b {
+				// the batch has already been fetched because it was full
+				l.mu.Unlock()
+				return
+			}
+			l.batch = nil
+			l.mu.Unlock()
+
+			l.end(b)
+		}()
+	}
+
+	b := l.batch
+	b.uids = append(b.uids, uid)
+	l.cache[uid] = b
+
+	if len(b.uids) >= l.maxBatch {
+		l.batch = nil
+		go l.end(b)
+	}
+
+	return b
+}
+
+// end fetches the users of the batch and releases everyone waiting for it
+func (l *UserLoader) end(b *userBatch) {
+	defer close(b.done)
+
+	users, err := l.UserService.GetMany(l.ctx, b.uids)
+	if err != nil {
+		b.err = err
+		return
+	}
+
+	b.users = make(map[uuid.UUID]*model.User, len(users))
+	for _, u := range users {
+		b.users[u.UID] = u
+	}
+}
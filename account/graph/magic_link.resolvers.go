@@ -0,0 +1,45 @@
+package graph
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+
+import (
+	"context"
+
+	gql_model "github.com/maxeth/go-account-api/graph/model"
+	"github.com/maxeth/go-account-api/library"
+	"github.com/maxeth/go-account-api/model"
+)
+
+func (r *mutationResolver) RequestMagicLink(ctx context.Context, input gql_model.RequestMagicLinkDto) (bool, error) {
+	if err := r.rateLimit(ctx, model.ActionMagicLink, input.Email); err != nil {
+		return false, err
+	}
+
+	createAccount := input.CreateAccount != nil && *input.CreateAccount
+
+	nonce, err := r.UserService.RequestMagicLink(ctx, input.Email, createAccount)
+	if err != nil {
+		return false, err
+	}
+
+	if err := setCookie(ctx, library.NewCookie(model.MagicLinkCookie, nonce, 0)); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) SignInWithMagicLink(ctx context.Context, token string) (*gql_model.SignInResponse, error) {
+	user, err := r.UserService.SigninWithMagicLink(ctx, token, cookie(ctx, model.MagicLinkCookie))
+	if err != nil {
+		return nil, err
+	}
+
+	// the nonce is useless once the link has been used
+	if err := setCookie(ctx, library.NewCookie(model.MagicLinkCookie, "", -1)); err != nil {
+		return nil, err
+	}
+
+	return r.completeSignIn(ctx, user, model.SigninMethodMagicLink)
+}
@@ -0,0 +1,31 @@
+package graph
+
+import (
+	gql_model "github.com/maxeth/go-account-api/graph/model"
+	"github.com/maxeth/go-account-api/model"
+)
+
+// mfaService returns the MFAService, or an error if 2FA isn't available
+func (r *Resolver) mfaService() (model.MFAService, error) {
+	if r.MFAService == nil {
+		return nil, model.NewBadRequest("2FA is not available.")
+	}
+
+	return r.MFAService, nil
+}
+
+func mfaChallengeFromModel(c *model.MFAChallenge) *gql_model.MfaChallenge {
+	return &gql_model.MfaChallenge{
+		ChallengeToken: c.ChallengeToken,
+		Methods:        c.Methods,
+		ExpiresIn:      int(c.ExpiresIn),
+	}
+}
+
+func totpEnrollmentFromModel(e *model.TOTPEnrollment) *gql_model.TotpEnrollment {
+	return &gql_model.TotpEnrollment{
+		URI:    e.URI,
+		QrCode: e.QRCode,
+		Secret: e.Secret,
+	}
+}
@@ -0,0 +1,161 @@
+package graph
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+
+import (
+	"context"
+
+	gql_model "github.com/maxeth/go-account-api/graph/model"
+	"github.com/maxeth/go-account-api/model"
+)
+
+func (r *mutationResolver) VerifyMfa(ctx context.Context, input gql_model.VerifyMfaDto) (*gql_model.TokensResponse, error) {
+	ms, err := r.mfaService()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.rateLimit(ctx, model.ActionMFA, ""); err != nil {
+		return nil, err
+	}
+
+	user, err := ms.VerifyTOTP(ctx, input.ChallengeToken, input.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenPair, err := r.TokenService.NewPairFromUser(ctx, user, "")
+	if err != nil {
+		return nil, err
+	}
+
+	r.UserService.SigninCompleted(ctx, user, model.MFAMethodTOTP)
+
+	return &gql_model.TokensResponse{
+		TokenPair: (*gql_model.TokenPair)(tokenPair),
+	}, nil
+}
+
+func (r *mutationResolver) VerifyRecoveryCode(ctx context.Context, input gql_model.VerifyMfaDto) (*gql_model.TokensResponse, error) {
+	ms, err := r.mfaService()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.rateLimit(ctx, model.ActionMFA, ""); err != nil {
+		return nil, err
+	}
+
+	user, err := ms.VerifyRecoveryCode(ctx, input.ChallengeToken, input.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenPair, err := r.TokenService.NewPairFromUser(ctx, user, "")
+	if err != nil {
+		return nil, err
+	}
+
+	r.UserService.SigninCompleted(ctx, user, model.MFAMethodRecovery)
+
+	return &gql_model.TokensResponse{
+		TokenPair: (*gql_model.TokenPair)(tokenPair),
+	}, nil
+}
+
+func (r *mutationResolver) EnrollTotp(ctx context.Context) (*gql_model.TotpEnrollmentResponse, error) {
+	ms, err := r.mfaService()
+	if err != nil {
+		return nil, err
+	}
+
+	user, _ := UserFromContext(ctx)
+
+	enrollment, err := ms.EnrollTOTP(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gql_model.TotpEnrollmentResponse{
+		Totp: totpEnrollmentFromModel(enrollment),
+	}, nil
+}
+
+func (r *mutationResolver) ConfirmTotp(ctx context.Context, code string) (*gql_model.RecoveryCodesResponse, error) {
+	ms, err := r.mfaService()
+	if err != nil {
+		return nil, err
+	}
+
+	user, _ := UserFromContext(ctx)
+	if err := r.rateLimit(ctx, model.ActionMFA, user.Email); err != nil {
+		return nil, err
+	}
+
+	codes, err := ms.ConfirmTOTP(ctx, user.UID, code)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gql_model.RecoveryCodesResponse{
+		RecoveryCodes: codes,
+	}, nil
+}
+
+func (r *mutationResolver) RegenerateTotp(ctx context.Context, code string) (*gql_model.TotpEnrollmentResponse, error) {
+	ms, err := r.mfaService()
+	if err != nil {
+		return nil, err
+	}
+
+	user, _ := UserFromContext(ctx)
+	if err := r.rateLimit(ctx, model.ActionMFA, user.Email); err != nil {
+		return nil, err
+	}
+
+	enrollment, err := ms.RegenerateTOTP(ctx, user, code)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gql_model.TotpEnrollmentResponse{
+		Totp: totpEnrollmentFromModel(enrollment),
+	}, nil
+}
+
+func (r *mutationResolver) DisableTotp(ctx context.Context, code string) (bool, error) {
+	ms, err := r.mfaService()
+	if err != nil {
+		return false, err
+	}
+
+	user, _ := UserFromContext(ctx)
+	if err := r.rateLimit(ctx, model.ActionMFA, user.Email); err != nil {
+		return false, err
+	}
+
+	if err := ms.DisableTOTP(ctx, user.UID, code); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) RegenerateRecoveryCodes(ctx context.Context) (*gql_model.RecoveryCodesResponse, error) {
+	ms, err := r.mfaService()
+	if err != nil {
+		return nil, err
+	}
+
+	user, _ := UserFromContext(ctx)
+
+	codes, err := ms.RegenerateRecoveryCodes(ctx, user.UID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gql_model.RecoveryCodesResponse{
+		RecoveryCodes: codes,
+	}, nil
+}
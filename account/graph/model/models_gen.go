@@ -2,15 +2,127 @@
 
 package gql_model
 
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
 type Response interface {
 	IsResponse()
 }
 
+type Activity struct {
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	Details   map[string]interface{} `json:"details"`
+	CreatedAt string                 `json:"createdAt"`
+}
+
+type AdminUser struct {
+	UID          string     `json:"uid"`
+	Email        string     `json:"email"`
+	PendingEmail *string    `json:"pendingEmail"`
+	Name         *string    `json:"name"`
+	ImageURL     *string    `json:"imageURL"`
+	Website      *string    `json:"website"`
+	Role         string     `json:"role"`
+	Status       UserStatus `json:"status"`
+	CreatedAt    string     `json:"createdAt"`
+	FailedLogins int        `json:"failedLogins"`
+	LockedUntil  *string    `json:"lockedUntil"`
+}
+
+type AuditEvent struct {
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	ActorUID   *string                `json:"actorUid"`
+	SubjectUID *string                `json:"subjectUid"`
+	IP         string                 `json:"ip"`
+	UserAgent  string                 `json:"userAgent"`
+	RequestID  string                 `json:"requestId"`
+	Details    map[string]interface{} `json:"details"`
+	CreatedAt  string                 `json:"createdAt"`
+}
+
+type AuditEventConnection struct {
+	Edges    []*AuditEventEdge `json:"edges"`
+	PageInfo *PageInfo         `json:"pageInfo"`
+}
+
+type AuditEventEdge struct {
+	Cursor string      `json:"cursor"`
+	Node   *AuditEvent `json:"node"`
+}
+
+type AuditEventFilter struct {
+	UID   *string  `json:"uid"`
+	Types []string `json:"types"`
+	From  *string  `json:"from"`
+	To    *string  `json:"to"`
+}
+
+type ChangePasswordDto struct {
+	CurrentPassword string `json:"currentPassword"`
+	Password        string `json:"password"`
+}
+
+type MfaChallenge struct {
+	ChallengeToken string   `json:"challengeToken"`
+	Methods        []string `json:"methods"`
+	ExpiresIn      int      `json:"expiresIn"`
+}
+
+type PageInfo struct {
+	EndCursor   *string `json:"endCursor"`
+	HasNextPage bool    `json:"hasNextPage"`
+}
+
+type PublicUser struct {
+	UID      string  `json:"uid"`
+	Name     *string `json:"name"`
+	ImageURL *string `json:"imageURL"`
+	Website  *string `json:"website"`
+}
+
+type RecoveryCodesResponse struct {
+	Errors        []*ResponseError `json:"errors"`
+	RecoveryCodes []string         `json:"recoveryCodes"`
+}
+
+func (RecoveryCodesResponse) IsResponse() {}
+
+type RefreshTokensDto struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type RequestMagicLinkDto struct {
+	Email         string `json:"email"`
+	CreateAccount *bool  `json:"createAccount"`
+}
+
 type ResponseError struct {
 	Field *string `json:"field"`
 	Error string  `json:"error"`
 }
 
+type SessionRevokedEvent struct {
+	RevokedAt string `json:"revokedAt"`
+}
+
+type SignInDto struct {
+	Password string `json:"password"`
+	Email    string `json:"email"`
+}
+
+type SignInResponse struct {
+	Errors       []*ResponseError `json:"errors"`
+	TokenPair    *TokenPair       `json:"tokenPair"`
+	MfaChallenge *MfaChallenge    `json:"mfaChallenge"`
+}
+
+func (SignInResponse) IsResponse() {}
+
 type SignUpDto struct {
 	Password string `json:"password"`
 	Email    string `json:"email"`
@@ -28,6 +140,31 @@ type TokenPair struct {
 	RefreshToken string `json:"refreshToken"`
 }
 
+type TokensResponse struct {
+	Errors    []*ResponseError `json:"errors"`
+	TokenPair *TokenPair       `json:"tokenPair"`
+}
+
+func (TokensResponse) IsResponse() {}
+
+type TotpEnrollment struct {
+	URI    string `json:"uri"`
+	QrCode string `json:"qrCode"`
+	Secret string `json:"secret"`
+}
+
+type TotpEnrollmentResponse struct {
+	Errors []*ResponseError `json:"errors"`
+	Totp   *TotpEnrollment  `json:"totp"`
+}
+
+func (TotpEnrollmentResponse) IsResponse() {}
+
+type UpdateDetailsDto struct {
+	Name    *string `json:"name"`
+	Website *string `json:"website"`
+}
+
 type User struct {
 	UID      string  `json:"uid"`
 	Email    string  `json:"email"`
@@ -36,9 +173,80 @@ type User struct {
 	Website  *string `json:"website"`
 }
 
+func (User) IsEntity() {}
+
+type UserConnection struct {
+	Edges    []*UserEdge `json:"edges"`
+	PageInfo *PageInfo   `json:"pageInfo"`
+}
+
+type UserEdge struct {
+	Cursor string     `json:"cursor"`
+	Node   *AdminUser `json:"node"`
+}
+
+type UserFilter struct {
+	Search *string     `json:"search"`
+	Status *UserStatus `json:"status"`
+}
+
 type UserResponse struct {
 	Errors []*ResponseError `json:"errors"`
 	User   *User            `json:"user"`
 }
 
 func (UserResponse) IsResponse() {}
+
+type VerifyMfaDto struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+}
+
+type WebAuthnCredential struct {
+	ID         string   `json:"id"`
+	Nickname   string   `json:"nickname"`
+	Transports []string `json:"transports"`
+	CreatedAt  string   `json:"createdAt"`
+	LastUsedAt *string  `json:"lastUsedAt"`
+}
+
+type UserStatus string
+
+const (
+	UserStatusActive    UserStatus = "ACTIVE"
+	UserStatusSuspended UserStatus = "SUSPENDED"
+)
+
+var AllUserStatus = []UserStatus{
+	UserStatusActive,
+	UserStatusSuspended,
+}
+
+func (e UserStatus) IsValid() bool {
+	switch e {
+	case UserStatusActive, UserStatusSuspended:
+		return true
+	}
+	return false
+}
+
+func (e UserStatus) String() string {
+	return string(e)
+}
+
+func (e *UserStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = UserStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid UserStatus", str)
+	}
+	return nil
+}
+
+func (e UserStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
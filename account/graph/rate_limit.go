@@ -0,0 +1,12 @@
+package graph
+
+import "context"
+
+// rateLimit counts an attempt of the action by the client of the request. Nothing is limited without a RateLimitService
+func (r *Resolver) rateLimit(ctx context.Context, action string, email string) error {
+	if r.RateLimitService == nil {
+		return nil
+	}
+
+	return r.RateLimitService.Allow(ctx, action, clientIP(ctx), email)
+}
@@ -7,6 +7,12 @@ import "github.com/maxeth/go-account-api/model"
 // It serves as dependency injection for your app, add any dependencies you require here.
 
 type Resolver struct {
-	UserService  model.UserService
-	TokenService model.TokenService
+	UserService      model.UserService
+	TokenService     model.TokenService
+	AdminService     model.AdminService
+	UserEventService model.UserEventService
+	RateLimitService model.RateLimitService
+	MFAService       model.MFAService
+	WebAuthnService  model.WebAuthnService
+	AuditService     model.AuditService
 }
@@ -23,27 +23,58 @@ func stringFromMap(key string, inMap interface{}) (string, error) {
 	return keyVal, nil
 }
 
-var SchemaDirectives = generated.DirectiveRoot{
-	ValidateEmail: func(ctx context.Context, obj interface{}, next graphql.Resolver, allowDuplicate bool) (res interface{}, err error) {
-		email, err := stringFromMap("email", obj)
-		if err != nil {
-			return nil, err
-		}
-
-		if _, err := mail.ParseAddress(email); err != nil {
-			return nil, model.NewValidation("email", "Input is not an Email.")
-		}
-
-		return next(ctx)
-	},
-	Length: func(ctx context.Context, obj interface{}, next graphql.Resolver, keyName string, minLength, maxLength int) (res interface{}, err error) {
-		arg, err := stringFromMap(keyName, obj)
-		if err != nil {
-			return nil, err
-		}
-		if len(arg) < minLength || len(arg) > maxLength {
-			return nil, model.NewValidation(keyName, fmt.Sprintf("%v should have a length of %v-%v.", keyName, minLength, maxLength))
-		}
-		return next(ctx)
-	},
+// NewSchemaDirectives returns the implementations of the schema directives.
+// @validateEmail looks up whether the email is taken with the UserService, limited like the REST /email/available route
+func NewSchemaDirectives(us model.UserService, rs model.RateLimitService) generated.DirectiveRoot {
+	return generated.DirectiveRoot{
+		Auth: func(ctx context.Context, obj interface{}, next graphql.Resolver) (res interface{}, err error) {
+			if _, ok := UserFromContext(ctx); !ok {
+				return nil, authError(ctx)
+			}
+			return next(ctx)
+		},
+		ValidateEmail: func(ctx context.Context, obj interface{}, next graphql.Resolver, allowDuplicate bool) (res interface{}, err error) {
+			email, err := stringFromMap("email", obj)
+			if err != nil {
+				return nil, err
+			}
+
+			if _, err := mail.ParseAddress(email); err != nil {
+				return reportInputError(ctx, model.NewValidation("email", "Input is not an Email."), next)
+			}
+
+			if !allowDuplicate {
+				if rs != nil {
+					if err := rs.Allow(ctx, model.ActionEmailCheck, clientIP(ctx), email); err != nil {
+						return nil, err
+					}
+				}
+
+				available, err := us.EmailAvailable(ctx, email)
+				if err != nil {
+					return nil, err
+				}
+				if !available {
+					return reportInputError(ctx, model.NewConflict("email", email), next)
+				}
+			}
+
+			return next(ctx)
+		},
+		Length: func(ctx context.Context, obj interface{}, next graphql.Resolver, keyName string, minLength, maxLength int) (res interface{}, err error) {
+			// optional fields which haven't been provided have no length to check
+			if argsMap, ok := obj.(map[string]interface{}); ok && argsMap[keyName] == nil {
+				return next(ctx)
+			}
+
+			arg, err := stringFromMap(keyName, obj)
+			if err != nil {
+				return nil, err
+			}
+			if len(arg) < minLength || len(arg) > maxLength {
+				return reportInputError(ctx, model.NewValidation(keyName, fmt.Sprintf("%v should have a length of %v-%v.", keyName, minLength, maxLength)), next)
+			}
+			return next(ctx)
+		},
+	}
 }
@@ -5,7 +5,7 @@ package graph
 
 import (
 	"context"
-	"fmt"
+	"net/http"
 
 	"github.com/maxeth/go-account-api/graph/generated"
 	gql_model "github.com/maxeth/go-account-api/graph/model"
@@ -13,21 +13,13 @@ import (
 )
 
 func (r *mutationResolver) SignUp(ctx context.Context, input gql_model.SignUpDto) (*gql_model.SignUpResponse, error) {
-	fmt.Println("GRAPHQL RESOLVER SIGNUP")
+	if err := r.rateLimit(ctx, model.ActionSignup, input.Email); err != nil {
+		return nil, err
+	}
+
 	user, err := r.UserService.Signup(ctx, input.Email, input.Password)
 	if err != nil {
-		// e := &gqlerror.Error{
-		// 	Path:    graphql.GetPath(ctx),
-		// 	Message: err.Error(),
-		// }
-		appError, ok := err.(*model.Error)
-		if ok {
-			// e.Extensions = map[string]interface{}{
-			// 	"field": appError.Field,
-			// 	"type":  appError.Type,
-			return nil, appError
-
-		}
+		// a conflicting email is reported in the errors of the payload by ReturnInputErrors
 		return nil, err
 	}
 
@@ -37,40 +29,155 @@ func (r *mutationResolver) SignUp(ctx context.Context, input gql_model.SignUpDto
 	}
 
 	return &gql_model.SignUpResponse{
-		Errors:    nil,
 		TokenPair: (*gql_model.TokenPair)(tokenPair),
 	}, nil
 }
 
-func (r *mutationResolver) SignIn(ctx context.Context, input gql_model.SignUpDto) (*gql_model.SignUpResponse, error) {
-	fmt.Println("GRAPHQL RESOLVER SIGNIN")
+func (r *mutationResolver) SignIn(ctx context.Context, input gql_model.SignInDto) (*gql_model.SignInResponse, error) {
+	if err := r.rateLimit(ctx, model.ActionSignin, input.Email); err != nil {
+		return nil, err
+	}
 
 	user, err := r.UserService.Signin(ctx, input.Email, input.Password)
 	if err != nil {
-		// e := &gqlerror.Error{
-		// 	Path:    graphql.GetPath(ctx),
-		// 	Message: err.Error(),
-		// }
-		e := model.NewInternal()
-		return nil, e
+		// suspended and locked out users get to know why they can't sign in, anything else is reported as invalid credentials
+		if status := model.Status(err); status == http.StatusForbidden || status == http.StatusTooManyRequests {
+			return nil, err
+		}
+		return nil, model.NewAuthorization("Invalid password or email.")
 	}
 
-	tokenPair, err := r.TokenService.NewPairFromUser(ctx, user, "")
+	return r.completeSignIn(ctx, user, model.SigninMethodPassword)
+}
+
+func (r *mutationResolver) RefreshTokens(ctx context.Context, input gql_model.RefreshTokensDto) (*gql_model.TokensResponse, error) {
+	if err := r.rateLimit(ctx, model.ActionTokenRefresh, ""); err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := r.TokenService.ValidateRefreshToken(input.RefreshToken)
 	if err != nil {
 		return nil, err
 	}
-	return &gql_model.SignUpResponse{
-		Errors:    nil,
+
+	user, err := r.UserService.Get(ctx, refreshToken.UID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := user.CheckActive(); err != nil {
+		return nil, err
+	}
+
+	tokenPair, err := r.TokenService.NewPairFromUser(ctx, user, refreshToken.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gql_model.TokensResponse{
 		TokenPair: (*gql_model.TokenPair)(tokenPair),
 	}, nil
 }
 
+func (r *mutationResolver) SignOut(ctx context.Context) (bool, error) {
+	user, _ := UserFromContext(ctx)
+
+	if err := r.TokenService.Signout(ctx, user.UID); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) UpdateDetails(ctx context.Context, input gql_model.UpdateDetailsDto) (*gql_model.UserResponse, error) {
+	user, _ := UserFromContext(ctx)
+
+	var name, website string
+	if input.Name != nil {
+		name = *input.Name
+	}
+	if input.Website != nil {
+		website = *input.Website
+	}
+
+	u, err := r.UserService.UpdateDetails(ctx, user.UID, name, website)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gql_model.UserResponse{
+		User: userFromModel(u),
+	}, nil
+}
+
+func (r *mutationResolver) DeleteImage(ctx context.Context) (*gql_model.UserResponse, error) {
+	user, _ := UserFromContext(ctx)
+
+	u, err := r.UserService.ClearProfileImage(ctx, user.UID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gql_model.UserResponse{
+		User: userFromModel(u),
+	}, nil
+}
+
+func (r *mutationResolver) ChangePassword(ctx context.Context, input gql_model.ChangePasswordDto) (*gql_model.UserResponse, error) {
+	user, _ := UserFromContext(ctx)
+
+	// violations of the password policy are reported in the errors of the payload by ReturnInputErrors
+	if err := r.UserService.ChangePassword(ctx, user.UID, input.CurrentPassword, input.Password); err != nil {
+		return nil, err
+	}
+
+	u, err := r.UserService.Get(ctx, user.UID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gql_model.UserResponse{
+		User: userFromModel(u),
+	}, nil
+}
+
 func (r *queryResolver) Me(ctx context.Context) (*gql_model.User, error) {
-	panic(fmt.Errorf("not implemented"))
+	// the @auth directive ensures there is a user in the context
+	user, _ := UserFromContext(ctx)
+
+	u, err := loadersFromContext(ctx).User.Load(user.UID)
+	if err != nil {
+		return nil, err
+	}
+
+	return userFromModel(u), nil
+}
+
+func (r *queryResolver) User(ctx context.Context, id string) (*gql_model.PublicUser, error) {
+	uid, err := parseUID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := loadersFromContext(ctx).User.Load(uid)
+	if err != nil {
+		if model.Status(err) == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return publicUserFromModel(u), nil
 }
 
-func (r *queryResolver) User(ctx context.Context, id int) (*gql_model.User, error) {
-	panic(fmt.Errorf("not implemented"))
+func (r *userResolver) Email(ctx context.Context, obj *gql_model.User) (string, error) {
+	// users are resolved for other subgraphs no matter who is signed in, but the email stays private
+	user, ok := UserFromContext(ctx)
+	if !ok || user.UID.String() != obj.UID {
+		return "", model.NewForbidden("The email is only visible to the user itself.")
+	}
+
+	return obj.Email, nil
 }
 
 // Mutation returns generated.MutationResolver implementation.
@@ -79,5 +186,9 @@ func (r *Resolver) Mutation() generated.MutationResolver { return &mutationResol
 // Query returns generated.QueryResolver implementation.
 func (r *Resolver) Query() generated.QueryResolver { return &queryResolver{r} }
 
+// User returns generated.UserResolver implementation.
+func (r *Resolver) User() generated.UserResolver { return &userResolver{r} }
+
 type mutationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
+type userResolver struct{ *Resolver }
@@ -0,0 +1,76 @@
+package graph
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/maxeth/go-account-api/graph/generated"
+	gql_model "github.com/maxeth/go-account-api/graph/model"
+	"github.com/maxeth/go-account-api/model"
+)
+
+func (r *subscriptionResolver) SessionRevoked(ctx context.Context) (<-chan *gql_model.SessionRevokedEvent, error) {
+	user, _ := UserFromContext(ctx)
+
+	events := r.UserEventService.Subscribe(ctx, user.UID)
+	ch := make(chan *gql_model.SessionRevokedEvent)
+
+	go func() {
+		defer close(ch)
+
+		for e := range events {
+			if e.Type != model.EventSessionRevoked {
+				continue
+			}
+
+			select {
+			case ch <- &gql_model.SessionRevokedEvent{RevokedAt: e.CreatedAt.Format(time.RFC3339)}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+func (r *subscriptionResolver) ProfileUpdated(ctx context.Context) (<-chan *gql_model.User, error) {
+	user, _ := UserFromContext(ctx)
+
+	events := r.UserEventService.Subscribe(ctx, user.UID)
+	ch := make(chan *gql_model.User)
+
+	go func() {
+		defer close(ch)
+
+		for e := range events {
+			if e.Type != model.EventProfileUpdated {
+				continue
+			}
+
+			// the event only tells that the profile has changed, the subscriber gets the current profile
+			u, err := r.UserService.Get(ctx, e.UID)
+			if err != nil {
+				log.Printf("Failed to load updated profile of uid: %v. Error: %v\n", e.UID, err)
+				continue
+			}
+
+			select {
+			case ch <- userFromModel(u):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// Subscription returns generated.SubscriptionResolver implementation.
+func (r *Resolver) Subscription() generated.SubscriptionResolver { return &subscriptionResolver{r} }
+
+type subscriptionResolver struct{ *Resolver }
@@ -0,0 +1,55 @@
+package graph
+
+import (
+	"context"
+
+	gql_model "github.com/maxeth/go-account-api/graph/model"
+	"github.com/maxeth/go-account-api/model"
+)
+
+func userFromModel(u *model.User) *gql_model.User {
+	return &gql_model.User{
+		UID:      u.UID.String(),
+		Email:    u.Email,
+		Name:     &u.Name,
+		ImageURL: &u.ImageURL,
+		Website:  &u.Website,
+	}
+}
+
+// publicUserFromModel strips everything but the public profile of the user
+func publicUserFromModel(u *model.User) *gql_model.PublicUser {
+	return &gql_model.PublicUser{
+		UID:      u.UID.String(),
+		Name:     &u.Name,
+		ImageURL: &u.ImageURL,
+		Website:  &u.Website,
+	}
+}
+
+// completeSignIn returns a token pair for the user who proved to own the account, or an MFA challenge if the
+// account has 2FA enabled. Tokens are only issued once the challenge has been completed with verifyMfa,
+// the sign in is recorded with method when they are
+func (r *Resolver) completeSignIn(ctx context.Context, user *model.User, method string) (*gql_model.SignInResponse, error) {
+	if r.MFAService != nil {
+		challenge, err := r.MFAService.Challenge(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		if challenge != nil {
+			return &gql_model.SignInResponse{
+				MfaChallenge: mfaChallengeFromModel(challenge),
+			}, nil
+		}
+	}
+
+	tokenPair, err := r.TokenService.NewPairFromUser(ctx, user, "")
+	if err != nil {
+		return nil, err
+	}
+
+	r.UserService.SigninCompleted(ctx, user, method)
+	return &gql_model.SignInResponse{
+		TokenPair: (*gql_model.TokenPair)(tokenPair),
+	}, nil
+}
@@ -0,0 +1,47 @@
+package graph
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	gql_model "github.com/maxeth/go-account-api/graph/model"
+	"github.com/maxeth/go-account-api/model"
+)
+
+// webAuthnService returns the WebAuthnService, or an error if passkeys aren't available
+func (r *Resolver) webAuthnService() (model.WebAuthnService, error) {
+	if r.WebAuthnService == nil {
+		return nil, model.NewBadRequest("Passkeys are not available.")
+	}
+
+	return r.WebAuthnService, nil
+}
+
+func webAuthnCredentialFromModel(c *model.WebAuthnCredential) *gql_model.WebAuthnCredential {
+	var lastUsedAt *string
+	if c.LastUsedAt != nil {
+		t := c.LastUsedAt.Format(time.RFC3339)
+		lastUsedAt = &t
+	}
+
+	transports := c.Transports
+	if transports == nil {
+		transports = []string{}
+	}
+
+	return &gql_model.WebAuthnCredential{
+		ID:         c.ID.String(),
+		Nickname:   c.Nickname,
+		Transports: transports,
+		CreatedAt:  c.CreatedAt.Format(time.RFC3339),
+		LastUsedAt: lastUsedAt,
+	}
+}
+
+func parseCredentialID(id string) (uuid.UUID, error) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.UUID{}, model.NewValidation("id", "Expected the credential id as uuid.")
+	}
+	return parsed, nil
+}
@@ -0,0 +1,51 @@
+package graph
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+
+import (
+	"context"
+
+	gql_model "github.com/maxeth/go-account-api/graph/model"
+)
+
+func (r *mutationResolver) DeleteWebAuthnCredential(ctx context.Context, id string) (bool, error) {
+	ws, err := r.webAuthnService()
+	if err != nil {
+		return false, err
+	}
+
+	credID, err := parseCredentialID(id)
+	if err != nil {
+		return false, err
+	}
+
+	user, _ := UserFromContext(ctx)
+
+	if err := ws.DeleteCredential(ctx, user.UID, credID); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *queryResolver) WebAuthnCredentials(ctx context.Context) ([]*gql_model.WebAuthnCredential, error) {
+	ws, err := r.webAuthnService()
+	if err != nil {
+		return nil, err
+	}
+
+	user, _ := UserFromContext(ctx)
+
+	creds, err := ws.ListCredentials(ctx, user.UID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*gql_model.WebAuthnCredential, len(creds))
+	for i, c := range creds {
+		res[i] = webAuthnCredentialFromModel(c)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maxeth/go-account-api/model"
+)
+
+type deleteMeReq struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// DeleteMe deletes the signed in users account and signs the user out on all devices.
+// The password has to be passed again to re-authenticate the user
+func (h *Handler) DeleteMe(c *gin.Context) {
+	user, ok := c.Get("user")
+	if !ok {
+		errM := model.NewAuthorization("not signed in")
+		errorResponse(c, *errM)
+		return
+	}
+
+	var req deleteMeReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	uid := user.(*model.User).UID
+
+	ctx := c.Request.Context()
+	if err := h.UserService.DeleteAccount(ctx, uid, req.Password); err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	if err := h.TokenService.Signout(ctx, uid); err != nil {
+		// the account is deleted already, refreshing tokens will fail once it is purged
+		log.Printf("Failed to sign out deleted user: %v\n", err.Error())
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Your account has been deleted. Check your email to restore it.",
+	})
+}
+
+// RestoreAccount cancels an account deletion during its grace period
+func (h *Handler) RestoreAccount(c *gin.Context) {
+	var req tokenReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := h.UserService.RestoreAccount(ctx, req.Token)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": user,
+	})
+}
+
+// UnlockAccount lifts the lock of an account after too many failed sign in attempts, using the emailed link
+func (h *Handler) UnlockAccount(c *gin.Context) {
+	var req tokenReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.UserService.UnlockAccount(ctx, req.Token); err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Your account has been unlocked.",
+	})
+}
+
+// RejectSignin signs the user out on all devices and resets the password, using the link of a new device
+// notification for a sign in that wasn't the user's
+func (h *Handler) RejectSignin(c *gin.Context) {
+	var req tokenReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := h.UserService.RejectSignin(ctx, req.Token)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	// unlike after a password reset, the whole point is to end the sessions, so failing to do so isn't ignored
+	if err := h.TokenService.Signout(ctx, user.UID); err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "You have been signed out on all devices. Choose a new password with the link sent to your email.",
+	})
+}
@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+)
+
+type listUsersReq struct {
+	Search string `form:"q"`
+	Status string `form:"status" binding:"omitempty,oneof=active suspended"`
+	After  string `form:"after"`
+	Limit  int    `form:"limit" binding:"omitempty,gte=1,lte=100"`
+}
+
+// ListUsers returns a page of users matching the search query by email, name or uid
+func (h *Handler) ListUsers(c *gin.Context) {
+	var req listUsersReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		errM := model.NewBadRequest("Invalid query parameters.")
+		errorResponse(c, *errM)
+		return
+	}
+
+	ctx := c.Request.Context()
+	page, err := h.AdminService.ListUsers(ctx, model.UserFilter{
+		Search: req.Search,
+		Status: req.Status,
+		After:  req.After,
+		Limit:  req.Limit,
+	})
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// GetUser returns the details of a user
+func (h *Handler) GetUser(c *gin.Context) {
+	uid, ok := uidParam(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := h.AdminService.GetUser(ctx, uid)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": user,
+	})
+}
+
+// SuspendUser suspends a user and signs the user out on all devices
+func (h *Handler) SuspendUser(c *gin.Context) {
+	h.setUserStatus(c, model.StatusSuspended)
+}
+
+// UnsuspendUser allows a suspended user to sign in again
+func (h *Handler) UnsuspendUser(c *gin.Context) {
+	h.setUserStatus(c, model.StatusActive)
+}
+
+func (h *Handler) setUserStatus(c *gin.Context, status string) {
+	uid, ok := uidParam(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := h.AdminService.SetStatus(ctx, uid, status)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": user,
+	})
+}
+
+type setRoleReq struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// SetUserRole grants or revokes admin rights of a user
+func (h *Handler) SetUserRole(c *gin.Context) {
+	uid, ok := uidParam(c)
+	if !ok {
+		return
+	}
+
+	var req setRoleReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := h.AdminService.SetRole(ctx, uid, req.Role)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": user,
+	})
+}
+
+// ForcePasswordReset invalidates the password of a user, who has to choose a new one with the mailed reset link
+func (h *Handler) ForcePasswordReset(c *gin.Context) {
+	uid, ok := uidParam(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.AdminService.ForcePasswordReset(ctx, uid); err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "The password has been reset.",
+	})
+}
+
+// RevokeSessions signs a user out on all devices
+func (h *Handler) RevokeSessions(c *gin.Context) {
+	uid, ok := uidParam(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.AdminService.RevokeSessions(ctx, uid); err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "All sessions have been revoked.",
+	})
+}
+
+// content types of the formats users can be imported from
+var importFormats = map[string]string{
+	"text/csv":             model.ImportFormatCSV,
+	"application/x-ndjson": model.ImportFormatJSONL,
+	"application/jsonl":    model.ImportFormatJSONL,
+}
+
+// ImportUsers creates accounts for the users in the request body, a csv file or json lines, keeping their password hashes
+func (h *Handler) ImportUsers(c *gin.Context) {
+	format, ok := importFormats[c.ContentType()]
+	if !ok {
+		err := model.NewUnsupportedMediaType("Content-Type for imports must be text/csv or application/x-ndjson")
+		errorResponse(c, *err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	result, err := h.AdminService.ImportUsers(ctx, format, c.Request.Body)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// uidParam parses the uid path parameter. If it isn't a valid uuid, an error is sent and false returned
+func uidParam(c *gin.Context) (uuid.UUID, bool) {
+	uid, err := uuid.Parse(c.Param("uid"))
+	if err != nil {
+		errM := model.NewBadRequest("Expected the uid as uuid.")
+		errorResponse(c, *errM)
+		return uuid.UUID{}, false
+	}
+
+	return uid, true
+}
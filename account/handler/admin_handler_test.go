@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportUsers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	admin := &model.User{
+		UID:   uuid.New(),
+		Email: email,
+		Role:  model.RoleAdmin,
+	}
+
+	us := mocks.NewMockUserService(ctrl)
+	ts := mocks.NewMockTokenService(ctrl)
+	ads := mocks.NewMockAdminService(ctrl)
+
+	router := gin.Default()
+	NewHandler(&Config{
+		R:               router,
+		UserService:     us,
+		TokenService:    ts,
+		AdminService:    ads,
+		TimeOutDuration: time.Duration(10 * time.Millisecond),
+	})
+
+	ts.EXPECT().ValidateAccessToken(randomAT).Times(1).Return(admin, nil)
+	us.EXPECT().Get(gomock.Any(), admin.UID).Times(1).Return(admin, nil)
+
+	// imports are not cut off by the Timeout middleware of the other routes
+	ads.EXPECT().ImportUsers(gomock.Any(), model.ImportFormatCSV, gomock.Any()).Times(1).DoAndReturn(func(ctx context.Context, format string, r io.Reader) (*model.UserImportResult, error) {
+		time.Sleep(50 * time.Millisecond)
+		require.NoError(t, ctx.Err())
+		return &model.UserImportResult{Imported: 1}, nil
+	})
+
+	req, err := http.NewRequest(http.MethodPost, "/admin/users/import", strings.NewReader("email,scheme,hash\n"))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "text/csv")
+	req.Header.Set("Authorization", "Bearer "+randomAT)
+
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	var result model.UserImportResult
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &result))
+	require.Equal(t, 1, result.Imported)
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+)
+
+type listAuditEventsReq struct {
+	UID    string    `form:"uid" binding:"omitempty,uuid"`
+	Types  []string  `form:"type"`
+	From   time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To     time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Before int64     `form:"before" binding:"omitempty,gte=1"`
+	Limit  int       `form:"limit" binding:"omitempty,gte=1,lte=200"`
+}
+
+// ListAuditEvents returns a page of the audit log, newest events first. It can be narrowed down
+// to the events of a user, to some event types and to a time range given as RFC 3339 timestamps
+func (h *Handler) ListAuditEvents(c *gin.Context) {
+	var req listAuditEventsReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		errM := model.NewBadRequest("Invalid query parameters.")
+		errorResponse(c, *errM)
+		return
+	}
+
+	filter := model.AuditEventFilter{
+		Types:  req.Types,
+		From:   req.From,
+		To:     req.To,
+		Before: req.Before,
+		Limit:  req.Limit,
+	}
+	if req.UID != "" {
+		uid, err := uuid.Parse(req.UID)
+		if err != nil {
+			errM := model.NewBadRequest("Expected the uid as uuid.")
+			errorResponse(c, *errM)
+			return
+		}
+		filter.UID = &uid
+	}
+
+	ctx := c.Request.Context()
+	page, err := h.AuditService.Query(ctx, filter)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// RecentActivity returns the latest sign ins and security relevant changes of the signed in user
+func (h *Handler) RecentActivity(c *gin.Context) {
+	user, ok := c.Get("user")
+	if !ok {
+		errM := model.NewAuthorization("not signed in")
+		errorResponse(c, *errM)
+		return
+	}
+
+	ctx := c.Request.Context()
+	events, err := h.AuditService.RecentActivity(ctx, user.(*model.User).UID)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+	})
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecentActivity(t *testing.T) {
+	user := &model.User{
+		UID:   uuid.New(),
+		Email: email,
+	}
+	activity := []*model.Activity{
+		{ID: 2, Type: model.AuditPasswordChanged, CreatedAt: time.Now()},
+		{ID: 1, Type: model.AuditSigninSucceeded, Details: model.AuditDetails{"method": "password"}, CreatedAt: time.Now()},
+	}
+
+	transports := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		events func(body map[string]interface{}) []interface{}
+	}{
+		{
+			name:   "REST",
+			method: http.MethodGet,
+			path:   "/me/activity",
+			events: func(body map[string]interface{}) []interface{} {
+				return body["events"].([]interface{})
+			},
+		},
+		{
+			name:   "GraphQL",
+			method: http.MethodPost,
+			path:   "/graphql",
+			body:   `{"query": "{ recentActivity { id type details createdAt } }"}`,
+			events: func(body map[string]interface{}) []interface{} {
+				return body["data"].(map[string]interface{})["recentActivity"].([]interface{})
+			},
+		},
+	}
+
+	for _, transport := range transports {
+		tr := transport
+
+		t.Run(tr.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			us := mocks.NewMockUserService(ctrl)
+			ts := mocks.NewMockTokenService(ctrl)
+			as := mocks.NewMockAuditService(ctrl)
+
+			router := gin.Default()
+			NewHandler(&Config{
+				R:               router,
+				UserService:     us,
+				TokenService:    ts,
+				AuditService:    as,
+				TimeOutDuration: time.Duration(5 * time.Second),
+			})
+
+			ts.EXPECT().ValidateAccessToken(randomAT).Times(1).Return(user, nil)
+
+			// the request is described in the context, for the events recorded while handling it
+			as.EXPECT().RecentActivity(gomock.Any(), user.UID).Times(1).DoAndReturn(func(ctx context.Context, uid uuid.UUID) ([]*model.Activity, error) {
+				info, ok := model.RequestInfoFromContext(ctx)
+				require.True(t, ok)
+				require.Equal(t, "request", info.RequestID)
+				require.Equal(t, "test-agent", info.UserAgent)
+				require.Equal(t, user.UID, *info.ActorUID)
+				return activity, nil
+			})
+
+			req, err := http.NewRequest(tr.method, tr.path, strings.NewReader(tr.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+randomAT)
+			req.Header.Set("User-Agent", "test-agent")
+			req.Header.Set(requestIDHeader, "request")
+
+			res := httptest.NewRecorder()
+			router.ServeHTTP(res, req)
+
+			require.Equal(t, http.StatusOK, res.Code)
+			require.Equal(t, "request", res.Header().Get(requestIDHeader))
+
+			var body map[string]interface{}
+			require.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+
+			got := tr.events(body)
+			require.Len(t, got, 2)
+			require.Equal(t, model.AuditPasswordChanged, got[0].(map[string]interface{})["type"])
+			// users don't get to see who triggered the events and from where
+			require.NotContains(t, got[0], "ip")
+			require.NotContains(t, got[0], "actorUid")
+			require.Equal(t, "password", got[1].(map[string]interface{})["details"].(map[string]interface{})["method"])
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	router := gin.Default()
+	NewHandler(&Config{
+		R:               router,
+		TimeOutDuration: time.Duration(5 * time.Second),
+	})
+
+	// a request id is generated for requests without one, or with one that is too long
+	for _, requestID := range []string{"", strings.Repeat("a", maxRequestIDLength+1)} {
+		req, err := http.NewRequest(http.MethodGet, "/auth", nil)
+		require.NoError(t, err)
+		req.Header.Set(requestIDHeader, requestID)
+
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+
+		_, err = uuid.Parse(res.Header().Get(requestIDHeader))
+		require.NoError(t, err)
+	}
+}
@@ -10,12 +10,7 @@ import (
 )
 
 // used to help extract validation errors of http request body
-type InvalidArgument struct {
-	Field string `json:"field"`
-	Value string `json:"value"`
-	Tag   string `json:"tag"`
-	Param string `json:"param"`
-}
+type InvalidArgument = model.InvalidArgument
 
 // type of the http reponse when sending an invalid request
 type InvalidRequestResponse struct {
@@ -52,10 +47,10 @@ func bindData(c *gin.Context, req interface{}) bool {
 
 		for _, err := range errs {
 			invalidArgs = append(invalidArgs, InvalidArgument{
-				err.Field(),
-				err.Value().(string),
-				err.Tag(),
-				err.Param(),
+				Field: err.Field(),
+				Value: err.Value().(string),
+				Tag:   err.Tag(),
+				Param: err.Param(),
 			})
 		}
 
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maxeth/go-account-api/handler/middleware"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCors(t *testing.T) {
+	router := gin.Default()
+	NewHandler(&Config{
+		R:               router,
+		TimeOutDuration: time.Duration(5 * time.Second),
+		Cors: CorsConfig{
+			REST: middleware.CorsPolicy{
+				AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+				AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE"},
+				AllowedHeaders:   []string{"Content-Type", "Authorization"},
+				ExposedHeaders:   []string{"X-Request-Id"},
+				AllowCredentials: true,
+				MaxAge:           10 * time.Minute,
+			},
+			GraphQL: middleware.CorsPolicy{
+				AllowedOrigins: []string{"*"},
+				AllowedMethods: []string{"GET", "POST"},
+				AllowedHeaders: []string{"Content-Type", "Authorization"},
+			},
+		},
+	})
+
+	testCases := []struct {
+		name            string
+		method          string
+		path            string
+		origin          string
+		preflightMethod string
+		wantOrigin      string
+		wantCredentials string
+		wantHeaders     map[string]string
+	}{
+		{
+			name:            "Preflight",
+			method:          http.MethodOptions,
+			path:            "/image",
+			origin:          "https://app.example.com",
+			preflightMethod: "DELETE",
+			wantOrigin:      "https://app.example.com",
+			wantCredentials: "true",
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Methods": "GET, POST, PUT, DELETE",
+				"Access-Control-Allow-Headers": "Content-Type, Authorization",
+				"Access-Control-Max-Age":       "600",
+			},
+		},
+		{
+			name:            "PreflightWithPathParams",
+			method:          http.MethodOptions,
+			path:            "/admin/users/2c1ef7ba-4b8d-4b1e-9d1e-7cc8b1f4d9a3/sessions",
+			origin:          "https://app.example.com",
+			preflightMethod: "DELETE",
+			wantOrigin:      "https://app.example.com",
+			wantCredentials: "true",
+		},
+		{
+			name:            "WildcardSubdomain",
+			method:          http.MethodOptions,
+			path:            "/signin",
+			origin:          "https://eu.app.example.org",
+			preflightMethod: "POST",
+			wantOrigin:      "https://eu.app.example.org",
+			wantCredentials: "true",
+		},
+		{
+			name:            "WildcardDoesntMatchApex",
+			method:          http.MethodOptions,
+			path:            "/signin",
+			origin:          "https://example.org",
+			preflightMethod: "POST",
+		},
+		{
+			name:            "WildcardDoesntMatchOtherScheme",
+			method:          http.MethodOptions,
+			path:            "/signin",
+			origin:          "http://app.example.org",
+			preflightMethod: "POST",
+		},
+		{
+			name:            "OriginNotAllowed",
+			method:          http.MethodOptions,
+			path:            "/signin",
+			origin:          "https://evil.com",
+			preflightMethod: "POST",
+		},
+		{
+			// the headers are set even if the request is rejected, so that scripts can read the error
+			name:            "ExposedHeaders",
+			method:          http.MethodGet,
+			path:            "/me",
+			origin:          "https://app.example.com",
+			wantOrigin:      "https://app.example.com",
+			wantCredentials: "true",
+			wantHeaders: map[string]string{
+				"Access-Control-Expose-Headers": "X-Request-Id",
+				"Access-Control-Allow-Methods":  "",
+			},
+		},
+		{
+			name:            "GraphQLAnyOrigin",
+			method:          http.MethodOptions,
+			path:            "/graphql",
+			origin:          "https://evil.com",
+			preflightMethod: "POST",
+			wantOrigin:      "*",
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Methods": "GET, POST",
+				"Access-Control-Max-Age":       "",
+			},
+		},
+		{
+			// the oauth routes have a policy of their own, which allows no origins
+			name:            "OAuthNotAllowed",
+			method:          http.MethodOptions,
+			path:            "/auth/twitch",
+			origin:          "https://app.example.com",
+			preflightMethod: "GET",
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, tc.path, nil)
+			require.NoError(t, err)
+			req.Header.Set("Origin", tc.origin)
+			if tc.preflightMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", tc.preflightMethod)
+			}
+
+			res := httptest.NewRecorder()
+			router.ServeHTTP(res, req)
+
+			if tc.method == http.MethodOptions {
+				require.Equal(t, http.StatusNoContent, res.Code)
+			}
+			require.Equal(t, tc.wantOrigin, res.Header().Get("Access-Control-Allow-Origin"))
+			require.Equal(t, tc.wantCredentials, res.Header().Get("Access-Control-Allow-Credentials"))
+			require.Contains(t, res.Header().Values("Vary"), "Origin")
+			for k, v := range tc.wantHeaders {
+				require.Equal(t, v, res.Header().Get(k), k)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+)
+
+// RequestExport queues an export of all data stored about the signed in user.
+// A download link is mailed to the user once the archive has been built
+func (h *Handler) RequestExport(c *gin.Context) {
+	user, ok := c.Get("user")
+	if !ok {
+		errM := model.NewAuthorization("not signed in")
+		errorResponse(c, *errM)
+		return
+	}
+
+	ctx := c.Request.Context()
+	export, err := h.DataExportService.RequestExport(ctx, user.(*model.User).UID)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"export": export,
+	})
+}
+
+// GetExport returns the status of an export of the signed in user
+func (h *Handler) GetExport(c *gin.Context) {
+	user, ok := c.Get("user")
+	if !ok {
+		errM := model.NewAuthorization("not signed in")
+		errorResponse(c, *errM)
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		errM := model.NewBadRequest("Expected the export id as uuid.")
+		errorResponse(c, *errM)
+		return
+	}
+
+	ctx := c.Request.Context()
+	export, err := h.DataExportService.GetExport(ctx, user.(*model.User).UID, id)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"export": export,
+	})
+}
+
+// DownloadExport sends the archive of a finished export. The token of the
+// download link authenticates the request, so no access token is required
+func (h *Handler) DownloadExport(c *gin.Context) {
+	token := c.Query("token")
+	if len(token) < 1 {
+		errM := model.NewBadRequest("Expected the download token as 'token' query parameter.")
+		errorResponse(c, *errM)
+		return
+	}
+
+	ctx := c.Request.Context()
+	export, err := h.DataExportService.Download(ctx, token)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"export-%s.zip\"", export.ID))
+	c.Data(http.StatusOK, "application/zip", export.Archive)
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maxeth/go-account-api/model"
+)
+
+type changeEmailReq struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ChangeEmail starts an email change for the signed in user. The new address only
+// replaces the current one once it has been confirmed
+func (h *Handler) ChangeEmail(c *gin.Context) {
+	user, ok := c.Get("user")
+	if !ok {
+		errM := model.NewAuthorization("not signed in")
+		errorResponse(c, *errM)
+		return
+	}
+
+	var req changeEmailReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.UserService.RequestEmailChange(ctx, user.(*model.User).UID, req.Email); err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "A confirmation link has been sent to the new email address.",
+	})
+}
+
+type tokenReq struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ConfirmEmail switches the users email to the confirmed pending email
+func (h *Handler) ConfirmEmail(c *gin.Context) {
+	var req tokenReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := h.UserService.ConfirmEmailChange(ctx, req.Token)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": user,
+	})
+}
+
+// CancelEmailChange discards a pending email change
+func (h *Handler) CancelEmailChange(c *gin.Context) {
+	var req tokenReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.UserService.CancelEmailChange(ctx, req.Token); err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "The email change has been cancelled.",
+	})
+}
+
+type emailAvailableReq struct {
+	Email string `form:"email" binding:"required,email"`
+}
+
+// EmailAvailable tells signup forms whether an account can be created with the email.
+// It reveals which emails have an account, so it is rate limited like sign up
+func (h *Handler) EmailAvailable(c *gin.Context) {
+	var req emailAvailableReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		errM := model.NewValidation("email", "Expected a valid email.")
+		errorResponse(c, *errM)
+		return
+	}
+
+	if ok := h.rateLimit(c, model.ActionEmailCheck, req.Email); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	available, err := h.UserService.EmailAvailable(ctx, req.Email)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"available": available,
+	})
+}
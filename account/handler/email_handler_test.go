@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmailAvailable(t *testing.T) {
+	testCases := []struct {
+		name          string
+		email         string
+		buildStubs    func(us *mocks.MockUserService, rs *mocks.MockRateLimitService)
+		checkResponse func(resRec *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "Available",
+			email: email,
+			buildStubs: func(us *mocks.MockUserService, rs *mocks.MockRateLimitService) {
+				rs.EXPECT().Allow(gomock.Any(), model.ActionEmailCheck, gomock.Any(), email).Times(1).Return(nil)
+				us.EXPECT().EmailAvailable(gomock.Any(), email).Times(1).Return(true, nil)
+			},
+			checkResponse: func(resRec *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, resRec.Code)
+
+				var res map[string]bool
+				require.NoError(t, json.Unmarshal(resRec.Body.Bytes(), &res))
+				require.True(t, res["available"])
+			},
+		},
+		{
+			name:  "Taken",
+			email: email,
+			buildStubs: func(us *mocks.MockUserService, rs *mocks.MockRateLimitService) {
+				rs.EXPECT().Allow(gomock.Any(), model.ActionEmailCheck, gomock.Any(), email).Times(1).Return(nil)
+				us.EXPECT().EmailAvailable(gomock.Any(), email).Times(1).Return(false, nil)
+			},
+			checkResponse: func(resRec *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, resRec.Code)
+
+				var res map[string]bool
+				require.NoError(t, json.Unmarshal(resRec.Body.Bytes(), &res))
+				require.False(t, res["available"])
+			},
+		},
+		{
+			name:  "InvalidEmail",
+			email: "mail",
+			buildStubs: func(us *mocks.MockUserService, rs *mocks.MockRateLimitService) {
+				rs.EXPECT().Allow(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				us.EXPECT().EmailAvailable(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(resRec *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, resRec.Code)
+			},
+		},
+		{
+			name:  "Limited",
+			email: email,
+			buildStubs: func(us *mocks.MockUserService, rs *mocks.MockRateLimitService) {
+				rs.EXPECT().Allow(gomock.Any(), model.ActionEmailCheck, gomock.Any(), email).Times(1).Return(model.NewTooManyRequests(time.Minute))
+				// nothing is revealed about the email once the client is limited
+				us.EXPECT().EmailAvailable(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(resRec *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusTooManyRequests, resRec.Code)
+				require.Equal(t, "60", resRec.Header().Get("Retry-After"))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			us := mocks.NewMockUserService(ctrl)
+			rs := mocks.NewMockRateLimitService(ctrl)
+			tc.buildStubs(us, rs)
+
+			router := gin.Default()
+			NewHandler(&Config{
+				R:                router,
+				UserService:      us,
+				RateLimitService: rs,
+				TimeOutDuration:  time.Duration(5 * time.Second),
+			})
+
+			req, err := http.NewRequest(http.MethodGet, "/email/available?email="+url.QueryEscape(tc.email), nil)
+			require.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			tc.checkResponse(recorder)
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+type federationResponse struct {
+	Data struct {
+		Entities []map[string]interface{} `json:"_entities"`
+		Service  struct {
+			SDL string `json:"sdl"`
+		} `json:"_service"`
+	} `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func TestFederation(t *testing.T) {
+	user := &model.User{
+		UID:   uuid.New(),
+		Email: email,
+		Name:  "name",
+	}
+	otherUser := &model.User{
+		UID:  uuid.New(),
+		Name: "other",
+	}
+	deletedUID := uuid.New()
+
+	entitiesQuery := `query($representations: [_Any!]!) { _entities(representations: $representations) { ... on User { uid name } } }`
+	representation := func(uid uuid.UUID) gin.H {
+		return gin.H{"__typename": "User", "uid": uid.String()}
+	}
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		accessToken   string
+		buildStubs    func(us *mocks.MockUserService, ts *mocks.MockTokenService)
+		checkResponse func(t *testing.T, res federationResponse)
+	}{
+		{
+			name: "Entities",
+			body: gin.H{
+				"query":     entitiesQuery,
+				"variables": gin.H{"representations": []gin.H{representation(user.UID), representation(deletedUID), representation(otherUser.UID)}},
+			},
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				// all references are loaded at once
+				us.EXPECT().GetMany(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(func(ctx context.Context, uids []uuid.UUID) ([]*model.User, error) {
+					require.ElementsMatch(t, []uuid.UUID{user.UID, deletedUID, otherUser.UID}, uids)
+					return []*model.User{otherUser, user}, nil
+				})
+			},
+			checkResponse: func(t *testing.T, res federationResponse) {
+				require.Empty(t, res.Errors)
+				require.Len(t, res.Data.Entities, 3)
+
+				// entities are returned in the order of the representations, deleted users resolve to null
+				require.Equal(t, user.UID.String(), res.Data.Entities[0]["uid"])
+				require.Equal(t, "name", res.Data.Entities[0]["name"])
+				require.Nil(t, res.Data.Entities[1])
+				require.Equal(t, otherUser.UID.String(), res.Data.Entities[2]["uid"])
+			},
+		},
+		{
+			name: "EntityEmailOfOtherUser",
+			body: gin.H{
+				"query":     `query($representations: [_Any!]!) { _entities(representations: $representations) { ... on User { uid email } } }`,
+				"variables": gin.H{"representations": []gin.H{representation(user.UID)}},
+			},
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				us.EXPECT().GetMany(gomock.Any(), []uuid.UUID{user.UID}).Times(1).Return([]*model.User{user}, nil)
+			},
+			checkResponse: func(t *testing.T, res federationResponse) {
+				require.Len(t, res.Errors, 1)
+				require.Equal(t, model.Forbidden, res.Errors[0].Extensions["code"])
+				require.Nil(t, res.Data.Entities[0])
+			},
+		},
+		{
+			name:        "EntityEmailOfSelf",
+			accessToken: randomAT,
+			body: gin.H{
+				"query":     `query($representations: [_Any!]!) { _entities(representations: $representations) { ... on User { uid email } } }`,
+				"variables": gin.H{"representations": []gin.H{representation(user.UID)}},
+			},
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				ts.EXPECT().ValidateAccessToken(randomAT).Times(1).Return(&model.User{UID: user.UID}, nil)
+				us.EXPECT().GetMany(gomock.Any(), []uuid.UUID{user.UID}).Times(1).Return([]*model.User{user}, nil)
+			},
+			checkResponse: func(t *testing.T, res federationResponse) {
+				require.Empty(t, res.Errors)
+				require.Equal(t, email, res.Data.Entities[0]["email"])
+			},
+		},
+		{
+			name: "UnknownType",
+			body: gin.H{
+				"query":     entitiesQuery,
+				"variables": gin.H{"representations": []gin.H{{"__typename": "Product", "upc": "1"}}},
+			},
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				us.EXPECT().GetMany(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, res federationResponse) {
+				require.Len(t, res.Errors, 1)
+				require.Empty(t, res.Data.Entities)
+			},
+		},
+		{
+			name: "Service",
+			body: gin.H{"query": `{ _service { sdl } }`},
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				us.EXPECT().GetMany(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, res federationResponse) {
+				require.Empty(t, res.Errors)
+				require.Contains(t, res.Data.Service.SDL, `@link(url: "https://specs.apollo.dev/federation/v2.0"`)
+				require.Contains(t, res.Data.Service.SDL, `type User @key(fields: "uid")`)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			us := mocks.NewMockUserService(ctrl)
+			ts := mocks.NewMockTokenService(ctrl)
+			tc.buildStubs(us, ts)
+
+			router := gin.Default()
+			NewHandler(&Config{
+				R:               router,
+				UserService:     us,
+				TokenService:    ts,
+				TimeOutDuration: time.Duration(5 * time.Second),
+			})
+
+			body, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			if tc.accessToken != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.accessToken)
+			}
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			var res federationResponse
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+			tc.checkResponse(t, res)
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphqlLimits(t *testing.T) {
+	publicQuery := `{ user(id: "5b9b9d8e-3bd4-4c7b-9e2b-1c1c6f2d1f4a") { uid } }`
+	h := sha256.Sum256([]byte(publicQuery))
+	publicQueryHash := hex.EncodeToString(h[:])
+
+	testCases := []struct {
+		name          string
+		config        GraphQLConfig
+		body          gin.H
+		buildStubs    func(us *mocks.MockUserService, pq *mocks.MockPersistedQueryRepository)
+		checkResponse func(res graphqlResponse)
+	}{
+		{
+			name:   "DepthLimitExceeded",
+			config: GraphQLConfig{DepthLimit: 2},
+			body:   gin.H{"query": `{ users { edges { node { uid } } } }`},
+			buildStubs: func(us *mocks.MockUserService, pq *mocks.MockPersistedQueryRepository) {
+				us.EXPECT().GetMany(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(res graphqlResponse) {
+				require.Len(t, res.Errors, 1)
+				require.Equal(t, "DEPTH_LIMIT_EXCEEDED", res.Errors[0].Extensions["code"])
+			},
+		},
+		{
+			name:   "ComplexityLimitExceeded",
+			config: GraphQLConfig{ComplexityLimit: 50},
+			body:   gin.H{"query": `{ users(first: 100) { edges { node { uid email } } } }`},
+			buildStubs: func(us *mocks.MockUserService, pq *mocks.MockPersistedQueryRepository) {
+				us.EXPECT().GetMany(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(res graphqlResponse) {
+				require.Len(t, res.Errors, 1)
+				require.Equal(t, "COMPLEXITY_LIMIT_EXCEEDED", res.Errors[0].Extensions["code"])
+			},
+		},
+		{
+			name:   "IntrospectionInProduction",
+			config: GraphQLConfig{Production: true},
+			body:   gin.H{"query": `{ __schema { queryType { name } } }`},
+			buildStubs: func(us *mocks.MockUserService, pq *mocks.MockPersistedQueryRepository) {
+			},
+			checkResponse: func(res graphqlResponse) {
+				require.Len(t, res.Errors, 1)
+			},
+		},
+		{
+			name:   "NotAllowlisted",
+			config: GraphQLConfig{Production: true, Allowlist: map[string]bool{"other": true}},
+			body:   gin.H{"query": publicQuery},
+			buildStubs: func(us *mocks.MockUserService, pq *mocks.MockPersistedQueryRepository) {
+				us.EXPECT().GetMany(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(res graphqlResponse) {
+				require.Len(t, res.Errors, 1)
+				require.Equal(t, "PERSISTED_QUERY_NOT_ALLOWED", res.Errors[0].Extensions["code"])
+			},
+		},
+		{
+			name:   "Allowlisted",
+			config: GraphQLConfig{Production: true, Allowlist: map[string]bool{publicQueryHash: true}},
+			body:   gin.H{"query": publicQuery},
+			buildStubs: func(us *mocks.MockUserService, pq *mocks.MockPersistedQueryRepository) {
+				us.EXPECT().GetMany(gomock.Any(), gomock.Any()).Times(1).Return([]*model.User{}, nil)
+			},
+			checkResponse: func(res graphqlResponse) {
+				require.Empty(t, res.Errors)
+			},
+		},
+		{
+			name: "PersistedQuery",
+			body: gin.H{"extensions": gin.H{"persistedQuery": gin.H{"version": 1, "sha256Hash": publicQueryHash}}},
+			buildStubs: func(us *mocks.MockUserService, pq *mocks.MockPersistedQueryRepository) {
+				pq.EXPECT().GetQuery(gomock.Any(), publicQueryHash).Times(1).Return(publicQuery, nil)
+				us.EXPECT().GetMany(gomock.Any(), gomock.Any()).Times(1).Return([]*model.User{}, nil)
+			},
+			checkResponse: func(res graphqlResponse) {
+				require.Empty(t, res.Errors)
+			},
+		},
+		{
+			name: "PersistedQueryRegistered",
+			body: gin.H{"query": publicQuery, "extensions": gin.H{"persistedQuery": gin.H{"version": 1, "sha256Hash": publicQueryHash}}},
+			buildStubs: func(us *mocks.MockUserService, pq *mocks.MockPersistedQueryRepository) {
+				pq.EXPECT().SetQuery(gomock.Any(), publicQueryHash, publicQuery).Times(1).Return(nil)
+				us.EXPECT().GetMany(gomock.Any(), gomock.Any()).Times(1).Return([]*model.User{}, nil)
+			},
+			checkResponse: func(res graphqlResponse) {
+				require.Empty(t, res.Errors)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			us := mocks.NewMockUserService(ctrl)
+			pq := mocks.NewMockPersistedQueryRepository(ctrl)
+			tc.buildStubs(us, pq)
+
+			config := tc.config
+			config.PersistedQueryRepository = pq
+
+			router := gin.Default()
+			NewHandler(&Config{
+				R:               router,
+				UserService:     us,
+				GraphQL:         config,
+				TimeOutDuration: time.Duration(5 * time.Second),
+			})
+
+			body, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			var res graphqlResponse
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+			tc.checkResponse(res)
+		})
+	}
+}
+
+func TestPlaygroundInProduction(t *testing.T) {
+	for _, production := range []bool{false, true} {
+		router := gin.Default()
+		NewHandler(&Config{
+			R:               router,
+			GraphQL:         GraphQLConfig{Production: production},
+			TimeOutDuration: time.Duration(5 * time.Second),
+		})
+
+		req, err := http.NewRequest(http.MethodGet, "/playground", nil)
+		require.NoError(t, err)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		if production {
+			require.Equal(t, http.StatusNotFound, recorder.Code)
+		} else {
+			require.Equal(t, http.StatusOK, recorder.Code)
+		}
+	}
+}
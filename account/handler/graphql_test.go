@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+type graphqlResponse struct {
+	Data   map[string]map[string]interface{} `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func TestGraphql(t *testing.T) {
+	user := &model.User{
+		UID:   uuid.New(),
+		Email: email,
+		Name:  "name",
+	}
+	otherUser := &model.User{
+		UID:  uuid.New(),
+		Name: "other",
+	}
+
+	testCases := []struct {
+		name          string
+		query         string
+		accessToken   string
+		buildStubs    func(us *mocks.MockUserService, ts *mocks.MockTokenService)
+		checkResponse func(res graphqlResponse)
+	}{
+		{
+			name:        "Me",
+			query:       `{ me { uid email name } }`,
+			accessToken: randomAT,
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				ts.EXPECT().ValidateAccessToken(randomAT).Times(1).Return(&model.User{UID: user.UID}, nil)
+				us.EXPECT().GetMany(gomock.Any(), []uuid.UUID{user.UID}).Times(1).Return([]*model.User{user}, nil)
+			},
+			checkResponse: func(res graphqlResponse) {
+				require.Empty(t, res.Errors)
+				require.Equal(t, user.UID.String(), res.Data["me"]["uid"])
+				require.Equal(t, email, res.Data["me"]["email"])
+			},
+		},
+		{
+			name:  "MeUnauthenticated",
+			query: `{ me { uid } }`,
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				us.EXPECT().GetMany(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(res graphqlResponse) {
+				require.Len(t, res.Errors, 1)
+				require.Equal(t, model.Authorization, res.Errors[0].Extensions["code"])
+				require.Nil(t, res.Data["me"])
+			},
+		},
+		{
+			name:  "User",
+			query: `{ user(id: "` + user.UID.String() + `") { uid name } }`,
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				us.EXPECT().GetMany(gomock.Any(), []uuid.UUID{user.UID}).Times(1).Return([]*model.User{user}, nil)
+			},
+			checkResponse: func(res graphqlResponse) {
+				require.Empty(t, res.Errors)
+				require.Equal(t, user.UID.String(), res.Data["user"]["uid"])
+				require.Equal(t, "name", res.Data["user"]["name"])
+			},
+		},
+		{
+			name:  "UserNotFound",
+			query: `{ user(id: "` + user.UID.String() + `") { uid } }`,
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				// missing users are left out of the result
+				us.EXPECT().GetMany(gomock.Any(), []uuid.UUID{user.UID}).Times(1).Return([]*model.User{}, nil)
+			},
+			checkResponse: func(res graphqlResponse) {
+				require.Empty(t, res.Errors)
+				require.Nil(t, res.Data["user"])
+			},
+		},
+		{
+			name:  "UsersBatched",
+			query: `{ a: user(id: "` + user.UID.String() + `") { uid } b: user(id: "` + otherUser.UID.String() + `") { uid } c: user(id: "` + user.UID.String() + `") { name } }`,
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				// all users of the query are loaded at once, each uid only once
+				us.EXPECT().GetMany(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(func(ctx context.Context, uids []uuid.UUID) ([]*model.User, error) {
+					require.ElementsMatch(t, []uuid.UUID{user.UID, otherUser.UID}, uids)
+					return []*model.User{otherUser, user}, nil
+				})
+			},
+			checkResponse: func(res graphqlResponse) {
+				require.Empty(t, res.Errors)
+				require.Equal(t, user.UID.String(), res.Data["a"]["uid"])
+				require.Equal(t, otherUser.UID.String(), res.Data["b"]["uid"])
+				require.Equal(t, "name", res.Data["c"]["name"])
+			},
+		},
+		{
+			name:  "SignUpInvalidInput",
+			query: `mutation { signUp(input: {email: "mail", password: "123"}) { errors { field error } tokenPair { accessToken } } }`,
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				us.EXPECT().EmailAvailable(gomock.Any(), gomock.Any()).Times(0)
+				us.EXPECT().Signup(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(res graphqlResponse) {
+				// validation failures are field-level errors of the payload, the password policy is only checked once the input is valid
+				require.Empty(t, res.Errors)
+				require.Nil(t, res.Data["signUp"]["tokenPair"])
+
+				var fields []interface{}
+				for _, e := range res.Data["signUp"]["errors"].([]interface{}) {
+					fields = append(fields, e.(map[string]interface{})["field"])
+				}
+				require.ElementsMatch(t, []interface{}{"email"}, fields)
+			},
+		},
+		{
+			name:  "SignUpWeakPassword",
+			query: `mutation { signUp(input: {email: "` + email + `", password: "123"}) { errors { field error } tokenPair { accessToken } } }`,
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				us.EXPECT().EmailAvailable(gomock.Any(), email).Times(1).Return(true, nil)
+				us.EXPECT().Signup(gomock.Any(), email, "123").Times(1).Return(nil, model.NewInvalidArguments([]model.InvalidArgument{
+					{Field: "password", Tag: model.PasswordRuleMinLength, Message: "Password should have at least 10 characters."},
+					{Field: "password", Tag: model.PasswordRuleBreached, Message: "Password has appeared in a data breach."},
+				}))
+			},
+			checkResponse: func(res graphqlResponse) {
+				// every violated rule of the password policy is an error of its own
+				require.Empty(t, res.Errors)
+				require.Nil(t, res.Data["signUp"]["tokenPair"])
+
+				errs := res.Data["signUp"]["errors"].([]interface{})
+				require.Len(t, errs, 2)
+				require.Equal(t, "password", errs[0].(map[string]interface{})["field"])
+				require.Equal(t, model.NewBadRequest("Password should have at least 10 characters.").Message, errs[0].(map[string]interface{})["error"])
+				require.Equal(t, "password", errs[1].(map[string]interface{})["field"])
+				require.Equal(t, model.NewBadRequest("Password has appeared in a data breach.").Message, errs[1].(map[string]interface{})["error"])
+			},
+		},
+		{
+			name:  "SignUpEmailTaken",
+			query: `mutation { signUp(input: {email: "` + email + `", password: "password"}) { errors { field error } tokenPair { accessToken } } }`,
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				us.EXPECT().EmailAvailable(gomock.Any(), email).Times(1).Return(false, nil)
+				us.EXPECT().Signup(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(res graphqlResponse) {
+				require.Empty(t, res.Errors)
+
+				errs := res.Data["signUp"]["errors"].([]interface{})
+				require.Len(t, errs, 1)
+				require.Equal(t, "email", errs[0].(map[string]interface{})["field"])
+			},
+		},
+		{
+			name:        "InternalError",
+			query:       `{ me { uid } }`,
+			accessToken: randomAT,
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				ts.EXPECT().ValidateAccessToken(randomAT).Times(1).Return(&model.User{UID: user.UID}, nil)
+				us.EXPECT().GetMany(gomock.Any(), []uuid.UUID{user.UID}).Times(1).Return(nil, errors.New("connection refused"))
+			},
+			checkResponse: func(res graphqlResponse) {
+				// the cause of internal errors is only logged
+				require.Len(t, res.Errors, 1)
+				require.Equal(t, model.NewInternal().Message, res.Errors[0].Message)
+				require.Equal(t, model.Internal, res.Errors[0].Extensions["code"])
+				require.NotEmpty(t, res.Errors[0].Extensions["correlationId"])
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			us := mocks.NewMockUserService(ctrl)
+			ts := mocks.NewMockTokenService(ctrl)
+			tc.buildStubs(us, ts)
+
+			router := gin.Default()
+			NewHandler(&Config{
+				R:               router,
+				UserService:     us,
+				TokenService:    ts,
+				TimeOutDuration: time.Duration(5 * time.Second),
+			})
+
+			body, err := json.Marshal(gin.H{"query": tc.query})
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			if tc.accessToken != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.accessToken)
+			}
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			var res graphqlResponse
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+			tc.checkResponse(res)
+		})
+	}
+}
@@ -1,12 +1,20 @@
 package handler
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	"github.com/maxeth/go-account-api/graph"
 	"github.com/maxeth/go-account-api/graph/generated"
 	"github.com/maxeth/go-account-api/handler/middleware"
@@ -14,18 +22,61 @@ import (
 )
 
 type Handler struct {
-	UserService     model.UserService
-	TokenService    model.TokenService
-	TimeOutDuration time.Duration
-	OAuthService    model.OAuthService
+	UserService       model.UserService
+	TokenService      model.TokenService
+	TimeOutDuration   time.Duration
+	OAuthService      model.OAuthService
+	DataExportService model.DataExportService
+	AdminService      model.AdminService
+	RateLimitService  model.RateLimitService
+	MFAService        model.MFAService
+	WebAuthnService   model.WebAuthnService
+	AuditService      model.AuditService
+	TrustedProxies    []*net.IPNet
+	TokenCookies      TokenCookieConfig
 }
 
 type Config struct {
-	R               *gin.Engine // type of the gin/http router
-	UserService     model.UserService
-	TokenService    model.TokenService
-	TimeOutDuration time.Duration
-	OAuthService    model.OAuthService
+	R                 *gin.Engine // type of the gin/http router
+	UserService       model.UserService
+	TokenService      model.TokenService
+	TimeOutDuration   time.Duration
+	OAuthService      model.OAuthService
+	DataExportService model.DataExportService
+	AdminService      model.AdminService
+	UserEventService  model.UserEventService
+	RateLimitService  model.RateLimitService // limits attempts of sign in, sign up, password reset, token refresh, 2FA codes and email checks. Nothing is limited if nil
+	MFAService        model.MFAService       // requires a second factor on sign in for users who enabled 2FA. 2FA is unavailable if nil
+	WebAuthnService   model.WebAuthnService  // registers passkeys and signs in with them. Passkeys are unavailable if nil
+	AuditService      model.AuditService     // serves the audit log to admins and the recent activity to users. Unavailable if nil
+	TrustedProxies    []*net.IPNet           // proxies whose X-Forwarded-For header is used to determine the client ip
+	TokenCookies      TokenCookieConfig
+	Cors              CorsConfig
+	GraphQL           GraphQLConfig
+}
+
+// CorsConfig holds the CORS policies of the route groups. A group whose policy allows no origins can only be used
+// by pages served from the api's own origin
+type CorsConfig struct {
+	REST    middleware.CorsPolicy
+	GraphQL middleware.CorsPolicy
+	OAuth   middleware.CorsPolicy
+}
+
+// TokenCookieConfig configures the delivery of refresh tokens in HttpOnly cookies to browser clients of the rest api.
+// Clients opt in with the X-Token-Delivery header, or get cookies by default if their origin is listed
+type TokenCookieConfig struct {
+	Origins []string // origins of browser clients which get cookies by default. The rest api's CORS policy has to allow them with credentials
+	MaxAge  int      // seconds until the cookies expire, should match the expiry of refresh tokens
+}
+
+// GraphQLConfig configures the limits and the production mode of the GraphQL api
+type GraphQLConfig struct {
+	ComplexityLimit          int                            // 0 disables the limit
+	DepthLimit               int                            // 0 disables the limit
+	Production               bool                           // turns off introspection and the playground
+	PersistedQueryRepository model.PersistedQueryRepository // enables automatic persisted queries if set
+	Allowlist                map[string]bool                // if set in production, only queries with these sha256 hashes are accepted
 }
 
 func playgroundHandler() gin.HandlerFunc {
@@ -42,43 +93,143 @@ func graphqlHandler(c *Config) gin.HandlerFunc {
 	// Resolver is in the resolver.go file
 	generatedConfig := generated.Config{
 		Resolvers: &graph.Resolver{
-			UserService:  c.UserService,
-			TokenService: c.TokenService,
+			UserService:      c.UserService,
+			TokenService:     c.TokenService,
+			AdminService:     c.AdminService,
+			UserEventService: c.UserEventService,
+			RateLimitService: c.RateLimitService,
+			MFAService:       c.MFAService,
+			WebAuthnService:  c.WebAuthnService,
+			AuditService:     c.AuditService,
 		},
-		Directives: graph.SchemaDirectives,
+		Directives: graph.NewSchemaDirectives(c.UserService, c.RateLimitService),
+		Complexity: graph.NewComplexityRoot(),
+	}
+
+	h := handler.New(generated.NewExecutableSchema(generatedConfig))
+
+	h.AddTransport(transport.Websocket{
+		KeepAlivePingInterval: 10 * time.Second,
+		InitFunc:              websocketInit(c.TokenService),
+		Upgrader: websocket.Upgrader{
+			// connections are authenticated with the access token in connection_init rather than cookies,
+			// so any origin is allowed regardless of the CORS policy of the graphql route
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	})
+	h.AddTransport(transport.Options{})
+	h.AddTransport(transport.GET{})
+	h.AddTransport(transport.POST{})
+	h.AddTransport(transport.MultipartForm{})
+
+	h.SetQueryCache(lru.New(1000))
+
+	gc := c.GraphQL
+	if !gc.Production {
+		h.Use(extension.Introspection{})
 	}
+	if gc.Production && gc.Allowlist != nil {
+		h.Use(graph.QueryAllowlist{Hashes: gc.Allowlist})
+	}
+	if gc.PersistedQueryRepository != nil {
+		h.Use(extension.AutomaticPersistedQuery{
+			Cache: graph.NewPersistedQueryCache(gc.PersistedQueryRepository),
+		})
+	}
+	if gc.ComplexityLimit > 0 {
+		h.Use(extension.FixedComplexityLimit(gc.ComplexityLimit))
+	}
+	if gc.DepthLimit > 0 {
+		h.Use(graph.DepthLimit{Limit: gc.DepthLimit})
+	}
+
+	h.SetErrorPresenter(graph.ErrorPresenter)
+	h.AroundOperations(graph.CollectInputErrors)
+	h.AroundOperations(graph.WithLoaders(c.UserService))
+	h.AroundFields(graph.ReturnInputErrors)
+	h.AroundFields(graph.PrimeEntities)
+
+	return func(ctx *gin.Context) {
+		// authentication is optional for graphql, resolvers requiring a user check for it in the context
+		if user, ok := ctx.Get("user"); ok {
+			ctx.Request = ctx.Request.WithContext(graph.WithUser(ctx.Request.Context(), user.(*model.User)))
+		}
+		if err, ok := ctx.Get("authError"); ok {
+			ctx.Request = ctx.Request.WithContext(graph.WithAuthError(ctx.Request.Context(), err.(*model.Error)))
+		}
+		ctx.Request = ctx.Request.WithContext(graph.WithClientIP(ctx.Request.Context(), clientIP(ctx, c.TrustedProxies)))
+		ctx.Request = ctx.Request.WithContext(graph.WithHTTP(ctx.Request.Context(), ctx.Writer, ctx.Request))
 
-	h := handler.NewDefaultServer(generated.NewExecutableSchema(generatedConfig))
-	if h == nil {
-		panic("GraphQL handlerfunction is nil.")
+		h.ServeHTTP(ctx.Writer, ctx.Request)
 	}
+}
 
-	return func(c *gin.Context) {
-		h.ServeHTTP(c.Writer, c.Request)
+// websocketInit authenticates graphql-ws connections with the access token sent as authorization in the connection_init payload
+func websocketInit(ts model.TokenService) transport.WebsocketInitFunc {
+	return func(ctx context.Context, payload transport.InitPayload) (context.Context, error) {
+		accessToken := strings.TrimPrefix(payload.Authorization(), "Bearer ")
+		if accessToken == "" {
+			return nil, model.NewAuthorization("Must provide the access token as authorization in the connection_init payload")
+		}
+
+		user, err := ts.ValidateAccessToken(accessToken)
+		if err != nil {
+			return nil, model.NewAuthorization("Provided token is invalid")
+		}
+
+		return graph.WithUser(ctx, user), nil
 	}
 }
 
+// requireWebsocket only lets websocket upgrade requests pass, so that the socket route isn't usable for regular requests without a timeout
+func requireWebsocket(c *gin.Context) {
+	if !c.IsWebsocket() {
+		errM := model.NewBadRequest("Expected a websocket upgrade.")
+		c.AbortWithStatusJSON(errM.Status(), gin.H{
+			"error": errM,
+		})
+		return
+	}
+
+	c.Next()
+}
+
 func applyMiddleware(c *Config) {
 	c.R.Use(middleware.Timeout(c.TimeOutDuration, model.NewInternal()))
-	c.R.Use(middleware.Cors("*"))
+	c.R.Use(middleware.Cors(c.Cors.REST))
 }
 
 func newGraphqlHandler(c *Config) {
 	fmt.Println("gql handler being init'ed")
 
-	c.R.POST("/graphql", graphqlHandler(c))
-	c.R.GET("/playground", playgroundHandler())
+	c.R.POST("/graphql", middleware.OptionalAuthUser(c.TokenService), graphqlHandler(c))
+	if !c.GraphQL.Production {
+		c.R.GET("/playground", playgroundHandler())
+	}
 }
 
 func NewHandler(c *Config) {
 	h := &Handler{
-		TokenService:    c.TokenService,
-		UserService:     c.UserService,
-		TimeOutDuration: c.TimeOutDuration,
-		OAuthService:    c.OAuthService,
+		TokenService:      c.TokenService,
+		UserService:       c.UserService,
+		TimeOutDuration:   c.TimeOutDuration,
+		OAuthService:      c.OAuthService,
+		DataExportService: c.DataExportService,
+		AdminService:      c.AdminService,
+		RateLimitService:  c.RateLimitService,
+		MFAService:        c.MFAService,
+		WebAuthnService:   c.WebAuthnService,
+		AuditService:      c.AuditService,
+		TrustedProxies:    c.TrustedProxies,
+		TokenCookies:      c.TokenCookies,
 	}
 
+	c.R.Use(requestInfo(c.TrustedProxies))
+
 	noMd := c.R.Group("/")
+	noMd.Use(middleware.Cors(c.Cors.OAuth))
+
+	known := routePaths(c.R)
 	noMd.GET("/auth/test", func(c *gin.Context) {
 		c.Redirect(301, "http://www.google.com/test")
 		c.Abort()
@@ -88,6 +239,7 @@ func NewHandler(c *Config) {
 	})
 	noMd.GET("/auth/twitch/callback", h.SigninTwitch)
 	noMd.GET("/auth/twitch", h.RedirectTwitch)
+	handlePreflights(c.R, known, c.Cors.OAuth)
 
 	g := c.R.Group("/")
 
@@ -98,22 +250,113 @@ func NewHandler(c *Config) {
 	}
 
 	g.Use(middleware.Timeout(c.TimeOutDuration, model.NewInternal()))
-	g.Use(middleware.Cors("*"))
+	g.Use(middleware.Cors(c.Cors.REST))
 
-	g.GET("/me", h.Me)
+	known = routePaths(c.R)
+
+	// imports stream a whole file of users through the password hash checks, which takes longer than the Timeout middleware allows
+	imports := c.R.Group("/admin")
+	imports.Use(middleware.Cors(c.Cors.REST))
+	imports.Use(middleware.AuthUser(h.TokenService), middleware.RequireAdmin(h.UserService))
+
+	imports.POST("/users/import", h.ImportUsers)
+
+	g.GET("/me", middleware.AuthUser(h.TokenService), h.Me)
+	g.DELETE("/me", middleware.AuthUser(h.TokenService), h.DeleteMe)
+	g.POST("/account/restore", h.RestoreAccount)
+	g.POST("/account/unlock", h.UnlockAccount)
+	g.POST("/me/export", middleware.AuthUser(h.TokenService), h.RequestExport)
+	g.GET("/me/export/:id", middleware.AuthUser(h.TokenService), h.GetExport)
+	g.GET("/export/download", h.DownloadExport)
+	g.POST("/password/forgot", h.ForgotPassword)
+	g.POST("/password/reset", h.ResetPassword)
+	g.PUT("/me/password", middleware.AuthUser(h.TokenService), h.ChangePassword)
+
+	admin := g.Group("/admin")
+	admin.Use(middleware.AuthUser(h.TokenService), middleware.RequireAdmin(h.UserService))
+
+	admin.GET("/users", h.ListUsers)
+	admin.GET("/users/:uid", h.GetUser)
+	admin.POST("/users/:uid/suspend", h.SuspendUser)
+	admin.POST("/users/:uid/unsuspend", h.UnsuspendUser)
+	admin.POST("/users/:uid/password-reset", h.ForcePasswordReset)
+	admin.DELETE("/users/:uid/sessions", h.RevokeSessions)
+	admin.PUT("/users/:uid/role", h.SetUserRole)
+	if h.AuditService != nil {
+		admin.GET("/audit-events", h.ListAuditEvents)
+		g.GET("/me/activity", middleware.AuthUser(h.TokenService), h.RecentActivity)
+	}
 	g.POST("/signup", h.Signup)
 	g.POST("/signin", h.Signin)
-	g.POST("/signout", h.Signout)
-	g.POST("/tokens", h.Tokens)
+	g.POST("/signin/magic", h.RequestMagicLink)
+	g.POST("/signin/magic/verify", h.SigninWithMagicLink)
+	g.POST("/signin/reject", h.RejectSignin)
+	if h.MFAService != nil {
+		g.POST("/signin/mfa", h.VerifyMFA)
+		g.POST("/signin/mfa/webauthn/begin", h.BeginMFAWebAuthn)
+		g.POST("/signin/mfa/webauthn/finish", h.VerifyMFAWebAuthn)
+		g.POST("/signin/mfa/recovery", h.VerifyRecoveryCode)
+		g.POST("/me/2fa/totp", middleware.AuthUser(h.TokenService), h.EnrollTOTP)
+		g.POST("/me/2fa/totp/confirm", middleware.AuthUser(h.TokenService), h.ConfirmTOTP)
+		g.POST("/me/2fa/totp/regenerate", middleware.AuthUser(h.TokenService), h.RegenerateTOTP)
+		g.DELETE("/me/2fa/totp", middleware.AuthUser(h.TokenService), h.DisableTOTP)
+		g.POST("/me/2fa/recovery-codes", middleware.AuthUser(h.TokenService), h.RegenerateRecoveryCodes)
+	}
+	if h.WebAuthnService != nil {
+		g.POST("/signin/webauthn/begin", h.BeginWebAuthnLogin)
+		g.POST("/signin/webauthn/finish", h.FinishWebAuthnLogin)
+		g.POST("/me/webauthn/register/begin", middleware.AuthUser(h.TokenService), h.BeginWebAuthnRegistration)
+		g.POST("/me/webauthn/register/finish", middleware.AuthUser(h.TokenService), h.FinishWebAuthnRegistration)
+		g.GET("/me/webauthn/credentials", middleware.AuthUser(h.TokenService), h.ListWebAuthnCredentials)
+		g.DELETE("/me/webauthn/credentials/:id", middleware.AuthUser(h.TokenService), h.DeleteWebAuthnCredential)
+	}
+	g.POST("/signout", middleware.AuthUser(h.TokenService), h.Signout)
+	g.POST("/tokens", middleware.CSRF(model.RefreshTokenCookie, model.CSRFCookie), h.Tokens)
 	g.POST("/image", h.Image)
-	g.DELETE("/image", h.DeleteImage)
-	g.PUT("/details", h.Details)
+	g.DELETE("/image", middleware.AuthUser(h.TokenService), h.DeleteImage)
+	g.PUT("/details", middleware.AuthUser(h.TokenService), h.Details)
+	g.POST("/email", middleware.AuthUser(h.TokenService), h.ChangeEmail)
+	g.POST("/email/confirm", h.ConfirmEmail)
+	g.POST("/email/cancel", h.CancelEmailChange)
+	g.GET("/email/available", h.EmailAvailable)
+	handlePreflights(c.R, known, c.Cors.REST)
+
+	gqlHandler := graphqlHandler(c)
+
+	// taken before the websocket route, which shares its path with the graphql route
+	known = routePaths(c.R)
+
+	// subscriptions are served over long-lived websocket connections, which would be cut off by the Timeout middleware
+	socket := c.R.Group("/")
+	socket.GET("/graphql", requireWebsocket, gqlHandler)
 
 	gql := c.R.Group("/")
 
 	gql.Use(middleware.Timeout(c.TimeOutDuration, model.NewInternal()))
-	gql.Use(middleware.Cors("*"))
+	gql.Use(middleware.Cors(c.Cors.GraphQL))
+
+	gql.POST("/graphql", middleware.OptionalAuthUser(c.TokenService), gqlHandler)
+	if !c.GraphQL.Production {
+		gql.GET("/playground", playgroundHandler())
+	}
+	handlePreflights(c.R, known, c.Cors.GraphQL)
+}
+
+// routePaths returns the paths the router has routes for
+func routePaths(r *gin.Engine) map[string]bool {
+	paths := map[string]bool{}
+	for _, route := range r.Routes() {
+		paths[route.Path] = true
+	}
+	return paths
+}
 
-	gql.POST("/graphql", graphqlHandler(c))
-	gql.GET("/playground", playgroundHandler())
+// handlePreflights answers the CORS preflight requests to the paths registered since known has been taken with the
+// policy of their group. Preflight requests need an OPTIONS route, as they would otherwise not match any route
+func handlePreflights(r *gin.Engine, known map[string]bool, policy middleware.CorsPolicy) {
+	for path := range routePaths(r) {
+		if !known[path] {
+			r.OPTIONS(path, middleware.Cors(policy))
+		}
+	}
 }
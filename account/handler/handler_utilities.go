@@ -1,18 +1,54 @@
 package handler
 
 import (
+	"errors"
+	"strconv"
+
 	"github.com/gin-gonic/gin"
 	"github.com/maxeth/go-account-api/model"
 )
 
 func basicErrorResponse(c *gin.Context, status int, err error) {
+	var errM *model.Error
+	if errors.As(err, &errM) {
+		setRetryAfter(c, *errM)
+
+		if len(errM.InvalidArgs) > 0 {
+			c.JSON(status, gin.H{
+				"error":       err,
+				"invalidArgs": errM.InvalidArgs,
+			})
+			return
+		}
+	}
+
 	c.JSON(status, gin.H{
 		"error": err,
 	})
 }
 
 func errorResponse(c *gin.Context, customError model.Error) {
-	c.JSON(customError.Status(), gin.H{
-		"error": customError,
-	})
+	basicErrorResponse(c, customError.Status(), &customError)
+}
+
+// setRetryAfter tells rate limited clients when to try again
+func setRetryAfter(c *gin.Context, err model.Error) {
+	if err.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(err.RetryAfter))
+	}
+}
+
+// rateLimit counts an attempt of the action by the client and responds with a 429 once the client exceeded its limit.
+// Returns false if the request has been rate limited. Without a RateLimitService, nothing is limited
+func (h *Handler) rateLimit(c *gin.Context, action string, email string) bool {
+	if h.RateLimitService == nil {
+		return true
+	}
+
+	if err := h.RateLimitService.Allow(c.Request.Context(), action, clientIP(c, h.TrustedProxies), email); err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return false
+	}
+
+	return true
 }
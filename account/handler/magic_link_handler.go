@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maxeth/go-account-api/library"
+	"github.com/maxeth/go-account-api/model"
+)
+
+type magicLinkReq struct {
+	Email         string `json:"email" binding:"required,email"`
+	CreateAccount bool   `json:"createAccount"` // creates a passwordless account on first use if there is none with the email
+}
+
+// RequestMagicLink mails a sign in link to the email and binds it to the requesting browser with an HttpOnly cookie.
+// The response doesn't tell whether a link has been sent
+func (h *Handler) RequestMagicLink(c *gin.Context) {
+	var req magicLinkReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	if ok := h.rateLimit(c, model.ActionMagicLink, req.Email); !ok {
+		return
+	}
+
+	nonce, err := h.UserService.RequestMagicLink(c.Request.Context(), req.Email, req.CreateAccount)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	http.SetCookie(c.Writer, library.NewCookie(model.MagicLinkCookie, nonce, 0))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "If the email can be used to sign in, a link has been sent to it.",
+	})
+}
+
+type magicLinkSigninReq struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// SigninWithMagicLink exchanges the token of a sign in link for a token pair, or for an MFA challenge if the account has 2FA enabled.
+// The request has to carry the cookie set when the link was requested
+func (h *Handler) SigninWithMagicLink(c *gin.Context) {
+	var req magicLinkSigninReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	nonce, _ := c.Cookie(model.MagicLinkCookie)
+
+	user, err := h.UserService.SigninWithMagicLink(c.Request.Context(), req.Token, nonce)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	// the nonce is useless once the link has been used
+	http.SetCookie(c.Writer, library.NewCookie(model.MagicLinkCookie, "", -1))
+
+	h.completeSignin(c, user, model.SigninMethodMagicLink)
+}
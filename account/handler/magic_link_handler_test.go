@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMagicLink(t *testing.T) {
+	user := &model.User{
+		UID:   uuid.New(),
+		Email: email,
+	}
+	tokens := &model.TokenPair{AccessToken: randomAT, RefreshToken: randomRT}
+
+	// every transport requests a link and signs in with it, the way a browser would
+	transports := []struct {
+		name         string
+		requestPath  string
+		requestBody  gin.H
+		verifyPath   string
+		verifyBody   func(token string) gin.H
+		accessToken  func(body map[string]interface{}) interface{}
+		errorMessage func(body map[string]interface{}) interface{}
+	}{
+		{
+			name:        "REST",
+			requestPath: "/signin/magic",
+			requestBody: gin.H{"email": email, "createAccount": true},
+			verifyPath:  "/signin/magic/verify",
+			verifyBody: func(token string) gin.H {
+				return gin.H{"token": token}
+			},
+			accessToken: func(body map[string]interface{}) interface{} {
+				return body["tokens"].(map[string]interface{})["accessToken"]
+			},
+			errorMessage: func(body map[string]interface{}) interface{} {
+				return body["error"].(map[string]interface{})["message"]
+			},
+		},
+		{
+			name:        "GraphQL",
+			requestPath: "/graphql",
+			requestBody: gin.H{"query": `mutation { requestMagicLink(input: {email: "` + email + `", createAccount: true}) }`},
+			verifyPath:  "/graphql",
+			verifyBody: func(token string) gin.H {
+				return gin.H{"query": `mutation { signInWithMagicLink(token: "` + token + `") { tokenPair { accessToken } } }`}
+			},
+			accessToken: func(body map[string]interface{}) interface{} {
+				data := body["data"].(map[string]interface{})["signInWithMagicLink"].(map[string]interface{})
+				return data["tokenPair"].(map[string]interface{})["accessToken"]
+			},
+			errorMessage: func(body map[string]interface{}) interface{} {
+				return body["errors"].([]interface{})[0].(map[string]interface{})["message"]
+			},
+		},
+	}
+
+	for _, transport := range transports {
+		tr := transport
+
+		t.Run(tr.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			us := mocks.NewMockUserService(ctrl)
+			ts := mocks.NewMockTokenService(ctrl)
+
+			router := gin.Default()
+			NewHandler(&Config{
+				R:               router,
+				UserService:     us,
+				TokenService:    ts,
+				TimeOutDuration: time.Duration(5 * time.Second),
+			})
+
+			post := func(path string, body gin.H, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+				b, err := json.Marshal(body)
+				require.NoError(t, err)
+
+				req, err := http.NewRequest(http.MethodPost, path, bytes.NewReader(b))
+				require.NoError(t, err)
+				req.Header.Set("Content-Type", "application/json")
+				for _, c := range cookies {
+					req.AddCookie(c)
+				}
+
+				recorder := httptest.NewRecorder()
+				router.ServeHTTP(recorder, req)
+				return recorder
+			}
+
+			// the nonce is handed to the browser as a cookie scripts can't read
+			us.EXPECT().RequestMagicLink(gomock.Any(), email, true).Times(1).Return("nonce", nil)
+
+			res := post(tr.requestPath, tr.requestBody)
+			require.Equal(t, http.StatusOK, res.Code)
+
+			cookies := res.Result().Cookies()
+			require.Len(t, cookies, 1)
+			nonce := cookies[0]
+			require.Equal(t, model.MagicLinkCookie, nonce.Name)
+			require.Equal(t, "nonce", nonce.Value)
+			require.True(t, nonce.HttpOnly)
+			require.True(t, nonce.Secure)
+
+			// links opened in another browser are rejected
+			us.EXPECT().SigninWithMagicLink(gomock.Any(), "token", "").Times(1).
+				Return(nil, model.NewAuthorization("The link has to be opened in the browser it has been requested from."))
+
+			res = post(tr.verifyPath, tr.verifyBody("token"))
+			var body map[string]interface{}
+			require.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+			require.Equal(t, "The link has to be opened in the browser it has been requested from.", tr.errorMessage(body))
+
+			// the browser that requested the link signs in and the nonce is cleared
+			us.EXPECT().SigninWithMagicLink(gomock.Any(), "token", "nonce").Times(1).Return(user, nil)
+			ts.EXPECT().NewPairFromUser(gomock.Any(), user, "").Times(1).Return(tokens, nil)
+			us.EXPECT().SigninCompleted(gomock.Any(), user, model.SigninMethodMagicLink).Times(1)
+
+			res = post(tr.verifyPath, tr.verifyBody("token"), nonce)
+			require.Equal(t, http.StatusOK, res.Code)
+			require.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+			require.Equal(t, randomAT, tr.accessToken(body))
+
+			cookies = res.Result().Cookies()
+			require.Len(t, cookies, 1)
+			require.Equal(t, model.MagicLinkCookie, cookies[0].Name)
+			require.True(t, cookies[0].MaxAge < 0)
+		})
+	}
+}
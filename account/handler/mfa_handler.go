@@ -0,0 +1,265 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maxeth/go-account-api/model"
+)
+
+type verifyMFAReq struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+// VerifyMFA completes a sign in of an account with 2FA enabled, exchanging the challenge token
+// returned by Signin along with a code of the users authenticator app for a token pair
+func (h *Handler) VerifyMFA(c *gin.Context) {
+	var req verifyMFAReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	if ok := h.rateLimit(c, model.ActionMFA, ""); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	user, err := h.MFAService.VerifyTOTP(ctx, req.ChallengeToken, req.Code)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	tokens, err := h.TokenService.NewPairFromUser(ctx, user, "")
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	h.UserService.SigninCompleted(ctx, user, model.MFAMethodTOTP)
+	h.respondWithTokens(c, tokens)
+}
+
+type mfaChallengeReq struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+}
+
+// BeginMFAWebAuthn returns the options to pass to navigator.credentials.get to complete a sign in challenge with a passkey
+func (h *Handler) BeginMFAWebAuthn(c *gin.Context) {
+	var req mfaChallengeReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	if ok := h.rateLimit(c, model.ActionMFA, ""); !ok {
+		return
+	}
+
+	options, err := h.MFAService.BeginWebAuthn(c.Request.Context(), req.ChallengeToken)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"options": options,
+	})
+}
+
+type verifyMFAWebAuthnReq struct {
+	ChallengeToken string                  `json:"challengeToken" binding:"required"`
+	Credential     model.WebAuthnAssertion `json:"credential" binding:"required"`
+}
+
+// VerifyMFAWebAuthn completes a sign in challenge with the passkey response to the options of BeginMFAWebAuthn
+func (h *Handler) VerifyMFAWebAuthn(c *gin.Context) {
+	var req verifyMFAWebAuthnReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	if ok := h.rateLimit(c, model.ActionMFA, ""); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	user, err := h.MFAService.VerifyWebAuthn(ctx, req.ChallengeToken, &req.Credential)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	tokens, err := h.TokenService.NewPairFromUser(ctx, user, "")
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	h.UserService.SigninCompleted(ctx, user, model.MFAMethodWebAuthn)
+	h.respondWithTokens(c, tokens)
+}
+
+// VerifyRecoveryCode completes a sign in challenge with one of the recovery codes of the user in place of a second factor
+func (h *Handler) VerifyRecoveryCode(c *gin.Context) {
+	var req verifyMFAReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	if ok := h.rateLimit(c, model.ActionMFA, ""); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	user, err := h.MFAService.VerifyRecoveryCode(ctx, req.ChallengeToken, req.Code)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	tokens, err := h.TokenService.NewPairFromUser(ctx, user, "")
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	h.UserService.SigninCompleted(ctx, user, model.MFAMethodRecovery)
+	h.respondWithTokens(c, tokens)
+}
+
+type totpCodeReq struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// EnrollTOTP creates a new authenticator app secret for the user, which has to be confirmed with ConfirmTOTP
+func (h *Handler) EnrollTOTP(c *gin.Context) {
+	user, ok := c.Get("user")
+	if !ok {
+		errM := model.NewAuthorization("not signed in")
+		errorResponse(c, *errM)
+		return
+	}
+
+	enrollment, err := h.MFAService.EnrollTOTP(c.Request.Context(), user.(*model.User))
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"totp": enrollment,
+	})
+}
+
+// ConfirmTOTP enables 2FA with the secret of the latest enrollment, using a first code generated from it.
+// The response holds new recovery codes unless the user still has unused ones, they are only shown once
+func (h *Handler) ConfirmTOTP(c *gin.Context) {
+	user, ok := c.Get("user")
+	if !ok {
+		errM := model.NewAuthorization("not signed in")
+		errorResponse(c, *errM)
+		return
+	}
+
+	var req totpCodeReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	if ok := h.rateLimit(c, model.ActionMFA, user.(*model.User).Email); !ok {
+		return
+	}
+
+	codes, err := h.MFAService.ConfirmTOTP(c.Request.Context(), user.(*model.User).UID, req.Code)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "2FA has been enabled.",
+		"recoveryCodes": codes,
+	})
+}
+
+// RegenerateTOTP creates a new secret after a code of the current one has been passed.
+// The current secret stays active until the new one is confirmed with ConfirmTOTP
+func (h *Handler) RegenerateTOTP(c *gin.Context) {
+	user, ok := c.Get("user")
+	if !ok {
+		errM := model.NewAuthorization("not signed in")
+		errorResponse(c, *errM)
+		return
+	}
+
+	var req totpCodeReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	if ok := h.rateLimit(c, model.ActionMFA, user.(*model.User).Email); !ok {
+		return
+	}
+
+	enrollment, err := h.MFAService.RegenerateTOTP(c.Request.Context(), user.(*model.User), req.Code)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"totp": enrollment,
+	})
+}
+
+// DisableTOTP turns 2FA off after a code of the current secret has been passed
+func (h *Handler) DisableTOTP(c *gin.Context) {
+	user, ok := c.Get("user")
+	if !ok {
+		errM := model.NewAuthorization("not signed in")
+		errorResponse(c, *errM)
+		return
+	}
+
+	var req totpCodeReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	if ok := h.rateLimit(c, model.ActionMFA, user.(*model.User).Email); !ok {
+		return
+	}
+
+	if err := h.MFAService.DisableTOTP(c.Request.Context(), user.(*model.User).UID, req.Code); err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "2FA has been disabled.",
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the signed in user, the previous codes can't be used anymore
+func (h *Handler) RegenerateRecoveryCodes(c *gin.Context) {
+	user, ok := c.Get("user")
+	if !ok {
+		errM := model.NewAuthorization("not signed in")
+		errorResponse(c, *errM)
+		return
+	}
+
+	codes, err := h.MFAService.RegenerateRecoveryCodes(c.Request.Context(), user.(*model.User).UID)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recoveryCodes": codes,
+	})
+}
@@ -0,0 +1,280 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMFA(t *testing.T) {
+	user := &model.User{
+		UID:   uuid.New(),
+		Email: email,
+	}
+	tokens := &model.TokenPair{AccessToken: randomAT, RefreshToken: randomRT}
+	challenge := &model.MFAChallenge{
+		ChallengeToken: "challenge",
+		Methods:        []string{model.MFAMethodTOTP},
+		ExpiresIn:      300,
+	}
+	enrollment := &model.TOTPEnrollment{
+		URI:    "otpauth://totp/accounts:" + email + "?secret=JBSWY3DPEHPK3PXP",
+		QRCode: "iVBORw0KGgo=",
+		Secret: "JBSWY3DPEHPK3PXP",
+	}
+
+	// the scenarios are run through both transports, with an MFAService on top of the services of the parity tests
+	scenarios := []struct {
+		transportScenario
+		buildMFAStubs func(ms *mocks.MockMFAService)
+	}{
+		{
+			transportScenario: transportScenario{
+				name: "SigninChallenge",
+				buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+					us.EXPECT().Signin(gomock.Any(), email, "password").Times(1).Return(user, nil)
+					// no tokens are issued before the challenge has been completed
+					ts.EXPECT().NewPairFromUser(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+					us.EXPECT().SigninCompleted(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				},
+				restMethod:    http.MethodPost,
+				restPath:      "/signin",
+				restBody:      gin.H{"email": email, "password": "password"},
+				restResult:    "mfaChallenge",
+				graphql:       `mutation { signIn(input: {email: "` + email + `", password: "password"}) { tokenPair { accessToken } mfaChallenge { challengeToken methods expiresIn } } }`,
+				graphqlResult: []string{"signIn", "mfaChallenge"},
+				checkResult: func(t *testing.T, result map[string]interface{}) {
+					require.Equal(t, "challenge", result["challengeToken"])
+					require.Equal(t, []interface{}{model.MFAMethodTOTP}, result["methods"])
+					require.Equal(t, float64(300), result["expiresIn"])
+				},
+			},
+			buildMFAStubs: func(ms *mocks.MockMFAService) {
+				ms.EXPECT().Challenge(gomock.Any(), user).Times(1).Return(challenge, nil)
+			},
+		},
+		{
+			transportScenario: transportScenario{
+				name: "SigninWithout2FA",
+				buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+					us.EXPECT().Signin(gomock.Any(), email, "password").Times(1).Return(user, nil)
+					ts.EXPECT().NewPairFromUser(gomock.Any(), user, "").Times(1).Return(tokens, nil)
+					us.EXPECT().SigninCompleted(gomock.Any(), user, model.SigninMethodPassword).Times(1)
+				},
+				restMethod:    http.MethodPost,
+				restPath:      "/signin",
+				restBody:      gin.H{"email": email, "password": "password"},
+				restResult:    "tokens",
+				graphql:       `mutation { signIn(input: {email: "` + email + `", password: "password"}) { tokenPair { accessToken refreshToken } mfaChallenge { challengeToken } } }`,
+				graphqlResult: []string{"signIn", "tokenPair"},
+				checkResult: func(t *testing.T, result map[string]interface{}) {
+					require.Equal(t, randomAT, result["accessToken"])
+				},
+			},
+			buildMFAStubs: func(ms *mocks.MockMFAService) {
+				ms.EXPECT().Challenge(gomock.Any(), user).Times(1).Return(nil, nil)
+			},
+		},
+		{
+			transportScenario: transportScenario{
+				name: "VerifyOK",
+				buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+					ts.EXPECT().NewPairFromUser(gomock.Any(), user, "").Times(1).Return(tokens, nil)
+					us.EXPECT().SigninCompleted(gomock.Any(), user, model.MFAMethodTOTP).Times(1)
+				},
+				restMethod:    http.MethodPost,
+				restPath:      "/signin/mfa",
+				restBody:      gin.H{"challengeToken": "challenge", "code": "123456"},
+				restResult:    "tokens",
+				graphql:       `mutation { verifyMfa(input: {challengeToken: "challenge", code: "123456"}) { tokenPair { accessToken refreshToken } } }`,
+				graphqlResult: []string{"verifyMfa", "tokenPair"},
+				checkResult: func(t *testing.T, result map[string]interface{}) {
+					require.Equal(t, randomAT, result["accessToken"])
+					require.Equal(t, randomRT, result["refreshToken"])
+				},
+			},
+			buildMFAStubs: func(ms *mocks.MockMFAService) {
+				ms.EXPECT().VerifyTOTP(gomock.Any(), "challenge", "123456").Times(1).Return(user, nil)
+			},
+		},
+		{
+			transportScenario: transportScenario{
+				name: "VerifyReplayedCode",
+				buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+					ts.EXPECT().NewPairFromUser(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				},
+				restMethod: http.MethodPost,
+				restPath:   "/signin/mfa",
+				restBody:   gin.H{"challengeToken": "challenge", "code": "123456"},
+				graphql:    `mutation { verifyMfa(input: {challengeToken: "challenge", code: "123456"}) { tokenPair { accessToken } } }`,
+				wantErr:    "The code has already been used. Wait for the next one.",
+				wantCode:   model.Authorization,
+			},
+			buildMFAStubs: func(ms *mocks.MockMFAService) {
+				ms.EXPECT().VerifyTOTP(gomock.Any(), "challenge", "123456").Times(1).
+					Return(nil, model.NewAuthorization("The code has already been used. Wait for the next one."))
+			},
+		},
+		{
+			transportScenario: transportScenario{
+				name: "VerifyRecoveryCode",
+				buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+					ts.EXPECT().NewPairFromUser(gomock.Any(), user, "").Times(1).Return(tokens, nil)
+					us.EXPECT().SigninCompleted(gomock.Any(), user, model.MFAMethodRecovery).Times(1)
+				},
+				restMethod:    http.MethodPost,
+				restPath:      "/signin/mfa/recovery",
+				restBody:      gin.H{"challengeToken": "challenge", "code": "0a1b2-c3d4e"},
+				restResult:    "tokens",
+				graphql:       `mutation { verifyRecoveryCode(input: {challengeToken: "challenge", code: "0a1b2-c3d4e"}) { tokenPair { accessToken refreshToken } } }`,
+				graphqlResult: []string{"verifyRecoveryCode", "tokenPair"},
+				checkResult: func(t *testing.T, result map[string]interface{}) {
+					require.Equal(t, randomAT, result["accessToken"])
+				},
+			},
+			buildMFAStubs: func(ms *mocks.MockMFAService) {
+				ms.EXPECT().VerifyRecoveryCode(gomock.Any(), "challenge", "0a1b2-c3d4e").Times(1).Return(user, nil)
+			},
+		},
+		{
+			transportScenario: transportScenario{
+				name: "VerifyUsedRecoveryCode",
+				buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+					ts.EXPECT().NewPairFromUser(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				},
+				restMethod: http.MethodPost,
+				restPath:   "/signin/mfa/recovery",
+				restBody:   gin.H{"challengeToken": "challenge", "code": "0a1b2-c3d4e"},
+				graphql:    `mutation { verifyRecoveryCode(input: {challengeToken: "challenge", code: "0a1b2-c3d4e"}) { tokenPair { accessToken } } }`,
+				wantErr:    "Invalid recovery code.",
+				wantCode:   model.Authorization,
+			},
+			buildMFAStubs: func(ms *mocks.MockMFAService) {
+				ms.EXPECT().VerifyRecoveryCode(gomock.Any(), "challenge", "0a1b2-c3d4e").Times(1).Return(nil, model.NewAuthorization("Invalid recovery code."))
+			},
+		},
+		{
+			transportScenario: transportScenario{
+				name:        "RegenerateRecoveryCodesNotEnabled",
+				accessToken: randomAT,
+				buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+					ts.EXPECT().ValidateAccessToken(randomAT).Times(1).Return(user, nil)
+				},
+				restMethod: http.MethodPost,
+				restPath:   "/me/2fa/recovery-codes",
+				graphql:    `mutation { regenerateRecoveryCodes { recoveryCodes } }`,
+				wantErr:    model.NewBadRequest("2FA is not enabled.").Message,
+				wantCode:   model.BadRequest,
+			},
+			buildMFAStubs: func(ms *mocks.MockMFAService) {
+				ms.EXPECT().RegenerateRecoveryCodes(gomock.Any(), user.UID).Times(1).Return(nil, model.NewBadRequest("2FA is not enabled."))
+			},
+		},
+		{
+			transportScenario: transportScenario{
+				name:        "EnrollTOTP",
+				accessToken: randomAT,
+				buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+					ts.EXPECT().ValidateAccessToken(randomAT).Times(1).Return(user, nil)
+				},
+				restMethod:    http.MethodPost,
+				restPath:      "/me/2fa/totp",
+				restResult:    "totp",
+				graphql:       `mutation { enrollTotp { totp { uri qrCode secret } } }`,
+				graphqlResult: []string{"enrollTotp", "totp"},
+				checkResult: func(t *testing.T, result map[string]interface{}) {
+					require.Equal(t, enrollment.URI, result["uri"])
+					require.Equal(t, enrollment.QRCode, result["qrCode"])
+					require.Equal(t, enrollment.Secret, result["secret"])
+				},
+			},
+			buildMFAStubs: func(ms *mocks.MockMFAService) {
+				ms.EXPECT().EnrollTOTP(gomock.Any(), user).Times(1).Return(enrollment, nil)
+			},
+		},
+		{
+			transportScenario: transportScenario{
+				name: "EnrollTOTPSignedOut",
+				buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				},
+				restMethod: http.MethodPost,
+				restPath:   "/me/2fa/totp",
+				graphql:    `mutation { enrollTotp { totp { uri } } }`,
+				wantErr:    "Must provide Authorization header with format `Bearer {token}`",
+				wantCode:   model.Authorization,
+			},
+			buildMFAStubs: func(ms *mocks.MockMFAService) {
+				ms.EXPECT().EnrollTOTP(gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+		{
+			transportScenario: transportScenario{
+				name:        "DisableTOTPWrongCode",
+				accessToken: randomAT,
+				buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+					ts.EXPECT().ValidateAccessToken(randomAT).Times(1).Return(user, nil)
+				},
+				restMethod: http.MethodDelete,
+				restPath:   "/me/2fa/totp",
+				restBody:   gin.H{"code": "000000"},
+				graphql:    `mutation { disableTotp(code: "000000") }`,
+				wantErr:    "Invalid code.",
+				wantCode:   model.Authorization,
+			},
+			buildMFAStubs: func(ms *mocks.MockMFAService) {
+				ms.EXPECT().DisableTOTP(gomock.Any(), user.UID, "000000").Times(1).Return(model.NewAuthorization("Invalid code."))
+			},
+		},
+	}
+
+	transports := []struct {
+		name string
+		run  func(t *testing.T, router *gin.Engine, s transportScenario) transportResult
+	}{
+		{name: "REST", run: runREST},
+		{name: "GraphQL", run: runGraphQL},
+	}
+
+	for i := range scenarios {
+		s := scenarios[i]
+
+		for _, transport := range transports {
+			run := transport.run
+
+			t.Run(transport.name+"/"+s.name, func(t *testing.T) {
+				ctrl := gomock.NewController(t)
+				defer ctrl.Finish()
+
+				us := mocks.NewMockUserService(ctrl)
+				ts := mocks.NewMockTokenService(ctrl)
+				ms := mocks.NewMockMFAService(ctrl)
+				s.buildStubs(us, ts)
+				s.buildMFAStubs(ms)
+
+				router := gin.Default()
+				NewHandler(&Config{
+					R:               router,
+					UserService:     us,
+					TokenService:    ts,
+					MFAService:      ms,
+					TimeOutDuration: time.Duration(5 * time.Second),
+				})
+
+				res := run(t, router, s.transportScenario)
+
+				require.Equal(t, s.wantErr, res.err)
+				require.Equal(t, s.wantCode, res.code)
+				if s.checkResult != nil {
+					s.checkResult(t, res.result)
+				}
+			})
+		}
+	}
+}
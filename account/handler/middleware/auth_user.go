@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maxeth/go-account-api/model"
+)
+
+type authHeader struct {
+	AccessToken string `header:"Authorization"`
+}
+
+// AuthUser extracts the user from the bearer access token in the Authorization header
+// and sets it as "user" in the gin context. Requests without a valid token are aborted with a 401
+func AuthUser(s model.TokenService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := userFromHeader(c, s)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		setUser(c, user)
+		c.Next()
+	}
+}
+
+// OptionalAuthUser sets the user as "user" in the gin context like AuthUser,
+// but lets requests without a valid access token pass as anonymous requests.
+// The reason the request is anonymous is set as "authError", for fields that do require a user
+func OptionalAuthUser(s model.TokenService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := userFromHeader(c, s)
+		if err != nil {
+			c.Set("authError", err)
+		} else {
+			setUser(c, user)
+		}
+
+		c.Next()
+	}
+}
+
+// setUser sets the user in the gin context and records it as the actor of the request for the audit log
+func setUser(c *gin.Context, user *model.User) {
+	c.Set("user", user)
+
+	if info, ok := model.RequestInfoFromContext(c.Request.Context()); ok {
+		info.ActorUID = &user.UID
+	}
+}
+
+func userFromHeader(c *gin.Context, s model.TokenService) (*model.User, *model.Error) {
+	h := authHeader{}
+
+	if err := c.ShouldBindHeader(&h); err != nil {
+		return nil, model.NewAuthorization("Unable to read Authorization header")
+	}
+
+	accessToken := strings.TrimPrefix(h.AccessToken, "Bearer ")
+	if accessToken == "" || accessToken == h.AccessToken {
+		return nil, model.NewAuthorization("Must provide Authorization header with format `Bearer {token}`")
+	}
+
+	user, err := s.ValidateAccessToken(accessToken)
+	if err != nil {
+		return nil, model.NewAuthorization("Provided token is invalid")
+	}
+
+	return user, nil
+}
+
+func abortWithError(c *gin.Context, err *model.Error) {
+	c.AbortWithStatusJSON(err.Status(), gin.H{
+		"error": err,
+	})
+}
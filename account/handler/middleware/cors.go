@@ -1,16 +1,89 @@
 package middleware
 
-import "github.com/gin-gonic/gin"
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CorsPolicy configures which cross-origin requests browsers allow. A policy without allowed origins
+// allows none, so that only the api's own origin can read responses
+type CorsPolicy struct {
+	// exact origins like https://app.example.com, or origins with a wildcard subdomain like https://*.example.com,
+	// which matches subdomains of any depth but not example.com itself. "*" allows any origin, but never with credentials
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string      // response headers scripts may read besides the simple ones
+	AllowCredentials bool          // lets matching origins send cookies along, "*" never does
+	MaxAge           time.Duration // how long browsers may cache the response to a preflight request, 0 leaves it up to them
+}
+
+// allows reports whether the origin is allowed, and whether it only is through "*"
+func (p CorsPolicy) allows(origin string) (allowed bool, any bool) {
+	for _, o := range p.AllowedOrigins {
+		if o == origin {
+			return true, false
+		}
+
+		// https://*.example.com matches https://app.example.com and https://eu.app.example.com
+		if i := strings.Index(o, "://*."); i >= 0 {
+			prefix, suffix := o[:i+len("://")], o[i+len("://*"):]
+			if strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) && len(origin) > len(prefix)+len(suffix) {
+				return true, false
+			}
+		}
+	}
+
+	for _, o := range p.AllowedOrigins {
+		if o == "*" {
+			return true, true
+		}
+	}
+
+	return false, false
+}
+
+// Cors applies the policy to the requests of a route group. Only allowed origins are reflected in
+// Access-Control-Allow-Origin, and the response varies by origin. OPTIONS requests are answered right away
+func Cors(p CorsPolicy) gin.HandlerFunc {
+	methods := strings.Join(p.AllowedMethods, ", ")
+	headers := strings.Join(p.AllowedHeaders, ", ")
+	exposed := strings.Join(p.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(p.MaxAge.Seconds()))
 
-func Cors(origin string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT")
+		h := c.Writer.Header()
+		h.Add("Vary", "Origin")
+
+		origin := c.GetHeader("Origin")
+		allowed, any := p.allows(origin)
+		if origin != "" && allowed {
+			if any {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+				if p.AllowCredentials {
+					h.Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+
+			if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+				h.Set("Access-Control-Allow-Methods", methods)
+				h.Set("Access-Control-Allow-Headers", headers)
+				if p.MaxAge > 0 {
+					h.Set("Access-Control-Max-Age", maxAge)
+				}
+			} else if exposed != "" {
+				h.Set("Access-Control-Expose-Headers", exposed)
+			}
+		}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
 
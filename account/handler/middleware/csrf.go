@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maxeth/go-account-api/model"
+)
+
+// CSRFHeader has to repeat the token of the CSRF cookie on state changing requests authenticated by a cookie
+const CSRFHeader = "X-CSRF-Token"
+
+// CSRF protects state changing requests carrying the authCookie with the double submit pattern. The token of the
+// csrfCookie has to be repeated in the X-CSRF-Token header, which other sites can neither read nor set.
+// Requests without the authCookie aren't authenticated by cookies and pass
+func CSRF(authCookie, csrfCookie string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		if _, err := c.Cookie(authCookie); err != nil {
+			c.Next()
+			return
+		}
+
+		token, err := c.Cookie(csrfCookie)
+		header := c.GetHeader(CSRFHeader)
+		if err != nil || token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(header)) != 1 {
+			abortWithError(c, model.NewForbidden("Missing or invalid CSRF token."))
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/maxeth/go-account-api/model"
+)
+
+// RequireAdmin aborts requests of users who are not admins. It has to run after AuthUser.
+// The role is read from the database rather than the access token, so that revoking it takes effect immediately
+func RequireAdmin(s model.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := c.Get("user")
+		if !ok {
+			abortWithError(c, model.NewAuthorization("not signed in"))
+			return
+		}
+
+		admin, err := s.Get(c.Request.Context(), user.(*model.User).UID)
+		if err != nil || admin.CheckActive() != nil || admin.Role != model.RoleAdmin {
+			abortWithError(c, model.NewForbidden("Admin role required."))
+			return
+		}
+
+		c.Set("user", admin)
+		c.Next()
+	}
+}
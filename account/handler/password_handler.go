@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maxeth/go-account-api/model"
+)
+
+type forgotPasswordReq struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ForgotPassword mails a password reset link. It responds the same way whether
+// or not an account with the email exists
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	var req forgotPasswordReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	if ok := h.rateLimit(c, model.ActionPasswordReset, req.Email); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.UserService.RequestPasswordReset(ctx, req.Email); err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "If an account with this email exists, a link to reset the password has been sent to it.",
+	})
+}
+
+type resetPasswordReq struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// ResetPassword sets a new password and signs the user out on all devices
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var req resetPasswordReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	if ok := h.rateLimit(c, model.ActionPasswordReset, ""); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := h.UserService.ResetPassword(ctx, req.Token, req.Password)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	if err := h.TokenService.Signout(ctx, user.UID); err != nil {
+		log.Printf("Failed to sign out user after password reset: %v\n", err.Error())
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Your password has been reset.",
+	})
+}
+
+type changePasswordReq struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	Password        string `json:"password" binding:"required"`
+}
+
+// ChangePassword replaces the password of the signed in user, who has to pass the current password again
+func (h *Handler) ChangePassword(c *gin.Context) {
+	user, ok := c.Get("user")
+	if !ok {
+		errM := model.NewAuthorization("not signed in")
+		errorResponse(c, *errM)
+		return
+	}
+
+	var req changePasswordReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.UserService.ChangePassword(ctx, user.(*model.User).UID, req.CurrentPassword, req.Password); err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Your password has been changed.",
+	})
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimit(t *testing.T) {
+	_, trustedProxy, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		path          string
+		body          gin.H
+		remoteAddr    string
+		forwardedFor  string
+		buildStubs    func(us *mocks.MockUserService, rs *mocks.MockRateLimitService)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:       "SigninLimited",
+			path:       "/signin",
+			body:       gin.H{"email": email, "password": "password"},
+			remoteAddr: "203.0.113.7:4711",
+			buildStubs: func(us *mocks.MockUserService, rs *mocks.MockRateLimitService) {
+				rs.EXPECT().Allow(gomock.Any(), model.ActionSignin, "203.0.113.7", email).Times(1).Return(model.NewTooManyRequests(30 * time.Second))
+				// no password is compared once the client is limited
+				us.EXPECT().Signin(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+				require.Equal(t, "30", recorder.Header().Get("Retry-After"))
+			},
+		},
+		{
+			name:       "ForgotPasswordLimited",
+			path:       "/password/forgot",
+			body:       gin.H{"email": email},
+			remoteAddr: "203.0.113.7:4711",
+			buildStubs: func(us *mocks.MockUserService, rs *mocks.MockRateLimitService) {
+				rs.EXPECT().Allow(gomock.Any(), model.ActionPasswordReset, "203.0.113.7", email).Times(1).Return(model.NewTooManyRequests(time.Minute))
+				us.EXPECT().RequestPasswordReset(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+				require.Equal(t, "60", recorder.Header().Get("Retry-After"))
+			},
+		},
+		{
+			name:         "ForwardedByTrustedProxy",
+			path:         "/password/forgot",
+			body:         gin.H{"email": email},
+			remoteAddr:   "10.0.0.2:4711",
+			forwardedFor: "198.51.100.1, 203.0.113.7, 10.0.0.1",
+			buildStubs: func(us *mocks.MockUserService, rs *mocks.MockRateLimitService) {
+				// the entry left of the trusted proxies is the client, anything before it could be forged
+				rs.EXPECT().Allow(gomock.Any(), model.ActionPasswordReset, "203.0.113.7", email).Times(1).Return(nil)
+				us.EXPECT().RequestPasswordReset(gomock.Any(), email).Times(1).Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:         "ForwardedByClient",
+			path:         "/password/forgot",
+			body:         gin.H{"email": email},
+			remoteAddr:   "203.0.113.7:4711",
+			forwardedFor: "198.51.100.1",
+			buildStubs: func(us *mocks.MockUserService, rs *mocks.MockRateLimitService) {
+				rs.EXPECT().Allow(gomock.Any(), model.ActionPasswordReset, "203.0.113.7", email).Times(1).Return(nil)
+				us.EXPECT().RequestPasswordReset(gomock.Any(), email).Times(1).Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:       "MFALimited",
+			path:       "/signin/mfa",
+			body:       gin.H{"challengeToken": "challenge", "code": "123456"},
+			remoteAddr: "203.0.113.7:4711",
+			buildStubs: func(us *mocks.MockUserService, rs *mocks.MockRateLimitService) {
+				// the MFAService has no expectations, so no code is checked once the client is limited
+				rs.EXPECT().Allow(gomock.Any(), model.ActionMFA, "203.0.113.7", "").Times(1).Return(model.NewTooManyRequests(time.Minute))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+				require.Equal(t, "60", recorder.Header().Get("Retry-After"))
+			},
+		},
+		{
+			name:       "GraphqlVerifyMfaLimited",
+			path:       "/graphql",
+			body:       gin.H{"query": `mutation { verifyMfa(input: {challengeToken: "challenge", code: "123456"}) { tokenPair { accessToken } } }`},
+			remoteAddr: "203.0.113.7:4711",
+			buildStubs: func(us *mocks.MockUserService, rs *mocks.MockRateLimitService) {
+				rs.EXPECT().Allow(gomock.Any(), model.ActionMFA, "203.0.113.7", "").Times(1).Return(model.NewTooManyRequests(time.Minute))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				var res graphqlResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+
+				require.Len(t, res.Errors, 1)
+				require.Equal(t, model.TooManyRequests, res.Errors[0].Extensions["code"])
+			},
+		},
+		{
+			name:       "GraphqlSignInLimited",
+			path:       "/graphql",
+			body:       gin.H{"query": `mutation { signIn(input: {email: "` + email + `", password: "password"}) { tokenPair { accessToken } } }`},
+			remoteAddr: "203.0.113.7:4711",
+			buildStubs: func(us *mocks.MockUserService, rs *mocks.MockRateLimitService) {
+				rs.EXPECT().Allow(gomock.Any(), model.ActionSignin, "203.0.113.7", email).Times(1).Return(model.NewTooManyRequests(30 * time.Second))
+				us.EXPECT().Signin(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				var res graphqlResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+
+				require.Len(t, res.Errors, 1)
+				require.Equal(t, model.TooManyRequests, res.Errors[0].Extensions["code"])
+				require.Equal(t, float64(30), res.Errors[0].Extensions["retryAfter"])
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			us := mocks.NewMockUserService(ctrl)
+			rs := mocks.NewMockRateLimitService(ctrl)
+			tc.buildStubs(us, rs)
+
+			router := gin.Default()
+			NewHandler(&Config{
+				R:                router,
+				UserService:      us,
+				TokenService:     mocks.NewMockTokenService(ctrl),
+				RateLimitService: rs,
+				MFAService:       mocks.NewMockMFAService(ctrl),
+				TrustedProxies:   []*net.IPNet{trustedProxy},
+				TimeOutDuration:  time.Duration(5 * time.Second),
+			})
+
+			body, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(http.MethodPost, tc.path, bytes.NewReader(body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			req.RemoteAddr = tc.remoteAddr
+			if tc.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tc.forwardedFor)
+			}
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			tc.checkResponse(recorder)
+		})
+	}
+}
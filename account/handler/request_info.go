@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"net"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+)
+
+// header carrying the id of a request, which is recorded with the audit events of the request
+const requestIDHeader = "X-Request-Id"
+
+// maximum length of a request id passed by the client or a proxy, longer ids are replaced
+const maxRequestIDLength = 128
+
+// requestInfo stores the client ip, user agent and request id in the request context, where they are picked up
+// by the audit log. The request id is taken from the X-Request-Id header if set and echoed in the response
+func requestInfo(trustedProxies []*net.IPNet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(requestIDHeader)
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			requestID = uuid.NewString()
+		}
+		c.Header(requestIDHeader, requestID)
+
+		info := &model.RequestInfo{
+			IP:        clientIP(c, trustedProxies),
+			UserAgent: c.Request.UserAgent(),
+			RequestID: requestID,
+		}
+		c.Request = c.Request.WithContext(model.WithRequestInfo(c.Request.Context(), info))
+
+		c.Next()
+	}
+}
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+type wsMessage struct {
+	ID      string                 `json:"id,omitempty"`
+	Type    string                 `json:"type"`
+	Payload map[string]interface{} `json:"payload,omitempty"`
+}
+
+func TestSubscriptions(t *testing.T) {
+	uid := uuid.New()
+
+	testCases := []struct {
+		name        string
+		initPayload map[string]interface{}
+		buildStubs  func(ts *mocks.MockTokenService, ues *mocks.MockUserEventService, events chan *model.UserEvent)
+		check       func(t *testing.T, conn *websocket.Conn, events chan *model.UserEvent)
+	}{
+		{
+			name:        "SessionRevoked",
+			initPayload: map[string]interface{}{"authorization": "Bearer " + randomAT},
+			buildStubs: func(ts *mocks.MockTokenService, ues *mocks.MockUserEventService, events chan *model.UserEvent) {
+				ts.EXPECT().ValidateAccessToken(randomAT).Times(1).Return(&model.User{UID: uid}, nil)
+				ues.EXPECT().Subscribe(gomock.Any(), uid).Times(1).Return((<-chan *model.UserEvent)(events))
+			},
+			check: func(t *testing.T, conn *websocket.Conn, events chan *model.UserEvent) {
+				require.Equal(t, "connection_ack", readWSMessage(t, conn).Type)
+
+				require.NoError(t, conn.WriteJSON(wsMessage{
+					ID:      "1",
+					Type:    "start",
+					Payload: map[string]interface{}{"query": "subscription { sessionRevoked { revokedAt } }"},
+				}))
+
+				// events of other types are skipped
+				events <- model.NewUserEvent(model.EventProfileUpdated, uid)
+				events <- model.NewUserEvent(model.EventSessionRevoked, uid)
+
+				msg := readWSMessage(t, conn)
+				require.Equal(t, "data", msg.Type)
+				require.Equal(t, "1", msg.ID)
+
+				data := msg.Payload["data"].(map[string]interface{})
+				require.NotEmpty(t, data["sessionRevoked"].(map[string]interface{})["revokedAt"])
+			},
+		},
+		{
+			name:        "MissingAccessToken",
+			initPayload: map[string]interface{}{},
+			buildStubs: func(ts *mocks.MockTokenService, ues *mocks.MockUserEventService, events chan *model.UserEvent) {
+				ts.EXPECT().ValidateAccessToken(gomock.Any()).Times(0)
+				ues.EXPECT().Subscribe(gomock.Any(), gomock.Any()).Times(0)
+			},
+			check: func(t *testing.T, conn *websocket.Conn, events chan *model.UserEvent) {
+				require.Equal(t, "connection_error", readWSMessage(t, conn).Type)
+			},
+		},
+		{
+			name:        "InvalidAccessToken",
+			initPayload: map[string]interface{}{"authorization": "Bearer " + randomAT},
+			buildStubs: func(ts *mocks.MockTokenService, ues *mocks.MockUserEventService, events chan *model.UserEvent) {
+				ts.EXPECT().ValidateAccessToken(randomAT).Times(1).Return(nil, model.NewAuthorization("invalid"))
+				ues.EXPECT().Subscribe(gomock.Any(), gomock.Any()).Times(0)
+			},
+			check: func(t *testing.T, conn *websocket.Conn, events chan *model.UserEvent) {
+				require.Equal(t, "connection_error", readWSMessage(t, conn).Type)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			ts := mocks.NewMockTokenService(ctrl)
+			ues := mocks.NewMockUserEventService(ctrl)
+			events := make(chan *model.UserEvent, 2)
+			tc.buildStubs(ts, ues, events)
+
+			router := gin.Default()
+			NewHandler(&Config{
+				R:                router,
+				TokenService:     ts,
+				UserEventService: ues,
+				// the socket route must not be cut off by the timeout
+				TimeOutDuration: time.Duration(time.Millisecond),
+			})
+
+			server := httptest.NewServer(router)
+			defer server.Close()
+
+			dialer := websocket.Dialer{Subprotocols: []string{"graphql-ws"}}
+			conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/graphql", nil)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			require.NoError(t, conn.WriteJSON(wsMessage{Type: "connection_init", Payload: tc.initPayload}))
+
+			tc.check(t, conn, events)
+		})
+	}
+}
+
+func TestSocketRouteRequiresWebsocket(t *testing.T) {
+	router := gin.Default()
+	NewHandler(&Config{
+		R:               router,
+		TimeOutDuration: time.Duration(5 * time.Second),
+	})
+
+	req, err := http.NewRequest(http.MethodGet, "/graphql?query={me{uid}}", nil)
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+// readWSMessage returns the next message that isn't a keep alive
+func readWSMessage(t *testing.T, conn *websocket.Conn) wsMessage {
+	for {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+
+		var msg wsMessage
+		require.NoError(t, conn.ReadJSON(&msg))
+		if msg.Type != "ka" {
+			return msg
+		}
+	}
+}
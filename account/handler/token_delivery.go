@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maxeth/go-account-api/library"
+	"github.com/maxeth/go-account-api/model"
+)
+
+// header with which clients choose how tokens are delivered, either "cookie" or "body".
+// Without it, the default of the client's origin applies
+const tokenDeliveryHeader = "X-Token-Delivery"
+
+// refreshPath is the only path the refresh token cookie is sent to
+const refreshPath = "/tokens"
+
+// useTokenCookies reports whether the refresh token of the request's client is delivered in a cookie rather than the body.
+// Clients which already hold a refresh token cookie keep using it
+func (h *Handler) useTokenCookies(c *gin.Context) bool {
+	switch c.GetHeader(tokenDeliveryHeader) {
+	case "cookie":
+		return true
+	case "body":
+		return false
+	}
+
+	if _, err := c.Cookie(model.RefreshTokenCookie); err == nil {
+		return true
+	}
+
+	origin := c.GetHeader("Origin")
+	for _, o := range h.TokenCookies.Origins {
+		if o == origin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// respondWithTokens responds with the token pair in the body, or in cookie mode with only the access token,
+// which the client keeps in memory. The refresh token is then set as an HttpOnly cookie along with a CSRF token,
+// which is returned in the body as well, since clients on other origins can't read the cookie. It only protects
+// against requests forged by other sites, so clients may store it where scripts can read it
+func (h *Handler) respondWithTokens(c *gin.Context, tokens *model.TokenPair) {
+	if !h.useTokenCookies(c) {
+		c.JSON(http.StatusOK, gin.H{
+			"tokens": tokens,
+		})
+		return
+	}
+
+	csrfToken, err := library.SecureToken(32)
+	if err != nil {
+		errM := model.NewInternal()
+		errorResponse(c, *errM)
+		return
+	}
+
+	http.SetCookie(c.Writer, refreshTokenCookie(tokens.RefreshToken, h.TokenCookies.MaxAge))
+	http.SetCookie(c.Writer, csrfCookie(csrfToken, h.TokenCookies.MaxAge))
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens":    &model.TokenPair{AccessToken: tokens.AccessToken},
+		"csrfToken": csrfToken,
+	})
+}
+
+// clearTokenCookies deletes the cookies set in cookie mode
+func clearTokenCookies(c *gin.Context) {
+	http.SetCookie(c.Writer, refreshTokenCookie("", -1))
+	http.SetCookie(c.Writer, csrfCookie("", -1))
+}
+
+// refreshTokenCookie is only sent along to refresh tokens, and never to other sites
+func refreshTokenCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     model.RefreshTokenCookie,
+		Value:    value,
+		Path:     refreshPath,
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+// csrfCookie can be read by scripts of the client's own origin, which repeat it in the X-CSRF-Token header
+func csrfCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     model.CSRFCookie,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	}
+}
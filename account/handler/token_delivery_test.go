@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/handler/middleware"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+const spaOrigin = "https://app.example.com"
+
+func TestTokenCookies(t *testing.T) {
+	user := &model.User{
+		UID:   uuid.New(),
+		Email: email,
+	}
+	tokens := &model.TokenPair{AccessToken: randomAT, RefreshToken: randomRT}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	us := mocks.NewMockUserService(ctrl)
+	ts := mocks.NewMockTokenService(ctrl)
+
+	router := gin.Default()
+	NewHandler(&Config{
+		R:               router,
+		UserService:     us,
+		TokenService:    ts,
+		TimeOutDuration: time.Duration(5 * time.Second),
+		TokenCookies: TokenCookieConfig{
+			Origins: []string{spaOrigin},
+			MaxAge:  3600,
+		},
+		Cors: CorsConfig{
+			REST: middleware.CorsPolicy{
+				AllowedOrigins:   []string{"*", spaOrigin},
+				AllowCredentials: true,
+			},
+		},
+	})
+
+	request := func(path string, body string, headers map[string]string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	responseCookies := func(res *httptest.ResponseRecorder) map[string]*http.Cookie {
+		cookies := map[string]*http.Cookie{}
+		for _, c := range res.Result().Cookies() {
+			cookies[c.Name] = c
+		}
+		return cookies
+	}
+
+	signinBody := `{"email": "` + email + `", "password": "password"}`
+
+	t.Run("BodyByDefault", func(t *testing.T) {
+		us.EXPECT().Signin(gomock.Any(), email, "password").Times(1).Return(user, nil)
+		ts.EXPECT().NewPairFromUser(gomock.Any(), user, "").Times(1).Return(tokens, nil)
+		us.EXPECT().SigninCompleted(gomock.Any(), user, model.SigninMethodPassword).Times(1)
+
+		res := request("/signin", signinBody, map[string]string{"Origin": "https://other.example.com"})
+		require.Equal(t, http.StatusOK, res.Code)
+		require.Empty(t, res.Result().Cookies())
+		require.Equal(t, "*", res.Header().Get("Access-Control-Allow-Origin"))
+		require.Empty(t, res.Header().Get("Access-Control-Allow-Credentials"))
+
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+		require.Equal(t, randomRT, body["tokens"].(map[string]interface{})["refreshToken"])
+	})
+
+	var refreshCookie, csrf *http.Cookie
+	var csrfToken string
+
+	t.Run("CookiesByOrigin", func(t *testing.T) {
+		us.EXPECT().Signin(gomock.Any(), email, "password").Times(1).Return(user, nil)
+		ts.EXPECT().NewPairFromUser(gomock.Any(), user, "").Times(1).Return(tokens, nil)
+		us.EXPECT().SigninCompleted(gomock.Any(), user, model.SigninMethodPassword).Times(1)
+
+		res := request("/signin", signinBody, map[string]string{"Origin": spaOrigin})
+		require.Equal(t, http.StatusOK, res.Code)
+		require.Equal(t, spaOrigin, res.Header().Get("Access-Control-Allow-Origin"))
+		require.Equal(t, "true", res.Header().Get("Access-Control-Allow-Credentials"))
+
+		// scripts only get the access token and the csrf token
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+		require.Equal(t, map[string]interface{}{"accessToken": randomAT}, body["tokens"])
+		csrfToken = body["csrfToken"].(string)
+		require.NotEmpty(t, csrfToken)
+
+		cookies := responseCookies(res)
+		refreshCookie = cookies[model.RefreshTokenCookie]
+		require.Equal(t, randomRT, refreshCookie.Value)
+		require.Equal(t, "/tokens", refreshCookie.Path)
+		require.Equal(t, 3600, refreshCookie.MaxAge)
+		require.True(t, refreshCookie.HttpOnly)
+		require.True(t, refreshCookie.Secure)
+		require.Equal(t, http.SameSiteStrictMode, refreshCookie.SameSite)
+
+		csrf = cookies[model.CSRFCookie]
+		require.Equal(t, csrfToken, csrf.Value)
+		require.False(t, csrf.HttpOnly)
+		require.Equal(t, http.SameSiteStrictMode, csrf.SameSite)
+	})
+
+	t.Run("CookiesByHeader", func(t *testing.T) {
+		us.EXPECT().Signin(gomock.Any(), email, "password").Times(1).Return(user, nil)
+		ts.EXPECT().NewPairFromUser(gomock.Any(), user, "").Times(1).Return(tokens, nil)
+		us.EXPECT().SigninCompleted(gomock.Any(), user, model.SigninMethodPassword).Times(1)
+
+		res := request("/signin", signinBody, map[string]string{tokenDeliveryHeader: "cookie"})
+		require.Equal(t, http.StatusOK, res.Code)
+		require.Contains(t, responseCookies(res), model.RefreshTokenCookie)
+	})
+
+	t.Run("RefreshWithoutCSRFToken", func(t *testing.T) {
+		ts.EXPECT().ValidateRefreshToken(gomock.Any()).Times(0)
+
+		res := request("/tokens", `{}`, nil, refreshCookie, csrf)
+		require.Equal(t, http.StatusForbidden, res.Code)
+
+		res = request("/tokens", `{}`, map[string]string{middleware.CSRFHeader: "forged"}, refreshCookie, csrf)
+		require.Equal(t, http.StatusForbidden, res.Code)
+	})
+
+	t.Run("RefreshWithCookie", func(t *testing.T) {
+		refreshed := &model.TokenPair{AccessToken: "at2", RefreshToken: "rt2"}
+		ts.EXPECT().ValidateRefreshToken(randomRT).Times(1).Return(&model.RefreshToken{ID: "id", UID: user.UID}, nil)
+		us.EXPECT().Get(gomock.Any(), user.UID).Times(1).Return(user, nil)
+		ts.EXPECT().NewPairFromUser(gomock.Any(), user, "id").Times(1).Return(refreshed, nil)
+
+		res := request("/tokens", `{}`, map[string]string{middleware.CSRFHeader: csrfToken}, refreshCookie, csrf)
+		require.Equal(t, http.StatusOK, res.Code)
+
+		cookies := responseCookies(res)
+		require.Equal(t, "rt2", cookies[model.RefreshTokenCookie].Value)
+		require.NotEqual(t, csrfToken, cookies[model.CSRFCookie].Value)
+	})
+
+	t.Run("RefreshWithoutToken", func(t *testing.T) {
+		res := request("/tokens", `{}`, nil)
+		require.Equal(t, http.StatusBadRequest, res.Code)
+	})
+
+	t.Run("SignoutClearsCookies", func(t *testing.T) {
+		ts.EXPECT().ValidateAccessToken(randomAT).Times(1).Return(user, nil)
+		ts.EXPECT().Signout(gomock.Any(), user.UID).Times(1).Return(nil)
+
+		res := request("/signout", ``, map[string]string{"Authorization": "Bearer " + randomAT})
+		require.Equal(t, http.StatusOK, res.Code)
+
+		cookies := responseCookies(res)
+		require.Equal(t, -1, cookies[model.RefreshTokenCookie].MaxAge)
+		require.Equal(t, "/tokens", cookies[model.RefreshTokenCookie].Path)
+		require.Equal(t, -1, cookies[model.CSRFCookie].MaxAge)
+	})
+}
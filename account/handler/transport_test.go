@@ -0,0 +1,328 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+// transportScenario describes an account operation which is run through both the REST and the GraphQL api.
+// Both transports are backed by the same service methods, so they have to produce the same results
+type transportScenario struct {
+	name        string
+	accessToken string
+	buildStubs  func(us *mocks.MockUserService, ts *mocks.MockTokenService)
+
+	restMethod string
+	restPath   string
+	restBody   gin.H
+	restResult string // key of the result in the REST response body
+
+	graphql       string
+	graphqlResult []string // path to the result in the data of the GraphQL response
+
+	wantErr     string // message of the expected error, empty if the operation succeeds
+	wantCode    string // type of the expected model.Error
+	checkResult func(t *testing.T, result map[string]interface{})
+}
+
+// transportResult is the outcome of a scenario, independent of the transport it has been run through
+type transportResult struct {
+	err    string
+	code   string
+	result map[string]interface{}
+}
+
+func TestTransportParity(t *testing.T) {
+	user := &model.User{
+		UID:      uuid.New(),
+		Email:    email,
+		Name:     "name",
+		ImageURL: "https://images.example.com/image.png",
+		Website:  "https://example.com",
+	}
+	refreshToken := &model.RefreshToken{ID: uuid.New().String(), UID: user.UID}
+	tokens := &model.TokenPair{AccessToken: randomAT, RefreshToken: randomRT}
+
+	checkUser := func(t *testing.T, result map[string]interface{}) {
+		require.Equal(t, user.UID.String(), result["uid"])
+		require.Equal(t, user.Name, result["name"])
+	}
+	checkTokens := func(t *testing.T, result map[string]interface{}) {
+		require.Equal(t, randomAT, result["accessToken"])
+		require.Equal(t, randomRT, result["refreshToken"])
+	}
+
+	scenarios := []transportScenario{
+		{
+			name: "SigninOK",
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				us.EXPECT().Signin(gomock.Any(), email, "password").Times(1).Return(user, nil)
+				ts.EXPECT().NewPairFromUser(gomock.Any(), user, "").Times(1).Return(tokens, nil)
+				us.EXPECT().SigninCompleted(gomock.Any(), user, model.SigninMethodPassword).Times(1)
+			},
+			restMethod:    http.MethodPost,
+			restPath:      "/signin",
+			restBody:      gin.H{"email": email, "password": "password"},
+			restResult:    "tokens",
+			graphql:       `mutation { signIn(input: {email: "` + email + `", password: "password"}) { tokenPair { accessToken refreshToken } } }`,
+			graphqlResult: []string{"signIn", "tokenPair"},
+			checkResult:   checkTokens,
+		},
+		{
+			name: "SigninInvalidCredentials",
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				us.EXPECT().Signin(gomock.Any(), email, "password").Times(1).Return(nil, model.NewNotFound("email", email))
+				ts.EXPECT().NewPairFromUser(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			restMethod: http.MethodPost,
+			restPath:   "/signin",
+			restBody:   gin.H{"email": email, "password": "password"},
+			graphql:    `mutation { signIn(input: {email: "` + email + `", password: "password"}) { tokenPair { accessToken } } }`,
+			wantErr:    "Invalid password or email.",
+			wantCode:   model.Authorization,
+		},
+		{
+			name: "SigninLocked",
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				us.EXPECT().Signin(gomock.Any(), email, "password").Times(1).Return(nil, model.NewAccountLocked(time.Hour))
+				ts.EXPECT().NewPairFromUser(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			restMethod: http.MethodPost,
+			restPath:   "/signin",
+			restBody:   gin.H{"email": email, "password": "password"},
+			graphql:    `mutation { signIn(input: {email: "` + email + `", password: "password"}) { tokenPair { accessToken } } }`,
+			wantErr:    model.NewAccountLocked(time.Hour).Message,
+			wantCode:   model.TooManyRequests,
+		},
+		{
+			name: "RefreshTokensOK",
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				ts.EXPECT().ValidateRefreshToken(randomRT).Times(1).Return(refreshToken, nil)
+				us.EXPECT().Get(gomock.Any(), user.UID).Times(1).Return(user, nil)
+				ts.EXPECT().NewPairFromUser(gomock.Any(), user, refreshToken.ID).Times(1).Return(tokens, nil)
+			},
+			restMethod:    http.MethodPost,
+			restPath:      "/tokens",
+			restBody:      gin.H{"refreshToken": randomRT},
+			restResult:    "tokens",
+			graphql:       `mutation { refreshTokens(input: {refreshToken: "` + randomRT + `"}) { tokenPair { accessToken refreshToken } } }`,
+			graphqlResult: []string{"refreshTokens", "tokenPair"},
+			checkResult:   checkTokens,
+		},
+		{
+			name: "RefreshTokensSuspended",
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				suspended := *user
+				suspended.Status = model.StatusSuspended
+
+				ts.EXPECT().ValidateRefreshToken(randomRT).Times(1).Return(refreshToken, nil)
+				us.EXPECT().Get(gomock.Any(), user.UID).Times(1).Return(&suspended, nil)
+				ts.EXPECT().NewPairFromUser(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			restMethod: http.MethodPost,
+			restPath:   "/tokens",
+			restBody:   gin.H{"refreshToken": randomRT},
+			graphql:    `mutation { refreshTokens(input: {refreshToken: "` + randomRT + `"}) { tokenPair { accessToken } } }`,
+			wantErr:    "Account has been suspended.",
+			wantCode:   model.Forbidden,
+		},
+		{
+			name:        "SignoutOK",
+			accessToken: randomAT,
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				ts.EXPECT().ValidateAccessToken(randomAT).Times(1).Return(user, nil)
+				ts.EXPECT().Signout(gomock.Any(), user.UID).Times(1).Return(nil)
+			},
+			restMethod: http.MethodPost,
+			restPath:   "/signout",
+			graphql:    `mutation { signOut }`,
+		},
+		{
+			name: "SignoutUnauthenticated",
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				ts.EXPECT().Signout(gomock.Any(), gomock.Any()).Times(0)
+			},
+			restMethod: http.MethodPost,
+			restPath:   "/signout",
+			graphql:    `mutation { signOut }`,
+			wantErr:    "Must provide Authorization header with format `Bearer {token}`",
+			wantCode:   model.Authorization,
+		},
+		{
+			name:        "UpdateDetailsOK",
+			accessToken: randomAT,
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				ts.EXPECT().ValidateAccessToken(randomAT).Times(1).Return(user, nil)
+				us.EXPECT().UpdateDetails(gomock.Any(), user.UID, user.Name, user.Website).Times(1).Return(user, nil)
+			},
+			restMethod:    http.MethodPut,
+			restPath:      "/details",
+			restBody:      gin.H{"name": user.Name, "website": user.Website},
+			restResult:    "user",
+			graphql:       `mutation { updateDetails(input: {name: "` + user.Name + `", website: "` + user.Website + `"}) { user { uid name } } }`,
+			graphqlResult: []string{"updateDetails", "user"},
+			checkResult:   checkUser,
+		},
+		{
+			name:        "DeleteImageOK",
+			accessToken: randomAT,
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				ts.EXPECT().ValidateAccessToken(randomAT).Times(1).Return(user, nil)
+				us.EXPECT().ClearProfileImage(gomock.Any(), user.UID).Times(1).Return(user, nil)
+			},
+			restMethod:    http.MethodDelete,
+			restPath:      "/image",
+			restResult:    "user",
+			graphql:       `mutation { deleteImage { user { uid name } } }`,
+			graphqlResult: []string{"deleteImage", "user"},
+			checkResult:   checkUser,
+		},
+		{
+			name:        "ChangePasswordWrongCurrent",
+			accessToken: randomAT,
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				ts.EXPECT().ValidateAccessToken(randomAT).Times(1).Return(user, nil)
+				us.EXPECT().ChangePassword(gomock.Any(), user.UID, "wrong", "new password").Times(1).Return(model.NewAuthorization("Invalid password."))
+			},
+			restMethod: http.MethodPut,
+			restPath:   "/me/password",
+			restBody:   gin.H{"currentPassword": "wrong", "password": "new password"},
+			graphql:    `mutation { changePassword(input: {currentPassword: "wrong", password: "new password"}) { user { uid } } }`,
+			wantErr:    "Invalid password.",
+			wantCode:   model.Authorization,
+		},
+		{
+			name:        "Me",
+			accessToken: randomAT,
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+				ts.EXPECT().ValidateAccessToken(randomAT).Times(1).Return(user, nil)
+				// REST loads the user directly, GraphQL through the user loader
+				us.EXPECT().Get(gomock.Any(), user.UID).MaxTimes(1).Return(user, nil)
+				us.EXPECT().GetMany(gomock.Any(), []uuid.UUID{user.UID}).MaxTimes(1).Return([]*model.User{user}, nil)
+			},
+			restMethod:    http.MethodGet,
+			restPath:      "/me",
+			restResult:    "user",
+			graphql:       `{ me { uid name } }`,
+			graphqlResult: []string{"me"},
+			checkResult:   checkUser,
+		},
+	}
+
+	transports := []struct {
+		name string
+		run  func(t *testing.T, router *gin.Engine, s transportScenario) transportResult
+	}{
+		{name: "REST", run: runREST},
+		{name: "GraphQL", run: runGraphQL},
+	}
+
+	for i := range scenarios {
+		s := scenarios[i]
+
+		for _, transport := range transports {
+			run := transport.run
+
+			t.Run(transport.name+"/"+s.name, func(t *testing.T) {
+				ctrl := gomock.NewController(t)
+				defer ctrl.Finish()
+
+				us := mocks.NewMockUserService(ctrl)
+				ts := mocks.NewMockTokenService(ctrl)
+				s.buildStubs(us, ts)
+
+				router := gin.Default()
+				NewHandler(&Config{
+					R:               router,
+					UserService:     us,
+					TokenService:    ts,
+					TimeOutDuration: time.Duration(5 * time.Second),
+				})
+
+				res := run(t, router, s)
+
+				require.Equal(t, s.wantErr, res.err)
+				require.Equal(t, s.wantCode, res.code)
+				if s.checkResult != nil {
+					s.checkResult(t, res.result)
+				}
+			})
+		}
+	}
+}
+
+func runREST(t *testing.T, router *gin.Engine, s transportScenario) transportResult {
+	var body []byte
+	if s.restBody != nil {
+		var err error
+		body, err = json.Marshal(s.restBody)
+		require.NoError(t, err)
+	}
+
+	res := serve(t, router, s.restMethod, s.restPath, body, s.accessToken)
+
+	var resBody map[string]interface{}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resBody))
+
+	if res.Code >= http.StatusBadRequest {
+		e, _ := resBody["error"].(map[string]interface{})
+		return transportResult{err: e["message"].(string), code: e["type"].(string)}
+	}
+
+	result, _ := resBody[s.restResult].(map[string]interface{})
+	return transportResult{result: result}
+}
+
+func runGraphQL(t *testing.T, router *gin.Engine, s transportScenario) transportResult {
+	body, err := json.Marshal(gin.H{"query": s.graphql})
+	require.NoError(t, err)
+
+	res := serve(t, router, http.MethodPost, "/graphql", body, s.accessToken)
+
+	var resBody struct {
+		Data   map[string]interface{} `json:"data"`
+		Errors []struct {
+			Message    string `json:"message"`
+			Extensions struct {
+				Code string `json:"code"`
+			} `json:"extensions"`
+		} `json:"errors"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resBody))
+
+	if len(resBody.Errors) > 0 {
+		return transportResult{err: resBody.Errors[0].Message, code: resBody.Errors[0].Extensions.Code}
+	}
+
+	result := resBody.Data
+	for _, key := range s.graphqlResult {
+		result, _ = result[key].(map[string]interface{})
+	}
+	return transportResult{result: result}
+}
+
+func serve(t *testing.T, router *gin.Engine, method, path string, body []byte, accessToken string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, path, bytes.NewReader(body))
+	require.NoError(t, err)
+
+	req.Header.Set("Content-Type", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	return recorder
+}
@@ -33,9 +33,10 @@ func (h *Handler) Me(c *gin.Context) {
 	})
 }
 
+// the password is checked against the password policy by the UserService
 type signupReq struct {
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,gte=6,lte=30"` // 6 <= password <= 30
+	Password string `json:"password" binding:"required"`
 }
 
 func (h *Handler) Signup(c *gin.Context) {
@@ -48,6 +49,10 @@ func (h *Handler) Signup(c *gin.Context) {
 		return
 	}
 
+	if ok := h.rateLimit(c, model.ActionSignup, req.Email); !ok {
+		return
+	}
+
 	ctx := c.Request.Context()
 	// will create a user with email and a password. rest of the fields will remain empty strings
 	user, err := h.UserService.Signup(ctx, req.Email, req.Password)
@@ -62,14 +67,12 @@ func (h *Handler) Signup(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"tokens": tokenPair,
-	})
+	h.respondWithTokens(c, tokenPair)
 }
 
 type signinReq struct {
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,gte=6,lte=30"` // 6 <= password <= 30
+	Password string `json:"password" binding:"required"`
 }
 
 func (h *Handler) Signin(c *gin.Context) {
@@ -78,13 +81,46 @@ func (h *Handler) Signin(c *gin.Context) {
 		return
 	}
 
+	if ok := h.rateLimit(c, model.ActionSignin, req.Email); !ok {
+		return
+	}
+
 	// extract the "actual" http context as this is the context we want to pass down the callchain in every handler, not the gin context
 	ctx := c.Request.Context()
 
 	user, err := h.UserService.Signin(ctx, req.Email, req.Password)
 	if err != nil {
+		// suspended and locked out users get to know why they can't sign in, anything else is reported as invalid credentials
+		if status := model.Status(err); status == http.StatusForbidden || status == http.StatusTooManyRequests {
+			basicErrorResponse(c, model.Status(err), err)
+			return
+		}
 		errM := model.NewAuthorization("Invalid password or email.")
 		errorResponse(c, *errM)
+		return
+	}
+
+	h.completeSignin(c, user, model.SigninMethodPassword)
+}
+
+// completeSignin responds with a token pair for the user who proved to own the account, or with
+// an MFA challenge if the account has 2FA enabled. Tokens are only issued once the challenge has been completed with VerifyMFA,
+// the sign in is recorded with method when they are
+func (h *Handler) completeSignin(c *gin.Context, user *model.User, method string) {
+	ctx := c.Request.Context()
+
+	if h.MFAService != nil {
+		challenge, err := h.MFAService.Challenge(ctx, user)
+		if err != nil {
+			basicErrorResponse(c, model.Status(err), err)
+			return
+		}
+		if challenge != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"mfaChallenge": challenge,
+			})
+			return
+		}
 	}
 
 	tokens, err := h.TokenService.NewPairFromUser(ctx, user, "")
@@ -92,25 +128,86 @@ func (h *Handler) Signin(c *gin.Context) {
 		log.Printf("Failed to create tokens when signing in user: %v\n", err.Error())
 		errM := model.NewInternal()
 		errorResponse(c, *errM)
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"tokens": tokens,
-	})
+	h.UserService.SigninCompleted(ctx, user, method)
+	h.respondWithTokens(c, tokens)
 }
 
-// Signout handler
+// Signout handler revokes all refresh tokens of the user and deletes the token cookies. Access tokens stay valid until they expire
 func (h *Handler) Signout(c *gin.Context) {
+	user, ok := c.Get("user")
+	if !ok {
+		errM := model.NewAuthorization("not signed in")
+		errorResponse(c, *errM)
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.TokenService.Signout(ctx, user.(*model.User).UID); err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	clearTokenCookies(c)
+
 	c.JSON(http.StatusOK, gin.H{
-		"hello": "it's signout",
+		"message": "Signed out successfully.",
 	})
 }
 
-// Tokens handler
+// the refresh token is read from the cookie in cookie mode
+type tokensReq struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// Tokens handler exchanges a refresh token for a new token pair. Each refresh token can only be used once
 func (h *Handler) Tokens(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"hello": "it's tokens",
-	})
+	var req tokensReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	if ok := h.rateLimit(c, model.ActionTokenRefresh, ""); !ok {
+		return
+	}
+
+	if req.RefreshToken == "" {
+		req.RefreshToken, _ = c.Cookie(model.RefreshTokenCookie)
+	}
+	if req.RefreshToken == "" {
+		errM := model.NewBadRequest("Expected the refresh token in the body or in the refresh token cookie.")
+		errorResponse(c, *errM)
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	refreshToken, err := h.TokenService.ValidateRefreshToken(req.RefreshToken)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	user, err := h.UserService.Get(ctx, refreshToken.UID)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	if err := user.CheckActive(); err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	tokens, err := h.TokenService.NewPairFromUser(ctx, user, refreshToken.ID)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	h.respondWithTokens(c, tokens)
 }
 
 // Image handler
@@ -120,16 +217,54 @@ func (h *Handler) Image(c *gin.Context) {
 	})
 }
 
-// DeleteImage handler
+// DeleteImage handler removes the profile image of the user
 func (h *Handler) DeleteImage(c *gin.Context) {
+	user, ok := c.Get("user")
+	if !ok {
+		errM := model.NewAuthorization("not signed in")
+		errorResponse(c, *errM)
+		return
+	}
+
+	ctx := c.Request.Context()
+	u, err := h.UserService.ClearProfileImage(ctx, user.(*model.User).UID)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"hello": "it's deleteImage",
+		"user": u,
 	})
 }
 
-// Details handler
+type detailsReq struct {
+	Name    string `json:"name" binding:"omitempty,max=50"`
+	Website string `json:"website" binding:"omitempty,url"`
+}
+
+// Details handler updates the name and website of the user
 func (h *Handler) Details(c *gin.Context) {
+	user, ok := c.Get("user")
+	if !ok {
+		errM := model.NewAuthorization("not signed in")
+		errorResponse(c, *errM)
+		return
+	}
+
+	var req detailsReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	u, err := h.UserService.UpdateDetails(ctx, user.(*model.User).UID, req.Name, req.Website)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"hello": "it's details",
+		"user": u,
 	})
 }
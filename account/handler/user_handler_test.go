@@ -69,7 +69,9 @@ func TestSignup(t *testing.T) {
 				"password": "123", // too short
 			},
 			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
-				us.EXPECT().Signup(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				// the password policy is checked by the service
+				us.EXPECT().Signup(gomock.Any(), email, "123").Times(1).
+					Return(nil, model.NewInvalidArguments([]model.InvalidArgument{{Field: "password", Tag: model.PasswordRuleMinLength}}))
 				ts.EXPECT().NewPairFromUser(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
 			},
 			checkResponse: func(resRec *httptest.ResponseRecorder) {
@@ -78,7 +80,7 @@ func TestSignup(t *testing.T) {
 					Error: model.Error{
 						Type: "BAD_REQUEST",
 					},
-					InvalidArgs: []InvalidArgument{{Field: "Password", Tag: "gte"}},
+					InvalidArgs: []InvalidArgument{{Field: "password", Tag: model.PasswordRuleMinLength}},
 				}
 				requireErrorResponseMatch(t, resRec.Body, *expectedIRR)
 			},
@@ -145,7 +147,7 @@ func TestSignup(t *testing.T) {
 
 			recorder := httptest.NewRecorder()
 
-			url := "/account/signup"
+			url := "/signup"
 
 			body, err := json.Marshal(tc.body)
 			//fmt.Println("passing body: ", string(body))
@@ -185,7 +187,7 @@ func TestSignin(t *testing.T) {
 					Password: pw,
 				}
 				us.EXPECT().
-					Signup(gomock.Any(), email, pw).
+					Signin(gomock.Any(), email, pw).
 					Times(1).Return(u, nil)
 
 				tp := &model.TokenPair{
@@ -193,6 +195,7 @@ func TestSignin(t *testing.T) {
 					RefreshToken: randomRT,
 				}
 				ts.EXPECT().NewPairFromUser(gomock.Any(), gomock.Eq(u), "").Times(1).Return(tp, nil)
+				us.EXPECT().SigninCompleted(gomock.Any(), u, model.SigninMethodPassword).Times(1)
 			},
 			checkResponse: func(resRec *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, resRec.Code)
@@ -210,18 +213,12 @@ func TestSignin(t *testing.T) {
 				"password": "123", // too short
 			},
 			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
-				us.EXPECT().Signup(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				// passwords set before the password policy changed still have to work, so sign in doesn't check them
+				us.EXPECT().Signin(gomock.Any(), email, "123").Times(1).Return(nil, model.NewAuthorization("password and email do not match"))
 				ts.EXPECT().NewPairFromUser(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
 			},
 			checkResponse: func(resRec *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusBadRequest, resRec.Code)
-				expectedIRR := &InvalidRequestResponse{
-					Error: model.Error{
-						Type: "BAD_REQUEST",
-					},
-					InvalidArgs: []InvalidArgument{{Field: "Password", Tag: "gte"}},
-				}
-				requireErrorResponseMatch(t, resRec.Body, *expectedIRR)
+				require.Equal(t, http.StatusUnauthorized, resRec.Code)
 			},
 		},
 		{
@@ -230,7 +227,7 @@ func TestSignin(t *testing.T) {
 				"email": email,
 			},
 			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
-				us.EXPECT().Signup(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				us.EXPECT().Signin(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
 				ts.EXPECT().NewPairFromUser(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
 			},
 			checkResponse: func(resRec *httptest.ResponseRecorder) {
@@ -248,7 +245,7 @@ func TestSignin(t *testing.T) {
 			name: "EmptyRequestBody",
 			body: gin.H{},
 			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
-				us.EXPECT().Signup(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				us.EXPECT().Signin(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
 				ts.EXPECT().NewPairFromUser(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
 			},
 			checkResponse: func(resRec *httptest.ResponseRecorder) {
@@ -286,7 +283,7 @@ func TestSignin(t *testing.T) {
 
 			recorder := httptest.NewRecorder()
 
-			url := "/account/signup"
+			url := "/signin"
 
 			body, err := json.Marshal(tc.body)
 			//fmt.Println("passing body: ", string(body))
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+)
+
+// BeginWebAuthnRegistration returns the options to pass to navigator.credentials.create to register a new passkey
+func (h *Handler) BeginWebAuthnRegistration(c *gin.Context) {
+	user, ok := c.Get("user")
+	if !ok {
+		errM := model.NewAuthorization("not signed in")
+		errorResponse(c, *errM)
+		return
+	}
+
+	options, err := h.WebAuthnService.BeginRegistration(c.Request.Context(), user.(*model.User))
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"options": options,
+	})
+}
+
+type finishWebAuthnRegistrationReq struct {
+	Nickname   string                    `json:"nickname" binding:"lte=50"`
+	Credential model.WebAuthnAttestation `json:"credential" binding:"required"`
+}
+
+// FinishWebAuthnRegistration stores the passkey created with the options of BeginWebAuthnRegistration.
+// The response holds new recovery codes unless the user still has unused ones, they are only shown once
+func (h *Handler) FinishWebAuthnRegistration(c *gin.Context) {
+	user, ok := c.Get("user")
+	if !ok {
+		errM := model.NewAuthorization("not signed in")
+		errorResponse(c, *errM)
+		return
+	}
+
+	var req finishWebAuthnRegistrationReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	cred, codes, err := h.WebAuthnService.FinishRegistration(c.Request.Context(), user.(*model.User), req.Nickname, &req.Credential)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"credential":    cred,
+		"recoveryCodes": codes,
+	})
+}
+
+// ListWebAuthnCredentials returns the passkeys of the signed in user
+func (h *Handler) ListWebAuthnCredentials(c *gin.Context) {
+	user, ok := c.Get("user")
+	if !ok {
+		errM := model.NewAuthorization("not signed in")
+		errorResponse(c, *errM)
+		return
+	}
+
+	creds, err := h.WebAuthnService.ListCredentials(c.Request.Context(), user.(*model.User).UID)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"credentials": creds,
+	})
+}
+
+// DeleteWebAuthnCredential removes a passkey of the signed in user
+func (h *Handler) DeleteWebAuthnCredential(c *gin.Context) {
+	user, ok := c.Get("user")
+	if !ok {
+		errM := model.NewAuthorization("not signed in")
+		errorResponse(c, *errM)
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		errM := model.NewBadRequest("Expected the credential id as uuid.")
+		errorResponse(c, *errM)
+		return
+	}
+
+	if err := h.WebAuthnService.DeleteCredential(c.Request.Context(), user.(*model.User).UID, id); err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "The passkey has been removed.",
+	})
+}
+
+// BeginWebAuthnLogin returns the options to pass to navigator.credentials.get for a passwordless sign in
+func (h *Handler) BeginWebAuthnLogin(c *gin.Context) {
+	if ok := h.rateLimit(c, model.ActionSignin, ""); !ok {
+		return
+	}
+
+	options, err := h.WebAuthnService.BeginLogin(c.Request.Context())
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"options": options,
+	})
+}
+
+type webAuthnAssertionReq struct {
+	Credential model.WebAuthnAssertion `json:"credential" binding:"required"`
+}
+
+// FinishWebAuthnLogin signs the user in with the passkey response to the options of BeginWebAuthnLogin.
+// Passkeys verify the user themselves, so no second factor is required
+func (h *Handler) FinishWebAuthnLogin(c *gin.Context) {
+	var req webAuthnAssertionReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	user, err := h.WebAuthnService.FinishLogin(ctx, &req.Credential)
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	tokens, err := h.TokenService.NewPairFromUser(ctx, user, "")
+	if err != nil {
+		basicErrorResponse(c, model.Status(err), err)
+		return
+	}
+
+	h.UserService.SigninCompleted(ctx, user, model.SigninMethodPasskey)
+	h.respondWithTokens(c, tokens)
+}
@@ -0,0 +1,294 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebAuthnCredentials(t *testing.T) {
+	user := &model.User{
+		UID:   uuid.New(),
+		Email: email,
+	}
+	cred := &model.WebAuthnCredential{
+		ID:         uuid.New(),
+		UID:        user.UID,
+		Transports: model.Transports{"usb"},
+		Nickname:   "security key",
+		CreatedAt:  time.Now(),
+	}
+
+	// the scenarios are run through both transports, with a WebAuthnService on top of the services of the parity tests
+	scenarios := []struct {
+		transportScenario
+		buildWebAuthnStubs func(ws *mocks.MockWebAuthnService)
+	}{
+		{
+			transportScenario: transportScenario{
+				name:        "List",
+				accessToken: randomAT,
+				buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+					ts.EXPECT().ValidateAccessToken(randomAT).Times(1).Return(user, nil)
+				},
+				restMethod: http.MethodGet,
+				restPath:   "/me/webauthn/credentials",
+				graphql:    `{ webAuthnCredentials { id nickname transports } }`,
+			},
+			buildWebAuthnStubs: func(ws *mocks.MockWebAuthnService) {
+				ws.EXPECT().ListCredentials(gomock.Any(), user.UID).Times(1).Return([]*model.WebAuthnCredential{cred}, nil)
+			},
+		},
+		{
+			transportScenario: transportScenario{
+				name:        "Delete",
+				accessToken: randomAT,
+				buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+					ts.EXPECT().ValidateAccessToken(randomAT).Times(1).Return(user, nil)
+				},
+				restMethod: http.MethodDelete,
+				restPath:   "/me/webauthn/credentials/" + cred.ID.String(),
+				graphql:    `mutation { deleteWebAuthnCredential(id: "` + cred.ID.String() + `") }`,
+			},
+			buildWebAuthnStubs: func(ws *mocks.MockWebAuthnService) {
+				ws.EXPECT().DeleteCredential(gomock.Any(), user.UID, cred.ID).Times(1).Return(nil)
+			},
+		},
+		{
+			transportScenario: transportScenario{
+				name:        "DeleteNotFound",
+				accessToken: randomAT,
+				buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService) {
+					ts.EXPECT().ValidateAccessToken(randomAT).Times(1).Return(user, nil)
+				},
+				restMethod: http.MethodDelete,
+				restPath:   "/me/webauthn/credentials/" + cred.ID.String(),
+				graphql:    `mutation { deleteWebAuthnCredential(id: "` + cred.ID.String() + `") }`,
+				wantErr:    model.NewNotFound("id", cred.ID.String()).Message,
+				wantCode:   model.NotFound,
+			},
+			buildWebAuthnStubs: func(ws *mocks.MockWebAuthnService) {
+				ws.EXPECT().DeleteCredential(gomock.Any(), user.UID, cred.ID).Times(1).Return(model.NewNotFound("id", cred.ID.String()))
+			},
+		},
+	}
+
+	transports := []struct {
+		name string
+		run  func(t *testing.T, router *gin.Engine, s transportScenario) transportResult
+	}{
+		{name: "REST", run: runREST},
+		{name: "GraphQL", run: runGraphQL},
+	}
+
+	for i := range scenarios {
+		s := scenarios[i]
+
+		for _, transport := range transports {
+			run := transport.run
+
+			t.Run(transport.name+"/"+s.name, func(t *testing.T) {
+				ctrl := gomock.NewController(t)
+				defer ctrl.Finish()
+
+				us := mocks.NewMockUserService(ctrl)
+				ts := mocks.NewMockTokenService(ctrl)
+				ws := mocks.NewMockWebAuthnService(ctrl)
+				s.buildStubs(us, ts)
+				s.buildWebAuthnStubs(ws)
+
+				router := gin.Default()
+				NewHandler(&Config{
+					R:               router,
+					UserService:     us,
+					TokenService:    ts,
+					WebAuthnService: ws,
+					TimeOutDuration: time.Duration(5 * time.Second),
+				})
+
+				res := run(t, router, s.transportScenario)
+
+				require.Equal(t, s.wantErr, res.err)
+				require.Equal(t, s.wantCode, res.code)
+			})
+		}
+	}
+}
+
+func TestWebAuthnCeremonies(t *testing.T) {
+	user := &model.User{
+		UID:   uuid.New(),
+		Email: email,
+	}
+	tokens := &model.TokenPair{AccessToken: randomAT, RefreshToken: randomRT}
+	assertion := gin.H{
+		"id":                "Y3JlZGVudGlhbA",
+		"clientDataJSON":    "e30",
+		"authenticatorData": "YXV0aERhdGE",
+		"signature":         "c2lnbmF0dXJl",
+	}
+
+	testCases := []struct {
+		name          string
+		method        string
+		path          string
+		body          gin.H
+		accessToken   string
+		buildStubs    func(us *mocks.MockUserService, ts *mocks.MockTokenService, ws *mocks.MockWebAuthnService, ms *mocks.MockMFAService)
+		checkResponse func(t *testing.T, code int, body map[string]interface{})
+	}{
+		{
+			name:        "BeginRegistration",
+			method:      http.MethodPost,
+			path:        "/me/webauthn/register/begin",
+			accessToken: randomAT,
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService, ws *mocks.MockWebAuthnService, ms *mocks.MockMFAService) {
+				ts.EXPECT().ValidateAccessToken(randomAT).Times(1).Return(user, nil)
+				ws.EXPECT().BeginRegistration(gomock.Any(), user).Times(1).Return(&model.WebAuthnCreationOptions{Challenge: "challenge"}, nil)
+			},
+			checkResponse: func(t *testing.T, code int, body map[string]interface{}) {
+				require.Equal(t, http.StatusOK, code)
+				require.Equal(t, "challenge", body["options"].(map[string]interface{})["challenge"])
+			},
+		},
+		{
+			name:        "FinishRegistration",
+			method:      http.MethodPost,
+			path:        "/me/webauthn/register/finish",
+			accessToken: randomAT,
+			body: gin.H{
+				"nickname": "laptop",
+				"credential": gin.H{
+					"id":                "Y3JlZGVudGlhbA",
+					"clientDataJSON":    "e30",
+					"attestationObject": "b2JqZWN0",
+					"transports":        []string{"internal"},
+				},
+			},
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService, ws *mocks.MockWebAuthnService, ms *mocks.MockMFAService) {
+				ts.EXPECT().ValidateAccessToken(randomAT).Times(1).Return(user, nil)
+				att := &model.WebAuthnAttestation{ID: "Y3JlZGVudGlhbA", ClientDataJSON: "e30", AttestationObject: "b2JqZWN0", Transports: []string{"internal"}}
+				ws.EXPECT().FinishRegistration(gomock.Any(), user, "laptop", att).Times(1).Return(&model.WebAuthnCredential{Nickname: "laptop"}, []string{"0a1b2-c3d4e"}, nil)
+			},
+			checkResponse: func(t *testing.T, code int, body map[string]interface{}) {
+				require.Equal(t, http.StatusOK, code)
+				require.Equal(t, "laptop", body["credential"].(map[string]interface{})["nickname"])
+				require.Equal(t, []interface{}{"0a1b2-c3d4e"}, body["recoveryCodes"])
+			},
+		},
+		{
+			name:   "FinishRegistrationSignedOut",
+			method: http.MethodPost,
+			path:   "/me/webauthn/register/finish",
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService, ws *mocks.MockWebAuthnService, ms *mocks.MockMFAService) {
+				ws.EXPECT().FinishRegistration(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, code int, body map[string]interface{}) {
+				require.Equal(t, http.StatusUnauthorized, code)
+			},
+		},
+		{
+			name:   "PasswordlessLogin",
+			method: http.MethodPost,
+			path:   "/signin/webauthn/finish",
+			body:   gin.H{"credential": assertion},
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService, ws *mocks.MockWebAuthnService, ms *mocks.MockMFAService) {
+				ws.EXPECT().FinishLogin(gomock.Any(), gomock.Any()).Times(1).Return(user, nil)
+				ts.EXPECT().NewPairFromUser(gomock.Any(), user, "").Times(1).Return(tokens, nil)
+				us.EXPECT().SigninCompleted(gomock.Any(), user, model.SigninMethodPasskey).Times(1)
+				// passkeys replace the second factor
+				ms.EXPECT().Challenge(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, code int, body map[string]interface{}) {
+				require.Equal(t, http.StatusOK, code)
+				require.Equal(t, randomAT, body["tokens"].(map[string]interface{})["accessToken"])
+			},
+		},
+		{
+			name:   "PasswordlessLoginInvalidAssertion",
+			method: http.MethodPost,
+			path:   "/signin/webauthn/finish",
+			body:   gin.H{"credential": gin.H{"id": "Y3JlZGVudGlhbA"}},
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService, ws *mocks.MockWebAuthnService, ms *mocks.MockMFAService) {
+				ws.EXPECT().FinishLogin(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, code int, body map[string]interface{}) {
+				require.Equal(t, http.StatusBadRequest, code)
+			},
+		},
+		{
+			name:   "SecondFactor",
+			method: http.MethodPost,
+			path:   "/signin/mfa/webauthn/finish",
+			body:   gin.H{"challengeToken": "challenge", "credential": assertion},
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService, ws *mocks.MockWebAuthnService, ms *mocks.MockMFAService) {
+				ms.EXPECT().VerifyWebAuthn(gomock.Any(), "challenge", gomock.Any()).Times(1).Return(user, nil)
+				ts.EXPECT().NewPairFromUser(gomock.Any(), user, "").Times(1).Return(tokens, nil)
+				us.EXPECT().SigninCompleted(gomock.Any(), user, model.MFAMethodWebAuthn).Times(1)
+			},
+			checkResponse: func(t *testing.T, code int, body map[string]interface{}) {
+				require.Equal(t, http.StatusOK, code)
+				require.Equal(t, randomAT, body["tokens"].(map[string]interface{})["accessToken"])
+			},
+		},
+		{
+			name:   "SecondFactorRejected",
+			method: http.MethodPost,
+			path:   "/signin/mfa/webauthn/finish",
+			body:   gin.H{"challengeToken": "challenge", "credential": assertion},
+			buildStubs: func(us *mocks.MockUserService, ts *mocks.MockTokenService, ws *mocks.MockWebAuthnService, ms *mocks.MockMFAService) {
+				ms.EXPECT().VerifyWebAuthn(gomock.Any(), "challenge", gomock.Any()).Times(1).Return(nil, model.NewAuthorization("The passkey could not be verified."))
+				ts.EXPECT().NewPairFromUser(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, code int, body map[string]interface{}) {
+				require.Equal(t, http.StatusUnauthorized, code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			us := mocks.NewMockUserService(ctrl)
+			ts := mocks.NewMockTokenService(ctrl)
+			ws := mocks.NewMockWebAuthnService(ctrl)
+			ms := mocks.NewMockMFAService(ctrl)
+			tc.buildStubs(us, ts, ws, ms)
+
+			router := gin.Default()
+			NewHandler(&Config{
+				R:               router,
+				UserService:     us,
+				TokenService:    ts,
+				MFAService:      ms,
+				WebAuthnService: ws,
+				TimeOutDuration: time.Duration(5 * time.Second),
+			})
+
+			var body []byte
+			if tc.body != nil {
+				var err error
+				body, err = json.Marshal(tc.body)
+				require.NoError(t, err)
+			}
+
+			res := serve(t, router, tc.method, tc.path, body, tc.accessToken)
+
+			var resBody map[string]interface{}
+			require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resBody))
+			tc.checkResponse(t, res.Code, resBody)
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/repository"
+	"github.com/maxeth/go-account-api/service"
+)
+
+// importUsers runs the import-users command, which imports the users of a csv or jsonl file with their password hashes:
+//
+//	account import-users -format csv users.csv
+//
+// The file is read from stdin if it is omitted or -. The result is printed as json
+func importUsers(args []string) error {
+	flags := flag.NewFlagSet("import-users", flag.ExitOnError)
+	format := flags.String("format", model.ImportFormatJSONL, "format of the file, csv or jsonl")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var in io.Reader = os.Stdin
+	if path := flags.Arg(0); path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("could not open import file: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	ds, err := initDS()
+	if err != nil {
+		return fmt.Errorf("couldnt connect to db: %w", err)
+	}
+	defer ds.close()
+
+	adminService := service.NewAdminService(&service.AdminServiceConfig{
+		UserRepository: repository.NewUserRepository(ds.DB),
+	})
+
+	result, err := adminService.ImportUsers(context.Background(), *format, in)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
@@ -1,16 +1,22 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 	"github.com/maxeth/go-account-api/handler"
+	"github.com/maxeth/go-account-api/handler/middleware"
+	"github.com/maxeth/go-account-api/model"
 	"github.com/maxeth/go-account-api/repository"
 	"github.com/maxeth/go-account-api/service"
 )
@@ -19,12 +25,276 @@ import (
 // which inject into repository layer
 // which inject into service layer
 // which inject into handler layer
-func inject(d *dataSources) (*gin.Engine, error) {
+// background jobs are started with ctx and stop once it is cancelled
+func inject(ctx context.Context, d *dataSources) (*gin.Engine, error) {
 	log.Println("Injecting data sources")
 
+	// load the smtp config for the mailer, if SMTP_HOST is empty mails are only logged
+	mailer := repository.NewMailer(&repository.SMTPMailerConfig{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USER"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("MAIL_FROM"),
+	})
+
+	emailTokenExp := os.Getenv("EMAIL_TOKEN_EXP")
+	emailTokenExpSecs, err := strconv.ParseInt(emailTokenExp, 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("could parse email token exp: %w", err)
+	}
+
+	// load how long sign in links stay valid, and whether they can create accounts without a password, off unless set
+	magicLinkExp := os.Getenv("MAGIC_LINK_EXP")
+	magicLinkExpSecs, err := strconv.ParseInt(magicLinkExp, 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("could parse magic link exp: %w", err)
+	}
+	passwordlessSignup, err := optionalBool(os.Getenv("PASSWORDLESS_SIGNUP"))
+	if err != nil {
+		return nil, fmt.Errorf("could parse passwordless signup: %w", err)
+	}
+
+	// load how long deleted accounts can be restored, and how often accounts past that period are purged
+	deletionGracePeriod := os.Getenv("DELETION_GRACE_PERIOD")
+	deletionGracePeriodSecs, err := strconv.ParseInt(deletionGracePeriod, 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("could parse deletion grace period: %w", err)
+	}
+	purgeInterval := os.Getenv("PURGE_INTERVAL")
+	purgeIntervalSecs, err := strconv.ParseInt(purgeInterval, 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("could parse purge interval: %w", err)
+	}
+
+	// load after how many failed sign in attempts sign in is delayed, and when and for how long accounts are locked
+	lockoutFreeAttempts, err := strconv.Atoi(os.Getenv("LOCKOUT_FREE_ATTEMPTS"))
+	if err != nil {
+		return nil, fmt.Errorf("could parse lockout free attempts: %w", err)
+	}
+	lockoutBaseDelay := os.Getenv("LOCKOUT_BASE_DELAY")
+	lockoutBaseDelaySecs, err := strconv.ParseInt(lockoutBaseDelay, 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("could parse lockout base delay: %w", err)
+	}
+	lockoutMaxFailures, err := strconv.Atoi(os.Getenv("LOCKOUT_MAX_FAILURES"))
+	if err != nil {
+		return nil, fmt.Errorf("could parse lockout max failures: %w", err)
+	}
+	lockoutDuration := os.Getenv("LOCKOUT_DURATION")
+	lockoutDurationSecs, err := strconv.ParseInt(lockoutDuration, 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("could parse lockout duration: %w", err)
+	}
+
+	// load the password policy, the character rules are off unless set. New passwords are checked against the breached
+	// password list in BREACHED_PASSWORDS_FILE, a file of sha1 hashes which is loaded into memory so that it works offline.
+	// Without a file the check is skipped
+	passwordMinLength, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH"))
+	if err != nil {
+		return nil, fmt.Errorf("could parse password min length: %w", err)
+	}
+	passwordMaxLength, err := strconv.Atoi(os.Getenv("PASSWORD_MAX_LENGTH"))
+	if err != nil {
+		return nil, fmt.Errorf("could parse password max length: %w", err)
+	}
+	passwordPolicy := model.PasswordPolicy{
+		MinLength: passwordMinLength,
+		MaxLength: passwordMaxLength,
+	}
+	for env, rule := range map[string]*bool{
+		"PASSWORD_REQUIRE_LOWER":    &passwordPolicy.RequireLower,
+		"PASSWORD_REQUIRE_UPPER":    &passwordPolicy.RequireUpper,
+		"PASSWORD_REQUIRE_DIGIT":    &passwordPolicy.RequireDigit,
+		"PASSWORD_REQUIRE_SYMBOL":   &passwordPolicy.RequireSymbol,
+		"PASSWORD_REJECT_USER_INFO": &passwordPolicy.RejectUserInfo,
+	} {
+		if *rule, err = optionalBool(os.Getenv(env)); err != nil {
+			return nil, fmt.Errorf("could parse %s: %w", env, err)
+		}
+	}
+
+	var breachedPasswordRepository model.BreachedPasswordRepository
+	if breachedPasswordsFile := os.Getenv("BREACHED_PASSWORDS_FILE"); breachedPasswordsFile != "" {
+		breachedPasswordRepository, err = repository.NewBreachedPasswordRepository(breachedPasswordsFile)
+		if err != nil {
+			return nil, err
+		}
+		passwordPolicy.RejectBreached = true
+	}
+
+	passwordPolicyService := service.NewPasswordPolicyService(&service.PasswordPolicyServiceConfig{
+		BreachedPasswordRepository: breachedPasswordRepository,
+		Policy:                     passwordPolicy,
+	})
+
+	// load the argon2id parameters new passwords are hashed with, memory is in KiB. Hashes with other parameters are
+	// replaced on the next sign in. Run go test -bench Argon2id ./service to see how long hashing takes with them
+	argon2Memory, err := strconv.ParseUint(os.Getenv("ARGON2_MEMORY"), 0, 32)
+	if err != nil {
+		return nil, fmt.Errorf("could parse argon2 memory: %w", err)
+	}
+	argon2Iterations, err := strconv.ParseUint(os.Getenv("ARGON2_ITERATIONS"), 0, 32)
+	if err != nil {
+		return nil, fmt.Errorf("could parse argon2 iterations: %w", err)
+	}
+	argon2Parallelism, err := strconv.ParseUint(os.Getenv("ARGON2_PARALLELISM"), 0, 8)
+	if err != nil {
+		return nil, fmt.Errorf("could parse argon2 parallelism: %w", err)
+	}
+	argon2Params := service.DefaultArgon2Params
+	argon2Params.Memory = uint32(argon2Memory)
+	argon2Params.Iterations = uint32(argon2Iterations)
+	argon2Params.Parallelism = uint8(argon2Parallelism)
+	if err := argon2Params.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+
+	// load the base64 encoded hash parameters of the Firebase project users have been imported from, if any
+	firebaseSignerKey, err := base64.StdEncoding.DecodeString(os.Getenv("FIREBASE_SIGNER_KEY"))
+	if err != nil {
+		return nil, fmt.Errorf("could parse firebase signer key: %w", err)
+	}
+	firebaseSaltSeparator, err := base64.StdEncoding.DecodeString(os.Getenv("FIREBASE_SALT_SEPARATOR"))
+	if err != nil {
+		return nil, fmt.Errorf("could parse firebase salt separator: %w", err)
+	}
+
+	passwordHasher := service.NewPasswordHasher(&service.PasswordHasherConfig{
+		Argon2: argon2Params,
+		FirebaseScrypt: service.FirebaseScryptKey{
+			SignerKey:     firebaseSignerKey,
+			SaltSeparator: firebaseSaltSeparator,
+		},
+	})
+
+	// user events are fanned out to the subscriptions on all instances through redis pub/sub
+	userEventRepository := repository.NewUserEventRepository(d.RedisClient)
+	userEventService := service.NewUserEventService(&service.UserEventServiceConfig{
+		UserEventRepository: userEventRepository,
+	})
+
+	// restarted after a second if the connection to redis is lost
+	runPeriodically(ctx, "deliver user events", time.Second, userEventService.Run)
+
+	// load how many audit events can wait to be written, and how often they are written at least
+	auditBufferSize, err := strconv.Atoi(os.Getenv("AUDIT_BUFFER_SIZE"))
+	if err != nil {
+		return nil, fmt.Errorf("could parse audit buffer size: %w", err)
+	}
+	auditFlushInterval := os.Getenv("AUDIT_FLUSH_INTERVAL")
+	auditFlushIntervalSecs, err := strconv.ParseInt(auditFlushInterval, 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("could parse audit flush interval: %w", err)
+	}
+
+	auditEventRepository := repository.NewAuditEventRepository(d.DB)
+	auditService := service.NewAuditService(&service.AuditServiceConfig{
+		AuditEventRepository: auditEventRepository,
+		BufferSize:           auditBufferSize,
+		FlushInterval:        time.Duration(auditFlushIntervalSecs) * time.Second,
+	})
+
+	// events are written in the background, so that sign ins don't wait for the audit log
+	runPeriodically(ctx, "write audit events", time.Second, auditService.Run)
+
+	// wrong passwords and wrong authenticator app codes are counted separately, with the same policy
+	lockoutPolicy := model.LockoutPolicy{
+		FreeAttempts: lockoutFreeAttempts,
+		BaseDelay:    time.Duration(lockoutBaseDelaySecs) * time.Second,
+		MaxFailures:  lockoutMaxFailures,
+		Duration:     time.Duration(lockoutDurationSecs) * time.Second,
+	}
+
 	userRepository := repository.NewUserRepository(d.DB)
+	knownDeviceRepository := repository.NewKnownDeviceRepository(d.DB)
+	actionTokenRepository := repository.NewActionTokenRepository(d.RedisClient)
 	userService := service.NewUserService(&service.UserServiceConfig{
-		UserRepository: userRepository,
+		UserRepository:          userRepository,
+		ActionTokenRepository:   actionTokenRepository,
+		UserEventRepository:     userEventRepository,
+		Mailer:                  mailer,
+		PasswordPolicyService:   passwordPolicyService,
+		PasswordHasher:          passwordHasher,
+		AuditService:            auditService,
+		KnownDeviceRepository:   knownDeviceRepository,
+		AppURL:                  os.Getenv("APP_URL"),
+		EmailTokenExpSecs:       emailTokenExpSecs,
+		DeletionGracePeriodSecs: deletionGracePeriodSecs,
+		MagicLinkExpSecs:        magicLinkExpSecs,
+		PasswordlessSignup:      passwordlessSignup,
+		Lockout:                 lockoutPolicy,
+	})
+
+	// load the key the authenticator app secrets are encrypted with, a base64 encoded 32 byte key,
+	// and how long and how often a sign in challenge of an account with 2FA enabled can be attempted
+	totpEncryptionKey, err := base64.StdEncoding.DecodeString(os.Getenv("TOTP_ENCRYPTION_KEY"))
+	if err != nil {
+		return nil, fmt.Errorf("could parse totp encryption key: %w", err)
+	}
+	if len(totpEncryptionKey) != 32 {
+		return nil, fmt.Errorf("totp encryption key must be 32 bytes long, got %d", len(totpEncryptionKey))
+	}
+	mfaChallengeExp := os.Getenv("MFA_CHALLENGE_EXP")
+	mfaChallengeExpSecs, err := strconv.ParseInt(mfaChallengeExp, 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("could parse mfa challenge exp: %w", err)
+	}
+	mfaMaxAttempts, err := strconv.Atoi(os.Getenv("MFA_MAX_ATTEMPTS"))
+	if err != nil {
+		return nil, fmt.Errorf("could parse mfa max attempts: %w", err)
+	}
+
+	// load the relying party passkeys are bound to, the origins are the comma separated urls of the frontends
+	// allowed to use them, and how long a passkey ceremony can be completed
+	relyingParty := model.RelyingParty{
+		ID:   os.Getenv("WEBAUTHN_RP_ID"),
+		Name: os.Getenv("WEBAUTHN_RP_NAME"),
+	}
+	for _, origin := range strings.Split(os.Getenv("WEBAUTHN_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			relyingParty.Origins = append(relyingParty.Origins, origin)
+		}
+	}
+	webAuthnChallengeExp := os.Getenv("WEBAUTHN_CHALLENGE_EXP")
+	webAuthnChallengeExpSecs, err := strconv.ParseInt(webAuthnChallengeExp, 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("could parse webauthn challenge exp: %w", err)
+	}
+
+	webAuthnCredentialRepository := repository.NewWebAuthnCredentialRepository(d.DB)
+	recoveryCodeRepository := repository.NewRecoveryCodeRepository(d.DB)
+
+	totpRepository := repository.NewTOTPRepository(d.DB)
+	mfaService := service.NewMFAService(&service.MFAServiceConfig{
+		TOTPRepository:               totpRepository,
+		WebAuthnCredentialRepository: webAuthnCredentialRepository,
+		RecoveryCodeRepository:       recoveryCodeRepository,
+		UserRepository:               userRepository,
+		ActionTokenRepository:        actionTokenRepository,
+		Mailer:                       mailer,
+		AuditService:                 auditService,
+		EncryptionKey:                totpEncryptionKey,
+		Issuer:                       os.Getenv("TOTP_ISSUER"),
+		RelyingParty:                 relyingParty,
+		ChallengeExpSecs:             mfaChallengeExpSecs,
+		MaxAttempts:                  mfaMaxAttempts,
+		Lockout:                      lockoutPolicy,
+	})
+
+	webAuthnService := service.NewWebAuthnService(&service.WebAuthnServiceConfig{
+		WebAuthnCredentialRepository: webAuthnCredentialRepository,
+		RecoveryCodeRepository:       recoveryCodeRepository,
+		UserRepository:               userRepository,
+		ActionTokenRepository:        actionTokenRepository,
+		AuditService:                 auditService,
+		RelyingParty:                 relyingParty,
+		ChallengeExpSecs:             webAuthnChallengeExpSecs,
+	})
+
+	runPeriodically(ctx, "purge deleted accounts", time.Duration(purgeIntervalSecs)*time.Second, func(ctx context.Context) error {
+		_, err := userService.PurgeDeletedAccounts(ctx)
+		return err
 	})
 
 	// load rsa keys and config vars for tokenrepository
@@ -66,6 +336,8 @@ func inject(d *dataSources) (*gin.Engine, error) {
 	tokenRepository := repository.NewTokenRepository(d.RedisClient)
 	tokenService := service.NewTokenService(&service.TokenServiceConfig{
 		TokenRepository:     tokenRepository,
+		UserEventRepository: userEventRepository,
+		AuditService:        auditService,
 		PrivKey:             privKey,
 		PubKey:              pubKey,
 		RefreshSecret:       refreshSecret,
@@ -73,6 +345,169 @@ func inject(d *dataSources) (*gin.Engine, error) {
 		AccessTokenExpSecs:  accessTokenExpSecs,
 	})
 
+	// load how long download links of data exports stay valid, how often queued exports are processed,
+	// and after how long a running export is assumed to be abandoned by a crashed worker and processed again
+	exportDownloadExp := os.Getenv("EXPORT_DOWNLOAD_EXP")
+	exportDownloadExpSecs, err := strconv.ParseInt(exportDownloadExp, 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("could parse export download exp: %w", err)
+	}
+	exportInterval := os.Getenv("EXPORT_INTERVAL")
+	exportIntervalSecs, err := strconv.ParseInt(exportInterval, 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("could parse export interval: %w", err)
+	}
+	exportClaimTimeout := os.Getenv("EXPORT_CLAIM_TIMEOUT")
+	exportClaimTimeoutSecs, err := strconv.ParseInt(exportClaimTimeout, 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("could parse export claim timeout: %w", err)
+	}
+
+	dataExportRepository := repository.NewDataExportRepository(d.DB)
+	dataExportService := service.NewDataExportService(&service.DataExportServiceConfig{
+		DataExportRepository: dataExportRepository,
+		UserRepository:       userRepository,
+		Mailer:               mailer,
+		// linked oauth identities and consent records aren't stored yet and need an exporter once they are
+		Exporters: []model.UserDataExporter{
+			service.NewProfileExporter(userRepository),
+			service.NewSessionExporter(tokenRepository),
+			service.NewWebAuthnCredentialExporter(webAuthnCredentialRepository),
+			service.NewTOTPExporter(totpRepository),
+			service.NewRecoveryCodeExporter(recoveryCodeRepository),
+			service.NewKnownDeviceExporter(knownDeviceRepository),
+			service.NewAuditEventExporter(auditEventRepository),
+		},
+		AppURL:           os.Getenv("APP_URL"),
+		DownloadExpSecs:  exportDownloadExpSecs,
+		ClaimTimeoutSecs: exportClaimTimeoutSecs,
+	})
+
+	runPeriodically(ctx, "process data exports", time.Duration(exportIntervalSecs)*time.Second, func(ctx context.Context) error {
+		_, err := dataExportService.ProcessPendingExports(ctx)
+		return err
+	})
+
+	adminService := service.NewAdminService(&service.AdminServiceConfig{
+		UserRepository: userRepository,
+		UserService:    userService,
+		TokenService:   tokenService,
+		AuditService:   auditService,
+	})
+
+	// load the limits of the graphql api, unset or 0 turns a limit off and lets persisted queries never expire.
+	// In production, the limits are required and introspection and the playground are turned off
+	production := os.Getenv("ENV") == "prod"
+	complexityLimit, err := optionalInt(os.Getenv("GRAPHQL_COMPLEXITY_LIMIT"))
+	if err != nil {
+		return nil, fmt.Errorf("could parse graphql complexity limit: %w", err)
+	}
+	depthLimit, err := optionalInt(os.Getenv("GRAPHQL_DEPTH_LIMIT"))
+	if err != nil {
+		return nil, fmt.Errorf("could parse graphql depth limit: %w", err)
+	}
+	if production && (complexityLimit < 1 || depthLimit < 1) {
+		return nil, fmt.Errorf("graphql complexity and depth limit must be set in production")
+	}
+	persistedQueryExpSecs, err := optionalInt(os.Getenv("PERSISTED_QUERY_EXP"))
+	if err != nil {
+		return nil, fmt.Errorf("could parse persisted query exp: %w", err)
+	}
+
+	// an allowlist of persisted query hashes is optional
+	var allowlist map[string]bool
+	if allowlistFile := os.Getenv("GRAPHQL_ALLOWLIST_FILE"); allowlistFile != "" {
+		allowlist, err = loadAllowlist(allowlistFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read graphql allowlist: %w", err)
+		}
+	}
+
+	graphqlConfig := handler.GraphQLConfig{
+		ComplexityLimit:          int(complexityLimit),
+		DepthLimit:               int(depthLimit),
+		Production:               production,
+		PersistedQueryRepository: repository.NewPersistedQueryRepository(d.RedisClient, time.Duration(persistedQueryExpSecs)*time.Second),
+		Allowlist:                allowlist,
+	}
+
+	// load the limits of the brute-force protection. Each action is configured as e.g. "ip=50/300,email=10/300,ip_email=5/300",
+	// which allows 50 attempts per client ip, 10 per email and 5 per combination of both within 300 seconds
+	rateLimitPolicies := make(map[string]model.RateLimitPolicy)
+	for action, env := range map[string]string{
+		model.ActionSignin:        "RATE_LIMIT_SIGNIN",
+		model.ActionSignup:        "RATE_LIMIT_SIGNUP",
+		model.ActionPasswordReset: "RATE_LIMIT_PASSWORD_RESET",
+		model.ActionTokenRefresh:  "RATE_LIMIT_TOKEN_REFRESH",
+		model.ActionMagicLink:     "RATE_LIMIT_MAGIC_LINK",
+		model.ActionEmailCheck:    "RATE_LIMIT_EMAIL_CHECK",
+		model.ActionMFA:           "RATE_LIMIT_MFA",
+	} {
+		if policy := os.Getenv(env); policy != "" {
+			rateLimitPolicies[action], err = parseRateLimitPolicy(policy)
+			if err != nil {
+				return nil, fmt.Errorf("could parse %s: %w", strings.ToLower(strings.ReplaceAll(env, "_", " ")), err)
+			}
+		}
+	}
+
+	rateLimitService := service.NewRateLimitService(&service.RateLimitServiceConfig{
+		RateLimitRepository: repository.NewRateLimitRepository(d.RedisClient),
+		Policies:            rateLimitPolicies,
+	})
+
+	// the client ip is taken from X-Forwarded-For only for requests from these proxies, e.g. "10.0.0.0/8,172.16.0.0/12"
+	var trustedProxies []*net.IPNet
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		for _, proxy := range strings.Split(proxies, ",") {
+			_, cidr, err := net.ParseCIDR(strings.TrimSpace(proxy))
+			if err != nil {
+				return nil, fmt.Errorf("could parse trusted proxies: %w", err)
+			}
+			trustedProxies = append(trustedProxies, cidr)
+		}
+	}
+
+	// load the origins of browser clients which get their refresh token in an HttpOnly cookie by default.
+	// Any client can opt in with the X-Token-Delivery header, but only these origins may send cookies cross-origin
+	tokenCookies := handler.TokenCookieConfig{
+		Origins: splitList(os.Getenv("TOKEN_COOKIE_ORIGINS")),
+		MaxAge:  int(refreshtokenExpSecs),
+	}
+
+	// load the origins allowed to call the rest, graphql and oauth routes from browsers, as comma separated exact origins,
+	// wildcard subdomains like https://*.example.com or *, and how long browsers may cache preflight responses
+	corsMaxAge, err := strconv.ParseInt(os.Getenv("CORS_MAX_AGE"), 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("could parse cors max age: %w", err)
+	}
+	corsHeaders := []string{"Content-Type", "Authorization", "X-CSRF-Token", "X-Token-Delivery", "X-Request-Id", "Cache-Control", "X-Requested-With"}
+	corsExposedHeaders := []string{"X-Request-Id", "Retry-After"}
+	corsConfig := handler.CorsConfig{
+		REST: middleware.CorsPolicy{
+			AllowedOrigins:   splitList(os.Getenv("CORS_REST_ORIGINS")),
+			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE"},
+			AllowedHeaders:   corsHeaders,
+			ExposedHeaders:   corsExposedHeaders,
+			AllowCredentials: true, // for the refresh token cookie
+			MaxAge:           time.Duration(corsMaxAge) * time.Second,
+		},
+		GraphQL: middleware.CorsPolicy{
+			AllowedOrigins:   splitList(os.Getenv("CORS_GRAPHQL_ORIGINS")),
+			AllowedMethods:   []string{"GET", "POST"},
+			AllowedHeaders:   corsHeaders,
+			ExposedHeaders:   corsExposedHeaders,
+			AllowCredentials: true, // for the sign in link cookie
+			MaxAge:           time.Duration(corsMaxAge) * time.Second,
+		},
+		OAuth: middleware.CorsPolicy{
+			AllowedOrigins: splitList(os.Getenv("CORS_OAUTH_ORIGINS")),
+			AllowedMethods: []string{"GET"},
+			AllowedHeaders: corsHeaders,
+			MaxAge:         time.Duration(corsMaxAge) * time.Second,
+		},
+	}
+
 	// initialize gin.Engine
 	router := gin.Default()
 
@@ -84,14 +519,121 @@ func inject(d *dataSources) (*gin.Engine, error) {
 	oAuthService := service.NewOAuthService(tc)
 
 	c := &handler.Config{
-		R:               router,
-		UserService:     userService,
-		OAuthService:    oAuthService,
-		TokenService:    tokenService,
-		TimeOutDuration: time.Duration(7 * time.Second),
+		R:                 router,
+		UserService:       userService,
+		OAuthService:      oAuthService,
+		TokenService:      tokenService,
+		DataExportService: dataExportService,
+		AdminService:      adminService,
+		UserEventService:  userEventService,
+		RateLimitService:  rateLimitService,
+		MFAService:        mfaService,
+		WebAuthnService:   webAuthnService,
+		AuditService:      auditService,
+		TrustedProxies:    trustedProxies,
+		TokenCookies:      tokenCookies,
+		Cors:              corsConfig,
+		GraphQL:           graphqlConfig,
+		TimeOutDuration:   time.Duration(7 * time.Second),
 	}
 	handler.NewHandler(c)
 	//handler.NewGraphQLHandler(c)
 
 	return router, nil
 }
+
+// loadAllowlist reads the sha256 hashes of the allowed graphql queries from a file with one hash per line
+func loadAllowlist(path string) (map[string]bool, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	allowlist := make(map[string]bool)
+	for _, line := range strings.Split(string(b), "\n") {
+		if hash := strings.TrimSpace(line); hash != "" && !strings.HasPrefix(hash, "#") {
+			allowlist[hash] = true
+		}
+	}
+
+	return allowlist, nil
+}
+
+// parseRateLimitPolicy parses a policy like "ip=50/300,email=10/300,ip_email=5/300", where each bucket
+// allows the number of attempts within the number of seconds. Buckets that are left out aren't limited
+func parseRateLimitPolicy(s string) (model.RateLimitPolicy, error) {
+	var policy model.RateLimitPolicy
+
+	for _, bucket := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(bucket), "=", 2)
+		if len(parts) != 2 {
+			return policy, fmt.Errorf("expected bucket=limit/seconds, got %q", bucket)
+		}
+
+		limit, err := parseRateLimit(parts[1])
+		if err != nil {
+			return policy, err
+		}
+
+		switch parts[0] {
+		case "ip":
+			policy.PerIP = limit
+		case "email":
+			policy.PerEmail = limit
+		case "ip_email":
+			policy.PerIPEmail = limit
+		default:
+			return policy, fmt.Errorf("unknown rate limit bucket %q", parts[0])
+		}
+	}
+
+	return policy, nil
+}
+
+func parseRateLimit(s string) (model.RateLimit, error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return model.RateLimit{}, fmt.Errorf("expected limit/seconds, got %q", s)
+	}
+
+	limit, err := strconv.ParseInt(parts[0], 0, 64)
+	if err != nil {
+		return model.RateLimit{}, err
+	}
+	windowSecs, err := strconv.ParseInt(parts[1], 0, 64)
+	if err != nil {
+		return model.RateLimit{}, err
+	}
+
+	return model.RateLimit{
+		Limit:  limit,
+		Window: time.Duration(windowSecs) * time.Second,
+	}, nil
+}
+
+// optionalInt parses a number from the environment, an empty string is 0
+func optionalInt(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 0, 64)
+}
+
+// optionalBool parses a flag from the environment, an empty string is false
+func optionalBool(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// splitList splits a comma separated list from the environment, an empty string is an empty list
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
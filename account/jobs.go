@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// runPeriodically runs job in its own goroutine every interval until ctx is cancelled
+func runPeriodically(ctx context.Context, name string, interval time.Duration, job func(ctx context.Context) error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				log.Printf("Stopped background job %s\n", name)
+				return
+			case <-ticker.C:
+				if err := job(ctx); err != nil {
+					log.Printf("Background job %s failed: %v\n", name, err)
+				}
+			}
+		}
+	}()
+}
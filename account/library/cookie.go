@@ -0,0 +1,17 @@
+package library
+
+import "net/http"
+
+// NewCookie returns a cookie for the whole site that is only sent over https and can't be read by scripts.
+// A maxAge of 0 creates a session cookie, a negative maxAge deletes the cookie
+func NewCookie(name, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
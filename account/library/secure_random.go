@@ -0,0 +1,43 @@
+package library
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+)
+
+// SecureToken returns a url safe string encoding n bytes read from crypto/rand.
+// Use it instead of RandomString for anything that has to be unguessable
+func SecureToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// SecureCode returns a string of n characters picked uniformly from the alphabet using crypto/rand
+func SecureCode(n int, alphabet string) (string, error) {
+	if len(alphabet) == 0 || len(alphabet) > 256 {
+		return "", errors.New("alphabet must hold between 1 and 256 characters")
+	}
+
+	// bytes at or above max would make the first characters of the alphabet more likely and are skipped
+	max := 256 - 256%len(alphabet)
+
+	code := make([]byte, 0, n)
+	b := make([]byte, n)
+	for len(code) < n {
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		for _, c := range b {
+			if int(c) < max && len(code) < n {
+				code = append(code, alphabet[int(c)%len(alphabet)])
+			}
+		}
+	}
+
+	return string(code), nil
+}
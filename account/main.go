@@ -11,6 +11,13 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import-users" {
+		if err := importUsers(os.Args[2:]); err != nil {
+			log.Fatalf("couldnt import users: %v\n", err)
+		}
+		return
+	}
+
 	log.Println("Starting server...")
 
 	ds, err := initDS()
@@ -18,7 +25,10 @@ func main() {
 		log.Fatalf("couldnt connect to db in main: %v\n", err)
 	}
 
-	router, err := inject(ds)
+	// cancelled on shutdown to stop all background jobs
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+
+	router, err := inject(jobsCtx, ds)
 	if err != nil {
 		log.Fatalf("couldnt inject dependencies in main: %v\n", err)
 	}
@@ -38,7 +48,7 @@ func main() {
 	log.Printf("Listening on port %v\n", srv.Addr)
 
 	// Wait for kill signal of channel
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
@@ -50,6 +60,8 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	stopJobs()
+
 	if err := ds.close(); err != nil {
 		log.Fatalf("couldn't close datasources: %v\n", err)
 	}
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS data_exports (
+  id uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+  uid uuid NOT NULL REFERENCES users (uid) ON DELETE CASCADE,
+  status VARCHAR NOT NULL DEFAULT 'pending',
+  archive BYTEA,
+  download_token_hash VARCHAR NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  completed_at TIMESTAMPTZ,
+  expires_at TIMESTAMPTZ,
+  claimed_at TIMESTAMPTZ,
+  attempts INT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS data_exports_uid_idx ON data_exports (uid);
+CREATE INDEX IF NOT EXISTS data_exports_download_token_hash_idx ON data_exports (download_token_hash);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS users_created_at_uid_idx;
+
+ALTER TABLE users
+  DROP COLUMN IF EXISTS role,
+  DROP COLUMN IF EXISTS status,
+  DROP COLUMN IF EXISTS created_at;
@@ -0,0 +1,7 @@
+ALTER TABLE users
+  ADD COLUMN IF NOT EXISTS role VARCHAR NOT NULL DEFAULT 'user',
+  ADD COLUMN IF NOT EXISTS status VARCHAR NOT NULL DEFAULT 'active',
+  ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- cursor pagination of the admin user list
+CREATE INDEX IF NOT EXISTS users_created_at_uid_idx ON users (created_at, uid);
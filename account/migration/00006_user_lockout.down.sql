@@ -0,0 +1,3 @@
+ALTER TABLE users
+  DROP COLUMN IF EXISTS failed_logins,
+  DROP COLUMN IF EXISTS locked_until;
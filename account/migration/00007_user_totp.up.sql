@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS user_totp (
+  uid uuid PRIMARY KEY REFERENCES users (uid) ON DELETE CASCADE,
+  secret VARCHAR NOT NULL DEFAULT '',
+  pending_secret VARCHAR NOT NULL DEFAULT '',
+  last_used_step BIGINT NOT NULL DEFAULT 0,
+  enabled_at TIMESTAMPTZ,
+  failed_attempts INT NOT NULL DEFAULT 0,
+  locked_until TIMESTAMPTZ
+);
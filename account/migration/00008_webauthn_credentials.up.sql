@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+  id uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+  uid uuid NOT NULL REFERENCES users (uid) ON DELETE CASCADE,
+  credential_id BYTEA NOT NULL UNIQUE,
+  public_key BYTEA NOT NULL,
+  sign_count BIGINT NOT NULL DEFAULT 0,
+  transports VARCHAR NOT NULL DEFAULT '',
+  nickname VARCHAR NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS webauthn_credentials_uid_idx ON webauthn_credentials (uid);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS recovery_codes (
+  id uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+  uid uuid NOT NULL REFERENCES users (uid) ON DELETE CASCADE,
+  code_hash VARCHAR NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS recovery_codes_uid_idx ON recovery_codes (uid);
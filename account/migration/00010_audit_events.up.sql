@@ -0,0 +1,41 @@
+-- append-only, events outlive the accounts they are about. The events of purged accounts are kept, but without
+-- what identifies the user: an update may only clear the uids, the ip, the user agent or keys of the details
+CREATE TABLE IF NOT EXISTS audit_events (
+  id BIGSERIAL PRIMARY KEY,
+  type VARCHAR NOT NULL,
+  actor_uid uuid,
+  subject_uid uuid,
+  ip VARCHAR NOT NULL DEFAULT '',
+  user_agent VARCHAR NOT NULL DEFAULT '',
+  request_id VARCHAR NOT NULL DEFAULT '',
+  details JSONB NOT NULL DEFAULT '{}',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_actor_uid_idx ON audit_events (actor_uid, id);
+CREATE INDEX IF NOT EXISTS audit_events_subject_uid_idx ON audit_events (subject_uid, id);
+CREATE INDEX IF NOT EXISTS audit_events_created_at_idx ON audit_events (created_at);
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'UPDATE'
+    AND NEW.id = OLD.id
+    AND NEW.type = OLD.type
+    AND NEW.request_id = OLD.request_id
+    AND NEW.created_at = OLD.created_at
+    AND (NEW.actor_uid IS NULL OR NEW.actor_uid = OLD.actor_uid)
+    AND (NEW.subject_uid IS NULL OR NEW.subject_uid = OLD.subject_uid)
+    AND NEW.ip IN ('', OLD.ip)
+    AND NEW.user_agent IN ('', OLD.user_agent)
+    AND NEW.details <@ OLD.details THEN
+    RETURN NEW;
+  END IF;
+
+  RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+CREATE TRIGGER audit_events_append_only
+  BEFORE UPDATE OR DELETE ON audit_events
+  FOR EACH ROW EXECUTE PROCEDURE audit_events_append_only();
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS known_devices (
+  uid uuid NOT NULL REFERENCES users (uid) ON DELETE CASCADE,
+  user_agent_family VARCHAR NOT NULL,
+  ip_prefix VARCHAR NOT NULL,
+  first_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (uid, user_agent_family, ip_prefix)
+);
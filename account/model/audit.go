@@ -0,0 +1,141 @@
+package model
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Types of the events recorded in the audit log
+const (
+	AuditSigninSucceeded          = "signin.succeeded"
+	AuditSigninFailed             = "signin.failed"
+	AuditNewDevice                = "signin.new_device"
+	AuditSigninRejected           = "signin.rejected" // the user reported a sign in from a new device that wasn't theirs
+	AuditSignup                   = "signup"
+	AuditTokenRefreshed           = "token.refreshed"
+	AuditTokenReused              = "token.reused" // a refresh token has been presented after it had been used or revoked
+	AuditPasswordChanged          = "password.changed"
+	AuditPasswordReset            = "password.reset"
+	AuditRecoveryCodeUsed         = "recovery_code.used"
+	AuditRecoveryCodesRegenerated = "recovery_codes.regenerated"
+	AuditRoleChanged              = "role.changed"
+	AuditUserSuspended            = "admin.user_suspended"
+	AuditUserUnsuspended          = "admin.user_unsuspended"
+	AuditPasswordResetForced      = "admin.password_reset_forced"
+	AuditSessionsRevoked          = "admin.sessions_revoked"
+	AuditUsersImported            = "admin.users_imported"
+)
+
+// ways a sign in can be completed, recorded along with it. Sign ins completed with a second factor are recorded with the MFA method
+const (
+	SigninMethodPassword  = "password"
+	SigninMethodMagicLink = "magic_link"
+	SigninMethodPasskey   = "passkey"
+)
+
+// AuditEventTypes holds all types of audit events, the audit log can only be filtered by these
+var AuditEventTypes = map[string]bool{
+	AuditSigninSucceeded:          true,
+	AuditSigninFailed:             true,
+	AuditNewDevice:                true,
+	AuditSigninRejected:           true,
+	AuditSignup:                   true,
+	AuditTokenRefreshed:           true,
+	AuditTokenReused:              true,
+	AuditPasswordChanged:          true,
+	AuditPasswordReset:            true,
+	AuditRecoveryCodeUsed:         true,
+	AuditRecoveryCodesRegenerated: true,
+	AuditRoleChanged:              true,
+	AuditUserSuspended:            true,
+	AuditUserUnsuspended:          true,
+	AuditPasswordResetForced:      true,
+	AuditSessionsRevoked:          true,
+	AuditUsersImported:            true,
+}
+
+// AuditEvent is a security relevant event of the audit log. The actor is the user who triggered the event,
+// the subject the user it affected. Both are nil if unknown, like for a failed sign in with an unknown email
+type AuditEvent struct {
+	ID         int64        `db:"id" json:"id"`
+	Type       string       `db:"type" json:"type"`
+	ActorUID   *uuid.UUID   `db:"actor_uid" json:"actorUid"`
+	SubjectUID *uuid.UUID   `db:"subject_uid" json:"subjectUid"`
+	IP         string       `db:"ip" json:"ip"`
+	UserAgent  string       `db:"user_agent" json:"userAgent"`
+	RequestID  string       `db:"request_id" json:"requestId"`
+	Details    AuditDetails `db:"details" json:"details"`
+	CreatedAt  time.Time    `db:"created_at" json:"createdAt"`
+}
+
+// AuditDetails holds what else is known about an audit event, stored as jsonb
+type AuditDetails map[string]interface{}
+
+// Value implements driver.Valuer
+func (d AuditDetails) Value() (driver.Value, error) {
+	if d == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(d)
+}
+
+// Scan implements sql.Scanner
+func (d *AuditDetails) Scan(src interface{}) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("expected audit details as []byte, got %T", src)
+	}
+	return json.Unmarshal(b, d)
+}
+
+// AuditEventFilter narrows down and paginates the audit log, which is ordered from the newest to the oldest event
+type AuditEventFilter struct {
+	UID        *uuid.UUID // events the user triggered or has been the subject of
+	SubjectUID *uuid.UUID // events the user has been the subject of
+	Types      []string   // any type if empty
+	From       time.Time  // events at or after, unbounded if zero
+	To         time.Time  // events before, unbounded if zero
+	Before     int64      // id of the last event of the previous page
+	Limit      int
+}
+
+// Activity is an audit event as shown to the user it is about. Who triggered it and from where is left out,
+// the actor may have been an admin or someone trying to sign in to the account
+type Activity struct {
+	ID        int64        `json:"id"`
+	Type      string       `json:"type"`
+	Details   AuditDetails `json:"details"`
+	CreatedAt time.Time    `json:"createdAt"`
+}
+
+// AuditEventPage is a page of the audit log
+type AuditEventPage struct {
+	Events     []*AuditEvent `json:"events"`
+	NextCursor string        `json:"nextCursor"` // empty if this is the last page
+}
+
+// RequestInfo describes the request an operation has been triggered by, it is recorded with the audit events of the operation
+type RequestInfo struct {
+	IP        string
+	UserAgent string
+	RequestID string
+	ActorUID  *uuid.UUID // the authenticated user, if any
+}
+
+type requestInfoCtxKey struct{}
+
+// WithRequestInfo returns a copy of ctx holding the info about the request
+func WithRequestInfo(ctx context.Context, info *RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoCtxKey{}, info)
+}
+
+// RequestInfoFromContext returns the info about the request ctx belongs to, if there is one
+func RequestInfoFromContext(ctx context.Context) (*RequestInfo, bool) {
+	info, ok := ctx.Value(requestInfoCtxKey{}).(*RequestInfo)
+	return info, ok
+}
@@ -0,0 +1,8 @@
+package model
+
+// names of the cookies set by the api
+const (
+	MagicLinkCookie    = "magic_link_nonce" // binds a sign in link to the browser it has been requested from
+	RefreshTokenCookie = "refresh_token"    // holds the refresh token of clients using cookie token delivery
+	CSRFCookie         = "csrf_token"       // holds the token that has to be repeated in the X-CSRF-Token header
+)
@@ -0,0 +1,29 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// states of a data export job
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportDone    = "done"
+	ExportFailed  = "failed"
+)
+
+// DataExport is a job building an archive of all data stored about a user
+type DataExport struct {
+	ID                uuid.UUID  `db:"id" json:"id"`
+	UID               uuid.UUID  `db:"uid" json:"uid"`
+	Status            string     `db:"status" json:"status"`
+	Archive           []byte     `db:"archive" json:"-"`
+	DownloadTokenHash string     `db:"download_token_hash" json:"-"`
+	CreatedAt         time.Time  `db:"created_at" json:"createdAt"`
+	CompletedAt       *time.Time `db:"completed_at" json:"completedAt"`
+	ExpiresAt         *time.Time `db:"expires_at" json:"expiresAt"` // the download link stops working after this point in time
+	ClaimedAt         *time.Time `db:"claimed_at" json:"-"`         // when a worker last started processing the export
+	Attempts          int        `db:"attempts" json:"-"`           // how often a worker started processing the export
+}
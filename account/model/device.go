@@ -0,0 +1,18 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// KnownDevice is a device a user has signed in from before. Devices are told apart by the family of the user agent,
+// like "Firefox on Windows", and the network they sign in from, so that browser updates and changing
+// addresses within the same network don't make a device look new
+type KnownDevice struct {
+	UID             uuid.UUID `db:"uid" json:"-"`
+	UserAgentFamily string    `db:"user_agent_family" json:"userAgentFamily"`
+	IPPrefix        string    `db:"ip_prefix" json:"ipPrefix"`
+	FirstSeenAt     time.Time `db:"first_seen_at" json:"firstSeenAt"`
+	LastSeenAt      time.Time `db:"last_seen_at" json:"lastSeenAt"`
+}
@@ -3,7 +3,9 @@ package model
 import (
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"time"
 )
 
 // "Set" of error Types
@@ -11,11 +13,13 @@ const (
 	Authorization        = "AUTHORIZATION"          // Authentication Failures -
 	BadRequest           = "BAD_REQUEST"            // Validation errors / BadInput
 	Conflict             = "CONFLICT"               // Already exists (eg, create account with existent email) - 409
+	Forbidden            = "FORBIDDEN"              // Authenticated, but not allowed (eg, suspended account or missing role) - 403
 	Internal             = "INTERNAL"               // Server (500) and fallback errors
 	NotFound             = "NOTFOUND"               // For not finding resource
 	PayloadTooLarge      = "PAYLOAD_TOO_LARGE"      // for uploading tons of JSON, or an image over the limit - 413
 	UnsupportedMediaType = "UNSUPPORTED_MEDIA_TYPE" // for http 415
 	ServiceUnavailable   = "SERVICE_UNAVAILABLE"
+	TooManyRequests      = "TOO_MANY_REQUESTS" // Rate limit exceeded - 429
 )
 
 // Error holds a custom http error for the application
@@ -25,6 +29,19 @@ type Error struct {
 	Type    string `json:"type"`
 	Message string `json:"message"`
 	Field   string `json:"field"`
+	// RetryAfter is the number of seconds until a rate limited request may be retried
+	RetryAfter int `json:"retryAfter,omitempty"`
+	// InvalidArgs are the arguments of the request that have been rejected, each with the rule it violates
+	InvalidArgs []InvalidArgument `json:"-"`
+}
+
+// InvalidArgument describes an argument of a request which failed validation
+type InvalidArgument struct {
+	Field   string `json:"field"`
+	Value   string `json:"value"`
+	Tag     string `json:"tag"`
+	Param   string `json:"param"`
+	Message string `json:"message,omitempty"`
 }
 
 // Error satisfies standard error interface
@@ -47,6 +64,8 @@ func (e *Error) Status() int {
 		return http.StatusBadRequest
 	case Conflict:
 		return http.StatusConflict
+	case Forbidden:
+		return http.StatusForbidden
 	case Internal:
 		return http.StatusInternalServerError
 	case NotFound:
@@ -55,6 +74,8 @@ func (e *Error) Status() int {
 		return http.StatusRequestEntityTooLarge
 	case ServiceUnavailable:
 		return http.StatusServiceUnavailable
+	case TooManyRequests:
+		return http.StatusTooManyRequests
 
 	case UnsupportedMediaType:
 		return http.StatusUnsupportedMediaType
@@ -103,6 +124,16 @@ func NewValidation(field, reason string) *Error {
 	}
 }
 
+// NewInvalidArguments to create a 400 for a request with the invalid arguments
+func NewInvalidArguments(args []InvalidArgument) *Error {
+	err := NewBadRequest("Invalid request parameters. See invalidArgs")
+	err.InvalidArgs = args
+	if len(args) > 0 {
+		err.Field = args[0].Field
+	}
+	return err
+}
+
 // NewConflict to create an error for 409
 func NewConflict(name string, value string) *Error {
 	return &Error{
@@ -112,6 +143,14 @@ func NewConflict(name string, value string) *Error {
 	}
 }
 
+// NewForbidden to create an error for 403
+func NewForbidden(reason string) *Error {
+	return &Error{
+		Type:    Forbidden,
+		Message: reason,
+	}
+}
+
 // NewInternal for 500 errors and unknown errors
 func NewInternal() *Error {
 	return &Error{
@@ -144,6 +183,27 @@ func NewServiceUnavailable() *Error {
 	}
 }
 
+// NewTooManyRequests to create an error for 429, retryAfter is how long the client has to wait before trying again
+func NewTooManyRequests(retryAfter time.Duration) *Error {
+	secs := int(math.Ceil(retryAfter.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+
+	return &Error{
+		Type:       TooManyRequests,
+		Message:    fmt.Sprintf("Too many requests. Try again in %v seconds.", secs),
+		RetryAfter: secs,
+	}
+}
+
+// NewAccountLocked to create a 429 for accounts that have been locked after too many failed sign in attempts
+func NewAccountLocked(retryAfter time.Duration) *Error {
+	err := NewTooManyRequests(retryAfter)
+	err.Message = "Account has been locked after too many failed sign in attempts. Use the link sent to your email to unlock it, or try again later."
+	return err
+}
+
 // NewUnsupportedMediaType to create an error for 415
 func NewUnsupportedMediaType(reason string) *Error {
 	return &Error{
@@ -2,6 +2,8 @@ package model
 
 import (
 	"context"
+	"crypto/sha1"
+	"io"
 	"time"
 
 	"github.com/google/uuid"
@@ -11,12 +13,116 @@ import (
 // any service it interacts with to implement
 type UserService interface {
 	Get(ctx context.Context, uid uuid.UUID) (*User, error)
+	GetMany(ctx context.Context, uids []uuid.UUID) ([]*User, error)
 	Signup(ctx context.Context, email, password string) (*User, error)
 	Signin(ctx context.Context, email, password string) (*User, error)
+	SigninCompleted(ctx context.Context, u *User, method string)
+	EmailAvailable(ctx context.Context, email string) (bool, error)
+	UpdateDetails(ctx context.Context, uid uuid.UUID, name, website string) (*User, error)
+	ClearProfileImage(ctx context.Context, uid uuid.UUID) (*User, error)
+	RequestEmailChange(ctx context.Context, uid uuid.UUID, newEmail string) error
+	ConfirmEmailChange(ctx context.Context, token string) (*User, error)
+	CancelEmailChange(ctx context.Context, token string) error
+	DeleteAccount(ctx context.Context, uid uuid.UUID, password string) error
+	RestoreAccount(ctx context.Context, token string) (*User, error)
+	PurgeDeletedAccounts(ctx context.Context) (int, error)
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token string, password string) (*User, error)
+	ChangePassword(ctx context.Context, uid uuid.UUID, currentPassword, password string) error
+	RejectSignin(ctx context.Context, token string) (*User, error)
+	ForcePasswordReset(ctx context.Context, uid uuid.UUID) error
+	UnlockAccount(ctx context.Context, token string) error
+	RequestMagicLink(ctx context.Context, email string, createAccount bool) (string, error)
+	SigninWithMagicLink(ctx context.Context, token string, nonce string) (*User, error)
 }
 
 type TokenService interface {
 	NewPairFromUser(ctx context.Context, u *User, prevTokenID string) (*TokenPair, error)
+	ValidateAccessToken(tokenString string) (*User, error)
+	Signout(ctx context.Context, uid uuid.UUID) error
+	ValidateRefreshToken(tokenString string) (*RefreshToken, error)
+}
+
+// AdminService defines the user management methods available to admins
+type AdminService interface {
+	ListUsers(ctx context.Context, filter UserFilter) (*UserPage, error)
+	GetUser(ctx context.Context, uid uuid.UUID) (*User, error)
+	SetStatus(ctx context.Context, uid uuid.UUID, status string) (*User, error)
+	SetRole(ctx context.Context, uid uuid.UUID, role string) (*User, error)
+	ForcePasswordReset(ctx context.Context, uid uuid.UUID) error
+	RevokeSessions(ctx context.Context, uid uuid.UUID) error
+	ImportUsers(ctx context.Context, format string, r io.Reader) (*UserImportResult, error)
+}
+
+// DataExportService defines methods the handler layer expects
+// to request and download archives of a users data
+type DataExportService interface {
+	RequestExport(ctx context.Context, uid uuid.UUID) (*DataExport, error)
+	GetExport(ctx context.Context, uid uuid.UUID, id uuid.UUID) (*DataExport, error)
+	Download(ctx context.Context, token string) (*DataExport, error)
+	ProcessPendingExports(ctx context.Context) (int, error)
+}
+
+// UserDataExporter is implemented by every part of the application that stores data about a user.
+// All exporters are included in the archive of a data export, each under its own name
+type UserDataExporter interface {
+	ExportName() string
+	ExportUserData(ctx context.Context, uid uuid.UUID) (interface{}, error)
+}
+
+// UserEventService delivers the events of a user to the subscriptions of that user on this instance
+type UserEventService interface {
+	Subscribe(ctx context.Context, uid uuid.UUID) <-chan *UserEvent
+	Run(ctx context.Context) error
+}
+
+// RateLimitService limits how often clients can attempt an action
+type RateLimitService interface {
+	Allow(ctx context.Context, action string, ip string, email string) error
+}
+
+// MFAService manages the second factors of users and completes sign ins of accounts with 2FA enabled
+type MFAService interface {
+	Challenge(ctx context.Context, u *User) (*MFAChallenge, error)
+	VerifyTOTP(ctx context.Context, challengeToken string, code string) (*User, error)
+	EnrollTOTP(ctx context.Context, u *User) (*TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, uid uuid.UUID, code string) ([]string, error)
+	RegenerateTOTP(ctx context.Context, u *User, code string) (*TOTPEnrollment, error)
+	DisableTOTP(ctx context.Context, uid uuid.UUID, code string) error
+	BeginWebAuthn(ctx context.Context, challengeToken string) (*WebAuthnRequestOptions, error)
+	VerifyWebAuthn(ctx context.Context, challengeToken string, assertion *WebAuthnAssertion) (*User, error)
+	VerifyRecoveryCode(ctx context.Context, challengeToken string, code string) (*User, error)
+	RegenerateRecoveryCodes(ctx context.Context, uid uuid.UUID) ([]string, error)
+}
+
+// WebAuthnService registers passkeys and signs users in with them, without a password
+type WebAuthnService interface {
+	BeginRegistration(ctx context.Context, u *User) (*WebAuthnCreationOptions, error)
+	FinishRegistration(ctx context.Context, u *User, nickname string, attestation *WebAuthnAttestation) (*WebAuthnCredential, []string, error)
+	BeginLogin(ctx context.Context) (*WebAuthnRequestOptions, error)
+	FinishLogin(ctx context.Context, assertion *WebAuthnAssertion) (*User, error)
+	ListCredentials(ctx context.Context, uid uuid.UUID) ([]*WebAuthnCredential, error)
+	DeleteCredential(ctx context.Context, uid uuid.UUID, id uuid.UUID) error
+}
+
+// AuditService records security relevant events in the audit log and queries it
+type AuditService interface {
+	Record(ctx context.Context, e *AuditEvent)
+	Query(ctx context.Context, filter AuditEventFilter) (*AuditEventPage, error)
+	RecentActivity(ctx context.Context, uid uuid.UUID) ([]*Activity, error)
+	Run(ctx context.Context) error
+}
+
+// PasswordPolicyService checks new passwords against the password policy
+type PasswordPolicyService interface {
+	Check(ctx context.Context, password string, u *User) error
+}
+
+// PasswordHasher hashes passwords and verifies them against stored hashes. outdated reports hashes
+// of an older algorithm or different parameters, which should be replaced once the password is at hand
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(hash, password string) (outdated bool, err error)
 }
 
 type OAuthService interface {
@@ -28,11 +134,110 @@ type OAuthService interface {
 // any repository it interacts with to implement
 type UserRepository interface {
 	FindByID(ctx context.Context, uid uuid.UUID) (*User, error)
+	FindByIDs(ctx context.Context, uids []uuid.UUID) ([]*User, error)
 	FindByEmail(ctx context.Context, email string) (*User, error)
+	EmailExists(ctx context.Context, email string) (bool, error)
 	Create(ctx context.Context, u *User) (*User, error)
+	Update(ctx context.Context, u *User) error
+	SoftDelete(ctx context.Context, uid uuid.UUID) error
+	Restore(ctx context.Context, uid uuid.UUID) (*User, error)
+	PurgeDeleted(ctx context.Context, deletedBefore time.Time) ([]uuid.UUID, error)
+	UpdatePassword(ctx context.Context, uid uuid.UUID, password string) error
+	SetStatus(ctx context.Context, uid uuid.UUID, status string) (*User, error)
+	SetRole(ctx context.Context, uid uuid.UUID, role string) (*User, error)
+	ClaimLoginAttempt(ctx context.Context, uid uuid.UUID, policy LockoutPolicy) (*User, bool, error)
+	ResetFailedLogins(ctx context.Context, uid uuid.UUID) error
+	List(ctx context.Context, filter UserFilter) (*UserPage, error)
 }
 
 type TokenRepository interface {
 	SetRefreshToken(ctx context.Context, userID string, tokenID string, expiresIn time.Duration) error
 	DeleteRefreshToken(ctx context.Context, userID string, tokenID string) error
+	DeleteUserRefreshTokens(ctx context.Context, userID string) error
+	GetUserRefreshTokens(ctx context.Context, userID string) ([]*Session, error)
+}
+
+type DataExportRepository interface {
+	Create(ctx context.Context, uid uuid.UUID) (*DataExport, error)
+	FindByID(ctx context.Context, id uuid.UUID) (*DataExport, error)
+	FindLatestByUID(ctx context.Context, uid uuid.UUID) (*DataExport, error)
+	FindByDownloadTokenHash(ctx context.Context, tokenHash string) (*DataExport, error)
+	ClaimPending(ctx context.Context, staleBefore time.Time) (*DataExport, error)
+	Complete(ctx context.Context, e *DataExport) error
+	Fail(ctx context.Context, id uuid.UUID) error
+	DeleteExpiredArchives(ctx context.Context, expiredBefore time.Time) (int64, error)
+}
+
+// ActionTokenRepository stores short-lived, single-use tokens that are sent to users
+// in links (e.g. email confirmation) along with a value the token resolves to
+type ActionTokenRepository interface {
+	SetActionToken(ctx context.Context, action string, token string, value string, expiresIn time.Duration) error
+	ConsumeActionToken(ctx context.Context, action string, token string) (string, error)
+}
+
+// TOTPRepository stores the authenticator app secrets of users
+type TOTPRepository interface {
+	Find(ctx context.Context, uid uuid.UUID) (*TOTP, error)
+	SetPendingSecret(ctx context.Context, uid uuid.UUID, secret string) error
+	Activate(ctx context.Context, uid uuid.UUID, step int64) error
+	UseStep(ctx context.Context, uid uuid.UUID, step int64) (bool, error)
+	ClaimAttempt(ctx context.Context, uid uuid.UUID, policy LockoutPolicy) (*TOTP, bool, error)
+	ResetFailedAttempts(ctx context.Context, uid uuid.UUID) error
+	Delete(ctx context.Context, uid uuid.UUID) error
+}
+
+// RecoveryCodeRepository stores the hashes of the single-use recovery codes of users
+type RecoveryCodeRepository interface {
+	Replace(ctx context.Context, uid uuid.UUID, hashes []string) error
+	Use(ctx context.Context, uid uuid.UUID, hash string) (bool, error)
+	CountUnused(ctx context.Context, uid uuid.UUID) (int, error)
+	FindByUID(ctx context.Context, uid uuid.UUID) ([]*RecoveryCode, error)
+}
+
+// WebAuthnCredentialRepository stores the passkeys and security keys of users
+type WebAuthnCredentialRepository interface {
+	Create(ctx context.Context, c *WebAuthnCredential) (*WebAuthnCredential, error)
+	FindByUID(ctx context.Context, uid uuid.UUID) ([]*WebAuthnCredential, error)
+	FindByCredentialID(ctx context.Context, credentialID []byte) (*WebAuthnCredential, error)
+	UpdateSignCount(ctx context.Context, id uuid.UUID, signCount int64) error
+	Delete(ctx context.Context, uid uuid.UUID, id uuid.UUID) error
+}
+
+// Mailer defines how the service layer sends emails to users
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// PersistedQueryRepository stores the GraphQL queries registered by clients under their sha256 hash
+type PersistedQueryRepository interface {
+	GetQuery(ctx context.Context, hash string) (string, error)
+	SetQuery(ctx context.Context, hash string, query string) error
+}
+
+// UserEventRepository publishes user events to all instances of the application
+type UserEventRepository interface {
+	Publish(ctx context.Context, e *UserEvent) error
+	Listen(ctx context.Context) (<-chan *UserEvent, error)
+}
+
+// AuditEventRepository appends events to the audit log, which can't be changed afterwards
+type AuditEventRepository interface {
+	Insert(ctx context.Context, events []*AuditEvent) error
+	List(ctx context.Context, filter AuditEventFilter) (*AuditEventPage, error)
+}
+
+// KnownDeviceRepository stores the devices users have signed in from
+type KnownDeviceRepository interface {
+	Remember(ctx context.Context, d *KnownDevice) (isNew bool, firstDevice bool, err error)
+	FindByUID(ctx context.Context, uid uuid.UUID) ([]*KnownDevice, error)
+}
+
+// BreachedPasswordRepository looks up passwords that are known from data breaches by their sha1 hash
+type BreachedPasswordRepository interface {
+	Contains(ctx context.Context, hash [sha1.Size]byte) (bool, error)
+}
+
+// RateLimitRepository counts the attempts made within fixed windows
+type RateLimitRepository interface {
+	Increment(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error)
 }
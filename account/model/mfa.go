@@ -0,0 +1,54 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// second factors an MFA challenge can be completed with
+const (
+	MFAMethodTOTP     = "totp"
+	MFAMethodWebAuthn = "webauthn"
+	MFAMethodRecovery = "recovery_code"
+)
+
+// TOTP holds the authenticator app secrets of a user. Both secrets are stored encrypted
+type TOTP struct {
+	UID            uuid.UUID  `db:"uid"`
+	Secret         string     `db:"secret"`         // empty until the first enrollment has been confirmed
+	PendingSecret  string     `db:"pending_secret"` // secret of an enrollment that still has to be confirmed with a code
+	LastUsedStep   int64      `db:"last_used_step"` // time step of the last accepted code, codes of this or earlier steps are rejected
+	EnabledAt      *time.Time `db:"enabled_at"`
+	FailedAttempts int        `db:"failed_attempts"` // wrong codes since the last accepted one
+	LockedUntil    *time.Time `db:"locked_until"`    // codes are rejected until then
+}
+
+// Enabled reports whether sign in requires a code
+func (t *TOTP) Enabled() bool {
+	return t != nil && t.Secret != ""
+}
+
+// RecoveryCode is one of the recovery codes of a user. Only the hash of the code is stored, it is never exposed
+type RecoveryCode struct {
+	ID        uuid.UUID  `db:"id" json:"id"`
+	UID       uuid.UUID  `db:"uid" json:"-"`
+	CodeHash  string     `db:"code_hash" json:"-"`
+	CreatedAt time.Time  `db:"created_at" json:"createdAt"`
+	UsedAt    *time.Time `db:"used_at" json:"usedAt"`
+}
+
+// MFAChallenge is returned instead of a token pair when signing in to an account with 2FA enabled.
+// The challenge token is exchanged for the token pair along with a code of one of the methods
+type MFAChallenge struct {
+	ChallengeToken string   `json:"challengeToken"`
+	Methods        []string `json:"methods"`
+	ExpiresIn      int64    `json:"expiresIn"` // seconds
+}
+
+// TOTPEnrollment holds what an authenticator app needs to be set up with a new secret
+type TOTPEnrollment struct {
+	URI    string `json:"uri"`    // otpauth:// provisioning uri
+	QRCode string `json:"qrCode"` // base64 encoded PNG of the uri
+	Secret string `json:"secret"` // base32 secret for manual entry
+}
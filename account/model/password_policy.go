@@ -0,0 +1,25 @@
+package model
+
+// Rules of the password policy, reported as the tag of the InvalidArgument of a violated rule
+const (
+	PasswordRuleMinLength = "min"
+	PasswordRuleMaxLength = "max"
+	PasswordRuleLower     = "lowercase"
+	PasswordRuleUpper     = "uppercase"
+	PasswordRuleDigit     = "digit"
+	PasswordRuleSymbol    = "symbol"
+	PasswordRuleUserInfo  = "user_info"
+	PasswordRuleBreached  = "breached"
+)
+
+// PasswordPolicy configures the rules new passwords have to follow. Lengths are counted in characters
+type PasswordPolicy struct {
+	MinLength      int
+	MaxLength      int // zero doesn't limit the length
+	RequireLower   bool
+	RequireUpper   bool
+	RequireDigit   bool
+	RequireSymbol  bool
+	RejectUserInfo bool // rejects passwords containing the email or the name of the user
+	RejectBreached bool // rejects passwords found in the breached password list
+}
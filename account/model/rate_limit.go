@@ -0,0 +1,53 @@
+package model
+
+import "time"
+
+// Actions protected by the rate limiter
+const (
+	ActionSignin        = "signin"
+	ActionSignup        = "signup"
+	ActionPasswordReset = "password_reset"
+	ActionTokenRefresh  = "token_refresh"
+	ActionMagicLink     = "magic_link"
+	ActionEmailCheck    = "email_check"
+	ActionMFA           = "mfa"
+)
+
+// RateLimit allows Limit attempts within each Window. A zero Limit turns the limit off
+type RateLimit struct {
+	Limit  int64
+	Window time.Duration
+}
+
+// RateLimitPolicy holds the limits of an action. Attempts are counted per client ip,
+// per email and per combination of both, so that neither distributed guessing against
+// one account nor guessing against many accounts from one client goes unnoticed
+type RateLimitPolicy struct {
+	PerIP      RateLimit
+	PerEmail   RateLimit
+	PerIPEmail RateLimit
+}
+
+// LockoutPolicy slows down and eventually stops password guessing against a single account, no matter
+// how many clients the guesses are spread across. A zero MaxFailures turns the lockout off
+type LockoutPolicy struct {
+	FreeAttempts int           // failed attempts before sign in is delayed
+	BaseDelay    time.Duration // delay after the first delayed attempt, doubled with every further failure
+	MaxFailures  int           // failed attempts after which the account is locked
+	Duration     time.Duration // how long a locked account stays locked, unless it is unlocked through the emailed link
+}
+
+// Delay returns how long further attempts are rejected after the given number of failed attempts,
+// which is 0 while the free attempts aren't used up
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	if failures < p.MaxFailures {
+		if d := p.BaseDelay << (failures - p.FreeAttempts - 1); d > 0 && d < p.Duration {
+			return d
+		}
+	}
+	return p.Duration
+}
@@ -0,0 +1,9 @@
+package model
+
+import "time"
+
+// Session is a refresh token issued to a user, one per signed in device
+type Session struct {
+	ID        string    `json:"id"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
@@ -1,6 +1,14 @@
 package model
 
+import "github.com/google/uuid"
+
 type TokenPair struct {
 	AccessToken  string `json:"accessToken"`
-	RefreshToken string `json:"refreshToken"`
+	RefreshToken string `json:"refreshToken,omitempty"` // empty if delivered in a cookie
+}
+
+// RefreshToken holds the claims of a validated refresh token
+type RefreshToken struct {
+	ID  string    // id the token is stored with in the token repository
+	UID uuid.UUID // id of the user the token has been issued for
 }
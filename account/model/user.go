@@ -1,15 +1,92 @@
 package model
 
 import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/google/uuid"
 )
 
+// roles of a user
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// states of a user account
+const (
+	StatusActive    = "active"
+	StatusSuspended = "suspended"
+)
+
 // User defines domain model and its json and db representations
 type User struct {
-	UID      uuid.UUID `db:"uid" json:"uid"`
-	Email    string    `db:"email" json:"email"`
-	Password string    `db:"password" json:"-"`
-	Name     string    `db:"name" json:"name"`
-	ImageURL string    `db:"image_url" json:"imageUrl"`
-	Website  string    `db:"website" json:"website"`
+	UID          uuid.UUID  `db:"uid" json:"uid"`
+	Email        string     `db:"email" json:"email"`
+	PendingEmail string     `db:"pending_email" json:"pendingEmail"` // new email awaiting confirmation, empty if there is no pending change
+	Password     string     `db:"password" json:"-"`
+	Name         string     `db:"name" json:"name"`
+	ImageURL     string     `db:"image_url" json:"imageUrl"`
+	Website      string     `db:"website" json:"website"`
+	Role         string     `db:"role" json:"role"`
+	Status       string     `db:"status" json:"status"`
+	CreatedAt    time.Time  `db:"created_at" json:"createdAt"`
+	DeletedAt    *time.Time `db:"deleted_at" json:"-"`               // set while the account waits to be purged
+	FailedLogins int        `db:"failed_logins" json:"failedLogins"` // failed sign in attempts since the last successful one
+	LockedUntil  *time.Time `db:"locked_until" json:"lockedUntil"`   // sign in attempts are rejected until then
+}
+
+// CheckActive returns an error if the user is not allowed to sign in or refresh tokens
+func (u *User) CheckActive() error {
+	if u.Status == StatusSuspended {
+		return NewForbidden("Account has been suspended.")
+	}
+	return nil
+}
+
+// Cursor returns the position of the user in the list of users, which is ordered by creation time and uid
+func (u *User) Cursor() string {
+	raw := fmt.Sprintf("%s|%s", u.CreatedAt.UTC().Format(time.RFC3339Nano), u.UID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseUserCursor returns the creation time and uid encoded in a cursor returned by User.Cursor
+func ParseUserCursor(cursor string) (time.Time, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.UUID{}, err
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return time.Time{}, uuid.UUID{}, fmt.Errorf("malformed cursor")
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, uuid.UUID{}, err
+	}
+
+	uid, err := uuid.Parse(parts[1])
+	if err != nil {
+		return time.Time{}, uuid.UUID{}, err
+	}
+
+	return createdAt, uid, nil
+}
+
+// UserFilter narrows down and paginates the list of users
+type UserFilter struct {
+	Search string // matches the users email or name, or the uid if it is a valid uuid
+	Status string // only users in this state if not empty
+	After  string // cursor of the last user of the previous page
+	Limit  int
+}
+
+// UserPage is a page of the list of users
+type UserPage struct {
+	Users      []*User `json:"users"`
+	NextCursor string  `json:"nextCursor"` // empty if this is the last page
 }
@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// types of user events
+const (
+	EventSessionRevoked = "session_revoked" // all sessions of the user have been revoked
+	EventProfileUpdated = "profile_updated" // the profile of the user has changed
+)
+
+// UserEvent notifies the connected clients of a user that something happened to the account
+type UserEvent struct {
+	Type      string    `json:"type"`
+	UID       uuid.UUID `json:"uid"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func NewUserEvent(eventType string, uid uuid.UUID) *UserEvent {
+	return &UserEvent{
+		Type:      eventType,
+		UID:       uid,
+		CreatedAt: time.Now(),
+	}
+}
@@ -0,0 +1,40 @@
+package model
+
+// Formats users can be imported from
+const (
+	ImportFormatCSV   = "csv"   // a header row naming the columns, followed by a row per user
+	ImportFormatJSONL = "jsonl" // a json object per line
+)
+
+// Schemes of the password hashes users can be imported with
+const (
+	HashSchemeBcrypt         = "bcrypt"
+	HashSchemeFirebaseScrypt = "firebase-scrypt"
+	HashSchemePBKDF2SHA256   = "pbkdf2-sha256"
+)
+
+// ImportedUser is a user exported from another auth system along with the hash of the password.
+// Salt and Hash are base64 encoded, except for bcrypt hashes which are passed in their usual $2a$ format
+type ImportedUser struct {
+	Email      string `json:"email"`
+	Name       string `json:"name"`
+	Scheme     string `json:"scheme"`
+	Hash       string `json:"hash"`
+	Salt       string `json:"salt"`
+	Iterations int    `json:"iterations"` // pbkdf2-sha256
+	Rounds     int    `json:"rounds"`     // firebase-scrypt
+	MemCost    int    `json:"memCost"`    // firebase-scrypt
+}
+
+// UserImportResult tells how many users have been imported and why the others haven't
+type UserImportResult struct {
+	Imported int                 `json:"imported"`
+	Failed   []UserImportFailure `json:"failed"`
+}
+
+// UserImportFailure is a user that couldn't be imported. Line is the line of the user in the input, starting at 1
+type UserImportFailure struct {
+	Line   int    `json:"line"`
+	Email  string `json:"email"`
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,125 @@
+package model
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RelyingParty identifies the app towards WebAuthn authenticators
+type RelyingParty struct {
+	ID      string   // domain the credentials are scoped to, e.g. "example.com"
+	Name    string   // shown by authenticators during registration
+	Origins []string // origins of the frontends the ceremonies are allowed to run on, e.g. "https://app.example.com"
+}
+
+// WebAuthnCredential is a passkey or security key registered by a user
+type WebAuthnCredential struct {
+	ID           uuid.UUID  `db:"id" json:"id"`
+	UID          uuid.UUID  `db:"uid" json:"-"`
+	CredentialID []byte     `db:"credential_id" json:"-"`
+	PublicKey    []byte     `db:"public_key" json:"-"` // COSE encoded
+	SignCount    int64      `db:"sign_count" json:"-"`
+	Transports   Transports `db:"transports" json:"transports"`
+	Nickname     string     `db:"nickname" json:"nickname"`
+	CreatedAt    time.Time  `db:"created_at" json:"createdAt"`
+	LastUsedAt   *time.Time `db:"last_used_at" json:"lastUsedAt"`
+}
+
+// Transports are the ways a client can reach an authenticator, e.g. "usb" or "internal".
+// They are stored as a comma separated list
+type Transports []string
+
+func (t Transports) Value() (driver.Value, error) {
+	return strings.Join(t, ","), nil
+}
+
+func (t *Transports) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case nil:
+	default:
+		return fmt.Errorf("cannot scan %T into Transports", src)
+	}
+
+	*t = Transports{}
+	if s != "" {
+		*t = strings.Split(s, ",")
+	}
+	return nil
+}
+
+// The following types mirror the options and results of navigator.credentials.create and navigator.credentials.get.
+// Binary values are base64url encoded without padding
+
+// WebAuthnCreationOptions are passed to navigator.credentials.create to register a new credential
+type WebAuthnCreationOptions struct {
+	Challenge              string                         `json:"challenge"`
+	RP                     WebAuthnRPEntity               `json:"rp"`
+	User                   WebAuthnUserEntity             `json:"user"`
+	PubKeyCredParams       []WebAuthnCredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                          `json:"timeout"` // milliseconds
+	ExcludeCredentials     []WebAuthnCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection WebAuthnAuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                         `json:"attestation"`
+}
+
+// WebAuthnRequestOptions are passed to navigator.credentials.get to authenticate with a registered credential
+type WebAuthnRequestOptions struct {
+	Challenge        string                         `json:"challenge"`
+	Timeout          int64                          `json:"timeout"` // milliseconds
+	RPID             string                         `json:"rpId"`
+	AllowCredentials []WebAuthnCredentialDescriptor `json:"allowCredentials"` // empty for discoverable credentials
+	UserVerification string                         `json:"userVerification"`
+}
+
+type WebAuthnRPEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type WebAuthnUserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type WebAuthnCredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type WebAuthnCredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type WebAuthnAuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// WebAuthnAttestation is the response of an authenticator to WebAuthnCreationOptions
+type WebAuthnAttestation struct {
+	ID                string   `json:"id" binding:"required"`
+	ClientDataJSON    string   `json:"clientDataJSON" binding:"required"`
+	AttestationObject string   `json:"attestationObject" binding:"required"`
+	Transports        []string `json:"transports"`
+}
+
+// WebAuthnAssertion is the response of an authenticator to WebAuthnRequestOptions
+type WebAuthnAssertion struct {
+	ID                string `json:"id" binding:"required"`
+	ClientDataJSON    string `json:"clientDataJSON" binding:"required"`
+	AuthenticatorData string `json:"authenticatorData" binding:"required"`
+	Signature         string `json:"signature" binding:"required"`
+	UserHandle        string `json:"userHandle"`
+}
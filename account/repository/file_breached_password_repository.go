@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/maxeth/go-account-api/model"
+)
+
+// BreachedPasswordPrefixLen is the number of hex characters of a sha1 hash every line of a breached password file
+// has to start with. Only this prefix is kept in memory, which is plenty to tell apart the hashes of any real-world corpus
+const BreachedPasswordPrefixLen = 16
+
+type fileBreachedPasswordRepository struct {
+	prefixes []uint64 // sorted
+}
+
+// NewBreachedPasswordRepository loads the breached password list at path, so that lookups work offline.
+// Every line holds the hex encoded sha1 hash of a password, or a prefix of at least BreachedPasswordPrefixLen characters,
+// optionally followed by a colon and the number of times it has been seen like in the Pwned Passwords downloads.
+// Empty lines and lines starting with # are skipped
+func NewBreachedPasswordRepository(path string) (model.BreachedPasswordRepository, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open breached password file: %w", err)
+	}
+	defer f.Close()
+
+	var prefixes []uint64
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if i := strings.IndexByte(text, ':'); i >= 0 {
+			text = text[:i]
+		}
+		if len(text) < BreachedPasswordPrefixLen {
+			return nil, fmt.Errorf("line %d of breached password file holds less than %d hex characters", line, BreachedPasswordPrefixLen)
+		}
+
+		b, err := hex.DecodeString(text[:BreachedPasswordPrefixLen])
+		if err != nil {
+			return nil, fmt.Errorf("line %d of breached password file is not hex encoded: %w", line, err)
+		}
+		prefixes = append(prefixes, binary.BigEndian.Uint64(b))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read breached password file: %w", err)
+	}
+
+	sort.Slice(prefixes, func(i, j int) bool { return prefixes[i] < prefixes[j] })
+
+	return &fileBreachedPasswordRepository{
+		prefixes: prefixes,
+	}, nil
+}
+
+func (r *fileBreachedPasswordRepository) Contains(ctx context.Context, hash [sha1.Size]byte) (bool, error) {
+	prefix := binary.BigEndian.Uint64(hash[:8])
+
+	i := sort.Search(len(r.prefixes), func(i int) bool { return r.prefixes[i] >= prefix })
+	return i < len(r.prefixes) && r.prefixes[i] == prefix, nil
+}
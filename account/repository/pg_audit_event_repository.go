@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/maxeth/go-account-api/model"
+)
+
+// auditInsertChunk bounds the rows per insert statement, postgres allows at most 65535 parameters per statement
+const auditInsertChunk = 500
+
+type pgAuditEventRepository struct {
+	DB *sqlx.DB
+}
+
+func NewAuditEventRepository(db *sqlx.DB) model.AuditEventRepository {
+	return &pgAuditEventRepository{
+		DB: db,
+	}
+}
+
+// Insert appends the events to the audit log, a multi row insert per chunk of events
+func (r *pgAuditEventRepository) Insert(ctx context.Context, events []*model.AuditEvent) error {
+	for start := 0; start < len(events); start += auditInsertChunk {
+		end := start + auditInsertChunk
+		if end > len(events) {
+			end = len(events)
+		}
+
+		rows := make([]string, 0, end-start)
+		args := make([]interface{}, 0, (end-start)*8)
+		for _, e := range events[start:end] {
+			n := len(args)
+			rows = append(rows, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8))
+			args = append(args, e.Type, e.ActorUID, e.SubjectUID, e.IP, e.UserAgent, e.RequestID, e.Details, e.CreatedAt)
+		}
+
+		q := "INSERT INTO audit_events (type, actor_uid, subject_uid, ip, user_agent, request_id, details, created_at) VALUES " + strings.Join(rows, ", ")
+		if _, err := r.DB.ExecContext(ctx, q, args...); err != nil {
+			fmt.Println("got error when inserting audit events:", err)
+			return model.NewInternal()
+		}
+	}
+
+	return nil
+}
+
+func (r *pgAuditEventRepository) List(ctx context.Context, filter model.AuditEventFilter) (*model.AuditEventPage, error) {
+	conds := []string{"TRUE"}
+	args := []interface{}{}
+
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.UID != nil {
+		p := arg(*filter.UID)
+		conds = append(conds, fmt.Sprintf("(actor_uid = %s OR subject_uid = %s)", p, p))
+	}
+
+	if filter.SubjectUID != nil {
+		conds = append(conds, "subject_uid = "+arg(*filter.SubjectUID))
+	}
+
+	if len(filter.Types) > 0 {
+		conds = append(conds, fmt.Sprintf("type = ANY(%s)", arg(pq.Array(filter.Types))))
+	}
+
+	if !filter.From.IsZero() {
+		conds = append(conds, "created_at >= "+arg(filter.From))
+	}
+
+	if !filter.To.IsZero() {
+		conds = append(conds, "created_at < "+arg(filter.To))
+	}
+
+	if filter.Before > 0 {
+		conds = append(conds, "id < "+arg(filter.Before))
+	}
+
+	// fetch one more row than requested to know whether there is a next page
+	q := fmt.Sprintf("SELECT * FROM audit_events WHERE %s ORDER BY id DESC LIMIT %s", strings.Join(conds, " AND "), arg(filter.Limit+1))
+
+	events := []*model.AuditEvent{}
+	if err := r.DB.SelectContext(ctx, &events, q, args...); err != nil {
+		fmt.Println("got error when listing audit events:", err)
+		return nil, model.NewInternal()
+	}
+
+	page := &model.AuditEventPage{Events: events}
+	if len(events) > filter.Limit {
+		page.Events = events[:filter.Limit]
+		page.NextCursor = strconv.FormatInt(page.Events[len(page.Events)-1].ID, 10)
+	}
+
+	return page, nil
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditEvents(t *testing.T) {
+	repo := NewAuditEventRepository(db)
+
+	uid := uuid.New()
+	adminUID := uuid.New()
+	now := time.Now().Truncate(time.Microsecond)
+
+	events := []*model.AuditEvent{
+		{Type: model.AuditSignup, ActorUID: &uid, SubjectUID: &uid, IP: "10.0.0.1", CreatedAt: now.Add(-time.Hour)},
+		{Type: model.AuditSigninFailed, SubjectUID: &uid, Details: model.AuditDetails{"reason": "invalid_password"}, CreatedAt: now.Add(-time.Minute)},
+		{Type: model.AuditRoleChanged, ActorUID: &adminUID, SubjectUID: &uid, Details: model.AuditDetails{"from": "user", "to": "admin"}, CreatedAt: now},
+	}
+	require.NoError(t, repo.Insert(context.Background(), events))
+
+	// the newest events come first
+	page, err := repo.List(context.Background(), model.AuditEventFilter{UID: &uid, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Events, 2)
+	require.Equal(t, model.AuditRoleChanged, page.Events[0].Type)
+	require.Equal(t, "admin", page.Events[0].Details["to"])
+	require.Equal(t, model.AuditSigninFailed, page.Events[1].Type)
+	require.Nil(t, page.Events[1].ActorUID)
+	require.NotEmpty(t, page.NextCursor)
+
+	before := page.Events[1].ID
+	page, err = repo.List(context.Background(), model.AuditEventFilter{UID: &uid, Before: before, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Events, 1)
+	require.Equal(t, model.AuditSignup, page.Events[0].Type)
+	require.Equal(t, "10.0.0.1", page.Events[0].IP)
+	require.Empty(t, page.NextCursor)
+
+	// the admin only acted on the user
+	page, err = repo.List(context.Background(), model.AuditEventFilter{UID: &adminUID, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, page.Events, 1)
+
+	page, err = repo.List(context.Background(), model.AuditEventFilter{SubjectUID: &adminUID, Limit: 10})
+	require.NoError(t, err)
+	require.Empty(t, page.Events)
+
+	page, err = repo.List(context.Background(), model.AuditEventFilter{UID: &uid, Types: []string{model.AuditSignup, model.AuditSigninFailed}, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, page.Events, 2)
+
+	page, err = repo.List(context.Background(), model.AuditEventFilter{UID: &uid, From: now.Add(-30 * time.Minute), To: now, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, page.Events, 1)
+	require.Equal(t, model.AuditSigninFailed, page.Events[0].Type)
+
+	// the log can't be changed
+	_, err = db.Exec("DELETE FROM audit_events WHERE id = $1", before)
+	require.Error(t, err)
+	_, err = db.Exec("UPDATE audit_events SET type = $1 WHERE id = $2", model.AuditSignup, before)
+	require.Error(t, err)
+
+	// only personal data can be removed
+	_, err = db.Exec("UPDATE audit_events SET subject_uid = NULL, ip = '', details = '{}' WHERE id = $1", before)
+	require.NoError(t, err)
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/maxeth/go-account-api/model"
+)
+
+type pgDataExportRepository struct {
+	DB *sqlx.DB
+}
+
+func NewDataExportRepository(db *sqlx.DB) model.DataExportRepository {
+	return &pgDataExportRepository{
+		DB: db,
+	}
+}
+
+func (r *pgDataExportRepository) Create(ctx context.Context, uid uuid.UUID) (*model.DataExport, error) {
+	q := "INSERT INTO data_exports (uid) VALUES ($1) RETURNING *"
+
+	e := &model.DataExport{}
+	if err := r.DB.GetContext(ctx, e, q, uid); err != nil {
+		fmt.Println("got error when creating data export:", err)
+		return nil, model.NewInternal()
+	}
+
+	return e, nil
+}
+
+func (r *pgDataExportRepository) FindByID(ctx context.Context, id uuid.UUID) (*model.DataExport, error) {
+	q := "SELECT * FROM data_exports WHERE id = $1"
+
+	return r.get(ctx, "id", id.String(), q, id)
+}
+
+// FindLatestByUID returns the most recently requested export of a user
+func (r *pgDataExportRepository) FindLatestByUID(ctx context.Context, uid uuid.UUID) (*model.DataExport, error) {
+	q := "SELECT * FROM data_exports WHERE uid = $1 ORDER BY created_at DESC LIMIT 1"
+
+	return r.get(ctx, "uid", uid.String(), q, uid)
+}
+
+// FindByDownloadTokenHash returns the finished export whose download link has not expired yet
+func (r *pgDataExportRepository) FindByDownloadTokenHash(ctx context.Context, tokenHash string) (*model.DataExport, error) {
+	q := "SELECT * FROM data_exports WHERE download_token_hash = $1 AND status = $2 AND expires_at > now()"
+
+	return r.get(ctx, "token", "", q, tokenHash, model.ExportDone)
+}
+
+// ClaimPending marks the oldest pending export as running and returns it. Exports which have been claimed before
+// staleBefore but never finished are claimed again, as the worker processing them has crashed. Locked rows are skipped,
+// so that multiple instances can process exports concurrently. Returns a not found error if nothing is pending
+func (r *pgDataExportRepository) ClaimPending(ctx context.Context, staleBefore time.Time) (*model.DataExport, error) {
+	q := `UPDATE data_exports SET status = $1, claimed_at = now(), attempts = attempts + 1
+	WHERE id = (
+		SELECT id FROM data_exports WHERE status = $2 OR (status = $1 AND claimed_at < $3)
+		ORDER BY created_at FOR UPDATE SKIP LOCKED LIMIT 1
+	)
+	RETURNING *`
+
+	return r.get(ctx, "status", model.ExportPending, q, model.ExportRunning, model.ExportPending, staleBefore)
+}
+
+// Complete stores the archive and download token of a finished export
+func (r *pgDataExportRepository) Complete(ctx context.Context, e *model.DataExport) error {
+	q := `UPDATE data_exports SET status = :status, archive = :archive, download_token_hash = :download_token_hash,
+	completed_at = :completed_at, expires_at = :expires_at WHERE id = :id`
+
+	e.Status = model.ExportDone
+	if _, err := r.DB.NamedExecContext(ctx, q, e); err != nil {
+		fmt.Println("got error when completing data export:", err)
+		return model.NewInternal()
+	}
+
+	return nil
+}
+
+func (r *pgDataExportRepository) Fail(ctx context.Context, id uuid.UUID) error {
+	q := "UPDATE data_exports SET status = $1, completed_at = now() WHERE id = $2"
+
+	if _, err := r.DB.ExecContext(ctx, q, model.ExportFailed, id); err != nil {
+		fmt.Println("got error when failing data export:", err)
+		return model.NewInternal()
+	}
+
+	return nil
+}
+
+// DeleteExpiredArchives drops the archives of all exports whose download link expired before expiredBefore.
+// The export rows are kept to be able to tell when a user requested an export
+func (r *pgDataExportRepository) DeleteExpiredArchives(ctx context.Context, expiredBefore time.Time) (int64, error) {
+	q := "UPDATE data_exports SET archive = NULL, download_token_hash = '' WHERE expires_at < $1 AND archive IS NOT NULL"
+
+	res, err := r.DB.ExecContext(ctx, q, expiredBefore)
+	if err != nil {
+		fmt.Println("got error when deleting expired data export archives:", err)
+		return 0, model.NewInternal()
+	}
+
+	return res.RowsAffected()
+}
+
+func (r *pgDataExportRepository) get(ctx context.Context, name, value, q string, args ...interface{}) (*model.DataExport, error) {
+	e := &model.DataExport{}
+	if err := r.DB.GetContext(ctx, e, q, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, model.NewNotFound(name, value)
+		}
+		fmt.Println("got error when querying data export:", err)
+		return nil, model.NewInternal()
+	}
+
+	return e, nil
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/maxeth/go-account-api/model"
+)
+
+type pgKnownDeviceRepository struct {
+	DB *sqlx.DB
+}
+
+func NewKnownDeviceRepository(db *sqlx.DB) model.KnownDeviceRepository {
+	return &pgKnownDeviceRepository{
+		DB: db,
+	}
+}
+
+// Remember stores the device, or updates when it has last been seen if it is known already, and reports whether it is new
+// and whether it is the first device of the user. Both the lookup and the insert happen in one statement
+func (r *pgKnownDeviceRepository) Remember(ctx context.Context, d *model.KnownDevice) (bool, bool, error) {
+	// the count is taken from the snapshot before the insert. xmax is only set for rows that have been updated
+	q := `WITH known AS (SELECT count(*) AS n FROM known_devices WHERE uid = $1),
+	remembered AS (
+		INSERT INTO known_devices (uid, user_agent_family, ip_prefix) VALUES ($1, $2, $3)
+		ON CONFLICT (uid, user_agent_family, ip_prefix) DO UPDATE SET last_seen_at = now()
+		RETURNING (xmax = 0) AS inserted
+	)
+	SELECT remembered.inserted, known.n = 0 FROM remembered, known`
+
+	var isNew, first bool
+	if err := r.DB.QueryRowxContext(ctx, q, d.UID, d.UserAgentFamily, d.IPPrefix).Scan(&isNew, &first); err != nil {
+		fmt.Println("got error when remembering device:", err)
+		return false, false, model.NewInternal()
+	}
+
+	return isNew, first, nil
+}
+
+// FindByUID returns the devices of the user, the one seen last first
+func (r *pgKnownDeviceRepository) FindByUID(ctx context.Context, uid uuid.UUID) ([]*model.KnownDevice, error) {
+	q := "SELECT * FROM known_devices WHERE uid = $1 ORDER BY last_seen_at DESC"
+
+	devices := []*model.KnownDevice{}
+	if err := r.DB.SelectContext(ctx, &devices, q, uid); err != nil {
+		fmt.Println("got error when querying known devices:", err)
+		return nil, model.NewInternal()
+	}
+
+	return devices, nil
+}
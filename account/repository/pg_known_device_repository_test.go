@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/maxeth/go-account-api/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKnownDevices(t *testing.T) {
+	userRepo := NewUserRepository(db)
+	repo := NewKnownDeviceRepository(db)
+
+	user, err := userRepo.Create(context.Background(), randomCreateUser())
+	require.NoError(t, err)
+
+	laptop := &model.KnownDevice{UID: user.UID, UserAgentFamily: "Firefox on Linux", IPPrefix: "10.0.0.0/24"}
+	phone := &model.KnownDevice{UID: user.UID, UserAgentFamily: "Safari on iOS", IPPrefix: "10.0.0.0/24"}
+
+	isNew, first, err := repo.Remember(context.Background(), laptop)
+	require.NoError(t, err)
+	require.True(t, isNew)
+	require.True(t, first)
+
+	isNew, first, err = repo.Remember(context.Background(), laptop)
+	require.NoError(t, err)
+	require.False(t, isNew)
+	require.False(t, first)
+
+	isNew, first, err = repo.Remember(context.Background(), phone)
+	require.NoError(t, err)
+	require.True(t, isNew)
+	require.False(t, first)
+
+	devices, err := repo.FindByUID(context.Background(), user.UID)
+	require.NoError(t, err)
+	require.Len(t, devices, 2)
+	require.Equal(t, phone.UserAgentFamily, devices[0].UserAgentFamily)
+	require.Equal(t, laptop.UserAgentFamily, devices[1].UserAgentFamily)
+}
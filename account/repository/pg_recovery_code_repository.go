@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/maxeth/go-account-api/model"
+)
+
+type pgRecoveryCodeRepository struct {
+	DB *sqlx.DB
+}
+
+func NewRecoveryCodeRepository(db *sqlx.DB) model.RecoveryCodeRepository {
+	return &pgRecoveryCodeRepository{
+		DB: db,
+	}
+}
+
+// Replace invalidates all codes of the user, used or not, and stores the hashes of a new set.
+// Both happen in one statement, so that the old set can't be used once the new one has been stored
+func (r *pgRecoveryCodeRepository) Replace(ctx context.Context, uid uuid.UUID, hashes []string) error {
+	q := `WITH deleted AS (DELETE FROM recovery_codes WHERE uid = $1)
+	INSERT INTO recovery_codes (uid, code_hash) SELECT $1, unnest($2::VARCHAR[])`
+
+	if _, err := r.DB.ExecContext(ctx, q, uid, pq.Array(hashes)); err != nil {
+		fmt.Println("got error when replacing recovery codes:", err)
+		return model.NewInternal()
+	}
+
+	return nil
+}
+
+// Use marks the unused code with the hash as used and reports whether there was one.
+// The check and the update happen in one statement, so that a code can't be used twice by concurrent requests
+func (r *pgRecoveryCodeRepository) Use(ctx context.Context, uid uuid.UUID, hash string) (bool, error) {
+	q := "UPDATE recovery_codes SET used_at = now() WHERE uid = $1 AND code_hash = $2 AND used_at IS NULL"
+
+	res, err := r.DB.ExecContext(ctx, q, uid, hash)
+	if err != nil {
+		fmt.Println("got error when using recovery code:", err)
+		return false, model.NewInternal()
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, model.NewInternal()
+	}
+
+	return n > 0, nil
+}
+
+// CountUnused returns how many codes of the user can still be used
+func (r *pgRecoveryCodeRepository) CountUnused(ctx context.Context, uid uuid.UUID) (int, error) {
+	q := "SELECT count(*) FROM recovery_codes WHERE uid = $1 AND used_at IS NULL"
+
+	var n int
+	if err := r.DB.GetContext(ctx, &n, q, uid); err != nil {
+		fmt.Println("got error when counting recovery codes:", err)
+		return 0, model.NewInternal()
+	}
+
+	return n, nil
+}
+
+// FindByUID returns the codes of the current set of the user, used or not, oldest first
+func (r *pgRecoveryCodeRepository) FindByUID(ctx context.Context, uid uuid.UUID) ([]*model.RecoveryCode, error) {
+	q := "SELECT * FROM recovery_codes WHERE uid = $1 ORDER BY created_at, id"
+
+	codes := []*model.RecoveryCode{}
+	if err := r.DB.SelectContext(ctx, &codes, q, uid); err != nil {
+		fmt.Println("got error when querying recovery codes:", err)
+		return nil, model.NewInternal()
+	}
+
+	return codes, nil
+}
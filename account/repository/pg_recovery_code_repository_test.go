@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	userRepo := NewUserRepository(db)
+	repo := NewRecoveryCodeRepository(db)
+
+	user, err := userRepo.Create(context.Background(), randomCreateUser())
+	require.NoError(t, err)
+
+	n, err := repo.CountUnused(context.Background(), user.UID)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	err = repo.Replace(context.Background(), user.UID, []string{"a", "b", "c"})
+	require.NoError(t, err)
+
+	n, err = repo.CountUnused(context.Background(), user.UID)
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+
+	// every code can only be used once
+	used, err := repo.Use(context.Background(), user.UID, "a")
+	require.NoError(t, err)
+	require.True(t, used)
+	used, err = repo.Use(context.Background(), user.UID, "a")
+	require.NoError(t, err)
+	require.False(t, used)
+
+	n, err = repo.CountUnused(context.Background(), user.UID)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	// a new set invalidates the old one
+	err = repo.Replace(context.Background(), user.UID, []string{"d", "e"})
+	require.NoError(t, err)
+
+	used, err = repo.Use(context.Background(), user.UID, "b")
+	require.NoError(t, err)
+	require.False(t, used)
+
+	n, err = repo.CountUnused(context.Background(), user.UID)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	// only the current set is listed
+	used, err = repo.Use(context.Background(), user.UID, "d")
+	require.NoError(t, err)
+	require.True(t, used)
+
+	codes, err := repo.FindByUID(context.Background(), user.UID)
+	require.NoError(t, err)
+	require.Len(t, codes, 2)
+	for _, c := range codes {
+		require.Equal(t, c.CodeHash == "d", c.UsedAt != nil)
+	}
+}
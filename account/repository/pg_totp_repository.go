@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/maxeth/go-account-api/model"
+)
+
+type pgTOTPRepository struct {
+	DB *sqlx.DB
+}
+
+func NewTOTPRepository(db *sqlx.DB) model.TOTPRepository {
+	return &pgTOTPRepository{
+		DB: db,
+	}
+}
+
+// Find returns the secrets of the user, or a not found error if the user never started an enrollment
+func (r *pgTOTPRepository) Find(ctx context.Context, uid uuid.UUID) (*model.TOTP, error) {
+	q := "SELECT * FROM user_totp WHERE uid = $1"
+
+	t := &model.TOTP{}
+	if err := r.DB.GetContext(ctx, t, q, uid); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, model.NewNotFound("uid", uid.String())
+		}
+		fmt.Println("got error when querying totp:", err)
+		return nil, model.NewInternal()
+	}
+
+	return t, nil
+}
+
+// SetPendingSecret stores the secret of a new enrollment, replacing any enrollment that hasn't been confirmed.
+// An already active secret stays in use until the new one is activated
+func (r *pgTOTPRepository) SetPendingSecret(ctx context.Context, uid uuid.UUID, secret string) error {
+	q := `INSERT INTO user_totp (uid, pending_secret) VALUES ($1, $2)
+	ON CONFLICT (uid) DO UPDATE SET pending_secret = EXCLUDED.pending_secret`
+
+	if _, err := r.DB.ExecContext(ctx, q, uid, secret); err != nil {
+		fmt.Println("got error when setting pending totp secret:", err)
+		return model.NewInternal()
+	}
+
+	return nil
+}
+
+// Activate replaces the active secret with the pending one, which has been confirmed with a code of the step
+func (r *pgTOTPRepository) Activate(ctx context.Context, uid uuid.UUID, step int64) error {
+	q := `UPDATE user_totp SET secret = pending_secret, pending_secret = '', last_used_step = $2, enabled_at = now()
+	WHERE uid = $1 AND pending_secret <> ''`
+
+	res, err := r.DB.ExecContext(ctx, q, uid, step)
+	if err != nil {
+		fmt.Println("got error when activating totp secret:", err)
+		return model.NewInternal()
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return model.NewNotFound("uid", uid.String())
+	}
+
+	return nil
+}
+
+// UseStep marks the step as used and reports whether it was later than the last used one.
+// The check and the update happen in one statement, so that a code can't be used twice by concurrent requests
+func (r *pgTOTPRepository) UseStep(ctx context.Context, uid uuid.UUID, step int64) (bool, error) {
+	q := "UPDATE user_totp SET last_used_step = $2 WHERE uid = $1 AND last_used_step < $2"
+
+	res, err := r.DB.ExecContext(ctx, q, uid, step)
+	if err != nil {
+		fmt.Println("got error when using totp step:", err)
+		return false, model.NewInternal()
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, model.NewInternal()
+	}
+
+	return n > 0, nil
+}
+
+// ClaimAttempt counts an attempt to enter a code before the code is checked, and delays further attempts as the policy
+// demands. Like UserRepository.ClaimLoginAttempt, the row is locked while doing so, so that concurrent attempts can't all
+// pass the check. Returns the secrets after the attempt, and false without counting anything while attempts are delayed
+func (r *pgTOTPRepository) ClaimAttempt(ctx context.Context, uid uuid.UUID, policy model.LockoutPolicy) (*model.TOTP, bool, error) {
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		fmt.Println("got error when claiming totp attempt:", err)
+		return nil, false, model.NewInternal()
+	}
+	defer tx.Rollback()
+
+	t := &model.TOTP{}
+	if err := tx.GetContext(ctx, t, "SELECT * FROM user_totp WHERE uid = $1 FOR UPDATE", uid); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, model.NewNotFound("uid", uid.String())
+		}
+		fmt.Println("got error when claiming totp attempt:", err)
+		return nil, false, model.NewInternal()
+	}
+
+	now := time.Now()
+	if t.LockedUntil != nil && t.LockedUntil.After(now) {
+		return t, false, nil
+	}
+
+	var lockedUntil *time.Time
+	if delay := policy.Delay(t.FailedAttempts + 1); delay > 0 {
+		until := now.Add(delay)
+		lockedUntil = &until
+	}
+
+	q := "UPDATE user_totp SET failed_attempts = failed_attempts + 1, locked_until = $1 WHERE uid = $2 RETURNING *"
+	if err := tx.GetContext(ctx, t, q, lockedUntil, uid); err != nil {
+		fmt.Println("got error when claiming totp attempt:", err)
+		return nil, false, model.NewInternal()
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("got error when claiming totp attempt:", err)
+		return nil, false, model.NewInternal()
+	}
+
+	return t, true, nil
+}
+
+// ResetFailedAttempts clears the wrong codes and lifts any lock after a code has been accepted
+func (r *pgTOTPRepository) ResetFailedAttempts(ctx context.Context, uid uuid.UUID) error {
+	q := "UPDATE user_totp SET failed_attempts = 0, locked_until = NULL WHERE uid = $1"
+
+	if _, err := r.DB.ExecContext(ctx, q, uid); err != nil {
+		fmt.Println("got error when resetting failed totp attempts:", err)
+		return model.NewInternal()
+	}
+
+	return nil
+}
+
+// Delete removes all secrets of the user, turning 2FA off
+func (r *pgTOTPRepository) Delete(ctx context.Context, uid uuid.UUID) error {
+	q := "DELETE FROM user_totp WHERE uid = $1"
+
+	if _, err := r.DB.ExecContext(ctx, q, uid); err != nil {
+		fmt.Println("got error when deleting totp:", err)
+		return model.NewInternal()
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/maxeth/go-account-api/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTP(t *testing.T) {
+	userRepo := NewUserRepository(db)
+	repo := NewTOTPRepository(db)
+
+	user, err := userRepo.Create(context.Background(), randomCreateUser())
+	require.NoError(t, err)
+
+	err = repo.SetPendingSecret(context.Background(), user.UID, "pending")
+	require.NoError(t, err)
+
+	totp, err := repo.Find(context.Background(), user.UID)
+	require.NoError(t, err)
+	require.False(t, totp.Enabled())
+	require.Equal(t, "pending", totp.PendingSecret)
+
+	err = repo.Activate(context.Background(), user.UID, 10)
+	require.NoError(t, err)
+
+	totp, err = repo.Find(context.Background(), user.UID)
+	require.NoError(t, err)
+	require.True(t, totp.Enabled())
+	require.Equal(t, "pending", totp.Secret)
+	require.Empty(t, totp.PendingSecret)
+	require.NotNil(t, totp.EnabledAt)
+
+	// steps up to the one the secret has been confirmed with can't be used again
+	used, err := repo.UseStep(context.Background(), user.UID, 10)
+	require.NoError(t, err)
+	require.False(t, used)
+	used, err = repo.UseStep(context.Background(), user.UID, 11)
+	require.NoError(t, err)
+	require.True(t, used)
+	used, err = repo.UseStep(context.Background(), user.UID, 11)
+	require.NoError(t, err)
+	require.False(t, used)
+
+	// wrong codes are delayed like failed sign ins, until a code is accepted
+	policy := model.LockoutPolicy{FreeAttempts: 1, BaseDelay: time.Minute, MaxFailures: 3, Duration: time.Hour}
+	totp, claimed, err := repo.ClaimAttempt(context.Background(), user.UID, policy)
+	require.NoError(t, err)
+	require.True(t, claimed)
+	require.Equal(t, 1, totp.FailedAttempts)
+	require.Nil(t, totp.LockedUntil)
+	totp, claimed, err = repo.ClaimAttempt(context.Background(), user.UID, policy)
+	require.NoError(t, err)
+	require.True(t, claimed)
+	require.WithinDuration(t, time.Now().Add(time.Minute), *totp.LockedUntil, time.Second)
+	_, claimed, err = repo.ClaimAttempt(context.Background(), user.UID, policy)
+	require.NoError(t, err)
+	require.False(t, claimed)
+
+	err = repo.ResetFailedAttempts(context.Background(), user.UID)
+	require.NoError(t, err)
+	totp, err = repo.Find(context.Background(), user.UID)
+	require.NoError(t, err)
+	require.Zero(t, totp.FailedAttempts)
+	require.Nil(t, totp.LockedUntil)
+
+	err = repo.Delete(context.Background(), user.UID)
+	require.NoError(t, err)
+
+	_, err = repo.Find(context.Background(), user.UID)
+	require.Error(t, err)
+}
@@ -2,7 +2,11 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
@@ -20,14 +24,20 @@ func NewUserRepository(db *sqlx.DB) model.UserRepository {
 	}
 }
 
+// isUniqueViolation checks whether err is a unique constraint violation pg error
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code.Name() == "unique_violation"
+}
+
 func (r *pgUserRepository) Create(ctx context.Context, u *model.User) (*model.User, error) {
-	q := "INSERT INTO users (email, password) VALUES ($1, $2) RETURNING *"
+	q := "INSERT INTO users (email, password, name) VALUES ($1, $2, $3) RETURNING *"
 
 	user := &model.User{}
-	if err := r.DB.GetContext(ctx, user, q, u.Email, u.Password); err != nil {
+	if err := r.DB.GetContext(ctx, user, q, u.Email, u.Password, u.Name); err != nil {
 		fmt.Println("got error when creating user:", err)
 		// check whether its a unique constrain viloation pg error
-		if err, ok := err.(*pq.Error); ok && err.Code.Name() == "unique_violation" {
+		if isUniqueViolation(err) {
 			errM := model.NewConflict("email", u.Email)
 			return &model.User{}, errM
 		}
@@ -40,24 +50,301 @@ func (r *pgUserRepository) Create(ctx context.Context, u *model.User) (*model.Us
 	return user, nil
 }
 
+// Update overwrites all mutable columns of the user with the given uid
+func (r *pgUserRepository) Update(ctx context.Context, u *model.User) error {
+	q := `UPDATE users SET name = :name, email = :email, pending_email = :pending_email, image_url = :image_url, website = :website
+	WHERE uid = :uid AND deleted_at IS NULL`
+
+	res, err := r.DB.NamedExecContext(ctx, q, u)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return model.NewConflict("email", u.Email)
+		}
+
+		fmt.Println("got error when updating user:", err)
+		return model.NewInternal()
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return model.NewNotFound("uid", u.UID.String())
+	}
+
+	return nil
+}
+
 func (r *pgUserRepository) FindByID(ctx context.Context, uid uuid.UUID) (*model.User, error) {
-	q := "SELECT * FROM users u WHERE id = $1 LIMIT 1"
+	q := "SELECT * FROM users u WHERE uid = $1 AND deleted_at IS NULL LIMIT 1"
 
 	user := &model.User{}
 	if err := r.DB.GetContext(ctx, user, q, uid); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &model.User{}, model.NewNotFound("uid", uid.String())
+		}
 		return &model.User{}, model.NewInternal()
 	}
 
 	return user, nil
 }
 
+// FindByIDs returns all users with one of the uids in a single query. Uids of missing or deleted
+// users are skipped, so the result can be shorter than uids and isn't in any particular order
+func (r *pgUserRepository) FindByIDs(ctx context.Context, uids []uuid.UUID) ([]*model.User, error) {
+	q := "SELECT * FROM users u WHERE uid = ANY($1) AND deleted_at IS NULL"
+
+	ids := make([]string, len(uids))
+	for i, uid := range uids {
+		ids[i] = uid.String()
+	}
+
+	users := []*model.User{}
+	if err := r.DB.SelectContext(ctx, &users, q, pq.Array(ids)); err != nil {
+		fmt.Println("got error when finding users:", err)
+		return nil, model.NewInternal()
+	}
+
+	return users, nil
+}
+
 func (r *pgUserRepository) FindByEmail(ctx context.Context, email string) (*model.User, error) {
-	q := "SELECT * FROM users u WHERE email = $1 LIMIT 1"
+	q := "SELECT * FROM users u WHERE email = $1 AND deleted_at IS NULL LIMIT 1"
 
 	user := &model.User{}
 	if err := r.DB.GetContext(ctx, user, q, email); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &model.User{}, model.NewNotFound("email", email)
+		}
+		return &model.User{}, model.NewInternal()
+	}
+
+	return user, nil
+}
+
+// EmailExists checks whether any user has the email. Soft deleted users are included,
+// as their email stays reserved until they are purged
+func (r *pgUserRepository) EmailExists(ctx context.Context, email string) (bool, error) {
+	q := "SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)"
+
+	var exists bool
+	if err := r.DB.GetContext(ctx, &exists, q, email); err != nil {
+		return false, model.NewInternal()
+	}
+
+	return exists, nil
+}
+
+// SoftDelete marks the user as deleted. Deleted users are treated as gone by all
+// find methods, but the row (and therefore the email) is kept until it is purged
+func (r *pgUserRepository) SoftDelete(ctx context.Context, uid uuid.UUID) error {
+	q := "UPDATE users SET deleted_at = now() WHERE uid = $1 AND deleted_at IS NULL"
+
+	res, err := r.DB.ExecContext(ctx, q, uid)
+	if err != nil {
+		fmt.Println("got error when soft deleting user:", err)
+		return model.NewInternal()
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return model.NewNotFound("uid", uid.String())
+	}
+
+	return nil
+}
+
+// Restore reverts a soft delete of a user that has not been purged yet
+func (r *pgUserRepository) Restore(ctx context.Context, uid uuid.UUID) (*model.User, error) {
+	q := "UPDATE users SET deleted_at = NULL WHERE uid = $1 AND deleted_at IS NOT NULL RETURNING *"
+
+	user := &model.User{}
+	if err := r.DB.GetContext(ctx, user, q, uid); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &model.User{}, model.NewNotFound("uid", uid.String())
+		}
 		return &model.User{}, model.NewInternal()
 	}
 
 	return user, nil
 }
+
+// PurgeDeleted permanently deletes all users soft deleted before deletedBefore and returns their ids.
+// Their audit events are kept but anonymized in the same statement: the uids are cleared, and so are the ip, user agent
+// and the details identifying them, unless the event was triggered by someone else like an admin
+func (r *pgUserRepository) PurgeDeleted(ctx context.Context, deletedBefore time.Time) ([]uuid.UUID, error) {
+	q := `WITH purged AS (DELETE FROM users WHERE deleted_at < $1 RETURNING uid),
+	anonymized AS (
+		UPDATE audit_events SET
+			actor_uid = CASE WHEN actor_uid IN (SELECT uid FROM purged) THEN NULL ELSE actor_uid END,
+			subject_uid = CASE WHEN subject_uid IN (SELECT uid FROM purged) THEN NULL ELSE subject_uid END,
+			ip = CASE WHEN actor_uid IS NULL OR actor_uid IN (SELECT uid FROM purged) THEN '' ELSE ip END,
+			user_agent = CASE WHEN actor_uid IS NULL OR actor_uid IN (SELECT uid FROM purged) THEN '' ELSE user_agent END,
+			details = details - ARRAY['email', 'ipPrefix', 'userAgentFamily']
+		WHERE actor_uid IN (SELECT uid FROM purged) OR subject_uid IN (SELECT uid FROM purged)
+	)
+	SELECT uid FROM purged`
+
+	var uids []uuid.UUID
+	if err := r.DB.SelectContext(ctx, &uids, q, deletedBefore); err != nil {
+		fmt.Println("got error when purging deleted users:", err)
+		return nil, model.NewInternal()
+	}
+
+	return uids, nil
+}
+
+func (r *pgUserRepository) UpdatePassword(ctx context.Context, uid uuid.UUID, password string) error {
+	q := "UPDATE users SET password = $1 WHERE uid = $2 AND deleted_at IS NULL"
+
+	res, err := r.DB.ExecContext(ctx, q, password, uid)
+	if err != nil {
+		fmt.Println("got error when updating password:", err)
+		return model.NewInternal()
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return model.NewNotFound("uid", uid.String())
+	}
+
+	return nil
+}
+
+func (r *pgUserRepository) SetStatus(ctx context.Context, uid uuid.UUID, status string) (*model.User, error) {
+	q := "UPDATE users SET status = $1 WHERE uid = $2 AND deleted_at IS NULL RETURNING *"
+
+	user := &model.User{}
+	if err := r.DB.GetContext(ctx, user, q, status, uid); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, model.NewNotFound("uid", uid.String())
+		}
+		fmt.Println("got error when setting user status:", err)
+		return nil, model.NewInternal()
+	}
+
+	return user, nil
+}
+
+// SetRole changes the role of the user and returns the updated user
+func (r *pgUserRepository) SetRole(ctx context.Context, uid uuid.UUID, role string) (*model.User, error) {
+	q := "UPDATE users SET role = $1 WHERE uid = $2 AND deleted_at IS NULL RETURNING *"
+
+	user := &model.User{}
+	if err := r.DB.GetContext(ctx, user, q, role, uid); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, model.NewNotFound("uid", uid.String())
+		}
+		fmt.Println("got error when setting user role:", err)
+		return nil, model.NewInternal()
+	}
+
+	return user, nil
+}
+
+// ClaimLoginAttempt counts a sign in attempt of the user before its credentials are checked, and delays further attempts
+// as the policy demands. The row is locked while doing so, so that concurrent attempts are counted one after another and
+// can't all pass the check. Returns the user after the attempt, and false without counting anything while attempts are delayed
+func (r *pgUserRepository) ClaimLoginAttempt(ctx context.Context, uid uuid.UUID, policy model.LockoutPolicy) (*model.User, bool, error) {
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		fmt.Println("got error when claiming login attempt:", err)
+		return nil, false, model.NewInternal()
+	}
+	defer tx.Rollback()
+
+	user := &model.User{}
+	if err := tx.GetContext(ctx, user, "SELECT * FROM users WHERE uid = $1 AND deleted_at IS NULL FOR UPDATE", uid); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, model.NewNotFound("uid", uid.String())
+		}
+		fmt.Println("got error when claiming login attempt:", err)
+		return nil, false, model.NewInternal()
+	}
+
+	now := time.Now()
+	if user.LockedUntil != nil && user.LockedUntil.After(now) {
+		return user, false, nil
+	}
+
+	var lockedUntil *time.Time
+	if delay := policy.Delay(user.FailedLogins + 1); delay > 0 {
+		t := now.Add(delay)
+		lockedUntil = &t
+	}
+
+	q := "UPDATE users SET failed_logins = failed_logins + 1, locked_until = $1 WHERE uid = $2 RETURNING *"
+	if err := tx.GetContext(ctx, user, q, lockedUntil, uid); err != nil {
+		fmt.Println("got error when claiming login attempt:", err)
+		return nil, false, model.NewInternal()
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("got error when claiming login attempt:", err)
+		return nil, false, model.NewInternal()
+	}
+
+	return user, true, nil
+}
+
+// ResetFailedLogins clears the failed sign in attempts and lifts any lock
+func (r *pgUserRepository) ResetFailedLogins(ctx context.Context, uid uuid.UUID) error {
+	q := "UPDATE users SET failed_logins = 0, locked_until = NULL WHERE uid = $1"
+
+	if _, err := r.DB.ExecContext(ctx, q, uid); err != nil {
+		fmt.Println("got error when resetting failed logins:", err)
+		return model.NewInternal()
+	}
+
+	return nil
+}
+
+// List returns a page of users ordered by their creation, matching the filter
+func (r *pgUserRepository) List(ctx context.Context, filter model.UserFilter) (*model.UserPage, error) {
+	conds := []string{"deleted_at IS NULL"}
+	args := []interface{}{}
+
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.Search != "" {
+		if uid, err := uuid.Parse(filter.Search); err == nil {
+			conds = append(conds, "uid = "+arg(uid))
+		} else {
+			pattern := "%" + escapeLike(filter.Search) + "%"
+			p := arg(pattern)
+			conds = append(conds, fmt.Sprintf("(email ILIKE %s OR name ILIKE %s)", p, p))
+		}
+	}
+
+	if filter.Status != "" {
+		conds = append(conds, "status = "+arg(filter.Status))
+	}
+
+	if filter.After != "" {
+		createdAt, uid, err := model.ParseUserCursor(filter.After)
+		if err != nil {
+			return nil, model.NewValidation("after", "Invalid cursor.")
+		}
+		conds = append(conds, fmt.Sprintf("(created_at, uid) > (%s, %s)", arg(createdAt), arg(uid)))
+	}
+
+	// fetch one more row than requested to know whether there is a next page
+	q := fmt.Sprintf("SELECT * FROM users WHERE %s ORDER BY created_at, uid LIMIT %s", strings.Join(conds, " AND "), arg(filter.Limit+1))
+
+	users := []*model.User{}
+	if err := r.DB.SelectContext(ctx, &users, q, args...); err != nil {
+		fmt.Println("got error when listing users:", err)
+		return nil, model.NewInternal()
+	}
+
+	page := &model.UserPage{Users: users}
+	if len(users) > filter.Limit {
+		page.Users = users[:filter.Limit]
+		page.NextCursor = page.Users[len(page.Users)-1].Cursor()
+	}
+
+	return page, nil
+}
+
+// escapeLike escapes the wildcard characters of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
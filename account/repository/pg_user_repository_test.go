@@ -2,8 +2,12 @@ package repository
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/maxeth/go-account-api/library"
 	"github.com/maxeth/go-account-api/model"
 	"github.com/stretchr/testify/require"
@@ -40,3 +44,205 @@ func TestCreateUser(t *testing.T) {
 	require.Equal(t, 409, errM.Status())
 	require.Empty(t, gotUser2)
 }
+
+func TestUpdateUser(t *testing.T) {
+	repo := NewUserRepository(db)
+
+	user, err := repo.Create(context.Background(), randomCreateUser())
+	require.NoError(t, err)
+	otherUser, err := repo.Create(context.Background(), randomCreateUser())
+	require.NoError(t, err)
+
+	user.PendingEmail = library.RandomString(8)
+	err = repo.Update(context.Background(), user)
+	require.NoError(t, err)
+
+	gotUser, err := repo.FindByID(context.Background(), user.UID)
+	require.NoError(t, err)
+	require.Equal(t, user.PendingEmail, gotUser.PendingEmail)
+
+	// switching to an email of another user violates the unique constraint
+	user.Email = otherUser.Email
+	err = repo.Update(context.Background(), user)
+
+	errM, ok := err.(*model.Error)
+	require.True(t, ok)
+	require.Equal(t, 409, errM.Status())
+	require.Equal(t, "email", errM.Field)
+}
+
+func TestSoftDeleteUser(t *testing.T) {
+	repo := NewUserRepository(db)
+
+	user, err := repo.Create(context.Background(), randomCreateUser())
+	require.NoError(t, err)
+
+	err = repo.SoftDelete(context.Background(), user.UID)
+	require.NoError(t, err)
+
+	// soft deleted users are treated as gone
+	_, err = repo.FindByID(context.Background(), user.UID)
+	require.Equal(t, 404, model.Status(err))
+	_, err = repo.FindByEmail(context.Background(), user.Email)
+	require.Equal(t, 404, model.Status(err))
+
+	// but keep their email until they are purged
+	_, err = repo.Create(context.Background(), &model.User{Email: user.Email, Password: user.Password})
+	require.Equal(t, 409, model.Status(err))
+
+	restored, err := repo.Restore(context.Background(), user.UID)
+	require.NoError(t, err)
+	require.Equal(t, user.UID, restored.UID)
+	require.Nil(t, restored.DeletedAt)
+}
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	repo := NewUserRepository(db)
+	auditRepo := NewAuditEventRepository(db)
+
+	user, err := repo.Create(context.Background(), randomCreateUser())
+	require.NoError(t, err)
+	admin, err := repo.Create(context.Background(), randomCreateUser())
+	require.NoError(t, err)
+
+	events := []*model.AuditEvent{
+		{Type: model.AuditSigninFailed, ActorUID: &user.UID, SubjectUID: &user.UID, IP: "10.0.0.1", UserAgent: "curl", Details: model.AuditDetails{"email": user.Email}, CreatedAt: time.Now()},
+		{Type: model.AuditRoleChanged, ActorUID: &admin.UID, SubjectUID: &user.UID, IP: "10.0.0.2", Details: model.AuditDetails{"to": "admin"}, CreatedAt: time.Now()},
+	}
+	require.NoError(t, auditRepo.Insert(context.Background(), events))
+
+	require.NoError(t, repo.SoftDelete(context.Background(), user.UID))
+
+	uids, err := repo.PurgeDeleted(context.Background(), time.Now())
+	require.NoError(t, err)
+	require.Contains(t, uids, user.UID)
+	require.NotContains(t, uids, admin.UID)
+
+	// the events stay but no longer identify the user
+	page, err := auditRepo.List(context.Background(), model.AuditEventFilter{UID: &user.UID, Limit: 10})
+	require.NoError(t, err)
+	require.Empty(t, page.Events)
+
+	page, err = auditRepo.List(context.Background(), model.AuditEventFilter{UID: &admin.UID, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, page.Events, 1)
+	require.Nil(t, page.Events[0].SubjectUID)
+	require.Equal(t, "10.0.0.2", page.Events[0].IP)
+	require.Equal(t, "admin", page.Events[0].Details["to"])
+
+	var anonymized model.AuditEvent
+	require.NoError(t, db.Get(&anonymized, "SELECT * FROM audit_events WHERE id = $1", page.Events[0].ID-1))
+	require.Equal(t, model.AuditSigninFailed, anonymized.Type)
+	require.Nil(t, anonymized.ActorUID)
+	require.Empty(t, anonymized.IP)
+	require.Empty(t, anonymized.UserAgent)
+	require.Empty(t, anonymized.Details)
+}
+
+func TestEmailExists(t *testing.T) {
+	repo := NewUserRepository(db)
+
+	user, err := repo.Create(context.Background(), randomCreateUser())
+	require.NoError(t, err)
+
+	exists, err := repo.EmailExists(context.Background(), user.Email)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	// the email of a soft deleted user stays reserved until it is purged
+	err = repo.SoftDelete(context.Background(), user.UID)
+	require.NoError(t, err)
+
+	exists, err = repo.EmailExists(context.Background(), user.Email)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	exists, err = repo.EmailExists(context.Background(), library.RandomString(12))
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+func TestFindUsersByIDs(t *testing.T) {
+	repo := NewUserRepository(db)
+
+	user, err := repo.Create(context.Background(), randomCreateUser())
+	require.NoError(t, err)
+	otherUser, err := repo.Create(context.Background(), randomCreateUser())
+	require.NoError(t, err)
+	deletedUser, err := repo.Create(context.Background(), randomCreateUser())
+	require.NoError(t, err)
+	require.NoError(t, repo.SoftDelete(context.Background(), deletedUser.UID))
+
+	// missing and deleted users are skipped
+	users, err := repo.FindByIDs(context.Background(), []uuid.UUID{user.UID, otherUser.UID, deletedUser.UID, uuid.New()})
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	require.ElementsMatch(t, []uuid.UUID{user.UID, otherUser.UID}, []uuid.UUID{users[0].UID, users[1].UID})
+
+	users, err = repo.FindByIDs(context.Background(), []uuid.UUID{})
+	require.NoError(t, err)
+	require.Empty(t, users)
+}
+
+func TestFailedLogins(t *testing.T) {
+	repo := NewUserRepository(db)
+
+	user, err := repo.Create(context.Background(), randomCreateUser())
+	require.NoError(t, err)
+
+	policy := model.LockoutPolicy{FreeAttempts: 1, BaseDelay: time.Minute, MaxFailures: 3, Duration: time.Hour}
+
+	// the free attempt isn't delayed
+	gotUser, claimed, err := repo.ClaimLoginAttempt(context.Background(), user.UID, policy)
+	require.NoError(t, err)
+	require.True(t, claimed)
+	require.Equal(t, 1, gotUser.FailedLogins)
+	require.Nil(t, gotUser.LockedUntil)
+
+	gotUser, claimed, err = repo.ClaimLoginAttempt(context.Background(), user.UID, policy)
+	require.NoError(t, err)
+	require.True(t, claimed)
+	require.Equal(t, 2, gotUser.FailedLogins)
+	require.WithinDuration(t, time.Now().Add(time.Minute), *gotUser.LockedUntil, time.Second)
+
+	// attempts during the delay aren't counted
+	gotUser, claimed, err = repo.ClaimLoginAttempt(context.Background(), user.UID, policy)
+	require.NoError(t, err)
+	require.False(t, claimed)
+	require.Equal(t, 2, gotUser.FailedLogins)
+
+	err = repo.ResetFailedLogins(context.Background(), user.UID)
+	require.NoError(t, err)
+
+	gotUser, err = repo.FindByID(context.Background(), user.UID)
+	require.NoError(t, err)
+	require.Zero(t, gotUser.FailedLogins)
+	require.Nil(t, gotUser.LockedUntil)
+}
+
+func TestClaimLoginAttemptConcurrently(t *testing.T) {
+	repo := NewUserRepository(db)
+
+	user, err := repo.Create(context.Background(), randomCreateUser())
+	require.NoError(t, err)
+
+	policy := model.LockoutPolicy{FreeAttempts: 3, BaseDelay: time.Minute, MaxFailures: 10, Duration: time.Hour}
+
+	// of many parallel attempts, only the free ones and the one starting the delay get through
+	var wg sync.WaitGroup
+	var claims int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, claimed, err := repo.ClaimLoginAttempt(context.Background(), user.UID, policy)
+			require.NoError(t, err)
+			if claimed {
+				atomic.AddInt32(&claims, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, int32(4), claims)
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/maxeth/go-account-api/model"
+)
+
+type pgWebAuthnCredentialRepository struct {
+	DB *sqlx.DB
+}
+
+func NewWebAuthnCredentialRepository(db *sqlx.DB) model.WebAuthnCredentialRepository {
+	return &pgWebAuthnCredentialRepository{
+		DB: db,
+	}
+}
+
+func (r *pgWebAuthnCredentialRepository) Create(ctx context.Context, c *model.WebAuthnCredential) (*model.WebAuthnCredential, error) {
+	q := `INSERT INTO webauthn_credentials (uid, credential_id, public_key, sign_count, transports, nickname)
+	VALUES ($1, $2, $3, $4, $5, $6) RETURNING *`
+
+	cred := &model.WebAuthnCredential{}
+	if err := r.DB.GetContext(ctx, cred, q, c.UID, c.CredentialID, c.PublicKey, c.SignCount, c.Transports, c.Nickname); err != nil {
+		if isUniqueViolation(err) {
+			return nil, model.NewConflict("credential", c.Nickname)
+		}
+		fmt.Println("got error when creating webauthn credential:", err)
+		return nil, model.NewInternal()
+	}
+
+	return cred, nil
+}
+
+// FindByUID returns the credentials of the user, oldest first
+func (r *pgWebAuthnCredentialRepository) FindByUID(ctx context.Context, uid uuid.UUID) ([]*model.WebAuthnCredential, error) {
+	q := "SELECT * FROM webauthn_credentials WHERE uid = $1 ORDER BY created_at"
+
+	creds := []*model.WebAuthnCredential{}
+	if err := r.DB.SelectContext(ctx, &creds, q, uid); err != nil {
+		fmt.Println("got error when querying webauthn credentials:", err)
+		return nil, model.NewInternal()
+	}
+
+	return creds, nil
+}
+
+// FindByCredentialID returns the credential with the id assigned by the authenticator
+func (r *pgWebAuthnCredentialRepository) FindByCredentialID(ctx context.Context, credentialID []byte) (*model.WebAuthnCredential, error) {
+	q := "SELECT * FROM webauthn_credentials WHERE credential_id = $1"
+
+	cred := &model.WebAuthnCredential{}
+	if err := r.DB.GetContext(ctx, cred, q, credentialID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, model.NewNotFound("credential", "")
+		}
+		fmt.Println("got error when querying webauthn credential:", err)
+		return nil, model.NewInternal()
+	}
+
+	return cred, nil
+}
+
+// UpdateSignCount stores the signature counter reported by the authenticator during a successful authentication
+func (r *pgWebAuthnCredentialRepository) UpdateSignCount(ctx context.Context, id uuid.UUID, signCount int64) error {
+	q := "UPDATE webauthn_credentials SET sign_count = $2, last_used_at = now() WHERE id = $1"
+
+	if _, err := r.DB.ExecContext(ctx, q, id, signCount); err != nil {
+		fmt.Println("got error when updating webauthn sign count:", err)
+		return model.NewInternal()
+	}
+
+	return nil
+}
+
+// Delete removes the credential if it belongs to the user
+func (r *pgWebAuthnCredentialRepository) Delete(ctx context.Context, uid uuid.UUID, id uuid.UUID) error {
+	q := "DELETE FROM webauthn_credentials WHERE id = $1 AND uid = $2"
+
+	res, err := r.DB.ExecContext(ctx, q, id, uid)
+	if err != nil {
+		fmt.Println("got error when deleting webauthn credential:", err)
+		return model.NewInternal()
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return model.NewNotFound("id", id.String())
+	}
+
+	return nil
+}
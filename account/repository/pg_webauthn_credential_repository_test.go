@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/library"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebAuthnCredentials(t *testing.T) {
+	userRepo := NewUserRepository(db)
+	repo := NewWebAuthnCredentialRepository(db)
+
+	user, err := userRepo.Create(context.Background(), randomCreateUser())
+	require.NoError(t, err)
+
+	cred, err := repo.Create(context.Background(), &model.WebAuthnCredential{
+		UID:          user.UID,
+		CredentialID: []byte(library.RandomString(32)),
+		PublicKey:    []byte("public key"),
+		Transports:   model.Transports{"usb", "nfc"},
+		Nickname:     "security key",
+	})
+	require.NoError(t, err)
+	require.Equal(t, model.Transports{"usb", "nfc"}, cred.Transports)
+
+	// credential ids are unique across all users
+	_, err = repo.Create(context.Background(), &model.WebAuthnCredential{UID: user.UID, CredentialID: cred.CredentialID, PublicKey: []byte("other key")})
+	require.Equal(t, http.StatusConflict, model.Status(err))
+
+	err = repo.UpdateSignCount(context.Background(), cred.ID, 5)
+	require.NoError(t, err)
+
+	found, err := repo.FindByCredentialID(context.Background(), cred.CredentialID)
+	require.NoError(t, err)
+	require.Equal(t, cred.ID, found.ID)
+	require.Equal(t, int64(5), found.SignCount)
+	require.NotNil(t, found.LastUsedAt)
+
+	creds, err := repo.FindByUID(context.Background(), user.UID)
+	require.NoError(t, err)
+	require.Len(t, creds, 1)
+
+	// credentials of other users can't be deleted
+	err = repo.Delete(context.Background(), uuid.New(), cred.ID)
+	require.Equal(t, http.StatusNotFound, model.Status(err))
+
+	err = repo.Delete(context.Background(), user.UID, cred.ID)
+	require.NoError(t, err)
+
+	creds, err = repo.FindByUID(context.Background(), user.UID)
+	require.NoError(t, err)
+	require.Empty(t, creds)
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/maxeth/go-account-api/model"
+)
+
+const (
+	ActionTokenRedisSuffix = "actiontoken"
+)
+
+type redisActionTokenRepository struct {
+	Redis *redis.Client
+}
+
+func NewActionTokenRepository(r *redis.Client) model.ActionTokenRepository {
+	return &redisActionTokenRepository{
+		Redis: r,
+	}
+}
+
+func (r *redisActionTokenRepository) SetActionToken(ctx context.Context, action string, token string, value string, expiresIn time.Duration) error {
+	key := fmt.Sprintf("%s-%s:%s", action, ActionTokenRedisSuffix, token)
+
+	if err := r.Redis.Set(ctx, key, value, expiresIn).Err(); err != nil {
+		log.Printf("error setting %s action token in redis repository. error: %v\n", action, err)
+		return err
+	}
+
+	return nil
+}
+
+// ConsumeActionToken returns the value stored for the token and deletes it in the same transaction,
+// so that a token can only ever be used once
+func (r *redisActionTokenRepository) ConsumeActionToken(ctx context.Context, action string, token string) (string, error) {
+	key := fmt.Sprintf("%s-%s:%s", action, ActionTokenRedisSuffix, token)
+
+	var get *redis.StringCmd
+	_, err := r.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		pipe.Del(ctx, key)
+		return nil
+	})
+	if err == redis.Nil {
+		return "", model.NewNotFound("token", token)
+	}
+	if err != nil {
+		log.Printf("error consuming %s action token in redis repository. error: %v\n", action, err)
+		return "", err
+	}
+
+	return get.Val(), nil
+}
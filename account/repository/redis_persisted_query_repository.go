@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/maxeth/go-account-api/model"
+)
+
+const (
+	PersistedQueryRedisPrefix = "persistedquery"
+)
+
+type redisPersistedQueryRepository struct {
+	Redis     *redis.Client
+	ExpiresIn time.Duration
+}
+
+// NewPersistedQueryRepository returns a repository storing persisted queries in redis. Queries expire
+// once they haven't been registered for expiresIn, clients simply register them again
+func NewPersistedQueryRepository(r *redis.Client, expiresIn time.Duration) model.PersistedQueryRepository {
+	return &redisPersistedQueryRepository{
+		Redis:     r,
+		ExpiresIn: expiresIn,
+	}
+}
+
+func (r *redisPersistedQueryRepository) GetQuery(ctx context.Context, hash string) (string, error) {
+	key := fmt.Sprintf("%s:%s", PersistedQueryRedisPrefix, hash)
+
+	query, err := r.Redis.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", model.NewNotFound("hash", hash)
+	}
+	if err != nil {
+		log.Printf("error getting persisted query from redis repository. error: %v\n", err)
+		return "", model.NewInternal()
+	}
+
+	return query, nil
+}
+
+func (r *redisPersistedQueryRepository) SetQuery(ctx context.Context, hash string, query string) error {
+	key := fmt.Sprintf("%s:%s", PersistedQueryRedisPrefix, hash)
+
+	if err := r.Redis.Set(ctx, key, query, r.ExpiresIn).Err(); err != nil {
+		log.Printf("error setting persisted query in redis repository. error: %v\n", err)
+		return model.NewInternal()
+	}
+
+	return nil
+}
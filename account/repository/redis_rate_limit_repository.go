@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/maxeth/go-account-api/model"
+)
+
+const (
+	RateLimitRedisPrefix = "ratelimit"
+)
+
+// incrementScript increments the counter and starts its window with the first attempt, both atomically,
+// so that a counter can never be left without expiry
+var incrementScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return {count, redis.call("PTTL", KEYS[1])}
+`)
+
+type redisRateLimitRepository struct {
+	Redis *redis.Client
+}
+
+func NewRateLimitRepository(r *redis.Client) model.RateLimitRepository {
+	return &redisRateLimitRepository{
+		Redis: r,
+	}
+}
+
+// Increment counts an attempt in the current window of the key and returns the number of attempts
+// made within the window, along with the time left until the window ends
+func (r *redisRateLimitRepository) Increment(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	key = fmt.Sprintf("%s:%s", RateLimitRedisPrefix, key)
+
+	val, err := incrementScript.Run(ctx, r.Redis, []string{key}, window.Milliseconds()).Result()
+	res, ok := val.([]interface{})
+	if err != nil || !ok || len(res) != 2 {
+		log.Printf("error incrementing rate limit counter in redis repository. error: %v\n", err)
+		return 0, 0, model.NewInternal()
+	}
+
+	count, _ := res[0].(int64)
+	ttl, _ := res[1].(int64)
+
+	return count, time.Duration(ttl) * time.Millisecond, nil
+}
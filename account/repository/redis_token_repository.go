@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -39,10 +40,72 @@ func (r *redisTokenRepository) SetRefreshToken(ctx context.Context, userID strin
 func (r *redisTokenRepository) DeleteRefreshToken(ctx context.Context, userID string, tokenID string) error {
 	key := fmt.Sprintf("%s-%s:%s", userID, TokenRedisSuffix, tokenID)
 
-	if err := r.Redis.Del(ctx, key).Err(); err != nil {
+	result := r.Redis.Del(ctx, key)
+	if err := result.Err(); err != nil {
 		log.Printf("error deleting token key-value-pair %s:%s in redis repository. error: %v\n", userID, tokenID, err)
 		return err
 	}
 
+	// the token has already been used, revoked or expired
+	if result.Val() < 1 {
+		log.Printf("refresh token %s:%s does not exist in redis repository\n", userID, tokenID)
+		return model.NewAuthorization("Invalid refresh token")
+	}
+
 	return nil
 }
+
+// DeleteUserRefreshTokens deletes all refresh tokens of a user, which signs the user out on all devices
+func (r *redisTokenRepository) DeleteUserRefreshTokens(ctx context.Context, userID string) error {
+	pattern := fmt.Sprintf("%s-%s:*", userID, TokenRedisSuffix)
+
+	iter := r.Redis.Scan(ctx, 0, pattern, 10).Iterator()
+	failCount := 0
+
+	for iter.Next(ctx) {
+		if err := r.Redis.Del(ctx, iter.Val()).Err(); err != nil {
+			log.Printf("failed to delete refresh token: %s. error: %v\n", iter.Val(), err)
+			failCount++
+		}
+	}
+
+	if err := iter.Err(); err != nil {
+		log.Printf("failed to scan refresh tokens of user: %s. error: %v\n", userID, err)
+		return err
+	}
+
+	if failCount > 0 {
+		return fmt.Errorf("failed to delete %d refresh tokens of user: %s", failCount, userID)
+	}
+
+	return nil
+}
+
+// GetUserRefreshTokens returns all refresh tokens of a user which have not expired yet
+func (r *redisTokenRepository) GetUserRefreshTokens(ctx context.Context, userID string) ([]*model.Session, error) {
+	pattern := fmt.Sprintf("%s-%s:*", userID, TokenRedisSuffix)
+	prefix := fmt.Sprintf("%s-%s:", userID, TokenRedisSuffix)
+
+	sessions := []*model.Session{}
+	iter := r.Redis.Scan(ctx, 0, pattern, 10).Iterator()
+
+	for iter.Next(ctx) {
+		ttl, err := r.Redis.TTL(ctx, iter.Val()).Result()
+		if err != nil || ttl < 0 {
+			// expired in between scanning and reading the ttl
+			continue
+		}
+
+		sessions = append(sessions, &model.Session{
+			ID:        strings.TrimPrefix(iter.Val(), prefix),
+			ExpiresAt: time.Now().Add(ttl),
+		})
+	}
+
+	if err := iter.Err(); err != nil {
+		log.Printf("failed to scan refresh tokens of user: %s. error: %v\n", userID, err)
+		return nil, err
+	}
+
+	return sessions, nil
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/maxeth/go-account-api/model"
+)
+
+const (
+	UserEventRedisPrefix = "userevents"
+)
+
+type redisUserEventRepository struct {
+	Redis *redis.Client
+}
+
+// NewUserEventRepository returns a repository which fans out user events to all instances through redis pub/sub
+func NewUserEventRepository(r *redis.Client) model.UserEventRepository {
+	return &redisUserEventRepository{
+		Redis: r,
+	}
+}
+
+func (r *redisUserEventRepository) Publish(ctx context.Context, e *model.UserEvent) error {
+	channel := fmt.Sprintf("%s:%s", UserEventRedisPrefix, e.UID)
+
+	msg, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if err := r.Redis.Publish(ctx, channel, msg).Err(); err != nil {
+		log.Printf("error publishing %s event in redis repository. error: %v\n", e.Type, err)
+		return err
+	}
+
+	return nil
+}
+
+// Listen receives the events of all users until ctx is cancelled. The returned channel is closed afterwards
+func (r *redisUserEventRepository) Listen(ctx context.Context) (<-chan *model.UserEvent, error) {
+	pubsub := r.Redis.PSubscribe(ctx, UserEventRedisPrefix+":*")
+
+	// wait for the subscription to be confirmed, so that no event published afterwards is missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	events := make(chan *model.UserEvent)
+	go func() {
+		defer close(events)
+		defer pubsub.Close()
+
+		msgs := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+
+				e := &model.UserEvent{}
+				if err := json.Unmarshal([]byte(msg.Payload), e); err != nil {
+					log.Printf("error decoding user event from redis repository. error: %v\n", err)
+					continue
+				}
+
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
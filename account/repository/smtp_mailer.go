@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/smtp"
+	"strings"
+
+	"github.com/maxeth/go-account-api/model"
+)
+
+type smtpMailer struct {
+	Addr string
+	Auth smtp.Auth
+	From string
+}
+
+type SMTPMailerConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// NewMailer returns a mailer sending emails over smtp. If no smtp host is configured,
+// emails are only written to the log, which is handy during local development
+func NewMailer(c *SMTPMailerConfig) model.Mailer {
+	if c.Host == "" {
+		return &logMailer{}
+	}
+
+	var auth smtp.Auth
+	if c.Username != "" {
+		auth = smtp.PlainAuth("", c.Username, c.Password, c.Host)
+	}
+
+	return &smtpMailer{
+		Addr: fmt.Sprintf("%s:%s", c.Host, c.Port),
+		Auth: auth,
+		From: c.From,
+	}
+}
+
+func (m *smtpMailer) Send(ctx context.Context, to, subject, body string) error {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", m.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=\"utf-8\"\r\n\r\n")
+	msg.WriteString(body)
+
+	if err := smtp.SendMail(m.Addr, m.Auth, m.From, []string{to}, []byte(msg.String())); err != nil {
+		log.Printf("error sending mail to %s: %v\n", to, err)
+		return err
+	}
+
+	return nil
+}
+
+type logMailer struct{}
+
+func (m *logMailer) Send(ctx context.Context, to, subject, body string) error {
+	log.Printf("mail to: %s, subject: %s\n%s\n", to, subject, body)
+	return nil
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+)
+
+// default and maximum number of users per page of the user list
+const (
+	DefaultUserPageSize = 20
+	MaxUserPageSize     = 100
+)
+
+type adminService struct {
+	UserRepository model.UserRepository
+	UserService    model.UserService
+	TokenService   model.TokenService
+	AuditService   model.AuditService
+}
+
+type AdminServiceConfig struct {
+	UserRepository model.UserRepository
+	UserService    model.UserService
+	TokenService   model.TokenService
+	AuditService   model.AuditService // records the actions of admins, optional
+}
+
+func NewAdminService(c *AdminServiceConfig) model.AdminService {
+	return &adminService{
+		UserRepository: c.UserRepository,
+		UserService:    c.UserService,
+		TokenService:   c.TokenService,
+		AuditService:   c.AuditService,
+	}
+}
+
+func (s *adminService) ListUsers(ctx context.Context, filter model.UserFilter) (*model.UserPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultUserPageSize
+	}
+	if filter.Limit > MaxUserPageSize {
+		filter.Limit = MaxUserPageSize
+	}
+
+	if filter.Status != "" && filter.Status != model.StatusActive && filter.Status != model.StatusSuspended {
+		return nil, model.NewValidation("status", "Unknown status.")
+	}
+
+	return s.UserRepository.List(ctx, filter)
+}
+
+func (s *adminService) GetUser(ctx context.Context, uid uuid.UUID) (*model.User, error) {
+	return s.UserRepository.FindByID(ctx, uid)
+}
+
+// SetStatus suspends or unsuspends a user. Suspended users are signed out on all devices
+func (s *adminService) SetStatus(ctx context.Context, uid uuid.UUID, status string) (*model.User, error) {
+	if status != model.StatusActive && status != model.StatusSuspended {
+		return nil, model.NewValidation("status", "Unknown status.")
+	}
+
+	u, err := s.UserRepository.SetStatus(ctx, uid, status)
+	if err != nil {
+		return nil, err
+	}
+
+	eventType := model.AuditUserUnsuspended
+	if status == model.StatusSuspended {
+		eventType = model.AuditUserSuspended
+	}
+	recordAudit(ctx, s.AuditService, eventType, &uid, nil)
+
+	if status == model.StatusSuspended {
+		if err := s.TokenService.Signout(ctx, uid); err != nil {
+			// refreshing tokens is refused for suspended users anyway
+			log.Printf("Failed to sign out suspended uid: %v. Error: %v\n", uid, err)
+		}
+	}
+
+	return u, nil
+}
+
+// SetRole grants or revokes admin rights
+func (s *adminService) SetRole(ctx context.Context, uid uuid.UUID, role string) (*model.User, error) {
+	if role != model.RoleUser && role != model.RoleAdmin {
+		return nil, model.NewValidation("role", "Unknown role.")
+	}
+
+	prev, err := s.UserRepository.FindByID(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := s.UserRepository.SetRole(ctx, uid, role)
+	if err != nil {
+		return nil, err
+	}
+
+	recordAudit(ctx, s.AuditService, model.AuditRoleChanged, &uid, model.AuditDetails{"from": prev.Role, "to": role})
+
+	return u, nil
+}
+
+// ForcePasswordReset invalidates the users password and signs the user out on all devices
+func (s *adminService) ForcePasswordReset(ctx context.Context, uid uuid.UUID) error {
+	if err := s.UserService.ForcePasswordReset(ctx, uid); err != nil {
+		return err
+	}
+
+	recordAudit(ctx, s.AuditService, model.AuditPasswordResetForced, &uid, nil)
+
+	return s.TokenService.Signout(ctx, uid)
+}
+
+func (s *adminService) RevokeSessions(ctx context.Context, uid uuid.UUID) error {
+	if _, err := s.UserRepository.FindByID(ctx, uid); err != nil {
+		return err
+	}
+
+	if err := s.TokenService.Signout(ctx, uid); err != nil {
+		return err
+	}
+
+	recordAudit(ctx, s.AuditService, model.AuditSessionsRevoked, &uid, nil)
+
+	return nil
+}
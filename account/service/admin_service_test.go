@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListUsers(t *testing.T) {
+	testCases := []struct {
+		name          string
+		filter        model.UserFilter
+		buildStubs    func(repo *mocks.MockUserRepository)
+		checkResponse func(t *testing.T, page *model.UserPage, err error)
+	}{
+		{
+			name:   "DefaultLimit",
+			filter: model.UserFilter{Search: "mail"},
+			buildStubs: func(repo *mocks.MockUserRepository) {
+				repo.EXPECT().List(gomock.Any(), model.UserFilter{Search: "mail", Limit: DefaultUserPageSize}).Times(1).Return(&model.UserPage{}, nil)
+			},
+			checkResponse: func(t *testing.T, page *model.UserPage, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:   "MaxLimit",
+			filter: model.UserFilter{Limit: 1000},
+			buildStubs: func(repo *mocks.MockUserRepository) {
+				repo.EXPECT().List(gomock.Any(), model.UserFilter{Limit: MaxUserPageSize}).Times(1).Return(&model.UserPage{}, nil)
+			},
+			checkResponse: func(t *testing.T, page *model.UserPage, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:   "UnknownStatus",
+			filter: model.UserFilter{Status: "banned"},
+			buildStubs: func(repo *mocks.MockUserRepository) {
+				repo.EXPECT().List(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, page *model.UserPage, err error) {
+				require.Equal(t, http.StatusBadRequest, model.Status(err))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockUserRepository(ctrl)
+			tc.buildStubs(repo)
+
+			service := NewAdminService(&AdminServiceConfig{
+				UserRepository: repo,
+			})
+
+			page, err := service.ListUsers(context.Background(), tc.filter)
+			tc.checkResponse(t, page, err)
+		})
+	}
+}
+
+func TestSetStatus(t *testing.T) {
+	user := randomUser(t)
+
+	testCases := []struct {
+		name       string
+		status     string
+		buildStubs func(repo *mocks.MockUserRepository, ts *mocks.MockTokenService)
+	}{
+		{
+			name:   "Suspend",
+			status: model.StatusSuspended,
+			buildStubs: func(repo *mocks.MockUserRepository, ts *mocks.MockTokenService) {
+				repo.EXPECT().SetStatus(gomock.Any(), user.UID, model.StatusSuspended).Times(1).Return(user, nil)
+				// suspended users are signed out on all devices
+				ts.EXPECT().Signout(gomock.Any(), user.UID).Times(1).Return(nil)
+			},
+		},
+		{
+			name:   "Unsuspend",
+			status: model.StatusActive,
+			buildStubs: func(repo *mocks.MockUserRepository, ts *mocks.MockTokenService) {
+				repo.EXPECT().SetStatus(gomock.Any(), user.UID, model.StatusActive).Times(1).Return(user, nil)
+				ts.EXPECT().Signout(gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockUserRepository(ctrl)
+			ts := mocks.NewMockTokenService(ctrl)
+			tc.buildStubs(repo, ts)
+
+			service := NewAdminService(&AdminServiceConfig{
+				UserRepository: repo,
+				TokenService:   ts,
+			})
+
+			u, err := service.SetStatus(context.Background(), user.UID, tc.status)
+			require.NoError(t, err)
+			require.Equal(t, user.UID, u.UID)
+		})
+	}
+}
+
+func TestSetRole(t *testing.T) {
+	user := randomUser(t)
+	user.Role = model.RoleUser
+
+	testCases := []struct {
+		name       string
+		role       string
+		buildStubs func(repo *mocks.MockUserRepository, as *mocks.MockAuditService)
+		wantCode   int
+	}{
+		{
+			name: "GrantAdmin",
+			role: model.RoleAdmin,
+			buildStubs: func(repo *mocks.MockUserRepository, as *mocks.MockAuditService) {
+				repo.EXPECT().FindByID(gomock.Any(), user.UID).Times(1).Return(user, nil)
+				repo.EXPECT().SetRole(gomock.Any(), user.UID, model.RoleAdmin).Times(1).Return(&model.User{UID: user.UID, Role: model.RoleAdmin}, nil)
+				as.EXPECT().Record(gomock.Any(), &model.AuditEvent{
+					Type:       model.AuditRoleChanged,
+					SubjectUID: &user.UID,
+					Details:    model.AuditDetails{"from": model.RoleUser, "to": model.RoleAdmin},
+				}).Times(1)
+			},
+		},
+		{
+			name: "UnknownRole",
+			role: "owner",
+			buildStubs: func(repo *mocks.MockUserRepository, as *mocks.MockAuditService) {
+				repo.EXPECT().SetRole(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				as.EXPECT().Record(gomock.Any(), gomock.Any()).Times(0)
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "NotFound",
+			role: model.RoleAdmin,
+			buildStubs: func(repo *mocks.MockUserRepository, as *mocks.MockAuditService) {
+				repo.EXPECT().FindByID(gomock.Any(), user.UID).Times(1).Return(nil, model.NewNotFound("uid", user.UID.String()))
+				repo.EXPECT().SetRole(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				as.EXPECT().Record(gomock.Any(), gomock.Any()).Times(0)
+			},
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockUserRepository(ctrl)
+			as := mocks.NewMockAuditService(ctrl)
+			tc.buildStubs(repo, as)
+
+			service := NewAdminService(&AdminServiceConfig{
+				UserRepository: repo,
+				AuditService:   as,
+			})
+
+			u, err := service.SetRole(context.Background(), user.UID, tc.role)
+			if tc.wantCode != 0 {
+				require.Equal(t, tc.wantCode, model.Status(err))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.role, u.Role)
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+)
+
+// default and maximum number of events per page of the audit log, and the number of recent events shown to users
+const (
+	DefaultAuditPageSize   = 50
+	MaxAuditPageSize       = 200
+	RecentActivityPageSize = 20
+)
+
+// auditBatchSize is the maximum number of events written with one insert
+const auditBatchSize = 100
+
+// how long the events still buffered on shutdown can take to be written
+const auditDrainTimeout = 5 * time.Second
+
+type auditService struct {
+	AuditEventRepository model.AuditEventRepository
+	FlushInterval        time.Duration
+
+	events chan *model.AuditEvent
+}
+
+type AuditServiceConfig struct {
+	AuditEventRepository model.AuditEventRepository
+	BufferSize           int           // number of events waiting to be written. Events recorded while the buffer is full are dropped
+	FlushInterval        time.Duration // how long an event waits at most for its batch to fill up
+}
+
+func NewAuditService(c *AuditServiceConfig) model.AuditService {
+	return &auditService{
+		AuditEventRepository: c.AuditEventRepository,
+		FlushInterval:        c.FlushInterval,
+		events:               make(chan *model.AuditEvent, c.BufferSize),
+	}
+}
+
+// Record buffers the event to be written by Run, so that callers never wait for the database.
+// The info about the request ctx belongs to is added to the event
+func (s *auditService) Record(ctx context.Context, e *model.AuditEvent) {
+	if info, ok := model.RequestInfoFromContext(ctx); ok {
+		e.IP = info.IP
+		e.UserAgent = info.UserAgent
+		e.RequestID = info.RequestID
+		if e.ActorUID == nil {
+			e.ActorUID = info.ActorUID
+		}
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+
+	select {
+	case s.events <- e:
+	default:
+		log.Printf("Dropped %s audit event, the buffer is full\n", e.Type)
+	}
+}
+
+// Run writes the recorded events in batches until ctx is cancelled. Batches which can't be written are retried
+// with the next flush, as long as they fit into the buffer. The events still buffered are written before returning
+func (s *auditService) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*model.AuditEvent, 0, auditBatchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.AuditEventRepository.Insert(ctx, batch); err != nil {
+			log.Printf("Failed to write %d audit events. Error: %v\n", len(batch), err)
+			if len(batch) < cap(s.events) {
+				return
+			}
+			log.Printf("Dropped %d audit events\n", len(batch))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			drainCtx, cancel := context.WithTimeout(context.Background(), auditDrainTimeout)
+			defer cancel()
+			for {
+				select {
+				case e := <-s.events:
+					batch = append(batch, e)
+					if len(batch) >= auditBatchSize {
+						flush(drainCtx)
+					}
+				default:
+					flush(drainCtx)
+					return nil
+				}
+			}
+		case e := <-s.events:
+			batch = append(batch, e)
+			if len(batch) >= auditBatchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		}
+	}
+}
+
+// Query returns a page of the audit log
+func (s *auditService) Query(ctx context.Context, filter model.AuditEventFilter) (*model.AuditEventPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultAuditPageSize
+	}
+	if filter.Limit > MaxAuditPageSize {
+		filter.Limit = MaxAuditPageSize
+	}
+
+	for _, t := range filter.Types {
+		if !model.AuditEventTypes[t] {
+			return nil, model.NewValidation("type", "Unknown event type.")
+		}
+	}
+
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		return nil, model.NewValidation("to", "Must not be before from.")
+	}
+
+	return s.AuditEventRepository.List(ctx, filter)
+}
+
+// RecentActivity returns the latest events the user has been the subject of. Events the user only triggered,
+// like admin actions on other accounts, are left out
+func (s *auditService) RecentActivity(ctx context.Context, uid uuid.UUID) ([]*model.Activity, error) {
+	page, err := s.AuditEventRepository.List(ctx, model.AuditEventFilter{
+		SubjectUID: &uid,
+		Limit:      RecentActivityPageSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	activity := make([]*model.Activity, len(page.Events))
+	for i, e := range page.Events {
+		activity[i] = &model.Activity{
+			ID:        e.ID,
+			Type:      e.Type,
+			Details:   e.Details,
+			CreatedAt: e.CreatedAt,
+		}
+	}
+
+	return activity, nil
+}
+
+// recordAudit records an event about the subject with as, if the audit log is enabled
+func recordAudit(ctx context.Context, as model.AuditService, eventType string, subject *uuid.UUID, details model.AuditDetails) {
+	if as == nil {
+		return
+	}
+
+	as.Record(ctx, &model.AuditEvent{
+		Type:       eventType,
+		SubjectUID: subject,
+		Details:    details,
+	})
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditRecord(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockAuditEventRepository(ctrl)
+	service := NewAuditService(&AuditServiceConfig{
+		AuditEventRepository: repo,
+		BufferSize:           2,
+		FlushInterval:        time.Hour,
+	})
+
+	actor := uuid.New()
+	subject := uuid.New()
+	ctx := model.WithRequestInfo(context.Background(), &model.RequestInfo{
+		IP:        "10.0.0.1",
+		UserAgent: "test",
+		RequestID: "req",
+		ActorUID:  &actor,
+	})
+
+	// the third event doesn't fit into the buffer and is dropped instead of blocking
+	service.Record(ctx, &model.AuditEvent{Type: model.AuditSignup, SubjectUID: &subject})
+	service.Record(context.Background(), &model.AuditEvent{Type: model.AuditSigninFailed})
+	service.Record(ctx, &model.AuditEvent{Type: model.AuditPasswordChanged})
+
+	written := []*model.AuditEvent{}
+	repo.EXPECT().Insert(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(func(ctx context.Context, events []*model.AuditEvent) error {
+		written = append(written, events...)
+		return nil
+	})
+
+	// the buffered events are written on shutdown
+	runCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, service.Run(runCtx))
+
+	require.Len(t, written, 2)
+	require.Equal(t, model.AuditSignup, written[0].Type)
+	require.Equal(t, "10.0.0.1", written[0].IP)
+	require.Equal(t, "test", written[0].UserAgent)
+	require.Equal(t, "req", written[0].RequestID)
+	require.Equal(t, actor, *written[0].ActorUID)
+	require.Equal(t, subject, *written[0].SubjectUID)
+	require.False(t, written[0].CreatedAt.IsZero())
+
+	require.Equal(t, model.AuditSigninFailed, written[1].Type)
+	require.Nil(t, written[1].ActorUID)
+	require.Empty(t, written[1].IP)
+}
+
+func TestAuditRunBatches(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockAuditEventRepository(ctrl)
+	service := NewAuditService(&AuditServiceConfig{
+		AuditEventRepository: repo,
+		BufferSize:           auditBatchSize * 3,
+		FlushInterval:        time.Hour,
+	})
+
+	for i := 0; i < auditBatchSize*2+1; i++ {
+		service.Record(context.Background(), &model.AuditEvent{Type: model.AuditSignup})
+	}
+
+	sizes := []int{}
+	repo.EXPECT().Insert(gomock.Any(), gomock.Any()).Times(3).DoAndReturn(func(ctx context.Context, events []*model.AuditEvent) error {
+		sizes = append(sizes, len(events))
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, service.Run(ctx))
+	require.Equal(t, []int{auditBatchSize, auditBatchSize, 1}, sizes)
+}
+
+func TestAuditQuery(t *testing.T) {
+	uid := uuid.New()
+	now := time.Now()
+
+	testCases := []struct {
+		name       string
+		filter     model.AuditEventFilter
+		buildStubs func(repo *mocks.MockAuditEventRepository)
+		wantCode   int
+	}{
+		{
+			name:   "DefaultLimit",
+			filter: model.AuditEventFilter{UID: &uid},
+			buildStubs: func(repo *mocks.MockAuditEventRepository) {
+				repo.EXPECT().List(gomock.Any(), model.AuditEventFilter{UID: &uid, Limit: DefaultAuditPageSize}).Times(1).Return(&model.AuditEventPage{}, nil)
+			},
+		},
+		{
+			name:   "MaxLimit",
+			filter: model.AuditEventFilter{Types: []string{model.AuditSignup}, Limit: 1000},
+			buildStubs: func(repo *mocks.MockAuditEventRepository) {
+				repo.EXPECT().List(gomock.Any(), model.AuditEventFilter{Types: []string{model.AuditSignup}, Limit: MaxAuditPageSize}).Times(1).Return(&model.AuditEventPage{}, nil)
+			},
+		},
+		{
+			name:   "UnknownType",
+			filter: model.AuditEventFilter{Types: []string{"signin"}},
+			buildStubs: func(repo *mocks.MockAuditEventRepository) {
+				repo.EXPECT().List(gomock.Any(), gomock.Any()).Times(0)
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:   "InvalidTimeRange",
+			filter: model.AuditEventFilter{From: now, To: now.Add(-time.Hour)},
+			buildStubs: func(repo *mocks.MockAuditEventRepository) {
+				repo.EXPECT().List(gomock.Any(), gomock.Any()).Times(0)
+			},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockAuditEventRepository(ctrl)
+			tc.buildStubs(repo)
+
+			service := NewAuditService(&AuditServiceConfig{
+				AuditEventRepository: repo,
+				FlushInterval:        time.Hour,
+			})
+
+			_, err := service.Query(context.Background(), tc.filter)
+			if tc.wantCode != 0 {
+				require.Equal(t, tc.wantCode, model.Status(err))
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestRecentActivity(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uid := uuid.New()
+	adminUID := uuid.New()
+	now := time.Now()
+
+	repo := mocks.NewMockAuditEventRepository(ctrl)
+	s := NewAuditService(&AuditServiceConfig{AuditEventRepository: repo})
+
+	// events the user only triggered aren't about them
+	repo.EXPECT().List(gomock.Any(), model.AuditEventFilter{SubjectUID: &uid, Limit: RecentActivityPageSize}).Times(1).Return(&model.AuditEventPage{
+		Events: []*model.AuditEvent{
+			{ID: 1, Type: model.AuditRoleChanged, ActorUID: &adminUID, SubjectUID: &uid, IP: "10.0.0.1", UserAgent: "curl", RequestID: "request", Details: model.AuditDetails{"to": "admin"}, CreatedAt: now},
+		},
+	}, nil)
+
+	activity, err := s.RecentActivity(context.Background(), uid)
+	require.NoError(t, err)
+	require.Equal(t, []*model.Activity{
+		{ID: 1, Type: model.AuditRoleChanged, Details: model.AuditDetails{"to": "admin"}, CreatedAt: now},
+	}, activity)
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/library"
+	"github.com/maxeth/go-account-api/model"
+)
+
+type dataExportService struct {
+	DataExportRepository model.DataExportRepository
+	UserRepository       model.UserRepository
+	Mailer               model.Mailer
+	Exporters            []model.UserDataExporter
+	AppURL               string
+	DownloadExpSecs      int64
+	ClaimTimeoutSecs     int64
+}
+
+// maxExportAttempts is how often an export is claimed again after its worker crashed, before it is failed
+const maxExportAttempts = 3
+
+type DataExportServiceConfig struct {
+	DataExportRepository model.DataExportRepository
+	UserRepository       model.UserRepository
+	Mailer               model.Mailer
+	Exporters            []model.UserDataExporter // every part of the app storing user data registers an exporter here
+	AppURL               string
+	DownloadExpSecs      int64 // how long the download link of a finished export stays valid
+	ClaimTimeoutSecs     int64 // how long an export can be running before it is assumed its worker crashed
+}
+
+func NewDataExportService(c *DataExportServiceConfig) model.DataExportService {
+	return &dataExportService{
+		DataExportRepository: c.DataExportRepository,
+		UserRepository:       c.UserRepository,
+		Mailer:               c.Mailer,
+		Exporters:            c.Exporters,
+		AppURL:               c.AppURL,
+		DownloadExpSecs:      c.DownloadExpSecs,
+		ClaimTimeoutSecs:     c.ClaimTimeoutSecs,
+	}
+}
+
+// RequestExport queues a new export for the user. If an export of the user is still
+// queued or running, that export is returned instead of queueing another one. A running export
+// whose worker crashed is claimed again by ProcessPendingExports, or failed after maxExportAttempts
+func (s *dataExportService) RequestExport(ctx context.Context, uid uuid.UUID) (*model.DataExport, error) {
+	latest, err := s.DataExportRepository.FindLatestByUID(ctx, uid)
+	if err != nil && model.Status(err) != http.StatusNotFound {
+		return nil, err
+	}
+
+	if latest != nil && (latest.Status == model.ExportPending || latest.Status == model.ExportRunning) {
+		return latest, nil
+	}
+
+	return s.DataExportRepository.Create(ctx, uid)
+}
+
+// GetExport returns the export if it belongs to the user
+func (s *dataExportService) GetExport(ctx context.Context, uid uuid.UUID, id uuid.UUID) (*model.DataExport, error) {
+	e, err := s.DataExportRepository.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.UID != uid {
+		return nil, model.NewNotFound("id", id.String())
+	}
+
+	return e, nil
+}
+
+// Download returns the finished export the download token has been issued for
+func (s *dataExportService) Download(ctx context.Context, token string) (*model.DataExport, error) {
+	e, err := s.DataExportRepository.FindByDownloadTokenHash(ctx, hashToken(token))
+	if err != nil {
+		if model.Status(err) == http.StatusNotFound {
+			return nil, model.NewAuthorization("The link is invalid or has expired.")
+		}
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// ProcessPendingExports builds the archives of all queued exports and mails their download links.
+// Exports running longer than the claim timeout are processed again. Archives whose download link
+// has expired are deleted. Returns the number of processed exports
+func (s *dataExportService) ProcessPendingExports(ctx context.Context) (int, error) {
+	if _, err := s.DataExportRepository.DeleteExpiredArchives(ctx, time.Now()); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for {
+		staleBefore := time.Now().Add(-time.Duration(s.ClaimTimeoutSecs) * time.Second)
+		e, err := s.DataExportRepository.ClaimPending(ctx, staleBefore)
+		if err != nil {
+			if model.Status(err) == http.StatusNotFound {
+				return n, nil
+			}
+			return n, err
+		}
+
+		// don't retry an export forever if building it crashes the worker every time
+		if e.Attempts > maxExportAttempts {
+			log.Printf("Giving up on data export: %v after %d attempts\n", e.ID, e.Attempts-1)
+			if err := s.DataExportRepository.Fail(ctx, e.ID); err != nil {
+				return n, err
+			}
+			n++
+			continue
+		}
+
+		if err := s.process(ctx, e); err != nil {
+			log.Printf("Failed to process data export: %v. Error: %v\n", e.ID, err)
+			if err := s.DataExportRepository.Fail(ctx, e.ID); err != nil {
+				return n, err
+			}
+		}
+		n++
+	}
+}
+
+func (s *dataExportService) process(ctx context.Context, e *model.DataExport) error {
+	archive, err := s.buildArchive(ctx, e.UID)
+	if err != nil {
+		return err
+	}
+
+	token, err := library.SecureToken(32)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(s.DownloadExpSecs) * time.Second)
+
+	e.Archive = archive
+	e.DownloadTokenHash = hashToken(token)
+	e.CompletedAt = &now
+	e.ExpiresAt = &expiresAt
+
+	if err := s.DataExportRepository.Complete(ctx, e); err != nil {
+		return err
+	}
+
+	u, err := s.UserRepository.FindByID(ctx, e.UID)
+	if err != nil {
+		// the account has been deleted in the meantime
+		return nil
+	}
+
+	body := fmt.Sprintf("Your data export is ready. Download it until %s by opening the following link:\n\n%s/export/download?token=%s", expiresAt.Format(time.RFC1123), s.AppURL, token)
+	if err := s.Mailer.Send(ctx, u.Email, "Your data export is ready", body); err != nil {
+		log.Printf("Failed to send data export link to uid: %v. Error: %v\n", u.UID, err)
+	}
+
+	return nil
+}
+
+// buildArchive creates a zip archive with one json file per registered exporter
+func (s *dataExportService) buildArchive(ctx context.Context, uid uuid.UUID) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for _, exporter := range s.Exporters {
+		data, err := exporter.ExportUserData(ctx, uid)
+		if err != nil {
+			return nil, fmt.Errorf("exporter %s failed: %w", exporter.ExportName(), err)
+		}
+
+		f, err := zw.Create(exporter.ExportName() + ".json")
+		if err != nil {
+			return nil, err
+		}
+
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// hashToken returns the hex encoded sha256 hash of a token, so that tokens are never stored in plain text
+func hashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestExport(t *testing.T) {
+	uid := uuid.New()
+
+	testCases := []struct {
+		name          string
+		buildStubs    func(repo *mocks.MockDataExportRepository)
+		checkResponse func(t *testing.T, e *model.DataExport, err error)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(repo *mocks.MockDataExportRepository) {
+				repo.EXPECT().FindLatestByUID(gomock.Any(), uid).Times(1).Return(nil, model.NewNotFound("uid", uid.String()))
+				repo.EXPECT().Create(gomock.Any(), uid).Times(1).Return(&model.DataExport{UID: uid, Status: model.ExportPending}, nil)
+			},
+			checkResponse: func(t *testing.T, e *model.DataExport, err error) {
+				require.NoError(t, err)
+				require.Equal(t, model.ExportPending, e.Status)
+			},
+		},
+		{
+			name: "AlreadyPending",
+			buildStubs: func(repo *mocks.MockDataExportRepository) {
+				repo.EXPECT().FindLatestByUID(gomock.Any(), uid).Times(1).Return(&model.DataExport{UID: uid, Status: model.ExportRunning}, nil)
+				repo.EXPECT().Create(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, e *model.DataExport, err error) {
+				require.NoError(t, err)
+				require.Equal(t, model.ExportRunning, e.Status)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockDataExportRepository(ctrl)
+			tc.buildStubs(repo)
+
+			service := NewDataExportService(&DataExportServiceConfig{
+				DataExportRepository: repo,
+			})
+
+			e, err := service.RequestExport(context.Background(), uid)
+			tc.checkResponse(t, e, err)
+		})
+	}
+}
+
+func TestProcessPendingExports(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := randomUser(t)
+	export := &model.DataExport{ID: uuid.New(), UID: user.UID, Status: model.ExportRunning, Attempts: 1}
+
+	repo := mocks.NewMockDataExportRepository(ctrl)
+	userRepo := mocks.NewMockUserRepository(ctrl)
+	mailer := mocks.NewMockMailer(ctrl)
+	exporter := mocks.NewMockUserDataExporter(ctrl)
+
+	exporter.EXPECT().ExportName().AnyTimes().Return("profile")
+	exporter.EXPECT().ExportUserData(gomock.Any(), user.UID).Times(1).Return(user, nil)
+
+	repo.EXPECT().DeleteExpiredArchives(gomock.Any(), gomock.Any()).Times(1).Return(int64(0), nil)
+	gomock.InOrder(
+		repo.EXPECT().ClaimPending(gomock.Any(), gomock.Any()).Times(1).Return(export, nil),
+		repo.EXPECT().ClaimPending(gomock.Any(), gomock.Any()).Times(1).Return(nil, model.NewNotFound("status", model.ExportPending)),
+	)
+	repo.EXPECT().Complete(gomock.Any(), export).Times(1).DoAndReturn(func(ctx context.Context, e *model.DataExport) error {
+		require.NotEmpty(t, e.DownloadTokenHash)
+		require.NotNil(t, e.ExpiresAt)
+
+		// the archive contains one json file per exporter
+		zr, err := zip.NewReader(bytes.NewReader(e.Archive), int64(len(e.Archive)))
+		require.NoError(t, err)
+		require.Len(t, zr.File, 1)
+		require.Equal(t, "profile.json", zr.File[0].Name)
+
+		f, err := zr.File[0].Open()
+		require.NoError(t, err)
+		defer f.Close()
+
+		var gotUser model.User
+		require.NoError(t, json.NewDecoder(f).Decode(&gotUser))
+		require.Equal(t, user.UID, gotUser.UID)
+		require.Empty(t, gotUser.Password)
+		return nil
+	})
+	userRepo.EXPECT().FindByID(gomock.Any(), user.UID).Times(1).Return(user, nil)
+	mailer.EXPECT().Send(gomock.Any(), user.Email, gomock.Any(), gomock.Any()).Times(1).Return(nil)
+
+	service := NewDataExportService(&DataExportServiceConfig{
+		DataExportRepository: repo,
+		UserRepository:       userRepo,
+		Mailer:               mailer,
+		Exporters:            []model.UserDataExporter{exporter},
+		DownloadExpSecs:      60,
+	})
+
+	n, err := service.ProcessPendingExports(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+}
+
+func TestProcessPendingExportsGivesUp(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// the export has been claimed again after its worker crashed too often
+	export := &model.DataExport{ID: uuid.New(), UID: uuid.New(), Status: model.ExportRunning, Attempts: maxExportAttempts + 1}
+
+	repo := mocks.NewMockDataExportRepository(ctrl)
+	exporter := mocks.NewMockUserDataExporter(ctrl)
+	exporter.EXPECT().ExportUserData(gomock.Any(), gomock.Any()).Times(0)
+
+	repo.EXPECT().DeleteExpiredArchives(gomock.Any(), gomock.Any()).Times(1).Return(int64(0), nil)
+	gomock.InOrder(
+		repo.EXPECT().ClaimPending(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(func(ctx context.Context, staleBefore time.Time) (*model.DataExport, error) {
+			require.WithinDuration(t, time.Now().Add(-time.Minute), staleBefore, time.Second)
+			return export, nil
+		}),
+		repo.EXPECT().ClaimPending(gomock.Any(), gomock.Any()).Times(1).Return(nil, model.NewNotFound("status", model.ExportPending)),
+	)
+	repo.EXPECT().Fail(gomock.Any(), export.ID).Times(1).Return(nil)
+	repo.EXPECT().Complete(gomock.Any(), gomock.Any()).Times(0)
+
+	service := NewDataExportService(&DataExportServiceConfig{
+		DataExportRepository: repo,
+		Exporters:            []model.UserDataExporter{exporter},
+		ClaimTimeoutSecs:     60,
+	})
+
+	n, err := service.ProcessPendingExports(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+}
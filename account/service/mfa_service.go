@@ -0,0 +1,582 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/library"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// action name of the token a sign in with 2FA enabled is continued with
+const MFAChallengeAction = "mfachallenge"
+
+const (
+	totpPeriod   = 30  // seconds each code is valid for
+	totpSkew     = 1   // steps the clock of an authenticator may be off by
+	totpQRCodePx = 256 // width and height of the QR code returned on enrollment
+)
+
+type mfaService struct {
+	TOTPRepository               model.TOTPRepository
+	WebAuthnCredentialRepository model.WebAuthnCredentialRepository
+	RecoveryCodeRepository       model.RecoveryCodeRepository
+	UserRepository               model.UserRepository
+	ActionTokenRepository        model.ActionTokenRepository
+	Mailer                       model.Mailer
+	AuditService                 model.AuditService
+	EncryptionKey                []byte
+	Issuer                       string
+	RelyingParty                 model.RelyingParty
+	ChallengeExpSecs             int64
+	MaxAttempts                  int
+	Lockout                      model.LockoutPolicy
+}
+
+type MFAServiceConfig struct {
+	TOTPRepository               model.TOTPRepository
+	WebAuthnCredentialRepository model.WebAuthnCredentialRepository
+	RecoveryCodeRepository       model.RecoveryCodeRepository
+	UserRepository               model.UserRepository
+	ActionTokenRepository        model.ActionTokenRepository
+	Mailer                       model.Mailer        // notifies users when codes are locked or a recovery code is used, no notifications are sent if nil
+	AuditService                 model.AuditService  // records failed second factors and the use of recovery codes, nothing is recorded if nil
+	EncryptionKey                []byte              // AES key the secrets are encrypted with, 32 bytes for AES-256
+	Issuer                       string              // name of the app shown in authenticator apps
+	RelyingParty                 model.RelyingParty  // passkeys are verified against it when used as second factor
+	ChallengeExpSecs             int64               // how long a challenge can be completed after signing in with the password
+	MaxAttempts                  int                 // wrong codes after which a challenge is invalidated
+	Lockout                      model.LockoutPolicy // delays and locks authenticator app codes of an account after too many wrong ones
+}
+
+func NewMFAService(c *MFAServiceConfig) model.MFAService {
+	return &mfaService{
+		TOTPRepository:               c.TOTPRepository,
+		WebAuthnCredentialRepository: c.WebAuthnCredentialRepository,
+		RecoveryCodeRepository:       c.RecoveryCodeRepository,
+		UserRepository:               c.UserRepository,
+		ActionTokenRepository:        c.ActionTokenRepository,
+		Mailer:                       c.Mailer,
+		AuditService:                 c.AuditService,
+		EncryptionKey:                c.EncryptionKey,
+		Issuer:                       c.Issuer,
+		RelyingParty:                 c.RelyingParty,
+		ChallengeExpSecs:             c.ChallengeExpSecs,
+		MaxAttempts:                  c.MaxAttempts,
+		Lockout:                      c.Lockout,
+	}
+}
+
+// mfaChallenge is the value stored along with a challenge token
+type mfaChallenge struct {
+	UID               uuid.UUID `json:"uid"`
+	Attempts          int       `json:"attempts"`
+	ExpiresAt         time.Time `json:"expiresAt"`
+	WebAuthnChallenge string    `json:"webAuthnChallenge,omitempty"` // set once an authentication with a passkey has been started
+}
+
+// Challenge returns the challenge the user has to complete with a second factor after signing in with the password.
+// 2FA is enabled by confirming a TOTP enrollment or by registering a passkey, unused recovery codes
+// can complete the challenge in place of either.
+// Returns nil if the user hasn't enabled 2FA, in which case the sign in is complete
+func (s *mfaService) Challenge(ctx context.Context, u *model.User) (*model.MFAChallenge, error) {
+	methods, err := s.enabledMethods(ctx, u.UID)
+	if err != nil {
+		return nil, err
+	}
+	if len(methods) == 0 {
+		return nil, nil
+	}
+
+	codes, err := s.RecoveryCodeRepository.CountUnused(ctx, u.UID)
+	if err != nil {
+		return nil, err
+	}
+	if codes > 0 {
+		methods = append(methods, model.MFAMethodRecovery)
+	}
+
+	token, err := library.SecureToken(32)
+	if err != nil {
+		log.Printf("Failed to generate %s token: %v\n", MFAChallengeAction, err)
+		return nil, model.NewInternal()
+	}
+
+	exp := time.Duration(s.ChallengeExpSecs) * time.Second
+	if err := s.setChallenge(ctx, token, &mfaChallenge{UID: u.UID, ExpiresAt: time.Now().Add(exp)}); err != nil {
+		return nil, err
+	}
+
+	return &model.MFAChallenge{
+		ChallengeToken: token,
+		Methods:        methods,
+		ExpiresIn:      s.ChallengeExpSecs,
+	}, nil
+}
+
+// VerifyTOTP completes the challenge with a code of the users authenticator app and returns the signed in user.
+// A wrong code counts as a failed attempt, the challenge can be retried until MaxAttempts is reached.
+// Wrong codes also count towards the lockout of the account, which new challenges don't reset
+func (s *mfaService) VerifyTOTP(ctx context.Context, challengeToken string, code string) (*model.User, error) {
+	ch, err := s.consumeChallenge(ctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := s.findTOTP(ctx, ch.UID)
+	if err != nil {
+		return nil, err
+	}
+	if !t.Enabled() {
+		// 2FA has been turned off since the challenge was issued
+		return nil, model.NewAuthorization("The challenge is invalid or has expired. Sign in again.")
+	}
+
+	err = s.checkCode(ctx, ch.UID, func() error {
+		return s.verifyCode(ctx, ch.UID, t.Secret, code)
+	})
+	if err != nil {
+		switch model.Status(err) {
+		case http.StatusUnauthorized:
+			recordAudit(ctx, s.AuditService, model.AuditSigninFailed, &ch.UID, model.AuditDetails{"method": model.MFAMethodTOTP, "reason": "invalid_code"})
+			s.retryChallenge(ctx, challengeToken, ch)
+		case http.StatusTooManyRequests:
+			recordAudit(ctx, s.AuditService, model.AuditSigninFailed, &ch.UID, model.AuditDetails{"method": model.MFAMethodTOTP, "reason": "locked"})
+			// no code has been checked, the challenge can still be completed once the delay is over
+			if err := s.setChallenge(ctx, challengeToken, ch); err != nil {
+				log.Printf("Failed to store mfa challenge of uid: %v after a delayed attempt. Error: %v\n", ch.UID, err)
+			}
+		}
+		return nil, err
+	}
+
+	return s.challengedUser(ctx, ch)
+}
+
+// BeginWebAuthn returns the options to complete the challenge with one of the passkeys of the user
+func (s *mfaService) BeginWebAuthn(ctx context.Context, challengeToken string) (*model.WebAuthnRequestOptions, error) {
+	ch, err := s.consumeChallenge(ctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := s.WebAuthnCredentialRepository.FindByUID(ctx, ch.UID)
+	if err != nil {
+		return nil, err
+	}
+	if len(creds) == 0 {
+		// the challenge can still be completed with another method
+		if err := s.setChallenge(ctx, challengeToken, ch); err != nil {
+			return nil, err
+		}
+		return nil, model.NewBadRequest("No passkey has been registered.")
+	}
+
+	ch.WebAuthnChallenge, err = library.SecureToken(32)
+	if err != nil {
+		log.Printf("Failed to generate webauthn challenge: %v\n", err)
+		return nil, model.NewInternal()
+	}
+	if err := s.setChallenge(ctx, challengeToken, ch); err != nil {
+		return nil, err
+	}
+
+	return &model.WebAuthnRequestOptions{
+		Challenge:        ch.WebAuthnChallenge,
+		Timeout:          time.Until(ch.ExpiresAt).Milliseconds(),
+		RPID:             s.RelyingParty.ID,
+		AllowCredentials: credentialDescriptors(creds),
+		UserVerification: userVerificationPreferred,
+	}, nil
+}
+
+// VerifyWebAuthn completes the challenge with the response of a passkey to the options of BeginWebAuthn and returns the signed in user.
+// A failed verification counts as a failed attempt, the passkey authentication has to be started again afterwards
+func (s *mfaService) VerifyWebAuthn(ctx context.Context, challengeToken string, a *model.WebAuthnAssertion) (*model.User, error) {
+	ch, err := s.consumeChallenge(ctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if ch.WebAuthnChallenge == "" {
+		if err := s.setChallenge(ctx, challengeToken, ch); err != nil {
+			return nil, err
+		}
+		return nil, model.NewBadRequest("The passkey authentication has not been started.")
+	}
+
+	if err := s.verifyWebAuthn(ctx, ch, a); err != nil {
+		if model.Status(err) == http.StatusUnauthorized {
+			recordAudit(ctx, s.AuditService, model.AuditSigninFailed, &ch.UID, model.AuditDetails{"method": model.MFAMethodWebAuthn, "reason": "invalid_passkey"})
+			ch.WebAuthnChallenge = ""
+			s.retryChallenge(ctx, challengeToken, ch)
+		}
+		return nil, err
+	}
+
+	return s.challengedUser(ctx, ch)
+}
+
+func (s *mfaService) verifyWebAuthn(ctx context.Context, ch *mfaChallenge, a *model.WebAuthnAssertion) error {
+	credentialID, err := base64.RawURLEncoding.DecodeString(a.ID)
+	if err != nil {
+		return model.NewAuthorization("The passkey could not be verified.")
+	}
+
+	cred, err := s.WebAuthnCredentialRepository.FindByCredentialID(ctx, credentialID)
+	if err != nil {
+		if model.Status(err) == http.StatusNotFound {
+			return model.NewAuthorization("The passkey is not registered.")
+		}
+		return err
+	}
+	if cred.UID != ch.UID {
+		return model.NewAuthorization("The passkey is not registered.")
+	}
+
+	return verifyCredentialUse(ctx, s.WebAuthnCredentialRepository, s.RelyingParty, ch.WebAuthnChallenge, cred, a, false)
+}
+
+// enabledMethods returns the second factors the user has set up
+func (s *mfaService) enabledMethods(ctx context.Context, uid uuid.UUID) ([]string, error) {
+	var methods []string
+
+	t, err := s.findTOTP(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if t.Enabled() {
+		methods = append(methods, model.MFAMethodTOTP)
+	}
+
+	creds, err := s.WebAuthnCredentialRepository.FindByUID(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if len(creds) > 0 {
+		methods = append(methods, model.MFAMethodWebAuthn)
+	}
+
+	return methods, nil
+}
+
+// consumeChallenge invalidates the challenge token and returns the challenge it has been issued for
+func (s *mfaService) consumeChallenge(ctx context.Context, challengeToken string) (*mfaChallenge, error) {
+	value, err := s.ActionTokenRepository.ConsumeActionToken(ctx, MFAChallengeAction, challengeToken)
+	if err != nil {
+		if model.Status(err) == http.StatusNotFound {
+			return nil, model.NewAuthorization("The challenge is invalid or has expired. Sign in again.")
+		}
+		return nil, model.NewInternal()
+	}
+
+	var ch mfaChallenge
+	if err := json.Unmarshal([]byte(value), &ch); err != nil {
+		return nil, model.NewInternal()
+	}
+
+	return &ch, nil
+}
+
+// challengedUser returns the user of a completed challenge
+func (s *mfaService) challengedUser(ctx context.Context, ch *mfaChallenge) (*model.User, error) {
+	user, err := s.UserRepository.FindByID(ctx, ch.UID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := user.CheckActive(); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// EnrollTOTP creates a new secret for the user, which is only used for sign in once it has been confirmed with a code
+func (s *mfaService) EnrollTOTP(ctx context.Context, u *model.User) (*model.TOTPEnrollment, error) {
+	t, err := s.findTOTP(ctx, u.UID)
+	if err != nil {
+		return nil, err
+	}
+	if t.Enabled() {
+		return nil, model.NewBadRequest("2FA is already enabled. Regenerate the secret to switch to another authenticator.")
+	}
+
+	return s.newEnrollment(ctx, u)
+}
+
+// ConfirmTOTP activates the secret of the latest enrollment with a first code generated from it.
+// Returns a new set of recovery codes unless the user still has unused ones
+func (s *mfaService) ConfirmTOTP(ctx context.Context, uid uuid.UUID, code string) ([]string, error) {
+	t, err := s.findTOTP(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil || t.PendingSecret == "" {
+		return nil, model.NewBadRequest("There is no 2FA enrollment to confirm.")
+	}
+
+	secret, err := s.decrypt(uid, t.PendingSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	var step int64
+	err = s.checkCode(ctx, uid, func() error {
+		var ok bool
+		if step, ok = matchTOTPStep(secret, code, time.Now()); !ok {
+			return model.NewAuthorization("Invalid code.")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the step of the confirming code is stored as used, so that the code can't be used to sign in
+	if err := s.TOTPRepository.Activate(ctx, uid, step); err != nil {
+		return nil, err
+	}
+
+	return ensureRecoveryCodes(ctx, s.RecoveryCodeRepository, uid)
+}
+
+// RegenerateTOTP creates a new secret after proving possession of the current one. The current secret
+// stays in use until the new one is confirmed with ConfirmTOTP
+func (s *mfaService) RegenerateTOTP(ctx context.Context, u *model.User, code string) (*model.TOTPEnrollment, error) {
+	t, err := s.findTOTP(ctx, u.UID)
+	if err != nil {
+		return nil, err
+	}
+	if !t.Enabled() {
+		return nil, model.NewBadRequest("2FA is not enabled.")
+	}
+
+	err = s.checkCode(ctx, u.UID, func() error {
+		return s.verifyCode(ctx, u.UID, t.Secret, code)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.newEnrollment(ctx, u)
+}
+
+// DisableTOTP turns 2FA off after proving possession of the current secret
+func (s *mfaService) DisableTOTP(ctx context.Context, uid uuid.UUID, code string) error {
+	t, err := s.findTOTP(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if !t.Enabled() {
+		return model.NewBadRequest("2FA is not enabled.")
+	}
+
+	err = s.checkCode(ctx, uid, func() error {
+		return s.verifyCode(ctx, uid, t.Secret, code)
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.TOTPRepository.Delete(ctx, uid)
+}
+
+// findTOTP returns the secrets of the user, or nil if the user never started an enrollment
+func (s *mfaService) findTOTP(ctx context.Context, uid uuid.UUID) (*model.TOTP, error) {
+	t, err := s.TOTPRepository.Find(ctx, uid)
+	if err != nil {
+		if model.Status(err) == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// newEnrollment generates a secret for the user and stores it as pending
+func (s *mfaService) newEnrollment(ctx context.Context, u *model.User) (*model.TOTPEnrollment, error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      s.Issuer,
+		AccountName: u.Email,
+		Period:      totpPeriod,
+	})
+	if err != nil {
+		log.Printf("Failed to generate totp secret for uid: %v. Error: %v\n", u.UID, err)
+		return nil, model.NewInternal()
+	}
+
+	encrypted, err := library.Encrypt(s.EncryptionKey, key.Secret())
+	if err != nil {
+		log.Printf("Failed to encrypt totp secret for uid: %v. Error: %v\n", u.UID, err)
+		return nil, model.NewInternal()
+	}
+
+	img, err := key.Image(totpQRCodePx, totpQRCodePx)
+	if err != nil {
+		log.Printf("Failed to render totp qr code for uid: %v. Error: %v\n", u.UID, err)
+		return nil, model.NewInternal()
+	}
+	var qrCode bytes.Buffer
+	if err := png.Encode(&qrCode, img); err != nil {
+		log.Printf("Failed to encode totp qr code for uid: %v. Error: %v\n", u.UID, err)
+		return nil, model.NewInternal()
+	}
+
+	if err := s.TOTPRepository.SetPendingSecret(ctx, u.UID, encrypted); err != nil {
+		return nil, err
+	}
+
+	return &model.TOTPEnrollment{
+		URI:    key.URL(),
+		QRCode: base64.StdEncoding.EncodeToString(qrCode.Bytes()),
+		Secret: key.Secret(),
+	}, nil
+}
+
+// checkCode runs verify to check a code of the users authenticator app. Wrong codes count towards the lockout policy
+// like failed sign ins do, on a counter of their own, so that signing in with the password again doesn't give another
+// round of guesses. While codes are delayed or locked, verify isn't run at all. An accepted code clears the count
+func (s *mfaService) checkCode(ctx context.Context, uid uuid.UUID, verify func() error) error {
+	if s.Lockout.MaxFailures <= 0 {
+		return verify()
+	}
+
+	t, ok, err := s.TOTPRepository.ClaimAttempt(ctx, uid, s.Lockout)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return model.NewTooManyRequests(time.Until(*t.LockedUntil))
+	}
+
+	if err := verify(); err != nil {
+		if model.Status(err) == http.StatusUnauthorized && t.FailedAttempts == s.Lockout.MaxFailures {
+			s.sendCodeLockNotice(ctx, uid)
+		}
+		return err
+	}
+
+	if err := s.TOTPRepository.ResetFailedAttempts(ctx, uid); err != nil {
+		log.Printf("Failed to reset failed totp attempts of uid: %v. Error: %v\n", uid, err)
+	}
+
+	return nil
+}
+
+// sendCodeLockNotice tells the user that codes are locked after too many wrong ones.
+// Failures are only logged, the attempt is rejected either way
+func (s *mfaService) sendCodeLockNotice(ctx context.Context, uid uuid.UUID) {
+	if s.Mailer == nil {
+		return
+	}
+
+	u, err := s.UserRepository.FindByID(ctx, uid)
+	if err != nil {
+		log.Printf("Failed to find uid: %v to send totp lock notice. Error: %v\n", uid, err)
+		return
+	}
+
+	body := fmt.Sprintf("Codes of your authenticator app are rejected for %v after %d wrong ones have been entered. If these attempts weren't yours, someone knows your password, change it right away.", s.Lockout.Duration, s.Lockout.MaxFailures)
+	if err := s.Mailer.Send(ctx, u.Email, "Too many wrong 2FA codes", body); err != nil {
+		log.Printf("Failed to send totp lock notice to uid: %v. Error: %v\n", uid, err)
+	}
+}
+
+// verifyCode checks the code against the encrypted secret and marks its step as used,
+// so that each code is only accepted once
+func (s *mfaService) verifyCode(ctx context.Context, uid uuid.UUID, encrypted string, code string) error {
+	secret, err := s.decrypt(uid, encrypted)
+	if err != nil {
+		return err
+	}
+
+	step, ok := matchTOTPStep(secret, code, time.Now())
+	if !ok {
+		return model.NewAuthorization("Invalid code.")
+	}
+
+	used, err := s.TOTPRepository.UseStep(ctx, uid, step)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return model.NewAuthorization("The code has already been used. Wait for the next one.")
+	}
+
+	return nil
+}
+
+func (s *mfaService) decrypt(uid uuid.UUID, encrypted string) (string, error) {
+	secret, err := library.Decrypt(s.EncryptionKey, encrypted)
+	if err != nil {
+		log.Printf("Failed to decrypt totp secret of uid: %v. Error: %v\n", uid, err)
+		return "", model.NewInternal()
+	}
+
+	return secret, nil
+}
+
+// retryChallenge stores the challenge again after a failed attempt, unless it ran out of attempts or time
+func (s *mfaService) retryChallenge(ctx context.Context, token string, ch *mfaChallenge) {
+	ch.Attempts++
+	if ch.Attempts >= s.MaxAttempts || time.Until(ch.ExpiresAt) <= 0 {
+		return
+	}
+
+	if err := s.setChallenge(ctx, token, ch); err != nil {
+		log.Printf("Failed to store mfa challenge of uid: %v after a failed attempt. Error: %v\n", ch.UID, err)
+	}
+}
+
+func (s *mfaService) setChallenge(ctx context.Context, token string, ch *mfaChallenge) error {
+	exp := time.Until(ch.ExpiresAt)
+	if exp <= 0 {
+		return model.NewAuthorization("The challenge is invalid or has expired. Sign in again.")
+	}
+
+	value, err := json.Marshal(ch)
+	if err != nil {
+		return model.NewInternal()
+	}
+
+	if err := s.ActionTokenRepository.SetActionToken(ctx, MFAChallengeAction, token, string(value), exp); err != nil {
+		return model.NewInternal()
+	}
+
+	return nil
+}
+
+// matchTOTPStep returns the time step the code has been generated for, accepting the steps around the current one
+func matchTOTPStep(secret string, code string, now time.Time) (int64, bool) {
+	opts := totp.ValidateOpts{
+		Period:    totpPeriod,
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(step*totpPeriod, 0), opts)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,652 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/maxeth/go-account-api/library"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/require"
+)
+
+var totpTestKey = []byte("0123456789abcdef0123456789abcdef")
+
+const totpTestSecret = "JBSWY3DPEHPK3PXP"
+
+// mfaTestMocks are the dependencies of the mfa service under test
+type mfaTestMocks struct {
+	totpRepo *mocks.MockTOTPRepository
+	credRepo *mocks.MockWebAuthnCredentialRepository
+	codeRepo *mocks.MockRecoveryCodeRepository
+	userRepo *mocks.MockUserRepository
+	atr      *mocks.MockActionTokenRepository
+	mailer   *mocks.MockMailer
+	audit    *mocks.MockAuditService
+}
+
+func newTestMFAService(ctrl *gomock.Controller) (model.MFAService, *mfaTestMocks) {
+	m := &mfaTestMocks{
+		totpRepo: mocks.NewMockTOTPRepository(ctrl),
+		credRepo: mocks.NewMockWebAuthnCredentialRepository(ctrl),
+		codeRepo: mocks.NewMockRecoveryCodeRepository(ctrl),
+		userRepo: mocks.NewMockUserRepository(ctrl),
+		atr:      mocks.NewMockActionTokenRepository(ctrl),
+		mailer:   mocks.NewMockMailer(ctrl),
+		audit:    mocks.NewMockAuditService(ctrl),
+	}
+
+	s := NewMFAService(&MFAServiceConfig{
+		TOTPRepository:               m.totpRepo,
+		WebAuthnCredentialRepository: m.credRepo,
+		RecoveryCodeRepository:       m.codeRepo,
+		UserRepository:               m.userRepo,
+		ActionTokenRepository:        m.atr,
+		Mailer:                       m.mailer,
+		AuditService:                 m.audit,
+		EncryptionKey:                totpTestKey,
+		Issuer:                       "accounts",
+		RelyingParty:                 testRelyingParty,
+		ChallengeExpSecs:             300,
+		MaxAttempts:                  3,
+	})
+
+	return s, m
+}
+
+func encryptedTestSecret(t *testing.T) string {
+	encrypted, err := library.Encrypt(totpTestKey, totpTestSecret)
+	require.NoError(t, err)
+	return encrypted
+}
+
+func currentTestCode(t *testing.T) string {
+	code, err := totp.GenerateCode(totpTestSecret, time.Now())
+	require.NoError(t, err)
+	return code
+}
+
+func TestMFAChallenge(t *testing.T) {
+	user := randomUser(t)
+	encrypted := encryptedTestSecret(t)
+
+	testCases := []struct {
+		name          string
+		buildStubs    func(m *mfaTestMocks)
+		checkResponse func(t *testing.T, challenge *model.MFAChallenge, err error)
+	}{
+		{
+			name: "Enabled",
+			buildStubs: func(m *mfaTestMocks) {
+				m.totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(&model.TOTP{UID: user.UID, Secret: encrypted}, nil)
+				m.credRepo.EXPECT().FindByUID(gomock.Any(), user.UID).Times(1).Return([]*model.WebAuthnCredential{}, nil)
+				m.codeRepo.EXPECT().CountUnused(gomock.Any(), user.UID).Times(1).Return(10, nil)
+				m.atr.EXPECT().SetActionToken(gomock.Any(), MFAChallengeAction, gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil)
+			},
+			checkResponse: func(t *testing.T, challenge *model.MFAChallenge, err error) {
+				require.NoError(t, err)
+				require.NotEmpty(t, challenge.ChallengeToken)
+				require.Equal(t, []string{model.MFAMethodTOTP, model.MFAMethodRecovery}, challenge.Methods)
+				require.Equal(t, int64(300), challenge.ExpiresIn)
+			},
+		},
+		{
+			name: "PasskeyOnly",
+			buildStubs: func(m *mfaTestMocks) {
+				m.totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(nil, model.NewNotFound("uid", user.UID.String()))
+				m.credRepo.EXPECT().FindByUID(gomock.Any(), user.UID).Times(1).Return([]*model.WebAuthnCredential{{UID: user.UID}}, nil)
+				// all recovery codes have been used
+				m.codeRepo.EXPECT().CountUnused(gomock.Any(), user.UID).Times(1).Return(0, nil)
+				m.atr.EXPECT().SetActionToken(gomock.Any(), MFAChallengeAction, gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil)
+			},
+			checkResponse: func(t *testing.T, challenge *model.MFAChallenge, err error) {
+				require.NoError(t, err)
+				require.Equal(t, []string{model.MFAMethodWebAuthn}, challenge.Methods)
+			},
+		},
+		{
+			name: "NotEnrolled",
+			buildStubs: func(m *mfaTestMocks) {
+				m.totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(nil, model.NewNotFound("uid", user.UID.String()))
+				m.credRepo.EXPECT().FindByUID(gomock.Any(), user.UID).Times(1).Return([]*model.WebAuthnCredential{}, nil)
+				m.atr.EXPECT().SetActionToken(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, challenge *model.MFAChallenge, err error) {
+				require.NoError(t, err)
+				require.Nil(t, challenge)
+			},
+		},
+		{
+			name: "EnrollmentNotConfirmed",
+			buildStubs: func(m *mfaTestMocks) {
+				m.totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(&model.TOTP{UID: user.UID, PendingSecret: encrypted}, nil)
+				m.credRepo.EXPECT().FindByUID(gomock.Any(), user.UID).Times(1).Return([]*model.WebAuthnCredential{}, nil)
+				m.atr.EXPECT().SetActionToken(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, challenge *model.MFAChallenge, err error) {
+				require.NoError(t, err)
+				require.Nil(t, challenge)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			s, m := newTestMFAService(ctrl)
+			tc.buildStubs(m)
+
+			challenge, err := s.Challenge(context.Background(), user)
+			tc.checkResponse(t, challenge, err)
+		})
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	user := randomUser(t)
+	user.Status = model.StatusActive
+	suspended := *user
+	suspended.Status = model.StatusSuspended
+
+	encrypted := encryptedTestSecret(t)
+	enabled := &model.TOTP{UID: user.UID, Secret: encrypted}
+
+	challenge := func(attempts int) string {
+		b, err := json.Marshal(&mfaChallenge{UID: user.UID, Attempts: attempts, ExpiresAt: time.Now().Add(time.Minute)})
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	testCases := []struct {
+		name          string
+		code          string
+		buildStubs    func(totpRepo *mocks.MockTOTPRepository, userRepo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository)
+		checkResponse func(t *testing.T, u *model.User, err error)
+	}{
+		{
+			name: "OK",
+			code: currentTestCode(t),
+			buildStubs: func(totpRepo *mocks.MockTOTPRepository, userRepo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), MFAChallengeAction, "challenge").Times(1).Return(challenge(0), nil)
+				totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(enabled, nil)
+				totpRepo.EXPECT().UseStep(gomock.Any(), user.UID, gomock.Any()).Times(1).Return(true, nil)
+				userRepo.EXPECT().FindByID(gomock.Any(), user.UID).Times(1).Return(user, nil)
+			},
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.NoError(t, err)
+				require.Equal(t, user, u)
+			},
+		},
+		{
+			name: "InvalidChallenge",
+			code: currentTestCode(t),
+			buildStubs: func(totpRepo *mocks.MockTOTPRepository, userRepo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), MFAChallengeAction, "challenge").Times(1).Return("", model.NewNotFound("token", "challenge"))
+				totpRepo.EXPECT().Find(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name: "WrongCode",
+			code: "000000",
+			buildStubs: func(totpRepo *mocks.MockTOTPRepository, userRepo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), MFAChallengeAction, "challenge").Times(1).Return(challenge(0), nil)
+				totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(enabled, nil)
+				totpRepo.EXPECT().UseStep(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				// the challenge can be retried with the same token
+				atr.EXPECT().SetActionToken(gomock.Any(), MFAChallengeAction, "challenge", gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(ctx context.Context, action, token, value string, exp time.Duration) error {
+						var ch mfaChallenge
+						require.NoError(t, json.Unmarshal([]byte(value), &ch))
+						require.Equal(t, 1, ch.Attempts)
+						require.True(t, exp > 0 && exp <= time.Minute)
+						return nil
+					})
+				userRepo.EXPECT().FindByID(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name: "LastAttempt",
+			code: "000000",
+			buildStubs: func(totpRepo *mocks.MockTOTPRepository, userRepo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), MFAChallengeAction, "challenge").Times(1).Return(challenge(2), nil)
+				totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(enabled, nil)
+				atr.EXPECT().SetActionToken(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name: "ReplayedCode",
+			code: currentTestCode(t),
+			buildStubs: func(totpRepo *mocks.MockTOTPRepository, userRepo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), MFAChallengeAction, "challenge").Times(1).Return(challenge(0), nil)
+				totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(enabled, nil)
+				totpRepo.EXPECT().UseStep(gomock.Any(), user.UID, gomock.Any()).Times(1).Return(false, nil)
+				atr.EXPECT().SetActionToken(gomock.Any(), MFAChallengeAction, "challenge", gomock.Any(), gomock.Any()).Times(1).Return(nil)
+				userRepo.EXPECT().FindByID(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name: "Disabled",
+			code: currentTestCode(t),
+			buildStubs: func(totpRepo *mocks.MockTOTPRepository, userRepo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), MFAChallengeAction, "challenge").Times(1).Return(challenge(0), nil)
+				totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(nil, model.NewNotFound("uid", user.UID.String()))
+				userRepo.EXPECT().FindByID(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name: "Suspended",
+			code: currentTestCode(t),
+			buildStubs: func(totpRepo *mocks.MockTOTPRepository, userRepo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), MFAChallengeAction, "challenge").Times(1).Return(challenge(0), nil)
+				totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(enabled, nil)
+				totpRepo.EXPECT().UseStep(gomock.Any(), user.UID, gomock.Any()).Times(1).Return(true, nil)
+				userRepo.EXPECT().FindByID(gomock.Any(), user.UID).Times(1).Return(&suspended, nil)
+			},
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.Equal(t, http.StatusForbidden, model.Status(err))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			s, m := newTestMFAService(ctrl)
+			// the events of failed attempts are checked by TestTOTPLockout
+			m.audit.EXPECT().Record(gomock.Any(), gomock.Any()).AnyTimes()
+			tc.buildStubs(m.totpRepo, m.userRepo, m.atr)
+
+			u, err := s.VerifyTOTP(context.Background(), "challenge", tc.code)
+			tc.checkResponse(t, u, err)
+		})
+	}
+}
+
+func TestTOTPLockout(t *testing.T) {
+	user := randomUser(t)
+	user.Status = model.StatusActive
+
+	encrypted := encryptedTestSecret(t)
+	enabled := &model.TOTP{UID: user.UID, Secret: encrypted}
+
+	policy := model.LockoutPolicy{
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxFailures:  10,
+		Duration:     time.Hour,
+	}
+
+	future := time.Now().Add(30 * time.Second)
+	challenge, err := json.Marshal(&mfaChallenge{UID: user.UID, ExpiresAt: time.Now().Add(time.Minute)})
+	require.NoError(t, err)
+
+	// claimed returns the secrets as stored after an attempt has been claimed
+	claimed := func(failedAttempts int, lockedUntil *time.Time) *model.TOTP {
+		return &model.TOTP{UID: user.UID, Secret: encrypted, FailedAttempts: failedAttempts, LockedUntil: lockedUntil}
+	}
+
+	testCases := []struct {
+		name          string
+		code          string
+		buildStubs    func(m *mfaTestMocks)
+		checkResponse func(t *testing.T, err error)
+	}{
+		{
+			name: "OK",
+			code: currentTestCode(t),
+			buildStubs: func(m *mfaTestMocks) {
+				m.totpRepo.EXPECT().ClaimAttempt(gomock.Any(), user.UID, policy).Times(1).Return(claimed(4, &future), true, nil)
+				m.totpRepo.EXPECT().UseStep(gomock.Any(), user.UID, gomock.Any()).Times(1).Return(true, nil)
+				m.totpRepo.EXPECT().ResetFailedAttempts(gomock.Any(), user.UID).Times(1).Return(nil)
+				m.userRepo.EXPECT().FindByID(gomock.Any(), user.UID).Times(1).Return(user, nil)
+			},
+			checkResponse: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "WrongCode",
+			code: "000000",
+			buildStubs: func(m *mfaTestMocks) {
+				m.totpRepo.EXPECT().ClaimAttempt(gomock.Any(), user.UID, policy).Times(1).Return(claimed(2, nil), true, nil)
+				m.totpRepo.EXPECT().ResetFailedAttempts(gomock.Any(), gomock.Any()).Times(0)
+				m.audit.EXPECT().Record(gomock.Any(), &model.AuditEvent{
+					Type:       model.AuditSigninFailed,
+					SubjectUID: &user.UID,
+					Details:    model.AuditDetails{"method": model.MFAMethodTOTP, "reason": "invalid_code"},
+				}).Times(1)
+				m.atr.EXPECT().SetActionToken(gomock.Any(), MFAChallengeAction, "challenge", gomock.Any(), gomock.Any()).Times(1).Return(nil)
+				m.mailer.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name: "Delayed",
+			code: currentTestCode(t),
+			buildStubs: func(m *mfaTestMocks) {
+				// not even the correct code is checked, a new challenge doesn't help either
+				m.totpRepo.EXPECT().ClaimAttempt(gomock.Any(), user.UID, policy).Times(1).Return(claimed(5, &future), false, nil)
+				m.totpRepo.EXPECT().UseStep(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				m.audit.EXPECT().Record(gomock.Any(), &model.AuditEvent{
+					Type:       model.AuditSigninFailed,
+					SubjectUID: &user.UID,
+					Details:    model.AuditDetails{"method": model.MFAMethodTOTP, "reason": "locked"},
+				}).Times(1)
+				// the challenge can be completed once the delay is over
+				m.atr.EXPECT().SetActionToken(gomock.Any(), MFAChallengeAction, "challenge", gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(ctx context.Context, action, token, value string, exp time.Duration) error {
+						var ch mfaChallenge
+						require.NoError(t, json.Unmarshal([]byte(value), &ch))
+						require.Zero(t, ch.Attempts)
+						return nil
+					})
+				m.userRepo.EXPECT().FindByID(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, err error) {
+				require.Equal(t, http.StatusTooManyRequests, model.Status(err))
+				require.Equal(t, 30, err.(*model.Error).RetryAfter)
+			},
+		},
+		{
+			name: "Locked",
+			code: "000000",
+			buildStubs: func(m *mfaTestMocks) {
+				m.totpRepo.EXPECT().ClaimAttempt(gomock.Any(), user.UID, policy).Times(1).Return(claimed(10, &future), true, nil)
+				m.audit.EXPECT().Record(gomock.Any(), gomock.Any()).Times(1)
+				m.atr.EXPECT().SetActionToken(gomock.Any(), MFAChallengeAction, "challenge", gomock.Any(), gomock.Any()).Times(1).Return(nil)
+				// the user learns that someone knows the password
+				m.userRepo.EXPECT().FindByID(gomock.Any(), user.UID).Times(1).Return(user, nil)
+				m.mailer.EXPECT().Send(gomock.Any(), user.Email, gomock.Any(), gomock.Any()).Times(1).Return(nil)
+			},
+			checkResponse: func(t *testing.T, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			s, m := newTestMFAService(ctrl)
+			s.(*mfaService).Lockout = policy
+
+			m.atr.EXPECT().ConsumeActionToken(gomock.Any(), MFAChallengeAction, "challenge").Times(1).Return(string(challenge), nil)
+			m.totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(enabled, nil)
+			tc.buildStubs(m)
+
+			_, err := s.VerifyTOTP(context.Background(), "challenge", tc.code)
+			tc.checkResponse(t, err)
+		})
+	}
+}
+
+func TestDisableTOTPDelayed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := randomUser(t)
+	future := time.Now().Add(time.Minute)
+	policy := model.LockoutPolicy{FreeAttempts: 3, BaseDelay: time.Second, MaxFailures: 10, Duration: time.Hour}
+
+	s, m := newTestMFAService(ctrl)
+	s.(*mfaService).Lockout = policy
+
+	// a stolen access token isn't enough to guess the code that turns 2FA off
+	m.totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(&model.TOTP{UID: user.UID, Secret: encryptedTestSecret(t)}, nil)
+	m.totpRepo.EXPECT().ClaimAttempt(gomock.Any(), user.UID, policy).Times(1).Return(&model.TOTP{FailedAttempts: 5, LockedUntil: &future}, false, nil)
+	m.totpRepo.EXPECT().UseStep(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	m.totpRepo.EXPECT().Delete(gomock.Any(), gomock.Any()).Times(0)
+
+	err := s.DisableTOTP(context.Background(), user.UID, currentTestCode(t))
+	require.Equal(t, http.StatusTooManyRequests, model.Status(err))
+}
+
+func TestEnrollTOTP(t *testing.T) {
+	user := randomUser(t)
+
+	t.Run("OK", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		s, m := newTestMFAService(ctrl)
+
+		var stored string
+		m.totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(nil, model.NewNotFound("uid", user.UID.String()))
+		m.totpRepo.EXPECT().SetPendingSecret(gomock.Any(), user.UID, gomock.Any()).Times(1).
+			DoAndReturn(func(ctx context.Context, uid interface{}, secret string) error {
+				stored = secret
+				return nil
+			})
+
+		enrollment, err := s.EnrollTOTP(context.Background(), user)
+		require.NoError(t, err)
+		require.Contains(t, enrollment.URI, "otpauth://totp/")
+		require.NotEmpty(t, enrollment.QRCode)
+
+		// only the encrypted secret is stored
+		require.NotEqual(t, enrollment.Secret, stored)
+		secret, err := library.Decrypt(totpTestKey, stored)
+		require.NoError(t, err)
+		require.Equal(t, enrollment.Secret, secret)
+	})
+
+	t.Run("AlreadyEnabled", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		s, m := newTestMFAService(ctrl)
+
+		m.totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(&model.TOTP{UID: user.UID, Secret: encryptedTestSecret(t)}, nil)
+		m.totpRepo.EXPECT().SetPendingSecret(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+		_, err := s.EnrollTOTP(context.Background(), user)
+		require.Equal(t, http.StatusBadRequest, model.Status(err))
+	})
+}
+
+func TestConfirmTOTP(t *testing.T) {
+	user := randomUser(t)
+	pending := &model.TOTP{UID: user.UID, PendingSecret: encryptedTestSecret(t)}
+
+	testCases := []struct {
+		name          string
+		code          string
+		buildStubs    func(totpRepo *mocks.MockTOTPRepository, codeRepo *mocks.MockRecoveryCodeRepository)
+		checkResponse func(t *testing.T, codes []string, err error)
+	}{
+		{
+			name: "OK",
+			code: currentTestCode(t),
+			buildStubs: func(totpRepo *mocks.MockTOTPRepository, codeRepo *mocks.MockRecoveryCodeRepository) {
+				totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(pending, nil)
+				totpRepo.EXPECT().Activate(gomock.Any(), user.UID, gomock.Any()).Times(1).Return(nil)
+				codeRepo.EXPECT().CountUnused(gomock.Any(), user.UID).Times(1).Return(0, nil)
+				codeRepo.EXPECT().Replace(gomock.Any(), user.UID, gomock.Len(recoveryCodeCount)).Times(1).Return(nil)
+			},
+			checkResponse: func(t *testing.T, codes []string, err error) {
+				require.NoError(t, err)
+				require.Len(t, codes, recoveryCodeCount)
+			},
+		},
+		{
+			name: "KeepsRecoveryCodes",
+			code: currentTestCode(t),
+			buildStubs: func(totpRepo *mocks.MockTOTPRepository, codeRepo *mocks.MockRecoveryCodeRepository) {
+				totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(pending, nil)
+				totpRepo.EXPECT().Activate(gomock.Any(), user.UID, gomock.Any()).Times(1).Return(nil)
+				codeRepo.EXPECT().CountUnused(gomock.Any(), user.UID).Times(1).Return(3, nil)
+				codeRepo.EXPECT().Replace(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, codes []string, err error) {
+				require.NoError(t, err)
+				require.Nil(t, codes)
+			},
+		},
+		{
+			name: "WrongCode",
+			code: "000000",
+			buildStubs: func(totpRepo *mocks.MockTOTPRepository, codeRepo *mocks.MockRecoveryCodeRepository) {
+				totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(pending, nil)
+				totpRepo.EXPECT().Activate(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				codeRepo.EXPECT().Replace(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, codes []string, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name: "NothingToConfirm",
+			code: currentTestCode(t),
+			buildStubs: func(totpRepo *mocks.MockTOTPRepository, codeRepo *mocks.MockRecoveryCodeRepository) {
+				totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(nil, model.NewNotFound("uid", user.UID.String()))
+				totpRepo.EXPECT().Activate(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				codeRepo.EXPECT().Replace(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, codes []string, err error) {
+				require.Equal(t, http.StatusBadRequest, model.Status(err))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			s, m := newTestMFAService(ctrl)
+			tc.buildStubs(m.totpRepo, m.codeRepo)
+
+			codes, err := s.ConfirmTOTP(context.Background(), user.UID, tc.code)
+			tc.checkResponse(t, codes, err)
+		})
+	}
+}
+
+func TestDisableTOTP(t *testing.T) {
+	user := randomUser(t)
+	enabled := &model.TOTP{UID: user.UID, Secret: encryptedTestSecret(t)}
+
+	testCases := []struct {
+		name          string
+		code          string
+		buildStubs    func(totpRepo *mocks.MockTOTPRepository)
+		checkResponse func(t *testing.T, err error)
+	}{
+		{
+			name: "OK",
+			code: currentTestCode(t),
+			buildStubs: func(totpRepo *mocks.MockTOTPRepository) {
+				totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(enabled, nil)
+				totpRepo.EXPECT().UseStep(gomock.Any(), user.UID, gomock.Any()).Times(1).Return(true, nil)
+				totpRepo.EXPECT().Delete(gomock.Any(), user.UID).Times(1).Return(nil)
+			},
+			checkResponse: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "WrongCode",
+			code: "000000",
+			buildStubs: func(totpRepo *mocks.MockTOTPRepository) {
+				totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(enabled, nil)
+				totpRepo.EXPECT().Delete(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name: "ReplayedCode",
+			code: currentTestCode(t),
+			buildStubs: func(totpRepo *mocks.MockTOTPRepository) {
+				totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(enabled, nil)
+				totpRepo.EXPECT().UseStep(gomock.Any(), user.UID, gomock.Any()).Times(1).Return(false, nil)
+				totpRepo.EXPECT().Delete(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name: "NotEnabled",
+			code: currentTestCode(t),
+			buildStubs: func(totpRepo *mocks.MockTOTPRepository) {
+				totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(nil, model.NewNotFound("uid", user.UID.String()))
+				totpRepo.EXPECT().Delete(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, err error) {
+				require.Equal(t, http.StatusBadRequest, model.Status(err))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			s, m := newTestMFAService(ctrl)
+			tc.buildStubs(m.totpRepo)
+
+			err := s.DisableTOTP(context.Background(), user.UID, tc.code)
+			tc.checkResponse(t, err)
+		})
+	}
+}
+
+func TestRegenerateTOTP(t *testing.T) {
+	user := randomUser(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, m := newTestMFAService(ctrl)
+
+	// the current secret has to be proven before a new one is issued, and stays active until the new one is confirmed
+	m.totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(&model.TOTP{UID: user.UID, Secret: encryptedTestSecret(t)}, nil)
+	m.totpRepo.EXPECT().UseStep(gomock.Any(), user.UID, gomock.Any()).Times(1).Return(true, nil)
+	m.totpRepo.EXPECT().SetPendingSecret(gomock.Any(), user.UID, gomock.Any()).Times(1).Return(nil)
+	m.totpRepo.EXPECT().Delete(gomock.Any(), gomock.Any()).Times(0)
+
+	enrollment, err := s.RegenerateTOTP(context.Background(), user, currentTestCode(t))
+	require.NoError(t, err)
+	require.NotEqual(t, totpTestSecret, enrollment.Secret)
+}
@@ -1,40 +1,297 @@
 package service
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"strings"
 
+	"github.com/maxeth/go-account-api/model"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
 )
 
-// hashes a plain password and returns the hash on success.
-func HashPassword(password string) (string, error) {
-	hpw, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// ErrPasswordMismatch is returned when a password doesn't match the hash it is verified against
+var ErrPasswordMismatch = errors.New("password doesn't match the hash")
+
+// ErrUnsupportedHash is returned for hashes of an unknown algorithm or in an invalid format
+var ErrUnsupportedHash = errors.New("unsupported password hash")
+
+// upper bounds of the cost parameters of hashes the hasher hasn't created itself, like those of imported users. Higher ones
+// would let a single sign in take up the server: scrypt needs 128·r·2^ln bytes of memory, 64 MiB with these bounds,
+// and every further bcrypt cost doubles the time a comparison takes
+const (
+	maxScryptLogN       = 16 // ln of scrypt, the memCost of Firebase scrypt
+	maxScryptRounds     = 8  // r·p of scrypt, the rounds of Firebase scrypt
+	maxPBKDF2Iterations = 2000000
+	maxBcryptCost       = 14
+)
+
+// Argon2Params are the parameters new passwords are hashed with. Memory is in KiB
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params follow the recommendation of RFC 9106 for memory constrained environments
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 4,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Validate checks the parameters against the limits of argon2, which panics on zero iterations or parallelism
+// and needs at least 8 KiB of memory per lane
+func (p Argon2Params) Validate() error {
+	if p.Iterations < 1 {
+		return errors.New("iterations must be at least 1")
+	}
+	if p.Parallelism < 1 {
+		return errors.New("parallelism must be at least 1")
+	}
+	if p.Memory < 8*uint32(p.Parallelism) {
+		return fmt.Errorf("memory must be at least %d KiB with a parallelism of %d", 8*uint32(p.Parallelism), p.Parallelism)
+	}
+	return nil
+}
+
+// hashes passwords with the default parameters, see HashPassword
+var defaultPasswordHasher = NewPasswordHasher(&PasswordHasherConfig{Argon2: DefaultArgon2Params})
+
+// FirebaseScryptKey holds the project-wide parameters of the Firebase scrypt hashes, as shown in the password hash parameters of the Firebase console
+type FirebaseScryptKey struct {
+	SignerKey     []byte
+	SaltSeparator []byte
+}
+
+type passwordHasher struct {
+	Argon2         Argon2Params
+	FirebaseScrypt FirebaseScryptKey
+}
+
+type PasswordHasherConfig struct {
+	Argon2         Argon2Params      // the parameters of new hashes. Hashes with different parameters are reported as outdated
+	FirebaseScrypt FirebaseScryptKey // only required to verify the passwords of users imported from Firebase
+}
+
+// NewPasswordHasher returns a hasher which hashes passwords with argon2id and verifies hashes in the PHC string format
+// of argon2id and scrypt, bcrypt hashes and the hashes of imported users, see EncodeImportedHash
+func NewPasswordHasher(c *PasswordHasherConfig) model.PasswordHasher {
+	return &passwordHasher{
+		Argon2:         c.Argon2,
+		FirebaseScrypt: c.FirebaseScrypt,
+	}
+}
+
+// Hash hashes the password with argon2id, encoded as $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>
+func (h *passwordHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.Argon2.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	p := h.Argon2
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Iterations, p.Parallelism, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+// Verify returns nil if the password matches the hash. outdated is true if the hash hasn't been created
+// with argon2id and the current parameters, the password should then be hashed again while it is at hand
+func (h *passwordHasher) Verify(hash, password string) (outdated bool, err error) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return h.verifyArgon2id(hash, password)
+	case strings.HasPrefix(hash, "$scrypt$"):
+		if err := verifyScrypt(hash, password); err != nil {
+			return false, err
+		}
+		return true, nil
+	case strings.HasPrefix(hash, "$firebase-scrypt$"):
+		if err := h.verifyFirebaseScrypt(hash, password); err != nil {
+			return false, err
+		}
+		return true, nil
+	case strings.HasPrefix(hash, "$pbkdf2-sha256$"):
+		if err := verifyPBKDF2SHA256(hash, password); err != nil {
+			return false, err
+		}
+		return true, nil
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		if cost, err := bcrypt.Cost([]byte(hash)); err != nil || cost > maxBcryptCost {
+			return false, ErrUnsupportedHash
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return false, ErrPasswordMismatch
+			}
+			return false, ErrUnsupportedHash
+		}
+		return true, nil
+	}
+
+	return false, ErrUnsupportedHash
+}
+
+func (h *passwordHasher) verifyArgon2id(hash, password string) (bool, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, ErrUnsupportedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, ErrUnsupportedHash
+	}
+
+	var p Argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return false, ErrUnsupportedHash
+	}
+
+	salt, key, err := decodeSaltAndKey(parts[4], parts[5])
 	if err != nil {
-		return "", fmt.Errorf("failed to hash pw %w", err)
+		return false, err
+	}
+	p.SaltLength, p.KeyLength = uint32(len(salt)), uint32(len(key))
+
+	if subtle.ConstantTimeCompare(key, argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)) != 1 {
+		return false, ErrPasswordMismatch
 	}
 
-	return string(hpw), nil
+	return p != h.Argon2, nil
 }
 
-// compares hash to given password and returns nil on success.
-func ComparePassword(hPw, pw string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hPw), []byte(pw))
+// verifyScrypt verifies a hash in the format $scrypt$ln=<log2 of N>,r=<block size>,p=<parallelism>$<salt>$<key>
+func verifyScrypt(hash, password string) error {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 {
+		return ErrUnsupportedHash
+	}
+
+	var ln, r, p int
+	if _, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &ln, &r, &p); err != nil || ln < 1 || ln > maxScryptLogN || r < 1 || p < 1 || r*p > maxScryptRounds {
+		return ErrUnsupportedHash
+	}
+
+	salt, key, err := decodeSaltAndKey(parts[3], parts[4])
+	if err != nil {
+		return err
+	}
+
+	derived, err := scrypt.Key([]byte(password), salt, 1<<ln, r, p, len(key))
+	if err != nil {
+		return ErrUnsupportedHash
+	}
+
+	if subtle.ConstantTimeCompare(key, derived) != 1 {
+		return ErrPasswordMismatch
+	}
+
+	return nil
+}
+
+// verifyFirebaseScrypt verifies a hash in the format $firebase-scrypt$m=<mem cost>,r=<rounds>$<salt>$<key>.
+// Firebase derives a key from the password with scrypt and stores the project signer key encrypted with it
+func (h *passwordHasher) verifyFirebaseScrypt(hash, password string) error {
+	if len(h.FirebaseScrypt.SignerKey) == 0 {
+		return ErrUnsupportedHash
+	}
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 {
+		return ErrUnsupportedHash
+	}
+
+	var memCost, rounds int
+	if _, err := fmt.Sscanf(parts[2], "m=%d,r=%d", &memCost, &rounds); err != nil || memCost < 1 || memCost > maxScryptLogN || rounds < 1 || rounds > maxScryptRounds {
+		return ErrUnsupportedHash
+	}
+
+	salt, key, err := decodeSaltAndKey(parts[3], parts[4])
+	if err != nil {
+		return err
+	}
+
+	derived, err := scrypt.Key([]byte(password), append(salt, h.FirebaseScrypt.SaltSeparator...), 1<<memCost, rounds, 1, 32)
+	if err != nil {
+		return ErrUnsupportedHash
+	}
+
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return ErrUnsupportedHash
+	}
+	encrypted := make([]byte, len(h.FirebaseScrypt.SignerKey))
+	cipher.NewCTR(block, make([]byte, aes.BlockSize)).XORKeyStream(encrypted, h.FirebaseScrypt.SignerKey)
+
+	if subtle.ConstantTimeCompare(key, encrypted) != 1 {
+		return ErrPasswordMismatch
+	}
+
+	return nil
 }
 
-// func hashPassword(pw string) (string, error) {
-// 	salt := make([]byte, 32)
-// 	_, err := rand.Read(salt)
+// verifyPBKDF2SHA256 verifies a hash in the format $pbkdf2-sha256$i=<iterations>$<salt>$<key>
+func verifyPBKDF2SHA256(hash, password string) error {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 {
+		return ErrUnsupportedHash
+	}
+
+	var iterations int
+	if _, err := fmt.Sscanf(parts[2], "i=%d", &iterations); err != nil || iterations < 1 || iterations > maxPBKDF2Iterations {
+		return ErrUnsupportedHash
+	}
+
+	salt, key, err := decodeSaltAndKey(parts[3], parts[4])
+	if err != nil {
+		return err
+	}
 
-// 	if err != nil {
-// 		return "", err
-// 	}
+	if subtle.ConstantTimeCompare(key, pbkdf2.Key([]byte(password), salt, iterations, len(key), sha256.New)) != 1 {
+		return ErrPasswordMismatch
+	}
 
-// 	sHash, err := scrypt.Key([]byte(pw), salt, 32768, 8, 1, 32)
-// 	if err != nil {
-// 		return "", err
-// 	}
+	return nil
+}
 
-// 	hashedPw := fmt.Sprintf("%s.%s", hex.EncodeToString(sHash), hex.EncodeToString(salt))
+// PHC strings encode binary values in base64 without padding
+var b64 = base64.RawStdEncoding
 
-// 	return hashedPw, nil
-// }
+func decodeSaltAndKey(encodedSalt, encodedKey string) ([]byte, []byte, error) {
+	salt, err := b64.DecodeString(encodedSalt)
+	if err != nil {
+		return nil, nil, ErrUnsupportedHash
+	}
+	key, err := b64.DecodeString(encodedKey)
+	if err != nil || len(key) == 0 {
+		return nil, nil, ErrUnsupportedHash
+	}
+
+	return salt, key, nil
+}
+
+// HashPassword hashes a plain password with the default parameters and returns the hash on success.
+func HashPassword(password string) (string, error) {
+	return defaultPasswordHasher.Hash(password)
+}
+
+// ComparePassword verifies a password against a hash of any supported algorithm and returns nil on success.
+func ComparePassword(hPw, pw string) error {
+	_, err := defaultPasswordHasher.Verify(hPw, pw)
+	return err
+}
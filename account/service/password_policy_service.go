@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/maxeth/go-account-api/model"
+)
+
+// field the violations of the password policy are reported for
+const passwordField = "password"
+
+// parts of the email and the name shorter than this aren't looked for in passwords, they'd reject too many of them
+const minUserInfoLen = 3
+
+type passwordPolicyService struct {
+	BreachedPasswordRepository model.BreachedPasswordRepository
+	Policy                     model.PasswordPolicy
+}
+
+type PasswordPolicyServiceConfig struct {
+	BreachedPasswordRepository model.BreachedPasswordRepository // required if the policy rejects breached passwords
+	Policy                     model.PasswordPolicy
+}
+
+func NewPasswordPolicyService(c *PasswordPolicyServiceConfig) model.PasswordPolicyService {
+	return &passwordPolicyService{
+		BreachedPasswordRepository: c.BreachedPasswordRepository,
+		Policy:                     c.Policy,
+	}
+}
+
+// Check returns an error holding an InvalidArgument for every rule of the policy the password violates.
+// u is the user the password is meant for, it only has to hold the email when signing up
+func (s *passwordPolicyService) Check(ctx context.Context, password string, u *model.User) error {
+	var violations []model.InvalidArgument
+	violate := func(rule, param, message string) {
+		violations = append(violations, model.InvalidArgument{
+			Field:   passwordField,
+			Tag:     rule,
+			Param:   param,
+			Message: message,
+		})
+	}
+
+	p := s.Policy
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violate(model.PasswordRuleMinLength, strconv.Itoa(p.MinLength), fmt.Sprintf("Password should have at least %d characters.", p.MinLength))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violate(model.PasswordRuleMaxLength, strconv.Itoa(p.MaxLength), fmt.Sprintf("Password should have at most %d characters.", p.MaxLength))
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsLetter(r) && !unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireLower && !lower {
+		violate(model.PasswordRuleLower, "", "Password should contain a lowercase letter.")
+	}
+	if p.RequireUpper && !upper {
+		violate(model.PasswordRuleUpper, "", "Password should contain an uppercase letter.")
+	}
+	if p.RequireDigit && !digit {
+		violate(model.PasswordRuleDigit, "", "Password should contain a digit.")
+	}
+	if p.RequireSymbol && !symbol {
+		violate(model.PasswordRuleSymbol, "", "Password should contain a symbol.")
+	}
+
+	if p.RejectUserInfo && u != nil && containsUserInfo(password, u) {
+		violate(model.PasswordRuleUserInfo, "", "Password should not contain your email or name.")
+	}
+
+	if p.RejectBreached && s.isBreached(ctx, password) {
+		violate(model.PasswordRuleBreached, "", "Password has appeared in a data breach and can't be used. Choose a different one.")
+	}
+
+	if len(violations) > 0 {
+		return model.NewInvalidArguments(violations)
+	}
+
+	return nil
+}
+
+// isBreached looks the password up in the breached password list. If the lookup fails, the password is allowed
+func (s *passwordPolicyService) isBreached(ctx context.Context, password string) bool {
+	breached, err := s.BreachedPasswordRepository.Contains(ctx, sha1.Sum([]byte(password)))
+	if err != nil {
+		log.Printf("Failed to look up password in breached password list, allowing it: %v\n", err)
+		return false
+	}
+
+	return breached
+}
+
+// containsUserInfo reports whether the password contains the email of the user, the part before the @,
+// or any word of the name, ignoring case
+func containsUserInfo(password string, u *model.User) bool {
+	password = strings.ToLower(password)
+
+	var infos []string
+	if email := strings.ToLower(u.Email); email != "" {
+		infos = append(infos, email)
+		if i := strings.LastIndexByte(email, '@'); i > 0 {
+			infos = append(infos, email[:i])
+		}
+	}
+	infos = append(infos, strings.Fields(strings.ToLower(u.Name))...)
+
+	for _, info := range infos {
+		if utf8.RuneCountInString(info) >= minUserInfoLen && strings.Contains(password, info) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := model.PasswordPolicy{
+		MinLength:      10,
+		MaxLength:      20,
+		RequireLower:   true,
+		RequireUpper:   true,
+		RequireDigit:   true,
+		RequireSymbol:  true,
+		RejectUserInfo: true,
+		RejectBreached: true,
+	}
+	user := &model.User{Email: "jane.doe@example.com", Name: "Jane Doe"}
+
+	testCases := []struct {
+		name       string
+		password   string
+		breached   bool
+		lookupErr  error
+		violations []string
+	}{
+		{
+			name:     "OK",
+			password: "Correct-Horse-9",
+		},
+		{
+			name:       "TooShort",
+			password:   "Sh0rt!",
+			violations: []string{model.PasswordRuleMinLength},
+		},
+		{
+			name:       "TooLong",
+			password:   "Way-Too-Long-Password-1",
+			violations: []string{model.PasswordRuleMaxLength},
+		},
+		{
+			name:       "MissingClasses",
+			password:   "onlylowercase",
+			violations: []string{model.PasswordRuleUpper, model.PasswordRuleDigit, model.PasswordRuleSymbol},
+		},
+		{
+			name:       "ContainsEmail",
+			password:   "Jane.Doe-1234",
+			violations: []string{model.PasswordRuleUserInfo},
+		},
+		{
+			name:       "ContainsName",
+			password:   "My-DOE-secret-7",
+			violations: []string{model.PasswordRuleUserInfo},
+		},
+		{
+			name:       "Breached",
+			password:   "Correct-Horse-9",
+			breached:   true,
+			violations: []string{model.PasswordRuleBreached},
+		},
+		{
+			name:      "LookupFailed",
+			password:  "Correct-Horse-9",
+			lookupErr: errors.New("lookup failed"),
+		},
+		{
+			// longer than MaxLength in bytes, but not in characters
+			name:     "CountsCharacters",
+			password: "Äöüäöüäöü-Ñandú-7",
+		},
+		{
+			name:       "AllViolations",
+			password:   "jane",
+			violations: []string{model.PasswordRuleMinLength, model.PasswordRuleUpper, model.PasswordRuleDigit, model.PasswordRuleSymbol, model.PasswordRuleUserInfo, model.PasswordRuleBreached},
+			breached:   true,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockBreachedPasswordRepository(ctrl)
+			repo.EXPECT().
+				Contains(gomock.Any(), sha1.Sum([]byte(tc.password))).
+				Times(1).Return(tc.breached, tc.lookupErr)
+
+			s := NewPasswordPolicyService(&PasswordPolicyServiceConfig{
+				BreachedPasswordRepository: repo,
+				Policy:                     policy,
+			})
+
+			err := s.Check(context.Background(), tc.password, user)
+			if len(tc.violations) == 0 {
+				require.NoError(t, err)
+				return
+			}
+
+			var appErr *model.Error
+			require.True(t, errors.As(err, &appErr))
+			require.Equal(t, model.BadRequest, appErr.Type)
+			require.Equal(t, "password", appErr.Field)
+
+			rules := make([]string, len(appErr.InvalidArgs))
+			for i, arg := range appErr.InvalidArgs {
+				require.Equal(t, "password", arg.Field)
+				require.Empty(t, arg.Value)
+				require.NotEmpty(t, arg.Message)
+				rules[i] = arg.Tag
+			}
+			require.Equal(t, tc.violations, rules)
+		})
+	}
+}
+
+func TestPasswordPolicyWithoutBreachedList(t *testing.T) {
+	s := NewPasswordPolicyService(&PasswordPolicyServiceConfig{
+		Policy: model.PasswordPolicy{MinLength: 6},
+	})
+
+	require.NoError(t, s.Check(context.Background(), "password", &model.User{Email: email}))
+	require.Error(t, s.Check(context.Background(), "pass", &model.User{Email: email}))
+}
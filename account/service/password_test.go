@@ -0,0 +1,259 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/maxeth/go-account-api/model"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// cheap parameters, so that the tests don't spend their time hashing
+var testArgon2Params = Argon2Params{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func TestArgon2ParamsValidate(t *testing.T) {
+	require.NoError(t, DefaultArgon2Params.Validate())
+	require.NoError(t, testArgon2Params.Validate())
+
+	invalid := map[string]Argon2Params{
+		"NoIterations":    {Memory: 1024, Iterations: 0, Parallelism: 1},
+		"NoParallelism":   {Memory: 1024, Iterations: 1, Parallelism: 0},
+		"TooLittleMemory": {Memory: 31, Iterations: 1, Parallelism: 4},
+	}
+	for name, p := range invalid {
+		require.Error(t, p.Validate(), name)
+	}
+}
+
+func TestPasswordHasher(t *testing.T) {
+	// the example parameters of the Firebase scrypt reference implementation
+	signerKey, err := base64.StdEncoding.DecodeString("jxspr8Ki0RYycVU8zykbdLGjFQ3McFUH0uiiTvC8pVMXAn210wjLNmdZJzxUECKbm0QsEmYUSDzZvpjeJ9WmXA==")
+	require.NoError(t, err)
+	saltSeparator, err := base64.StdEncoding.DecodeString("Bw==")
+	require.NoError(t, err)
+
+	hasher := NewPasswordHasher(&PasswordHasherConfig{
+		Argon2:         testArgon2Params,
+		FirebaseScrypt: FirebaseScryptKey{SignerKey: signerKey, SaltSeparator: saltSeparator},
+	})
+
+	argon2Hash, err := hasher.Hash("password")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(argon2Hash, "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+	// the same password is hashed with a new salt every time
+	otherHash, err := hasher.Hash("password")
+	require.NoError(t, err)
+	require.NotEqual(t, argon2Hash, otherHash)
+
+	outdatedHasher := NewPasswordHasher(&PasswordHasherConfig{Argon2: Argon2Params{Memory: 512, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}})
+	outdatedArgon2Hash, err := outdatedHasher.Hash("password")
+	require.NoError(t, err)
+
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	salt := []byte("0123456789abcdef")
+	scryptKey, err := scrypt.Key([]byte("password"), salt, 1<<10, 8, 1, 32)
+	require.NoError(t, err)
+	scryptHash := fmt.Sprintf("$scrypt$ln=10,r=8,p=1$%s$%s", b64.EncodeToString(salt), b64.EncodeToString(scryptKey))
+
+	firebaseHash, err := EncodeImportedHash(&model.ImportedUser{
+		Scheme:  model.HashSchemeFirebaseScrypt,
+		Hash:    "lSrfV15cpx95/sZS2W9c9Kp6i/LVgQNDNC/qzrCnh1SAyZvqmZqAjTdn3aoItz+VHjoZilo78198JAdRuid5lQ==",
+		Salt:    "42xEC+ixf3L2lw==",
+		Rounds:  8,
+		MemCost: 14,
+	})
+	require.NoError(t, err)
+
+	pbkdf2Salt := []byte("0123456789abcdef")
+	pbkdf2Hash, err := EncodeImportedHash(&model.ImportedUser{
+		Scheme:     model.HashSchemePBKDF2SHA256,
+		Hash:       base64.StdEncoding.EncodeToString(pbkdf2.Key([]byte("password"), pbkdf2Salt, 1000, 32, sha256.New)),
+		Salt:       base64.StdEncoding.EncodeToString(pbkdf2Salt),
+		Iterations: 1000,
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name         string
+		hash         string
+		password     string
+		wantOutdated bool
+		wantErr      error
+	}{
+		{
+			name:     "Argon2id",
+			hash:     argon2Hash,
+			password: "password",
+		},
+		{
+			name:     "Argon2idWrongPassword",
+			hash:     argon2Hash,
+			password: "wrong password",
+			wantErr:  ErrPasswordMismatch,
+		},
+		{
+			name:         "Argon2idOutdatedParameters",
+			hash:         outdatedArgon2Hash,
+			password:     "password",
+			wantOutdated: true,
+		},
+		{
+			name:         "Bcrypt",
+			hash:         string(bcryptHash),
+			password:     "password",
+			wantOutdated: true,
+		},
+		{
+			name:     "BcryptWrongPassword",
+			hash:     string(bcryptHash),
+			password: "wrong password",
+			wantErr:  ErrPasswordMismatch,
+		},
+		{
+			name:         "Scrypt",
+			hash:         scryptHash,
+			password:     "password",
+			wantOutdated: true,
+		},
+		{
+			name:     "ScryptWrongPassword",
+			hash:     scryptHash,
+			password: "wrong password",
+			wantErr:  ErrPasswordMismatch,
+		},
+		{
+			name:         "FirebaseScrypt",
+			hash:         firebaseHash,
+			password:     "user1password",
+			wantOutdated: true,
+		},
+		{
+			name:     "FirebaseScryptWrongPassword",
+			hash:     firebaseHash,
+			password: "user2password",
+			wantErr:  ErrPasswordMismatch,
+		},
+		{
+			name:         "PBKDF2SHA256",
+			hash:         pbkdf2Hash,
+			password:     "password",
+			wantOutdated: true,
+		},
+		{
+			name:     "PBKDF2SHA256WrongPassword",
+			hash:     pbkdf2Hash,
+			password: "wrong password",
+			wantErr:  ErrPasswordMismatch,
+		},
+		{
+			// accounts created through a sign in link have no password
+			name:     "Empty",
+			hash:     "",
+			password: "",
+			wantErr:  ErrUnsupportedHash,
+		},
+		{
+			name:     "Malformed",
+			hash:     "$argon2id$v=19$m=1024,t=1,p=1$not base64!$",
+			password: "password",
+			wantErr:  ErrUnsupportedHash,
+		},
+		{
+			// stored hashes are trusted no more than imported ones, their cost is capped as well
+			name:     "ScryptTooMuchMemory",
+			hash:     "$scrypt$ln=17,r=8,p=1$c2FsdA$aGFzaA",
+			password: "password",
+			wantErr:  ErrUnsupportedHash,
+		},
+		{
+			name:     "ScryptTooManyRounds",
+			hash:     "$scrypt$ln=10,r=8,p=2$c2FsdA$aGFzaA",
+			password: "password",
+			wantErr:  ErrUnsupportedHash,
+		},
+		{
+			name:     "FirebaseScryptTooMuchMemory",
+			hash:     "$firebase-scrypt$m=17,r=8$c2FsdA$aGFzaA",
+			password: "password",
+			wantErr:  ErrUnsupportedHash,
+		},
+		{
+			name:     "FirebaseScryptTooManyRounds",
+			hash:     "$firebase-scrypt$m=14,r=9$c2FsdA$aGFzaA",
+			password: "password",
+			wantErr:  ErrUnsupportedHash,
+		},
+		{
+			name:     "PBKDF2SHA256TooManyIterations",
+			hash:     "$pbkdf2-sha256$i=2000001$c2FsdA$aGFzaA",
+			password: "password",
+			wantErr:  ErrUnsupportedHash,
+		},
+		{
+			name:     "BcryptTooExpensive",
+			hash:     "$2a$15$" + strings.Repeat("a", 53),
+			password: "password",
+			wantErr:  ErrUnsupportedHash,
+		},
+		{
+			name:     "UnknownAlgorithm",
+			hash:     "$md5$salt$hash",
+			password: "password",
+			wantErr:  ErrUnsupportedHash,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			outdated, err := hasher.Verify(tc.hash, tc.password)
+			require.Equal(t, tc.wantErr, err)
+			require.Equal(t, tc.wantOutdated, outdated)
+		})
+	}
+
+	// Firebase hashes can't be verified without the key of the project
+	_, err = NewPasswordHasher(&PasswordHasherConfig{Argon2: testArgon2Params}).Verify(firebaseHash, "user1password")
+	require.Equal(t, ErrUnsupportedHash, err)
+}
+
+// BenchmarkArgon2id helps to pick the argon2id parameters. Pick the most expensive ones that keep
+// a sign in fast enough on the production hardware, with -cpu set to the cores available to the service
+func BenchmarkArgon2id(b *testing.B) {
+	for _, memory := range []uint32{19 * 1024, 46 * 1024, 64 * 1024} {
+		for _, iterations := range []uint32{1, 2, 3} {
+			for _, parallelism := range []uint8{1, 2, 4} {
+				params := DefaultArgon2Params
+				params.Memory = memory
+				params.Iterations = iterations
+				params.Parallelism = parallelism
+
+				hasher := NewPasswordHasher(&PasswordHasherConfig{Argon2: params})
+
+				b.Run(fmt.Sprintf("m=%d,t=%d,p=%d", memory, iterations, parallelism), func(b *testing.B) {
+					for i := 0; i < b.N; i++ {
+						if _, err := hasher.Hash("correct horse battery staple"); err != nil {
+							b.Fatal(err)
+						}
+					}
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/maxeth/go-account-api/model"
+)
+
+type rateLimitService struct {
+	RateLimitRepository model.RateLimitRepository
+	Policies            map[string]model.RateLimitPolicy
+}
+
+// rateLimitBucket counts the attempts of an action under key
+type rateLimitBucket struct {
+	limit model.RateLimit
+	key   string
+}
+
+type RateLimitServiceConfig struct {
+	RateLimitRepository model.RateLimitRepository
+	Policies            map[string]model.RateLimitPolicy // actions without a policy aren't limited
+}
+
+func NewRateLimitService(c *RateLimitServiceConfig) model.RateLimitService {
+	return &rateLimitService{
+		RateLimitRepository: c.RateLimitRepository,
+		Policies:            c.Policies,
+	}
+}
+
+// Allow counts an attempt of the action and returns a TooManyRequests error if the client ip,
+// the email or the combination of both exceeded its limit. The email is optional for actions
+// that aren't tied to an account. If the attempts can't be counted, the attempt is allowed
+func (s *rateLimitService) Allow(ctx context.Context, action string, ip string, email string) error {
+	policy, ok := s.Policies[action]
+	if !ok {
+		return nil
+	}
+
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	buckets := []rateLimitBucket{
+		{policy.PerIP, fmt.Sprintf("%s:ip:%s", action, ip)},
+	}
+	if email != "" {
+		buckets = append(buckets,
+			rateLimitBucket{policy.PerEmail, fmt.Sprintf("%s:email:%s", action, email)},
+			rateLimitBucket{policy.PerIPEmail, fmt.Sprintf("%s:ipemail:%s:%s", action, ip, email)},
+		)
+	}
+
+	// every bucket counts the attempt, the client has to wait for the one that frees up last
+	var retryAfter time.Duration
+	for _, b := range buckets {
+		if b.limit.Limit <= 0 {
+			continue
+		}
+
+		count, ttl, err := s.RateLimitRepository.Increment(ctx, b.key, b.limit.Window)
+		if err != nil {
+			log.Printf("Failed to count %s attempt, allowing it: %v\n", action, err)
+			continue
+		}
+
+		if count > b.limit.Limit && ttl > retryAfter {
+			retryAfter = ttl
+		}
+	}
+
+	if retryAfter > 0 {
+		return model.NewTooManyRequests(retryAfter)
+	}
+
+	return nil
+}
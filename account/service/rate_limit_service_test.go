@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitAllow(t *testing.T) {
+	const ip = "203.0.113.7"
+
+	policy := model.RateLimitPolicy{
+		PerIP:      model.RateLimit{Limit: 50, Window: 5 * time.Minute},
+		PerEmail:   model.RateLimit{Limit: 10, Window: 5 * time.Minute},
+		PerIPEmail: model.RateLimit{Limit: 5, Window: time.Minute},
+	}
+
+	testCases := []struct {
+		name          string
+		action        string
+		email         string
+		buildStubs    func(repo *mocks.MockRateLimitRepository)
+		checkResponse func(t *testing.T, err error)
+	}{
+		{
+			name:   "UnderLimit",
+			action: model.ActionSignin,
+			email:  email,
+			buildStubs: func(repo *mocks.MockRateLimitRepository) {
+				repo.EXPECT().Increment(gomock.Any(), "signin:ip:"+ip, 5*time.Minute).Times(1).Return(int64(1), 5*time.Minute, nil)
+				repo.EXPECT().Increment(gomock.Any(), "signin:email:"+email, 5*time.Minute).Times(1).Return(int64(1), 5*time.Minute, nil)
+				repo.EXPECT().Increment(gomock.Any(), "signin:ipemail:"+ip+":"+email, time.Minute).Times(1).Return(int64(5), time.Minute, nil)
+			},
+			checkResponse: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:   "OverLimit",
+			action: model.ActionSignin,
+			email:  " SomeMail@gmail.com",
+			buildStubs: func(repo *mocks.MockRateLimitRepository) {
+				// the email is normalized, so that changing its case doesn't open a new bucket
+				repo.EXPECT().Increment(gomock.Any(), "signin:ip:"+ip, gomock.Any()).Times(1).Return(int64(1), 5*time.Minute, nil)
+				repo.EXPECT().Increment(gomock.Any(), "signin:email:"+email, gomock.Any()).Times(1).Return(int64(11), 90*time.Second, nil)
+				repo.EXPECT().Increment(gomock.Any(), "signin:ipemail:"+ip+":"+email, gomock.Any()).Times(1).Return(int64(6), 30*time.Second, nil)
+			},
+			checkResponse: func(t *testing.T, err error) {
+				// the client has to wait until every exceeded bucket frees up
+				require.Equal(t, http.StatusTooManyRequests, model.Status(err))
+				require.Equal(t, 90, err.(*model.Error).RetryAfter)
+			},
+		},
+		{
+			name:   "WithoutEmail",
+			action: model.ActionTokenRefresh,
+			buildStubs: func(repo *mocks.MockRateLimitRepository) {
+				repo.EXPECT().Increment(gomock.Any(), "token_refresh:ip:"+ip, gomock.Any()).Times(1).Return(int64(51), 1500*time.Millisecond, nil)
+			},
+			checkResponse: func(t *testing.T, err error) {
+				require.Equal(t, http.StatusTooManyRequests, model.Status(err))
+				require.Equal(t, 2, err.(*model.Error).RetryAfter)
+			},
+		},
+		{
+			name:   "NoPolicy",
+			action: model.ActionSignup,
+			email:  email,
+			buildStubs: func(repo *mocks.MockRateLimitRepository) {
+				repo.EXPECT().Increment(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:   "RepositoryError",
+			action: model.ActionTokenRefresh,
+			buildStubs: func(repo *mocks.MockRateLimitRepository) {
+				repo.EXPECT().Increment(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(int64(0), time.Duration(0), errors.New("connection refused"))
+			},
+			checkResponse: func(t *testing.T, err error) {
+				// an outage of redis doesn't lock everyone out
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockRateLimitRepository(ctrl)
+			tc.buildStubs(repo)
+
+			service := NewRateLimitService(&RateLimitServiceConfig{
+				RateLimitRepository: repo,
+				Policies: map[string]model.RateLimitPolicy{
+					model.ActionSignin:       policy,
+					model.ActionTokenRefresh: policy,
+				},
+			})
+
+			err := service.Allow(context.Background(), tc.action, ip, tc.email)
+			tc.checkResponse(t, err)
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/library"
+	"github.com/maxeth/go-account-api/model"
+)
+
+const (
+	recoveryCodeCount  = 10 // codes per set
+	recoveryCodeLength = 10 // characters per code, shown in two groups of five
+	// crockford base32, which leaves out the letters that are easily mistaken for digits
+	recoveryCodeAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+)
+
+// newRecoveryCodes replaces the recovery codes of the user with a new set and returns the codes, which can't be retrieved again.
+// Codes carry 50 random bits each, so that a salted sha256 is enough to store them, unlike passwords
+func newRecoveryCodes(ctx context.Context, r model.RecoveryCodeRepository, uid uuid.UUID) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		code, err := library.SecureCode(recoveryCodeLength, recoveryCodeAlphabet)
+		if err != nil {
+			log.Printf("Failed to generate recovery code for uid: %v. Error: %v\n", uid, err)
+			return nil, model.NewInternal()
+		}
+
+		codes[i] = code[:recoveryCodeLength/2] + "-" + code[recoveryCodeLength/2:]
+		hashes[i] = hashRecoveryCode(uid, code)
+	}
+
+	if err := r.Replace(ctx, uid, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// ensureRecoveryCodes returns a new set of recovery codes when 2FA is enrolled and the user has no unused codes left.
+// Returns nil if the codes the user received earlier can still be used
+func ensureRecoveryCodes(ctx context.Context, r model.RecoveryCodeRepository, uid uuid.UUID) ([]string, error) {
+	n, err := r.CountUnused(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		return nil, nil
+	}
+
+	return newRecoveryCodes(ctx, r, uid)
+}
+
+// hashRecoveryCode hashes the normalized code along with the uid, so that equal codes of different users don't share a hash
+func hashRecoveryCode(uid uuid.UUID, code string) string {
+	sum := sha256.Sum256(append(uid[:], normalizeRecoveryCode(code)...))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeRecoveryCode drops the separators and case of a code as typed by the user and maps
+// the letters left out of the alphabet to the digits they are mistaken for
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', ' ':
+			return -1
+		case 'o':
+			return '0'
+		case 'i', 'l':
+			return '1'
+		}
+		return r
+	}, strings.ToLower(code))
+}
+
+// VerifyRecoveryCode completes the challenge with one of the recovery codes of the user and returns the signed in user.
+// The code can't be used again. A wrong code counts as a failed attempt, the challenge can be retried until MaxAttempts is reached
+func (s *mfaService) VerifyRecoveryCode(ctx context.Context, challengeToken string, code string) (*model.User, error) {
+	ch, err := s.consumeChallenge(ctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	used, err := s.RecoveryCodeRepository.Use(ctx, ch.UID, hashRecoveryCode(ch.UID, code))
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		recordAudit(ctx, s.AuditService, model.AuditSigninFailed, &ch.UID, model.AuditDetails{"method": model.MFAMethodRecovery, "reason": "invalid_code"})
+		s.retryChallenge(ctx, challengeToken, ch)
+		return nil, model.NewAuthorization("Invalid recovery code.")
+	}
+
+	user, err := s.challengedUser(ctx, ch)
+	if err != nil {
+		return nil, err
+	}
+
+	recordAudit(ctx, s.AuditService, model.AuditRecoveryCodeUsed, &user.UID, nil)
+	s.sendRecoveryCodeNotice(ctx, user)
+
+	return user, nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of a user with 2FA enabled, invalidating the previous set
+func (s *mfaService) RegenerateRecoveryCodes(ctx context.Context, uid uuid.UUID) ([]string, error) {
+	enabled, err := s.enabledMethods(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if len(enabled) == 0 {
+		return nil, model.NewBadRequest("2FA is not enabled.")
+	}
+
+	codes, err := newRecoveryCodes(ctx, s.RecoveryCodeRepository, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	recordAudit(ctx, s.AuditService, model.AuditRecoveryCodesRegenerated, &uid, nil)
+
+	return codes, nil
+}
+
+// sendRecoveryCodeNotice tells the user that a recovery code has been used, along with how many are left.
+// Failures are only logged, the sign in has already been completed
+func (s *mfaService) sendRecoveryCodeNotice(ctx context.Context, u *model.User) {
+	if s.Mailer == nil {
+		return
+	}
+
+	remaining, err := s.RecoveryCodeRepository.CountUnused(ctx, u.UID)
+	if err != nil {
+		log.Printf("Failed to count recovery codes of uid: %v. Error: %v\n", u.UID, err)
+		return
+	}
+
+	body := fmt.Sprintf("A recovery code has just been used to sign in to your account. %d of your recovery codes are left. If this wasn't you, change your password and generate new recovery codes right away.", remaining)
+	if err := s.Mailer.Send(ctx, u.Email, "A recovery code has been used", body); err != nil {
+		log.Printf("Failed to send recovery code notice to uid: %v. Error: %v\n", u.UID, err)
+	}
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRecoveryCodes(t *testing.T) {
+	uid := uuid.New()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	codeRepo := mocks.NewMockRecoveryCodeRepository(ctrl)
+
+	var stored []string
+	codeRepo.EXPECT().Replace(gomock.Any(), uid, gomock.Any()).Times(1).
+		DoAndReturn(func(ctx context.Context, uid uuid.UUID, hashes []string) error {
+			stored = hashes
+			return nil
+		})
+
+	codes, err := newRecoveryCodes(context.Background(), codeRepo, uid)
+	require.NoError(t, err)
+	require.Len(t, codes, recoveryCodeCount)
+
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		require.Regexp(t, "^[0-9a-hjkmnp-tv-z]{5}-[0-9a-hjkmnp-tv-z]{5}$", code)
+		require.False(t, seen[code])
+		seen[code] = true
+
+		// only the hashes are stored
+		require.NotContains(t, stored, code)
+		require.Equal(t, hashRecoveryCode(uid, code), stored[i])
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	uid := uuid.New()
+	hash := hashRecoveryCode(uid, "0a1b2-c3d4e")
+
+	// codes are accepted however they are typed
+	require.Equal(t, hash, hashRecoveryCode(uid, "0A1B2C3D4E"))
+	require.Equal(t, hash, hashRecoveryCode(uid, "0a1b2 c3d4e"))
+	require.Equal(t, hash, hashRecoveryCode(uid, "oaIb2-c3d4e"))
+
+	require.NotEqual(t, hash, hashRecoveryCode(uid, "0a1b2-c3d4f"))
+	require.NotEqual(t, hash, hashRecoveryCode(uuid.New(), "0a1b2-c3d4e"))
+}
+
+func TestVerifyRecoveryCode(t *testing.T) {
+	user := randomUser(t)
+	user.Status = model.StatusActive
+	suspended := *user
+	suspended.Status = model.StatusSuspended
+
+	const code = "0a1b2-c3d4e"
+
+	challenge := func(t *testing.T) string {
+		b, err := json.Marshal(&mfaChallenge{UID: user.UID, ExpiresAt: time.Now().Add(time.Minute)})
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	testCases := []struct {
+		name          string
+		buildStubs    func(t *testing.T, m *mfaTestMocks)
+		checkResponse func(t *testing.T, u *model.User, err error)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(t *testing.T, m *mfaTestMocks) {
+				m.atr.EXPECT().ConsumeActionToken(gomock.Any(), MFAChallengeAction, "challenge").Times(1).Return(challenge(t), nil)
+				m.codeRepo.EXPECT().Use(gomock.Any(), user.UID, hashRecoveryCode(user.UID, code)).Times(1).Return(true, nil)
+				m.userRepo.EXPECT().FindByID(gomock.Any(), user.UID).Times(1).Return(user, nil)
+				m.audit.EXPECT().Record(gomock.Any(), &model.AuditEvent{Type: model.AuditRecoveryCodeUsed, SubjectUID: &user.UID}).Times(1)
+				m.codeRepo.EXPECT().CountUnused(gomock.Any(), user.UID).Times(1).Return(9, nil)
+				m.mailer.EXPECT().Send(gomock.Any(), user.Email, gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(ctx context.Context, to, subject, body string) error {
+						require.True(t, strings.Contains(body, "9 of your recovery codes are left"))
+						return nil
+					})
+			},
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.NoError(t, err)
+				require.Equal(t, user, u)
+			},
+		},
+		{
+			name: "WrongCode",
+			buildStubs: func(t *testing.T, m *mfaTestMocks) {
+				m.atr.EXPECT().ConsumeActionToken(gomock.Any(), MFAChallengeAction, "challenge").Times(1).Return(challenge(t), nil)
+				m.codeRepo.EXPECT().Use(gomock.Any(), user.UID, gomock.Any()).Times(1).Return(false, nil)
+				// the challenge can be retried
+				m.atr.EXPECT().SetActionToken(gomock.Any(), MFAChallengeAction, "challenge", gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(ctx context.Context, action, token, value string, exp time.Duration) error {
+						var ch mfaChallenge
+						require.NoError(t, json.Unmarshal([]byte(value), &ch))
+						require.Equal(t, 1, ch.Attempts)
+						return nil
+					})
+				m.mailer.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				m.audit.EXPECT().Record(gomock.Any(), &model.AuditEvent{
+					Type:       model.AuditSigninFailed,
+					SubjectUID: &user.UID,
+					Details:    model.AuditDetails{"method": model.MFAMethodRecovery, "reason": "invalid_code"},
+				}).Times(1)
+			},
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+				require.Nil(t, u)
+			},
+		},
+		{
+			name: "SuspendedUser",
+			buildStubs: func(t *testing.T, m *mfaTestMocks) {
+				m.atr.EXPECT().ConsumeActionToken(gomock.Any(), MFAChallengeAction, "challenge").Times(1).Return(challenge(t), nil)
+				m.codeRepo.EXPECT().Use(gomock.Any(), user.UID, gomock.Any()).Times(1).Return(true, nil)
+				m.userRepo.EXPECT().FindByID(gomock.Any(), user.UID).Times(1).Return(&suspended, nil)
+				m.mailer.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.Equal(t, http.StatusForbidden, model.Status(err))
+			},
+		},
+		{
+			name: "ExpiredChallenge",
+			buildStubs: func(t *testing.T, m *mfaTestMocks) {
+				m.atr.EXPECT().ConsumeActionToken(gomock.Any(), MFAChallengeAction, "challenge").Times(1).Return("", model.NewNotFound("token", "challenge"))
+				m.codeRepo.EXPECT().Use(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			s, m := newTestMFAService(ctrl)
+			tc.buildStubs(t, m)
+
+			u, err := s.VerifyRecoveryCode(context.Background(), "challenge", code)
+			tc.checkResponse(t, u, err)
+		})
+	}
+}
+
+func TestRegenerateRecoveryCodes(t *testing.T) {
+	user := randomUser(t)
+
+	t.Run("OK", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		s, m := newTestMFAService(ctrl)
+
+		m.totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(nil, model.NewNotFound("uid", user.UID.String()))
+		m.credRepo.EXPECT().FindByUID(gomock.Any(), user.UID).Times(1).Return([]*model.WebAuthnCredential{{UID: user.UID}}, nil)
+		m.codeRepo.EXPECT().Replace(gomock.Any(), user.UID, gomock.Len(recoveryCodeCount)).Times(1).Return(nil)
+		m.audit.EXPECT().Record(gomock.Any(), &model.AuditEvent{Type: model.AuditRecoveryCodesRegenerated, SubjectUID: &user.UID}).Times(1)
+
+		codes, err := s.RegenerateRecoveryCodes(context.Background(), user.UID)
+		require.NoError(t, err)
+		require.Len(t, codes, recoveryCodeCount)
+	})
+
+	t.Run("NotEnabled", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		s, m := newTestMFAService(ctrl)
+
+		m.totpRepo.EXPECT().Find(gomock.Any(), user.UID).Times(1).Return(nil, model.NewNotFound("uid", user.UID.String()))
+		m.credRepo.EXPECT().FindByUID(gomock.Any(), user.UID).Times(1).Return([]*model.WebAuthnCredential{}, nil)
+		m.codeRepo.EXPECT().Replace(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+		_, err := s.RegenerateRecoveryCodes(context.Background(), user.UID)
+		require.Equal(t, http.StatusBadRequest, model.Status(err))
+	})
+}
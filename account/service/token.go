@@ -2,6 +2,7 @@ package service
 
 import (
 	"crypto/rsa"
+	"fmt"
 	"log"
 	"time"
 
@@ -37,6 +38,28 @@ func generateAccessToken(u *model.User, key *rsa.PrivateKey, exp int64) (string,
 	return ss, nil
 }
 
+// validateAccessToken parses the signed token string and returns its claims if the token
+// is signed with the private key matching the passed public key and has not expired yet
+func validateAccessToken(tokenString string, key *rsa.PublicKey) (*AccessTokenClaims, error) {
+	claims := &AccessTokenClaims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid || claims.User == nil {
+		return nil, fmt.Errorf("access token is invalid")
+	}
+
+	return claims, nil
+}
+
 // the refresh token holds the jwt signed string token
 type RefreshToken struct {
 	SignedRefreshToken string        // signed refresh token string that is beign  returned to the user
@@ -85,3 +108,25 @@ func generateRefreshToken(uid uuid.UUID, key string, exp int64) (*RefreshToken,
 
 	return rt, nil
 }
+
+// validateRefreshToken parses the signed token string and returns its claims
+// if the token has been signed with the refresh secret and has not expired yet
+func validateRefreshToken(tokenString string, key string) (*RefreshTokenClaims, error) {
+	claims := &RefreshTokenClaims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(key), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, fmt.Errorf("refresh token is invalid")
+	}
+
+	return claims, nil
+}
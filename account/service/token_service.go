@@ -5,6 +5,7 @@ import (
 	"crypto/rsa"
 	"log"
 
+	"github.com/google/uuid"
 	"github.com/maxeth/go-account-api/model"
 )
 
@@ -13,6 +14,8 @@ import (
 // signing JWTs
 type tokenService struct {
 	TokenRepository     model.TokenRepository
+	UserEventRepository model.UserEventRepository
+	AuditService        model.AuditService
 	PrivKey             *rsa.PrivateKey
 	PubKey              *rsa.PublicKey
 	RefreshSecret       string
@@ -24,6 +27,8 @@ type tokenService struct {
 // this service layer
 type TokenServiceConfig struct {
 	TokenRepository     model.TokenRepository
+	UserEventRepository model.UserEventRepository
+	AuditService        model.AuditService
 	PrivKey             *rsa.PrivateKey
 	PubKey              *rsa.PublicKey
 	RefreshSecret       string
@@ -36,6 +41,8 @@ type TokenServiceConfig struct {
 func NewTokenService(c *TokenServiceConfig) model.TokenService {
 	return &tokenService{
 		TokenRepository:     c.TokenRepository,
+		UserEventRepository: c.UserEventRepository,
+		AuditService:        c.AuditService,
 		PrivKey:             c.PrivKey,
 		PubKey:              c.PubKey,
 		RefreshSecret:       c.RefreshSecret,
@@ -61,21 +68,27 @@ func (s *tokenService) NewPairFromUser(ctx context.Context, u *model.User, prevT
 		return nil, model.NewInternal()
 	}
 
-	// save the refresh token associated to this user id in redis.
-	if err := s.TokenRepository.SetRefreshToken(ctx, u.UID.String(), refreshToken.ID, refreshToken.ExpiresIn); err != nil {
-		log.Printf("error saving refresh token in redis: %v\n", err.Error())
-		return nil, model.NewInternal()
-	}
-
-	// delete the users previous refresh token from redis if an prevTokenID was provided
+	// delete the users previous refresh token from redis if an prevTokenID was provided.
+	// this fails if the previous token has been used already, so that a refresh token can only be used once
 	if len(prevTokenID) > 0 {
 		if err := s.TokenRepository.DeleteRefreshToken(ctx, u.UID.String(), prevTokenID); err != nil {
 			log.Printf("error deleting user's previous refresh token in redis: %v\n", err.Error())
+			if errM, ok := err.(*model.Error); ok {
+				// a valid refresh token which isn't stored anymore has been used or revoked before
+				recordAudit(ctx, s.AuditService, model.AuditTokenReused, &u.UID, model.AuditDetails{"tokenId": prevTokenID})
+				return nil, errM
+			}
 			return nil, model.NewInternal()
 		}
+
+		recordAudit(ctx, s.AuditService, model.AuditTokenRefreshed, &u.UID, model.AuditDetails{"tokenId": prevTokenID})
 	}
 
-	// TODO: store refresh tokens by calling TokenRepository methods
+	// save the refresh token associated to this user id in redis.
+	if err := s.TokenRepository.SetRefreshToken(ctx, u.UID.String(), refreshToken.ID, refreshToken.ExpiresIn); err != nil {
+		log.Printf("error saving refresh token in redis: %v\n", err.Error())
+		return nil, model.NewInternal()
+	}
 
 	tp := &model.TokenPair{
 		AccessToken:  accessToken,
@@ -83,3 +96,41 @@ func (s *tokenService) NewPairFromUser(ctx context.Context, u *model.User, prevT
 	}
 	return tp, nil
 }
+
+// ValidateAccessToken validates the access token string and
+// returns the user it has been issued for
+func (s *tokenService) ValidateAccessToken(tokenString string) (*model.User, error) {
+	claims, err := validateAccessToken(tokenString, s.PubKey)
+	if err != nil {
+		log.Printf("Unable to validate or parse access token: %v\n", err)
+		return nil, model.NewAuthorization("Unable to verify user from access token")
+	}
+
+	return claims.User, nil
+}
+
+// Signout revokes all refresh tokens of the user and notifies the connected clients of the user
+func (s *tokenService) Signout(ctx context.Context, uid uuid.UUID) error {
+	if err := s.TokenRepository.DeleteUserRefreshTokens(ctx, uid.String()); err != nil {
+		log.Printf("Failed to delete refresh tokens of uid: %v. Error: %v\n", uid, err)
+		return model.NewInternal()
+	}
+
+	publishUserEvent(ctx, s.UserEventRepository, model.EventSessionRevoked, uid)
+
+	return nil
+}
+
+// ValidateRefreshToken validates the refresh token string and returns its id and the user it has been issued for
+func (s *tokenService) ValidateRefreshToken(tokenString string) (*model.RefreshToken, error) {
+	claims, err := validateRefreshToken(tokenString, s.RefreshSecret)
+	if err != nil {
+		log.Printf("Unable to validate or parse refresh token: %v\n", err)
+		return nil, model.NewAuthorization("Unable to verify user from refresh token")
+	}
+
+	return &model.RefreshToken{
+		ID:  claims.Id,
+		UID: claims.UID,
+	}, nil
+}
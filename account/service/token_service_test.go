@@ -7,7 +7,9 @@ import (
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/golang/mock/gomock"
 	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model/mocks"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -29,7 +31,14 @@ func TestNewPairFromUser(t *testing.T) {
 	atExpiry := issuedAt.Add(15 * time.Minute)    // expected access token expiry
 	rtExpiry := issuedAt.Add(30 * time.Hour * 24) // expected refresh token expiry
 
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tokenRepository := mocks.NewMockTokenRepository(ctrl)
+	tokenRepository.EXPECT().SetRefreshToken(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil)
+
 	tsc := &TokenServiceConfig{
+		TokenRepository:     tokenRepository,
 		PrivKey:             privKey,
 		PubKey:              pubKey,
 		RefreshSecret:       secret,
@@ -82,3 +91,47 @@ func TestNewPairFromUser(t *testing.T) {
 	require.WithinDuration(t, time.Unix(rtClaims.ExpiresAt, 0), rtExpiry, time.Second)
 	require.WithinDuration(t, time.Unix(rtClaims.IssuedAt, 0), issuedAt, time.Second)
 }
+
+func TestValidateAccessToken(t *testing.T) {
+	privFile, err := ioutil.ReadFile("../rsa_private_test.pem")
+	require.NoError(t, err)
+	privKey, err := jwt.ParseRSAPrivateKeyFromPEM(privFile)
+	require.NoError(t, err)
+
+	pubFile, err := ioutil.ReadFile("../rsa_public_test.pem")
+	require.NoError(t, err)
+	pubKey, err := jwt.ParseRSAPublicKeyFromPEM(pubFile)
+	require.NoError(t, err)
+
+	tokenService := NewTokenService(&TokenServiceConfig{
+		PrivKey: privKey,
+		PubKey:  pubKey,
+	})
+
+	user := randomUser(t)
+
+	t.Run("OK", func(t *testing.T) {
+		ss, err := generateAccessToken(user, privKey, 60)
+		require.NoError(t, err)
+
+		gotUser, err := tokenService.ValidateAccessToken(ss)
+		require.NoError(t, err)
+		require.Equal(t, user.UID, gotUser.UID)
+		require.Equal(t, user.Email, gotUser.Email)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		ss, err := generateAccessToken(user, privKey, -60)
+		require.NoError(t, err)
+
+		gotUser, err := tokenService.ValidateAccessToken(ss)
+		require.Error(t, err)
+		require.Nil(t, gotUser)
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		gotUser, err := tokenService.ValidateAccessToken("not-a-jwt")
+		require.Error(t, err)
+		require.Nil(t, gotUser)
+	})
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+)
+
+type profileExporter struct {
+	UserRepository model.UserRepository
+}
+
+// NewProfileExporter exports the users profile as stored in the users table
+func NewProfileExporter(r model.UserRepository) model.UserDataExporter {
+	return &profileExporter{
+		UserRepository: r,
+	}
+}
+
+func (e *profileExporter) ExportName() string {
+	return "profile"
+}
+
+func (e *profileExporter) ExportUserData(ctx context.Context, uid uuid.UUID) (interface{}, error) {
+	return e.UserRepository.FindByID(ctx, uid)
+}
+
+type sessionExporter struct {
+	TokenRepository model.TokenRepository
+}
+
+// NewSessionExporter exports the sessions, i.e. the refresh tokens, the user is currently signed in with
+func NewSessionExporter(r model.TokenRepository) model.UserDataExporter {
+	return &sessionExporter{
+		TokenRepository: r,
+	}
+}
+
+func (e *sessionExporter) ExportName() string {
+	return "sessions"
+}
+
+func (e *sessionExporter) ExportUserData(ctx context.Context, uid uuid.UUID) (interface{}, error) {
+	return e.TokenRepository.GetUserRefreshTokens(ctx, uid.String())
+}
+
+type webAuthnCredentialExporter struct {
+	WebAuthnCredentialRepository model.WebAuthnCredentialRepository
+}
+
+// NewWebAuthnCredentialExporter exports the passkeys and security keys the user registered
+func NewWebAuthnCredentialExporter(r model.WebAuthnCredentialRepository) model.UserDataExporter {
+	return &webAuthnCredentialExporter{
+		WebAuthnCredentialRepository: r,
+	}
+}
+
+func (e *webAuthnCredentialExporter) ExportName() string {
+	return "passkeys"
+}
+
+func (e *webAuthnCredentialExporter) ExportUserData(ctx context.Context, uid uuid.UUID) (interface{}, error) {
+	return e.WebAuthnCredentialRepository.FindByUID(ctx, uid)
+}
+
+type totpExporter struct {
+	TOTPRepository model.TOTPRepository
+}
+
+// totpExport describes the authenticator app enrollment of a user. The secrets are left out, they would
+// allow anyone getting hold of the archive to generate codes
+type totpExport struct {
+	Enabled           bool       `json:"enabled"`
+	EnabledAt         *time.Time `json:"enabledAt"`
+	EnrollmentPending bool       `json:"enrollmentPending"`
+	FailedAttempts    int        `json:"failedAttempts"`
+	LockedUntil       *time.Time `json:"lockedUntil"`
+}
+
+// NewTOTPExporter exports whether the user enrolled an authenticator app for 2FA
+func NewTOTPExporter(r model.TOTPRepository) model.UserDataExporter {
+	return &totpExporter{
+		TOTPRepository: r,
+	}
+}
+
+func (e *totpExporter) ExportName() string {
+	return "totp"
+}
+
+func (e *totpExporter) ExportUserData(ctx context.Context, uid uuid.UUID) (interface{}, error) {
+	t, err := e.TOTPRepository.Find(ctx, uid)
+	if err != nil {
+		if model.Status(err) == http.StatusNotFound {
+			return &totpExport{}, nil
+		}
+		return nil, err
+	}
+
+	return &totpExport{
+		Enabled:           t.Enabled(),
+		EnabledAt:         t.EnabledAt,
+		EnrollmentPending: t.PendingSecret != "",
+		FailedAttempts:    t.FailedAttempts,
+		LockedUntil:       t.LockedUntil,
+	}, nil
+}
+
+type recoveryCodeExporter struct {
+	RecoveryCodeRepository model.RecoveryCodeRepository
+}
+
+// NewRecoveryCodeExporter exports when the recovery codes of the user were generated and used. The codes themselves
+// can't be exported, only their hashes are stored
+func NewRecoveryCodeExporter(r model.RecoveryCodeRepository) model.UserDataExporter {
+	return &recoveryCodeExporter{
+		RecoveryCodeRepository: r,
+	}
+}
+
+func (e *recoveryCodeExporter) ExportName() string {
+	return "recoveryCodes"
+}
+
+func (e *recoveryCodeExporter) ExportUserData(ctx context.Context, uid uuid.UUID) (interface{}, error) {
+	return e.RecoveryCodeRepository.FindByUID(ctx, uid)
+}
+
+type knownDeviceExporter struct {
+	KnownDeviceRepository model.KnownDeviceRepository
+}
+
+// NewKnownDeviceExporter exports the devices the user has signed in from
+func NewKnownDeviceExporter(r model.KnownDeviceRepository) model.UserDataExporter {
+	return &knownDeviceExporter{
+		KnownDeviceRepository: r,
+	}
+}
+
+func (e *knownDeviceExporter) ExportName() string {
+	return "devices"
+}
+
+func (e *knownDeviceExporter) ExportUserData(ctx context.Context, uid uuid.UUID) (interface{}, error) {
+	return e.KnownDeviceRepository.FindByUID(ctx, uid)
+}
+
+type auditEventExporter struct {
+	AuditEventRepository model.AuditEventRepository
+}
+
+// auditEventExport is an audit event about the user. Where it came from is only included if the user triggered it,
+// not if it was an admin or someone trying to sign in to the account
+type auditEventExport struct {
+	Type      string             `json:"type"`
+	IP        string             `json:"ip,omitempty"`
+	UserAgent string             `json:"userAgent,omitempty"`
+	Details   model.AuditDetails `json:"details"`
+	CreatedAt time.Time          `json:"createdAt"`
+}
+
+// NewAuditEventExporter exports the audit events the user has been the subject of, newest first
+func NewAuditEventExporter(r model.AuditEventRepository) model.UserDataExporter {
+	return &auditEventExporter{
+		AuditEventRepository: r,
+	}
+}
+
+func (e *auditEventExporter) ExportName() string {
+	return "activity"
+}
+
+func (e *auditEventExporter) ExportUserData(ctx context.Context, uid uuid.UUID) (interface{}, error) {
+	events := []*auditEventExport{}
+
+	filter := model.AuditEventFilter{SubjectUID: &uid, Limit: MaxAuditPageSize}
+	for {
+		page, err := e.AuditEventRepository.List(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ev := range page.Events {
+			export := &auditEventExport{
+				Type:      ev.Type,
+				Details:   ev.Details,
+				CreatedAt: ev.CreatedAt,
+			}
+			if ev.ActorUID != nil && *ev.ActorUID == uid {
+				export.IP = ev.IP
+				export.UserAgent = ev.UserAgent
+			}
+			events = append(events, export)
+		}
+
+		if page.NextCursor == "" {
+			return events, nil
+		}
+		filter.Before = page.Events[len(page.Events)-1].ID
+	}
+}
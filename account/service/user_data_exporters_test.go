@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditEventExporter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uid := uuid.New()
+	adminUID := uuid.New()
+	now := time.Now()
+
+	repo := mocks.NewMockAuditEventRepository(ctrl)
+	e := NewAuditEventExporter(repo)
+
+	// all pages are exported
+	gomock.InOrder(
+		repo.EXPECT().List(gomock.Any(), model.AuditEventFilter{SubjectUID: &uid, Limit: MaxAuditPageSize}).Times(1).Return(&model.AuditEventPage{
+			Events: []*model.AuditEvent{
+				{ID: 3, Type: model.AuditPasswordChanged, ActorUID: &uid, SubjectUID: &uid, IP: "10.0.0.1", UserAgent: "curl", CreatedAt: now},
+				{ID: 2, Type: model.AuditRoleChanged, ActorUID: &adminUID, SubjectUID: &uid, IP: "10.0.0.2", Details: model.AuditDetails{"to": "admin"}, CreatedAt: now},
+			},
+			NextCursor: "2",
+		}, nil),
+		repo.EXPECT().List(gomock.Any(), model.AuditEventFilter{SubjectUID: &uid, Before: 2, Limit: MaxAuditPageSize}).Times(1).Return(&model.AuditEventPage{
+			Events: []*model.AuditEvent{
+				{ID: 1, Type: model.AuditSigninFailed, SubjectUID: &uid, IP: "10.0.0.3", CreatedAt: now},
+			},
+		}, nil),
+	)
+
+	data, err := e.ExportUserData(context.Background(), uid)
+	require.NoError(t, err)
+
+	// where events came from is only exported for those the user triggered
+	require.Equal(t, []*auditEventExport{
+		{Type: model.AuditPasswordChanged, IP: "10.0.0.1", UserAgent: "curl", CreatedAt: now},
+		{Type: model.AuditRoleChanged, Details: model.AuditDetails{"to": "admin"}, CreatedAt: now},
+		{Type: model.AuditSigninFailed, CreatedAt: now},
+	}, data)
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+)
+
+// action name of the token sent out to cancel an account deletion
+const AccountRestoreAction = "accountrestore"
+
+// DeleteAccount soft deletes the account after re-authenticating the user with the password. Users without a password
+// have to set one with a password reset first. The account can be restored with the link sent to the users email until the grace period has passed
+func (us *userService) DeleteAccount(ctx context.Context, uid uuid.UUID, password string) error {
+	u, err := us.UserRepository.FindByID(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	if err := us.reauthenticate(u, password); err != nil {
+		return err
+	}
+
+	if err := us.UserRepository.SoftDelete(ctx, uid); err != nil {
+		return err
+	}
+
+	gracePeriod := time.Duration(us.DeletionGracePeriodSecs) * time.Second
+
+	token, err := us.newActionToken(ctx, AccountRestoreAction, uid.String(), gracePeriod)
+	if err != nil {
+		// the account is deleted either way, the user only loses the option to restore it
+		log.Printf("Failed to create restore token for uid: %v. Error: %v\n", uid, err)
+		return nil
+	}
+
+	body := fmt.Sprintf("Your account has been deleted and will be removed permanently on %s. If you changed your mind, restore your account by opening the following link:\n\n%s/account/restore?token=%s", time.Now().Add(gracePeriod).Format("January 2, 2006"), us.AppURL, token)
+	if err := us.Mailer.Send(ctx, u.Email, "Your account has been deleted", body); err != nil {
+		log.Printf("Failed to send account deletion notice to uid: %v. Error: %v\n", uid, err)
+	}
+
+	return nil
+}
+
+// RestoreAccount cancels the deletion of the account the token has been issued for
+func (us *userService) RestoreAccount(ctx context.Context, token string) (*model.User, error) {
+	value, err := us.consumeActionToken(ctx, AccountRestoreAction, token)
+	if err != nil {
+		return nil, err
+	}
+
+	uid, err := uuid.Parse(value)
+	if err != nil {
+		return nil, model.NewInternal()
+	}
+
+	return us.UserRepository.Restore(ctx, uid)
+}
+
+// PurgeDeletedAccounts permanently deletes all accounts whose grace period has passed,
+// which frees their emails for new signups. Returns the number of purged accounts.
+// Profile images aren't stored by the service yet, image_url only links to them, and neither are linked oauth identities,
+// so deleting the users row is all there is to purge. Both need to be removed here once they are stored
+func (us *userService) PurgeDeletedAccounts(ctx context.Context) (int, error) {
+	deletedBefore := time.Now().Add(-time.Duration(us.DeletionGracePeriodSecs) * time.Second)
+
+	uids, err := us.UserRepository.PurgeDeleted(ctx, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, uid := range uids {
+		log.Printf("Purged deleted account uid: %v\n", uid)
+	}
+
+	return len(uids), nil
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteAccount(t *testing.T) {
+	user := randomUser(t)
+	pw := user.Password
+
+	hashedPw, err := HashPassword(pw)
+	require.NoError(t, err)
+	storedUser := &model.User{UID: user.UID, Email: user.Email, Password: hashedPw}
+
+	testCases := []struct {
+		name       string
+		password   string
+		buildStubs func(repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository, mailer *mocks.MockMailer)
+		checkError func(t *testing.T, err error)
+	}{
+		{
+			name:     "OK",
+			password: pw,
+			buildStubs: func(repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository, mailer *mocks.MockMailer) {
+				repo.EXPECT().FindByID(gomock.Any(), user.UID).Times(1).Return(storedUser, nil)
+				repo.EXPECT().SoftDelete(gomock.Any(), user.UID).Times(1).Return(nil)
+				atr.EXPECT().SetActionToken(gomock.Any(), AccountRestoreAction, gomock.Any(), user.UID.String(), time.Hour).Times(1).Return(nil)
+				mailer.EXPECT().Send(gomock.Any(), user.Email, gomock.Any(), gomock.Any()).Times(1).Return(nil)
+			},
+			checkError: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:     "WrongPassword",
+			password: "wrong password",
+			buildStubs: func(repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository, mailer *mocks.MockMailer) {
+				repo.EXPECT().FindByID(gomock.Any(), user.UID).Times(1).Return(storedUser, nil)
+				repo.EXPECT().SoftDelete(gomock.Any(), gomock.Any()).Times(0)
+				mailer.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkError: func(t *testing.T, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			// accounts created with a sign in link have to set a password with a password reset first
+			name:     "NoPassword",
+			password: "",
+			buildStubs: func(repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository, mailer *mocks.MockMailer) {
+				repo.EXPECT().FindByID(gomock.Any(), user.UID).Times(1).Return(&model.User{UID: user.UID, Email: user.Email}, nil)
+				repo.EXPECT().SoftDelete(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkError: func(t *testing.T, err error) {
+				require.Equal(t, http.StatusBadRequest, model.Status(err))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockUserRepository(ctrl)
+			atr := mocks.NewMockActionTokenRepository(ctrl)
+			mailer := mocks.NewMockMailer(ctrl)
+			tc.buildStubs(repo, atr, mailer)
+
+			service := NewUserService(&UserServiceConfig{
+				UserRepository:          repo,
+				ActionTokenRepository:   atr,
+				Mailer:                  mailer,
+				DeletionGracePeriodSecs: 60 * 60,
+			})
+
+			err := service.DeleteAccount(context.Background(), user.UID, tc.password)
+			tc.checkError(t, err)
+		})
+	}
+}
+
+func TestPurgeDeletedAccounts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockUserRepository(ctrl)
+	service := NewUserService(&UserServiceConfig{
+		UserRepository:          repo,
+		DeletionGracePeriodSecs: 60 * 60 * 24,
+	})
+
+	purged := []uuid.UUID{uuid.New(), uuid.New()}
+	repo.EXPECT().PurgeDeleted(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(func(ctx context.Context, deletedBefore time.Time) ([]uuid.UUID, error) {
+		// only accounts deleted before the grace period started may be purged
+		require.WithinDuration(t, time.Now().Add(-24*time.Hour), deletedBefore, time.Second)
+		return purged, nil
+	})
+
+	n, err := service.PurgeDeletedAccounts(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, len(purged), n)
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+)
+
+// UpdateDetails sets the name and website of the user. The email is changed with RequestEmailChange instead
+func (us *userService) UpdateDetails(ctx context.Context, uid uuid.UUID, name, website string) (*model.User, error) {
+	if website != "" {
+		if u, err := url.ParseRequestURI(website); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, model.NewValidation("website", "Website must be a valid URL.")
+		}
+	}
+
+	u, err := us.UserRepository.FindByID(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Name = name
+	u.Website = website
+
+	if err := us.UserRepository.Update(ctx, u); err != nil {
+		return nil, err
+	}
+
+	publishUserEvent(ctx, us.UserEventRepository, model.EventProfileUpdated, uid)
+
+	return u, nil
+}
+
+// ClearProfileImage removes the profile image of the user
+func (us *userService) ClearProfileImage(ctx context.Context, uid uuid.UUID) (*model.User, error) {
+	u, err := us.UserRepository.FindByID(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.ImageURL == "" {
+		return u, nil
+	}
+
+	u.ImageURL = ""
+
+	if err := us.UserRepository.Update(ctx, u); err != nil {
+		return nil, err
+	}
+
+	publishUserEvent(ctx, us.UserEventRepository, model.EventProfileUpdated, uid)
+
+	return u, nil
+}
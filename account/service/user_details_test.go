@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateDetails(t *testing.T) {
+	user := randomUser(t)
+
+	testCases := []struct {
+		name          string
+		website       string
+		buildStubs    func(repo *mocks.MockUserRepository, events *mocks.MockUserEventRepository)
+		checkResponse func(t *testing.T, u *model.User, err error)
+	}{
+		{
+			name:    "OK",
+			website: "https://example.com",
+			buildStubs: func(repo *mocks.MockUserRepository, events *mocks.MockUserEventRepository) {
+				repo.EXPECT().FindByID(gomock.Any(), user.UID).Times(1).Return(user, nil)
+				repo.EXPECT().Update(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(func(ctx context.Context, u *model.User) error {
+					require.Equal(t, "name", u.Name)
+					require.Equal(t, "https://example.com", u.Website)
+					return nil
+				})
+				// connected clients of the user are notified
+				events.EXPECT().Publish(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(func(ctx context.Context, e *model.UserEvent) error {
+					require.Equal(t, model.EventProfileUpdated, e.Type)
+					require.Equal(t, user.UID, e.UID)
+					return nil
+				})
+			},
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "name", u.Name)
+			},
+		},
+		{
+			name:    "InvalidWebsite",
+			website: "example",
+			buildStubs: func(repo *mocks.MockUserRepository, events *mocks.MockUserEventRepository) {
+				repo.EXPECT().FindByID(gomock.Any(), gomock.Any()).Times(0)
+				repo.EXPECT().Update(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.Equal(t, http.StatusBadRequest, model.Status(err))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockUserRepository(ctrl)
+			events := mocks.NewMockUserEventRepository(ctrl)
+			tc.buildStubs(repo, events)
+
+			service := NewUserService(&UserServiceConfig{
+				UserRepository:      repo,
+				UserEventRepository: events,
+			})
+
+			u, err := service.UpdateDetails(context.Background(), user.UID, "name", tc.website)
+			tc.checkResponse(t, u, err)
+		})
+	}
+}
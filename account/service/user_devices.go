@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+)
+
+// action name of the token sent out with new device notifications, which lets users reject a sign in that wasn't theirs
+const RejectSigninAction = "rejectsignin"
+
+// how long the device of a sign in can take to be checked in the background
+const deviceCheckTimeout = 10 * time.Second
+
+// prefix lengths of the networks devices are told apart by
+const (
+	deviceIPv4PrefixBits = 24
+	deviceIPv6PrefixBits = 48
+)
+
+// checkDevice remembers the device of a completed sign in, whichever way it has been made, and notifies the user if it is new.
+// It runs in the background, so that sign ins don't wait for the database or the mailer
+func (us *userService) checkDevice(ctx context.Context, u *model.User) {
+	if us.KnownDeviceRepository == nil {
+		return
+	}
+
+	info, ok := model.RequestInfoFromContext(ctx)
+	if !ok {
+		return
+	}
+	request := *info
+
+	go func() {
+		// the request context is cancelled once the response has been sent
+		ctx, cancel := context.WithTimeout(model.WithRequestInfo(context.Background(), &request), deviceCheckTimeout)
+		defer cancel()
+
+		us.notifyNewDevice(ctx, u, request.UserAgent, request.IP)
+	}()
+}
+
+// notifyNewDevice mails the user about a sign in from a device that hasn't been seen before, along with a link
+// to reject the sign in. Failures are only logged
+func (us *userService) notifyNewDevice(ctx context.Context, u *model.User, userAgent, ip string) {
+	d := &model.KnownDevice{
+		UID:             u.UID,
+		UserAgentFamily: userAgentFamily(userAgent),
+		IPPrefix:        ipPrefix(ip),
+	}
+
+	isNew, first, err := us.KnownDeviceRepository.Remember(ctx, d)
+	if err != nil {
+		log.Printf("Failed to remember device of uid: %v. Error: %v\n", u.UID, err)
+		return
+	}
+
+	// the first device is the one the account has been created or first used on since devices are remembered
+	if !isNew || first {
+		return
+	}
+
+	recordAudit(ctx, us.AuditService, model.AuditNewDevice, &u.UID, model.AuditDetails{
+		"userAgentFamily": d.UserAgentFamily,
+		"ipPrefix":        d.IPPrefix,
+	})
+
+	if us.Mailer == nil {
+		return
+	}
+
+	token, err := us.newActionToken(ctx, RejectSigninAction, u.UID.String(), time.Duration(us.EmailTokenExpSecs)*time.Second)
+	if err != nil {
+		log.Printf("Failed to create reject sign in token for uid: %v. Error: %v\n", u.UID, err)
+		return
+	}
+
+	body := fmt.Sprintf("Your account has been signed in to from a new device:\n\n%s, from %s\n\nIf this was you, ignore this email. If it wasn't, open the following link to sign out on all devices and choose a new password:\n\n%s/signin/reject?token=%s", d.UserAgentFamily, ip, us.AppURL, token)
+	if err := us.Mailer.Send(ctx, u.Email, "New sign in to your account", body); err != nil {
+		log.Printf("Failed to send new device notification to uid: %v. Error: %v\n", u.UID, err)
+	}
+}
+
+// RejectSignin is used through the link of a new device notification when the sign in wasn't the user's.
+// The password is reset, so that it has to be chosen anew. Signing the user out is up to the caller
+func (us *userService) RejectSignin(ctx context.Context, token string) (*model.User, error) {
+	value, err := us.consumeActionToken(ctx, RejectSigninAction, token)
+	if err != nil {
+		return nil, err
+	}
+
+	uid, err := uuid.Parse(value)
+	if err != nil {
+		return nil, model.NewInternal()
+	}
+
+	u, err := us.UserRepository.FindByID(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := us.replacePassword(ctx, u, "You reported a sign in to your account that wasn't yours, so your password has been reset and you have been signed out on all devices. You have to choose a new password to sign in again."); err != nil {
+		return nil, err
+	}
+
+	recordAudit(ctx, us.AuditService, model.AuditSigninRejected, &uid, nil)
+
+	return u, nil
+}
+
+// userAgentFamily reduces a user agent to its browser and operating system, like "Chrome on Windows"
+func userAgentFamily(userAgent string) string {
+	browser := "Unknown browser"
+	for _, b := range []struct{ token, name string }{
+		// checked in order, as most browsers claim to be some of the others as well
+		{"Edg/", "Edge"},
+		{"EdgiOS/", "Edge"},
+		{"OPR/", "Opera"},
+		{"SamsungBrowser/", "Samsung Internet"},
+		{"Firefox/", "Firefox"},
+		{"FxiOS/", "Firefox"},
+		{"CriOS/", "Chrome"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	system := "unknown OS"
+	for _, o := range []struct{ token, name string }{
+		{"Windows", "Windows"},
+		{"iPhone", "iOS"},
+		{"iPad", "iOS"},
+		{"Android", "Android"},
+		{"CrOS", "ChromeOS"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, o.token) {
+			system = o.name
+			break
+		}
+	}
+
+	return browser + " on " + system
+}
+
+// ipPrefix returns the network of the ip, a /24 for ipv4 and a /48 for ipv6. Unparsable ips are returned unchanged
+func ipPrefix(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(deviceIPv4PrefixBits, 32)), Mask: net.CIDRMask(deviceIPv4PrefixBits, 32)}).String()
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(deviceIPv6PrefixBits, 128)), Mask: net.CIDRMask(deviceIPv6PrefixBits, 128)}).String()
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceFingerprint(t *testing.T) {
+	userAgents := map[string]string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36":                         "Chrome on Windows",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0":           "Edge on Windows",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0":                                                                  "Firefox on Linux",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1": "Safari on iOS",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Safari/605.1.15":                   "Safari on macOS",
+		"Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.144 Mobile Safari/537.36":                       "Chrome on Android",
+		"curl/8.4.0": "Unknown browser on unknown OS",
+	}
+	for userAgent, family := range userAgents {
+		require.Equal(t, family, userAgentFamily(userAgent), userAgent)
+	}
+
+	ips := map[string]string{
+		"203.0.113.57":              "203.0.113.0/24",
+		"2001:db8:85a3:8d3::8a2e:7": "2001:db8:85a3::/48",
+		"::ffff:203.0.113.57":       "203.0.113.0/24",
+		"invalid":                   "invalid",
+	}
+	for ip, prefix := range ips {
+		require.Equal(t, prefix, ipPrefix(ip), ip)
+	}
+}
+
+func TestNotifyNewDevice(t *testing.T) {
+	user := randomUser(t)
+	userAgent := "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0"
+	device := &model.KnownDevice{UID: user.UID, UserAgentFamily: "Firefox on Linux", IPPrefix: "203.0.113.0/24"}
+
+	testCases := []struct {
+		name       string
+		buildStubs func(kdr *mocks.MockKnownDeviceRepository, atr *mocks.MockActionTokenRepository, mailer *mocks.MockMailer)
+	}{
+		{
+			name: "NewDevice",
+			buildStubs: func(kdr *mocks.MockKnownDeviceRepository, atr *mocks.MockActionTokenRepository, mailer *mocks.MockMailer) {
+				kdr.EXPECT().Remember(gomock.Any(), device).Times(1).Return(true, false, nil)
+				atr.EXPECT().SetActionToken(gomock.Any(), RejectSigninAction, gomock.Any(), user.UID.String(), time.Hour).Times(1).Return(nil)
+				mailer.EXPECT().Send(gomock.Any(), user.Email, gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(ctx context.Context, to, subject, body string) error {
+						require.True(t, strings.Contains(body, "Firefox on Linux, from 203.0.113.57"))
+						require.True(t, strings.Contains(body, "/signin/reject?token="))
+						return nil
+					})
+			},
+		},
+		{
+			name: "KnownDevice",
+			buildStubs: func(kdr *mocks.MockKnownDeviceRepository, atr *mocks.MockActionTokenRepository, mailer *mocks.MockMailer) {
+				kdr.EXPECT().Remember(gomock.Any(), device).Times(1).Return(false, false, nil)
+				mailer.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+		{
+			// users who had no device remembered yet aren't told about the one they are using
+			name: "FirstDevice",
+			buildStubs: func(kdr *mocks.MockKnownDeviceRepository, atr *mocks.MockActionTokenRepository, mailer *mocks.MockMailer) {
+				kdr.EXPECT().Remember(gomock.Any(), device).Times(1).Return(true, true, nil)
+				mailer.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			kdr := mocks.NewMockKnownDeviceRepository(ctrl)
+			atr := mocks.NewMockActionTokenRepository(ctrl)
+			mailer := mocks.NewMockMailer(ctrl)
+			tc.buildStubs(kdr, atr, mailer)
+
+			us := NewUserService(&UserServiceConfig{
+				KnownDeviceRepository: kdr,
+				ActionTokenRepository: atr,
+				Mailer:                mailer,
+				EmailTokenExpSecs:     3600,
+			}).(*userService)
+
+			us.notifyNewDevice(context.Background(), user, userAgent, "203.0.113.57")
+		})
+	}
+}
+
+func TestSigninCompletedChecksDeviceInBackground(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := randomUser(t)
+	kdr := mocks.NewMockKnownDeviceRepository(ctrl)
+
+	// the device is only checked once the sign in has returned
+	release := make(chan struct{})
+	checked := make(chan struct{})
+	kdr.EXPECT().Remember(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(func(ctx context.Context, d *model.KnownDevice) (bool, bool, error) {
+		<-release
+		defer close(checked)
+		require.NoError(t, ctx.Err())
+		require.Equal(t, "10.0.0.0/24", d.IPPrefix)
+		return false, false, nil
+	})
+
+	service := NewUserService(&UserServiceConfig{
+		KnownDeviceRepository: kdr,
+	})
+
+	// sign ins through a link, a passkey or a second factor are checked as well, not only those with a password
+	ctx, cancel := context.WithCancel(model.WithRequestInfo(context.Background(), &model.RequestInfo{IP: "10.0.0.1"}))
+	service.SigninCompleted(ctx, user, model.SigninMethodMagicLink)
+
+	// the check outlives the request
+	cancel()
+	close(release)
+	<-checked
+}
+
+func TestRejectSignin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := randomUser(t)
+
+	repo := mocks.NewMockUserRepository(ctrl)
+	atr := mocks.NewMockActionTokenRepository(ctrl)
+	mailer := mocks.NewMockMailer(ctrl)
+	as := mocks.NewMockAuditService(ctrl)
+
+	service := NewUserService(&UserServiceConfig{
+		UserRepository:        repo,
+		ActionTokenRepository: atr,
+		Mailer:                mailer,
+		AuditService:          as,
+		PasswordHasher:        NewPasswordHasher(&PasswordHasherConfig{Argon2: testArgon2Params}),
+	})
+
+	// the link can only be used once
+	atr.EXPECT().ConsumeActionToken(gomock.Any(), RejectSigninAction, "token").Times(1).Return(user.UID.String(), nil)
+	repo.EXPECT().FindByID(gomock.Any(), user.UID).Times(1).Return(user, nil)
+	repo.EXPECT().UpdatePassword(gomock.Any(), user.UID, gomock.Any()).Times(1).Return(nil)
+	atr.EXPECT().SetActionToken(gomock.Any(), PasswordResetAction, gomock.Any(), user.UID.String(), gomock.Any()).Times(1).Return(nil)
+	mailer.EXPECT().Send(gomock.Any(), user.Email, gomock.Any(), gomock.Any()).Times(1).Return(nil)
+	as.EXPECT().Record(gomock.Any(), &model.AuditEvent{Type: model.AuditSigninRejected, SubjectUID: &user.UID}).Times(1)
+
+	u, err := service.RejectSignin(context.Background(), "token")
+	require.NoError(t, err)
+	require.Equal(t, user.UID, u.UID)
+
+	atr.EXPECT().ConsumeActionToken(gomock.Any(), RejectSigninAction, "token").Times(1).Return("", model.NewNotFound("token", "token"))
+
+	_, err = service.RejectSignin(context.Background(), "token")
+	require.Equal(t, http.StatusUnauthorized, model.Status(err))
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+)
+
+// action names of the tokens sent out during an email change
+const (
+	EmailConfirmAction = "emailconfirm"
+	EmailCancelAction  = "emailcancel"
+)
+
+// emailChange is the value stored along with the confirm and cancel tokens of an email change.
+// Storing the requested email allows to detect links of an older, superseded request
+type emailChange struct {
+	UID   uuid.UUID `json:"uid"`
+	Email string    `json:"email"`
+}
+
+// RequestEmailChange stores newEmail as the users pending email and sends a confirmation link to it.
+// The current address receives a notice with a link to cancel the change.
+// The users email is only switched once the new address has been confirmed
+func (us *userService) RequestEmailChange(ctx context.Context, uid uuid.UUID, newEmail string) error {
+	u, err := us.UserRepository.FindByID(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(u.Email, newEmail) {
+		return model.NewValidation("email", "New email must differ from the current email.")
+	}
+
+	// fail early if the email is taken, the unique constraint is checked again once the change is confirmed
+	if _, err := us.UserRepository.FindByEmail(ctx, newEmail); err == nil {
+		return model.NewConflict("email", newEmail)
+	} else if model.Status(err) != http.StatusNotFound {
+		return err
+	}
+
+	u.PendingEmail = newEmail
+	if err := us.UserRepository.Update(ctx, u); err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(emailChange{UID: u.UID, Email: newEmail})
+	if err != nil {
+		return model.NewInternal()
+	}
+
+	exp := time.Duration(us.EmailTokenExpSecs) * time.Second
+
+	confirmToken, err := us.newActionToken(ctx, EmailConfirmAction, string(value), exp)
+	if err != nil {
+		return err
+	}
+
+	cancelToken, err := us.newActionToken(ctx, EmailCancelAction, string(value), exp)
+	if err != nil {
+		return err
+	}
+
+	confirmBody := fmt.Sprintf("Please confirm your new email address by opening the following link:\n\n%s/email/confirm?token=%s", us.AppURL, confirmToken)
+	if err := us.Mailer.Send(ctx, newEmail, "Confirm your new email address", confirmBody); err != nil {
+		return model.NewInternal()
+	}
+
+	noticeBody := fmt.Sprintf("A change of your account email to %s has been requested. If this wasn't you, cancel the change by opening the following link:\n\n%s/email/cancel?token=%s", newEmail, us.AppURL, cancelToken)
+	if err := us.Mailer.Send(ctx, u.Email, "Your email address is about to change", noticeBody); err != nil {
+		// the change is still pending and needs confirmation of the new address, so don't fail the request
+		log.Printf("Failed to send email change notice to uid: %v. Error: %v\n", u.UID, err)
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange switches the users email to the pending email the token has been issued for
+func (us *userService) ConfirmEmailChange(ctx context.Context, token string) (*model.User, error) {
+	change, err := us.consumeEmailChangeToken(ctx, EmailConfirmAction, token)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := us.UserRepository.FindByID(ctx, change.UID)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.PendingEmail != change.Email {
+		return nil, model.NewNotFound("pendingEmail", change.Email)
+	}
+
+	u.Email = change.Email
+	u.PendingEmail = ""
+
+	// returns a conflict if the email has been taken in the meantime
+	if err := us.UserRepository.Update(ctx, u); err != nil {
+		return nil, err
+	}
+
+	publishUserEvent(ctx, us.UserEventRepository, model.EventProfileUpdated, u.UID)
+
+	return u, nil
+}
+
+// CancelEmailChange discards the pending email the token has been issued for,
+// which invalidates the confirmation link sent to the new address
+func (us *userService) CancelEmailChange(ctx context.Context, token string) error {
+	change, err := us.consumeEmailChangeToken(ctx, EmailCancelAction, token)
+	if err != nil {
+		return err
+	}
+
+	u, err := us.UserRepository.FindByID(ctx, change.UID)
+	if err != nil {
+		return err
+	}
+
+	if u.PendingEmail != change.Email {
+		// the change has already been confirmed, cancelled or superseded
+		return model.NewNotFound("pendingEmail", change.Email)
+	}
+
+	u.PendingEmail = ""
+	return us.UserRepository.Update(ctx, u)
+}
+
+func (us *userService) consumeEmailChangeToken(ctx context.Context, action, token string) (*emailChange, error) {
+	value, err := us.consumeActionToken(ctx, action, token)
+	if err != nil {
+		return nil, err
+	}
+
+	var change emailChange
+	if err := json.Unmarshal([]byte(value), &change); err != nil {
+		return nil, model.NewInternal()
+	}
+
+	return &change, nil
+}
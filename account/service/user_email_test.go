@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestEmailChange(t *testing.T) {
+	user := randomUser(t)
+	newEmail := "new@mail.com"
+
+	testCases := []struct {
+		name       string
+		newEmail   string
+		buildStubs func(repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository, mailer *mocks.MockMailer)
+		checkError func(t *testing.T, err error)
+	}{
+		{
+			name:     "OK",
+			newEmail: newEmail,
+			buildStubs: func(repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository, mailer *mocks.MockMailer) {
+				repo.EXPECT().FindByID(gomock.Any(), user.UID).Times(1).Return(&model.User{UID: user.UID, Email: user.Email}, nil)
+				repo.EXPECT().FindByEmail(gomock.Any(), newEmail).Times(1).Return(&model.User{}, model.NewNotFound("email", newEmail))
+				repo.EXPECT().Update(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(func(ctx context.Context, u *model.User) error {
+					require.Equal(t, newEmail, u.PendingEmail)
+					require.Equal(t, user.Email, u.Email)
+					return nil
+				})
+				atr.EXPECT().SetActionToken(gomock.Any(), EmailConfirmAction, gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil)
+				atr.EXPECT().SetActionToken(gomock.Any(), EmailCancelAction, gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil)
+				mailer.EXPECT().Send(gomock.Any(), newEmail, gomock.Any(), gomock.Any()).Times(1).Return(nil)
+				mailer.EXPECT().Send(gomock.Any(), user.Email, gomock.Any(), gomock.Any()).Times(1).Return(nil)
+			},
+			checkError: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:     "EmailTaken",
+			newEmail: newEmail,
+			buildStubs: func(repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository, mailer *mocks.MockMailer) {
+				repo.EXPECT().FindByID(gomock.Any(), user.UID).Times(1).Return(&model.User{UID: user.UID, Email: user.Email}, nil)
+				repo.EXPECT().FindByEmail(gomock.Any(), newEmail).Times(1).Return(randomUser(t), nil)
+				repo.EXPECT().Update(gomock.Any(), gomock.Any()).Times(0)
+				mailer.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkError: func(t *testing.T, err error) {
+				require.Equal(t, http.StatusConflict, model.Status(err))
+			},
+		},
+		{
+			name:     "SameEmail",
+			newEmail: user.Email,
+			buildStubs: func(repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository, mailer *mocks.MockMailer) {
+				repo.EXPECT().FindByID(gomock.Any(), user.UID).Times(1).Return(&model.User{UID: user.UID, Email: user.Email}, nil)
+				repo.EXPECT().Update(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkError: func(t *testing.T, err error) {
+				require.Equal(t, http.StatusBadRequest, model.Status(err))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockUserRepository(ctrl)
+			atr := mocks.NewMockActionTokenRepository(ctrl)
+			mailer := mocks.NewMockMailer(ctrl)
+			tc.buildStubs(repo, atr, mailer)
+
+			service := NewUserService(&UserServiceConfig{
+				UserRepository:        repo,
+				ActionTokenRepository: atr,
+				Mailer:                mailer,
+			})
+
+			err := service.RequestEmailChange(context.Background(), user.UID, tc.newEmail)
+			tc.checkError(t, err)
+		})
+	}
+}
+
+func TestConfirmEmailChange(t *testing.T) {
+	user := randomUser(t)
+	newEmail := "new@mail.com"
+	token := "token"
+
+	value, err := json.Marshal(emailChange{UID: user.UID, Email: newEmail})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		buildStubs    func(repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository)
+		checkResponse func(t *testing.T, gotUser *model.User, err error)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), EmailConfirmAction, token).Times(1).Return(string(value), nil)
+				repo.EXPECT().FindByID(gomock.Any(), user.UID).Times(1).Return(&model.User{UID: user.UID, Email: user.Email, PendingEmail: newEmail}, nil)
+				repo.EXPECT().Update(gomock.Any(), gomock.Any()).Times(1).Return(nil)
+			},
+			checkResponse: func(t *testing.T, gotUser *model.User, err error) {
+				require.NoError(t, err)
+				require.Equal(t, newEmail, gotUser.Email)
+				require.Empty(t, gotUser.PendingEmail)
+			},
+		},
+		{
+			name: "InvalidToken",
+			buildStubs: func(repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), EmailConfirmAction, token).Times(1).Return("", model.NewNotFound("token", token))
+				repo.EXPECT().Update(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, gotUser *model.User, err error) {
+				require.Nil(t, gotUser)
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name: "Cancelled",
+			buildStubs: func(repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), EmailConfirmAction, token).Times(1).Return(string(value), nil)
+				repo.EXPECT().FindByID(gomock.Any(), user.UID).Times(1).Return(&model.User{UID: user.UID, Email: user.Email}, nil)
+				repo.EXPECT().Update(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, gotUser *model.User, err error) {
+				require.Nil(t, gotUser)
+				require.Equal(t, http.StatusNotFound, model.Status(err))
+			},
+		},
+		{
+			name: "EmailTakenInMeantime",
+			buildStubs: func(repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), EmailConfirmAction, token).Times(1).Return(string(value), nil)
+				repo.EXPECT().FindByID(gomock.Any(), user.UID).Times(1).Return(&model.User{UID: user.UID, Email: user.Email, PendingEmail: newEmail}, nil)
+				repo.EXPECT().Update(gomock.Any(), gomock.Any()).Times(1).Return(model.NewConflict("email", newEmail))
+			},
+			checkResponse: func(t *testing.T, gotUser *model.User, err error) {
+				require.Nil(t, gotUser)
+				require.Equal(t, http.StatusConflict, model.Status(err))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockUserRepository(ctrl)
+			atr := mocks.NewMockActionTokenRepository(ctrl)
+			tc.buildStubs(repo, atr)
+
+			events := mocks.NewMockUserEventRepository(ctrl)
+			events.EXPECT().Publish(gomock.Any(), gomock.Any()).AnyTimes().Return(nil)
+
+			service := NewUserService(&UserServiceConfig{
+				UserRepository:        repo,
+				ActionTokenRepository: atr,
+				UserEventRepository:   events,
+			})
+
+			u, err := service.ConfirmEmailChange(context.Background(), token)
+			tc.checkResponse(t, u, err)
+		})
+	}
+}
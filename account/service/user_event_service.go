@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+)
+
+// number of events buffered per subscription. Events for subscribers which don't keep up are dropped
+const userEventBufferSize = 16
+
+type userEventService struct {
+	UserEventRepository model.UserEventRepository
+
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]map[chan *model.UserEvent]struct{}
+}
+
+type UserEventServiceConfig struct {
+	UserEventRepository model.UserEventRepository
+}
+
+func NewUserEventService(c *UserEventServiceConfig) model.UserEventService {
+	return &userEventService{
+		UserEventRepository: c.UserEventRepository,
+		subscribers:         make(map[uuid.UUID]map[chan *model.UserEvent]struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving the events of the user until ctx is cancelled. The channel is closed afterwards
+func (s *userEventService) Subscribe(ctx context.Context, uid uuid.UUID) <-chan *model.UserEvent {
+	ch := make(chan *model.UserEvent, userEventBufferSize)
+
+	s.mu.Lock()
+	if s.subscribers[uid] == nil {
+		s.subscribers[uid] = make(map[chan *model.UserEvent]struct{})
+	}
+	s.subscribers[uid][ch] = struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		s.mu.Lock()
+		delete(s.subscribers[uid], ch)
+		if len(s.subscribers[uid]) == 0 {
+			delete(s.subscribers, uid)
+		}
+		close(ch)
+		s.mu.Unlock()
+	}()
+
+	return ch
+}
+
+// Run delivers the events published by all instances to the subscriptions on this instance until ctx is cancelled
+func (s *userEventService) Run(ctx context.Context) error {
+	events, err := s.UserEventRepository.Listen(ctx)
+	if err != nil {
+		return err
+	}
+
+	for e := range events {
+		s.dispatch(e)
+	}
+
+	return nil
+}
+
+func (s *userEventService) dispatch(e *model.UserEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ch := range s.subscribers[e.UID] {
+		select {
+		case ch <- e:
+		default:
+			log.Printf("Dropped %s event of uid: %v for a slow subscriber\n", e.Type, e.UID)
+		}
+	}
+}
+
+// publishUserEvent publishes an event of the user. Failing to notify connected clients doesn't fail the operation
+func publishUserEvent(ctx context.Context, r model.UserEventRepository, eventType string, uid uuid.UUID) {
+	if err := r.Publish(ctx, model.NewUserEvent(eventType, uid)); err != nil {
+		log.Printf("Failed to publish %s event of uid: %v. Error: %v\n", eventType, uid, err)
+	}
+}
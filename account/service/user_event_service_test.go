@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserEventService(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uid := uuid.New()
+	otherUID := uuid.New()
+
+	published := make(chan *model.UserEvent)
+	repo := mocks.NewMockUserEventRepository(ctrl)
+	repo.EXPECT().Listen(gomock.Any()).Times(1).Return((<-chan *model.UserEvent)(published), nil)
+
+	service := NewUserEventService(&UserEventServiceConfig{
+		UserEventRepository: repo,
+	})
+
+	subCtx, unsubscribe := context.WithCancel(context.Background())
+	events := service.Subscribe(subCtx, uid)
+
+	done := make(chan error)
+	go func() {
+		done <- service.Run(context.Background())
+	}()
+
+	// only events of the subscribed user are delivered
+	published <- model.NewUserEvent(model.EventProfileUpdated, otherUID)
+	published <- model.NewUserEvent(model.EventSessionRevoked, uid)
+
+	select {
+	case e := <-events:
+		require.Equal(t, model.EventSessionRevoked, e.Type)
+		require.Equal(t, uid, e.UID)
+	case <-time.After(time.Second):
+		t.Fatal("event has not been delivered")
+	}
+
+	// the channel is closed once the subscription ends
+	unsubscribe()
+	select {
+	case _, ok := <-events:
+		require.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("subscription has not been closed")
+	}
+
+	close(published)
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"github.com/maxeth/go-account-api/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// longest line of a jsonl import
+const maxImportLineSize = 1 << 20
+
+// ImportUsers creates an account for every user in r, keeping the password hash the user had in the other auth system.
+// Users that can't be imported, like those whose email is taken already, are reported in the result and skipped.
+// The hashes are replaced with argon2id hashes the first time each user signs in
+func (s *adminService) ImportUsers(ctx context.Context, format string, r io.Reader) (*model.UserImportResult, error) {
+	result := &model.UserImportResult{Failed: []model.UserImportFailure{}}
+
+	importUser := func(line int, u *model.ImportedUser) error {
+		if err := s.importUser(ctx, u); err != nil {
+			var appErr *model.Error
+			if errors.As(err, &appErr) && appErr.Type == model.Internal {
+				return err
+			}
+			result.Failed = append(result.Failed, model.UserImportFailure{Line: line, Email: u.Email, Reason: err.Error()})
+			return nil
+		}
+
+		result.Imported++
+		return nil
+	}
+
+	var err error
+	switch format {
+	case model.ImportFormatCSV:
+		err = readImportCSV(r, importUser)
+	case model.ImportFormatJSONL:
+		err = readImportJSONL(r, result, importUser)
+	default:
+		return nil, model.NewValidation("format", "Format has to be csv or jsonl.")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	recordAudit(ctx, s.AuditService, model.AuditUsersImported, nil, model.AuditDetails{
+		"format":   format,
+		"imported": result.Imported,
+		"failed":   len(result.Failed),
+	})
+
+	return result, nil
+}
+
+func (s *adminService) importUser(ctx context.Context, u *model.ImportedUser) error {
+	if addr, err := mail.ParseAddress(u.Email); err != nil || addr.Address != u.Email {
+		return errors.New("Invalid email.")
+	}
+
+	hash, err := EncodeImportedHash(u)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.UserRepository.Create(ctx, &model.User{
+		Email:    u.Email,
+		Name:     u.Name,
+		Password: hash,
+	})
+	if model.Status(err) == http.StatusConflict {
+		return errors.New("An account with this email exists already.")
+	}
+
+	return err
+}
+
+// readImportCSV passes every row of a csv file to importUser. The header row names the columns by the json keys
+// of model.ImportedUser, in any order. Only email, scheme and hash are required
+func readImportCSV(r io.Reader, importUser func(line int, u *model.ImportedUser) error) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return model.NewBadRequest("The csv file has no header row.")
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, required := range []string{"email", "scheme", "hash"} {
+		if _, ok := columns[required]; !ok {
+			return model.NewBadRequest(fmt.Sprintf("The csv file has no %s column.", required))
+		}
+	}
+
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return model.NewBadRequest(fmt.Sprintf("The csv file is malformed: %v", err))
+		}
+
+		column := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		number := func(name string) int {
+			n, _ := strconv.Atoi(column(name))
+			return n
+		}
+
+		if err := importUser(line, &model.ImportedUser{
+			Email:      column("email"),
+			Name:       column("name"),
+			Scheme:     column("scheme"),
+			Hash:       column("hash"),
+			Salt:       column("salt"),
+			Iterations: number("iterations"),
+			Rounds:     number("rounds"),
+			MemCost:    number("memCost"),
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+// readImportJSONL passes the user of every non-empty line to importUser. Lines which aren't valid json are reported as failed
+func readImportJSONL(r io.Reader, result *model.UserImportResult, importUser func(line int, u *model.ImportedUser) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxImportLineSize)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var u model.ImportedUser
+		if err := json.Unmarshal([]byte(text), &u); err != nil {
+			result.Failed = append(result.Failed, model.UserImportFailure{Line: line, Reason: "Invalid json."})
+			continue
+		}
+
+		if err := importUser(line, &u); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return model.NewBadRequest(fmt.Sprintf("The jsonl file couldn't be read: %v", err))
+	}
+
+	return nil
+}
+
+// EncodeImportedHash returns the hash of an imported user in the format the PasswordHasher verifies it in, tagged with its scheme.
+// bcrypt hashes are kept as they are, the others are encoded as $firebase-scrypt$m=<mem cost>,r=<rounds>$<salt>$<hash>
+// and $pbkdf2-sha256$i=<iterations>$<salt>$<hash>
+func EncodeImportedHash(u *model.ImportedUser) (string, error) {
+	switch u.Scheme {
+	case model.HashSchemeBcrypt:
+		cost, err := bcrypt.Cost([]byte(u.Hash))
+		if err != nil {
+			return "", errors.New("Invalid bcrypt hash.")
+		}
+		if cost > maxBcryptCost {
+			return "", fmt.Errorf("bcrypt hashes need a cost of at most %d.", maxBcryptCost)
+		}
+		return u.Hash, nil
+
+	case model.HashSchemeFirebaseScrypt:
+		if u.MemCost < 1 || u.MemCost > maxScryptLogN || u.Rounds < 1 || u.Rounds > maxScryptRounds {
+			return "", fmt.Errorf("Firebase scrypt hashes need a memCost of 1-%d and 1-%d rounds.", maxScryptLogN, maxScryptRounds)
+		}
+		salt, hash, err := decodeImportedSaltAndHash(u)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("$firebase-scrypt$m=%d,r=%d$%s$%s", u.MemCost, u.Rounds, b64.EncodeToString(salt), b64.EncodeToString(hash)), nil
+
+	case model.HashSchemePBKDF2SHA256:
+		if u.Iterations < 1 || u.Iterations > maxPBKDF2Iterations {
+			return "", fmt.Errorf("PBKDF2 hashes need 1-%d iterations.", maxPBKDF2Iterations)
+		}
+		salt, hash, err := decodeImportedSaltAndHash(u)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("$pbkdf2-sha256$i=%d$%s$%s", u.Iterations, b64.EncodeToString(salt), b64.EncodeToString(hash)), nil
+	}
+
+	return "", fmt.Errorf("Unknown scheme %q.", u.Scheme)
+}
+
+// decodeImportedSaltAndHash decodes the salt and hash of an imported user, which may be base64 encoded with or without padding
+func decodeImportedSaltAndHash(u *model.ImportedUser) ([]byte, []byte, error) {
+	decode := func(s string) ([]byte, error) {
+		if b, err := base64.StdEncoding.DecodeString(s); err == nil {
+			return b, nil
+		}
+		return base64.RawStdEncoding.DecodeString(s)
+	}
+
+	salt, err := decode(u.Salt)
+	if err != nil || len(salt) == 0 {
+		return nil, nil, errors.New("Salt is not base64 encoded.")
+	}
+	hash, err := decode(u.Hash)
+	if err != nil || len(hash) == 0 {
+		return nil, nil, errors.New("Hash is not base64 encoded.")
+	}
+
+	return salt, hash, nil
+}
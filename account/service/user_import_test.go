@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+// a well-formed bcrypt hash, the password it has been created from doesn't matter for the import
+const importBcryptHash = "$2a$04$YhQu6ULPUJgodyI6YNvYZeVF7.YlYGRQRZE5u6R8bTY5b1Aj9DGNC"
+
+func TestImportUsers(t *testing.T) {
+	testCases := []struct {
+		name          string
+		format        string
+		input         string
+		buildStubs    func(repo *mocks.MockUserRepository)
+		checkResponse func(t *testing.T, result *model.UserImportResult, err error)
+	}{
+		{
+			name:   "CSV",
+			format: model.ImportFormatCSV,
+			input: "email,name,scheme,hash,salt,iterations\n" +
+				"a@example.com,Alice,bcrypt," + importBcryptHash + ",,\n" +
+				"b@example.com,,pbkdf2-sha256,aGFzaA==,c2FsdA==,1000\n",
+			buildStubs: func(repo *mocks.MockUserRepository) {
+				repo.EXPECT().Create(gomock.Any(), &model.User{Email: "a@example.com", Name: "Alice", Password: importBcryptHash}).Times(1).Return(&model.User{}, nil)
+				repo.EXPECT().Create(gomock.Any(), &model.User{Email: "b@example.com", Password: "$pbkdf2-sha256$i=1000$c2FsdA$aGFzaA"}).Times(1).Return(&model.User{}, nil)
+			},
+			checkResponse: func(t *testing.T, result *model.UserImportResult, err error) {
+				require.NoError(t, err)
+				require.Equal(t, 2, result.Imported)
+				require.Empty(t, result.Failed)
+			},
+		},
+		{
+			name:   "JSONL",
+			format: model.ImportFormatJSONL,
+			input: `{"email": "a@example.com", "scheme": "firebase-scrypt", "hash": "aGFzaA==", "salt": "c2FsdA==", "rounds": 8, "memCost": 14}` + "\n\n" +
+				`{"email": "b@example.com", "scheme": "bcrypt", "hash": "` + importBcryptHash + `"}`,
+			buildStubs: func(repo *mocks.MockUserRepository) {
+				repo.EXPECT().Create(gomock.Any(), &model.User{Email: "a@example.com", Password: "$firebase-scrypt$m=14,r=8$c2FsdA$aGFzaA"}).Times(1).Return(&model.User{}, nil)
+				repo.EXPECT().Create(gomock.Any(), &model.User{Email: "b@example.com", Password: importBcryptHash}).Times(1).Return(&model.User{}, nil)
+			},
+			checkResponse: func(t *testing.T, result *model.UserImportResult, err error) {
+				require.NoError(t, err)
+				require.Equal(t, 2, result.Imported)
+			},
+		},
+		{
+			name:   "InvalidUsersSkipped",
+			format: model.ImportFormatJSONL,
+			input: `{"email": "taken@example.com", "scheme": "bcrypt", "hash": "` + importBcryptHash + `"}` + "\n" +
+				`{"email": "not an email", "scheme": "bcrypt", "hash": "` + importBcryptHash + `"}` + "\n" +
+				`{"email": "md5@example.com", "scheme": "md5", "hash": "hash"}` + "\n" +
+				`{"email": "bcrypt@example.com", "scheme": "bcrypt", "hash": "not a bcrypt hash"}` + "\n" +
+				`{"email": "pbkdf2@example.com", "scheme": "pbkdf2-sha256", "hash": "aGFzaA==", "salt": "c2FsdA=="}` + "\n" +
+				`{"email": "slow-pbkdf2@example.com", "scheme": "pbkdf2-sha256", "hash": "aGFzaA==", "salt": "c2FsdA==", "iterations": 2000001}` + "\n" +
+				`{"email": "slow-firebase@example.com", "scheme": "firebase-scrypt", "hash": "aGFzaA==", "salt": "c2FsdA==", "rounds": 9, "memCost": 14}` + "\n" +
+				`{"email": "big-firebase@example.com", "scheme": "firebase-scrypt", "hash": "aGFzaA==", "salt": "c2FsdA==", "rounds": 8, "memCost": 17}` + "\n" +
+				`{"email": "slow-bcrypt@example.com", "scheme": "bcrypt", "hash": "` + strings.Replace(importBcryptHash, "$04$", "$15$", 1) + `"}` + "\n" +
+				`not json`,
+			buildStubs: func(repo *mocks.MockUserRepository) {
+				repo.EXPECT().Create(gomock.Any(), gomock.Any()).Times(1).Return(nil, model.NewConflict("email", "taken@example.com"))
+			},
+			checkResponse: func(t *testing.T, result *model.UserImportResult, err error) {
+				require.NoError(t, err)
+				require.Equal(t, 0, result.Imported)
+
+				lines := make([]int, len(result.Failed))
+				for i, f := range result.Failed {
+					require.NotEmpty(t, f.Reason)
+					lines[i] = f.Line
+				}
+				require.Equal(t, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, lines)
+				require.Equal(t, "taken@example.com", result.Failed[0].Email)
+			},
+		},
+		{
+			name:   "DatabaseError",
+			format: model.ImportFormatCSV,
+			input:  "email,scheme,hash\na@example.com,bcrypt," + importBcryptHash + "\nb@example.com,bcrypt," + importBcryptHash + "\n",
+			buildStubs: func(repo *mocks.MockUserRepository) {
+				repo.EXPECT().Create(gomock.Any(), gomock.Any()).Times(1).Return(nil, model.NewInternal())
+			},
+			checkResponse: func(t *testing.T, result *model.UserImportResult, err error) {
+				require.Equal(t, http.StatusInternalServerError, model.Status(err))
+			},
+		},
+		{
+			name:   "CSVMissingColumn",
+			format: model.ImportFormatCSV,
+			input:  "email,hash\na@example.com," + importBcryptHash + "\n",
+			buildStubs: func(repo *mocks.MockUserRepository) {
+				repo.EXPECT().Create(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, result *model.UserImportResult, err error) {
+				require.Equal(t, http.StatusBadRequest, model.Status(err))
+			},
+		},
+		{
+			name:   "UnknownFormat",
+			format: "xml",
+			buildStubs: func(repo *mocks.MockUserRepository) {
+				repo.EXPECT().Create(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, result *model.UserImportResult, err error) {
+				require.Equal(t, http.StatusBadRequest, model.Status(err))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockUserRepository(ctrl)
+			tc.buildStubs(repo)
+
+			service := NewAdminService(&AdminServiceConfig{
+				UserRepository: repo,
+			})
+
+			result, err := service.ImportUsers(context.Background(), tc.format, strings.NewReader(tc.input))
+			tc.checkResponse(t, result, err)
+		})
+	}
+}
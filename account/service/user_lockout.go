@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+)
+
+// action name of the token sent out to unlock an account after too many failed sign in attempts
+const AccountUnlockAction = "accountunlock"
+
+// claimLoginAttempt counts a sign in attempt of the user before the password is compared, and rejects it while attempts
+// are delayed or the account is locked. Counting and checking happen in one step, so that concurrent guesses can't all
+// pass the check. Once the free attempts are used up, every further attempt delays the next one twice as long as the
+// previous one, until the account is locked after MaxFailures attempts. A successful sign in clears the count again
+func (us *userService) claimLoginAttempt(ctx context.Context, u *model.User) error {
+	if us.Lockout.MaxFailures <= 0 {
+		return nil
+	}
+
+	claimed, ok, err := us.UserRepository.ClaimLoginAttempt(ctx, u.UID, us.Lockout)
+	if err != nil {
+		log.Printf("Failed to claim login attempt of uid: %v. Error: %v\n", u.UID, err)
+		return model.NewInternal()
+	}
+
+	u.FailedLogins = claimed.FailedLogins
+	u.LockedUntil = claimed.LockedUntil
+	if ok {
+		return nil
+	}
+
+	remaining := time.Until(*u.LockedUntil)
+	if u.FailedLogins >= us.Lockout.MaxFailures {
+		return model.NewAccountLocked(remaining)
+	}
+	return model.NewTooManyRequests(remaining)
+}
+
+// recordFailedLogin finishes a failed sign in attempt, which has already been counted by claimLoginAttempt.
+// The user is sent an unlock link when the attempt locked the account
+func (us *userService) recordFailedLogin(ctx context.Context, u *model.User) {
+	if us.Lockout.MaxFailures > 0 && u.FailedLogins == us.Lockout.MaxFailures {
+		us.sendUnlockLink(ctx, u)
+	}
+}
+
+// sendUnlockLink tells the user about the lock and sends a link which unlocks the account right away
+func (us *userService) sendUnlockLink(ctx context.Context, u *model.User) {
+	if us.Mailer == nil {
+		return
+	}
+
+	token, err := us.newActionToken(ctx, AccountUnlockAction, u.UID.String(), us.Lockout.Duration)
+	if err != nil {
+		log.Printf("Failed to create unlock token for uid: %v. Error: %v\n", u.UID, err)
+		return
+	}
+
+	body := fmt.Sprintf("Your account has been locked for %v after %d failed sign in attempts. If these attempts were yours, unlock your account by opening the following link. If they weren't, consider changing your password.\n\n%s/account/unlock?token=%s", us.Lockout.Duration, us.Lockout.MaxFailures, us.AppURL, token)
+	if err := us.Mailer.Send(ctx, u.Email, "Your account has been locked", body); err != nil {
+		log.Printf("Failed to send unlock link to uid: %v. Error: %v\n", u.UID, err)
+	}
+}
+
+// resetFailedLogins clears the failed attempts after a successful sign in
+func (us *userService) resetFailedLogins(ctx context.Context, u *model.User) {
+	if u.FailedLogins == 0 && u.LockedUntil == nil {
+		return
+	}
+
+	if err := us.UserRepository.ResetFailedLogins(ctx, u.UID); err != nil {
+		log.Printf("Failed to reset failed logins of uid: %v. Error: %v\n", u.UID, err)
+	}
+}
+
+// UnlockAccount lifts the lock of the account the token has been issued for
+func (us *userService) UnlockAccount(ctx context.Context, token string) error {
+	value, err := us.consumeActionToken(ctx, AccountUnlockAction, token)
+	if err != nil {
+		return err
+	}
+
+	uid, err := uuid.Parse(value)
+	if err != nil {
+		return model.NewInternal()
+	}
+
+	return us.UserRepository.ResetFailedLogins(ctx, uid)
+}
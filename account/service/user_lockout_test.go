@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigninLockout(t *testing.T) {
+	user := randomUser(t)
+	pw := user.Password
+
+	hashedPw, err := HashPassword(pw)
+	require.NoError(t, err)
+
+	policy := model.LockoutPolicy{
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxFailures:  10,
+		Duration:     time.Hour,
+	}
+
+	future := time.Now().Add(30 * time.Second)
+	delayed := time.Now().Add(4 * time.Second)
+	locked := time.Now().Add(time.Hour)
+
+	// claimed returns the user as stored after an attempt has been claimed
+	claimed := func(failedLogins int, lockedUntil *time.Time) *model.User {
+		return &model.User{UID: user.UID, Email: user.Email, FailedLogins: failedLogins, LockedUntil: lockedUntil}
+	}
+
+	testCases := []struct {
+		name          string
+		password      string
+		buildStubs    func(repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository, mailer *mocks.MockMailer)
+		checkResponse func(t *testing.T, err error)
+	}{
+		{
+			name:     "FreeAttempt",
+			password: "wrong password",
+			buildStubs: func(repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository, mailer *mocks.MockMailer) {
+				repo.EXPECT().ClaimLoginAttempt(gomock.Any(), user.UID, policy).Times(1).Return(claimed(2, nil), true, nil)
+				mailer.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name:     "ProgressiveDelay",
+			password: "wrong password",
+			buildStubs: func(repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository, mailer *mocks.MockMailer) {
+				repo.EXPECT().ClaimLoginAttempt(gomock.Any(), user.UID, policy).Times(1).Return(claimed(6, &delayed), true, nil)
+				mailer.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name:     "Lockout",
+			password: "wrong password",
+			buildStubs: func(repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository, mailer *mocks.MockMailer) {
+				repo.EXPECT().ClaimLoginAttempt(gomock.Any(), user.UID, policy).Times(1).Return(claimed(10, &locked), true, nil)
+				atr.EXPECT().SetActionToken(gomock.Any(), AccountUnlockAction, gomock.Any(), user.UID.String(), time.Hour).Times(1).Return(nil)
+				mailer.EXPECT().Send(gomock.Any(), user.Email, gomock.Any(), gomock.Any()).Times(1).Return(nil)
+			},
+			checkResponse: func(t *testing.T, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name:     "Delayed",
+			password: pw,
+			buildStubs: func(repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository, mailer *mocks.MockMailer) {
+				// not even the correct password is accepted
+				repo.EXPECT().ClaimLoginAttempt(gomock.Any(), user.UID, policy).Times(1).Return(claimed(5, &future), false, nil)
+				repo.EXPECT().ResetFailedLogins(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, err error) {
+				require.Equal(t, http.StatusTooManyRequests, model.Status(err))
+				require.Equal(t, 30, err.(*model.Error).RetryAfter)
+			},
+		},
+		{
+			name:     "Locked",
+			password: "wrong password",
+			buildStubs: func(repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository, mailer *mocks.MockMailer) {
+				repo.EXPECT().ClaimLoginAttempt(gomock.Any(), user.UID, policy).Times(1).Return(claimed(10, &future), false, nil)
+				mailer.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, err error) {
+				require.Equal(t, http.StatusTooManyRequests, model.Status(err))
+				require.Equal(t, model.NewAccountLocked(time.Second).Message, err.(*model.Error).Message)
+			},
+		},
+		{
+			name:     "CorrectPassword",
+			password: pw,
+			buildStubs: func(repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository, mailer *mocks.MockMailer) {
+				// the attempt counts until the password turned out to be correct
+				repo.EXPECT().ClaimLoginAttempt(gomock.Any(), user.UID, policy).Times(1).Return(claimed(6, &delayed), true, nil)
+				repo.EXPECT().ResetFailedLogins(gomock.Any(), user.UID).Times(1).Return(nil)
+			},
+			checkResponse: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockUserRepository(ctrl)
+			atr := mocks.NewMockActionTokenRepository(ctrl)
+			mailer := mocks.NewMockMailer(ctrl)
+
+			repo.EXPECT().FindByEmail(gomock.Any(), user.Email).Times(1).Return(&model.User{
+				UID:          user.UID,
+				Email:        user.Email,
+				Password:     hashedPw,
+				Status:       model.StatusActive,
+				FailedLogins: 5,
+			}, nil)
+			tc.buildStubs(repo, atr, mailer)
+
+			service := NewUserService(&UserServiceConfig{
+				UserRepository:        repo,
+				ActionTokenRepository: atr,
+				Mailer:                mailer,
+				Lockout:               policy,
+			})
+
+			_, err := service.Signin(context.Background(), user.Email, tc.password)
+			tc.checkResponse(t, err)
+		})
+	}
+}
+
+func TestLockoutPolicyDelay(t *testing.T) {
+	policy := model.LockoutPolicy{
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxFailures:  10,
+		Duration:     20 * time.Second,
+	}
+
+	require.Zero(t, policy.Delay(3))
+	require.Equal(t, time.Second, policy.Delay(4))
+	require.Equal(t, 4*time.Second, policy.Delay(6))
+	// delays never exceed the lock
+	require.Equal(t, 20*time.Second, policy.Delay(9))
+	require.Equal(t, 20*time.Second, policy.Delay(10))
+	require.Equal(t, 20*time.Second, policy.Delay(11))
+}
+
+func TestUnlockAccount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := randomUser(t)
+
+	repo := mocks.NewMockUserRepository(ctrl)
+	atr := mocks.NewMockActionTokenRepository(ctrl)
+	atr.EXPECT().ConsumeActionToken(gomock.Any(), AccountUnlockAction, "token").Times(1).Return(user.UID.String(), nil)
+	repo.EXPECT().ResetFailedLogins(gomock.Any(), user.UID).Times(1).Return(nil)
+
+	service := NewUserService(&UserServiceConfig{
+		UserRepository:        repo,
+		ActionTokenRepository: atr,
+	})
+
+	require.NoError(t, service.UnlockAccount(context.Background(), "token"))
+}
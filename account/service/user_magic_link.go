@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/maxeth/go-account-api/library"
+	"github.com/maxeth/go-account-api/model"
+)
+
+// action name of the token sent out to sign in without a password
+const MagicLinkAction = "magiclink"
+
+// magicLink is the value stored along with a sign in link token
+type magicLink struct {
+	Email         string `json:"email"`
+	NonceHash     string `json:"nonceHash"`     // the link is only accepted along with the nonce, which is kept by the requesting browser
+	CreateAccount bool   `json:"createAccount"` // set if there was no account with the email when the link was requested
+}
+
+// RequestMagicLink mails a single-use sign in link to the email and returns the nonce the requesting browser has to
+// present when the link is used. Unknown emails only receive a link that creates an account if createAccount is set
+// and passwordless accounts are allowed. A nonce is returned either way, so that the response doesn't tell whether
+// an account exists
+func (us *userService) RequestMagicLink(ctx context.Context, email string, createAccount bool) (string, error) {
+	nonce, err := library.SecureToken(32)
+	if err != nil {
+		log.Printf("Failed to generate %s nonce: %v\n", MagicLinkAction, err)
+		return "", model.NewInternal()
+	}
+
+	link := magicLink{Email: email, NonceHash: hashNonce(nonce)}
+
+	if _, err := us.UserRepository.FindByEmail(ctx, email); err != nil {
+		if model.Status(err) != http.StatusNotFound {
+			return "", err
+		}
+		if !createAccount || !us.PasswordlessSignup {
+			return nonce, nil
+		}
+		link.CreateAccount = true
+	}
+
+	value, err := json.Marshal(link)
+	if err != nil {
+		return "", model.NewInternal()
+	}
+
+	exp := time.Duration(us.MagicLinkExpSecs) * time.Second
+
+	token, err := us.newActionToken(ctx, MagicLinkAction, string(value), exp)
+	if err != nil {
+		return "", err
+	}
+
+	body := fmt.Sprintf("Sign in by opening the following link in the browser you requested it from. The link can be used once within the next %v. If this wasn't you, ignore this email.\n\n%s/signin/magic?token=%s", exp, us.AppURL, token)
+	if err := us.Mailer.Send(ctx, email, "Your sign in link", body); err != nil {
+		log.Printf("Failed to send sign in link. Error: %v\n", err)
+		return "", model.NewInternal()
+	}
+
+	return nonce, nil
+}
+
+// SigninWithMagicLink returns the user the link has been sent to, creating a passwordless account if the link has been
+// requested to do so. The link can only be used once, and only along with the nonce of the browser that requested it
+func (us *userService) SigninWithMagicLink(ctx context.Context, token string, nonce string) (*model.User, error) {
+	value, err := us.consumeActionToken(ctx, MagicLinkAction, token)
+	if err != nil {
+		return nil, err
+	}
+
+	var link magicLink
+	if err := json.Unmarshal([]byte(value), &link); err != nil {
+		return nil, model.NewInternal()
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashNonce(nonce)), []byte(link.NonceHash)) != 1 {
+		return nil, model.NewAuthorization("The link has to be opened in the browser it has been requested from.")
+	}
+
+	u, err := us.UserRepository.FindByEmail(ctx, link.Email)
+	if err != nil {
+		if model.Status(err) != http.StatusNotFound {
+			return nil, err
+		}
+		// the account has been deleted since the link was requested, or passwordless accounts have been turned off
+		if !link.CreateAccount || !us.PasswordlessSignup {
+			return nil, model.NewAuthorization("The link is invalid or has expired.")
+		}
+
+		// accounts without a password can only sign in with links until a password is set through a password reset
+		u, err := us.UserRepository.Create(ctx, &model.User{Email: link.Email})
+		if err != nil {
+			return nil, err
+		}
+
+		recordAudit(ctx, us.AuditService, model.AuditSignup, &u.UID, model.AuditDetails{"method": model.SigninMethodMagicLink})
+		return u, nil
+	}
+
+	if err := u.CheckActive(); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+func hashNonce(nonce string) string {
+	sum := sha256.Sum256([]byte(nonce))
+	return hex.EncodeToString(sum[:])
+}
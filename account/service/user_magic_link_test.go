@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestMagicLink(t *testing.T) {
+	user := randomUser(t)
+	unknown := "unknown@mail.com"
+
+	testCases := []struct {
+		name               string
+		email              string
+		createAccount      bool
+		passwordlessSignup bool
+		buildStubs         func(t *testing.T, repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository, mailer *mocks.MockMailer)
+	}{
+		{
+			name:  "ExistingAccount",
+			email: user.Email,
+			buildStubs: func(t *testing.T, repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository, mailer *mocks.MockMailer) {
+				repo.EXPECT().FindByEmail(gomock.Any(), user.Email).Times(1).Return(user, nil)
+				atr.EXPECT().SetActionToken(gomock.Any(), MagicLinkAction, gomock.Any(), gomock.Any(), 600*time.Second).Times(1).
+					DoAndReturn(func(ctx context.Context, action, token, value string, exp time.Duration) error {
+						var link magicLink
+						require.NoError(t, json.Unmarshal([]byte(value), &link))
+						require.Equal(t, user.Email, link.Email)
+						require.False(t, link.CreateAccount)
+						return nil
+					})
+				mailer.EXPECT().Send(gomock.Any(), user.Email, gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(ctx context.Context, to, subject, body string) error {
+						require.True(t, strings.Contains(body, "/signin/magic?token="))
+						return nil
+					})
+			},
+		},
+		{
+			name:               "CreateAccount",
+			email:              unknown,
+			createAccount:      true,
+			passwordlessSignup: true,
+			buildStubs: func(t *testing.T, repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository, mailer *mocks.MockMailer) {
+				repo.EXPECT().FindByEmail(gomock.Any(), unknown).Times(1).Return(nil, model.NewNotFound("email", unknown))
+				atr.EXPECT().SetActionToken(gomock.Any(), MagicLinkAction, gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(ctx context.Context, action, token, value string, exp time.Duration) error {
+						var link magicLink
+						require.NoError(t, json.Unmarshal([]byte(value), &link))
+						require.True(t, link.CreateAccount)
+						return nil
+					})
+				mailer.EXPECT().Send(gomock.Any(), unknown, gomock.Any(), gomock.Any()).Times(1).Return(nil)
+			},
+		},
+		{
+			name:               "UnknownEmail",
+			email:              unknown,
+			passwordlessSignup: true,
+			buildStubs: func(t *testing.T, repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository, mailer *mocks.MockMailer) {
+				repo.EXPECT().FindByEmail(gomock.Any(), unknown).Times(1).Return(nil, model.NewNotFound("email", unknown))
+				atr.EXPECT().SetActionToken(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				mailer.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+		{
+			name:          "PasswordlessSignupDisabled",
+			email:         unknown,
+			createAccount: true,
+			buildStubs: func(t *testing.T, repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository, mailer *mocks.MockMailer) {
+				repo.EXPECT().FindByEmail(gomock.Any(), unknown).Times(1).Return(nil, model.NewNotFound("email", unknown))
+				atr.EXPECT().SetActionToken(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				mailer.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockUserRepository(ctrl)
+			atr := mocks.NewMockActionTokenRepository(ctrl)
+			mailer := mocks.NewMockMailer(ctrl)
+			tc.buildStubs(t, repo, atr, mailer)
+
+			service := NewUserService(&UserServiceConfig{
+				UserRepository:        repo,
+				ActionTokenRepository: atr,
+				Mailer:                mailer,
+				MagicLinkExpSecs:      600,
+				PasswordlessSignup:    tc.passwordlessSignup,
+			})
+
+			// the response is the same whether a link has been sent or not
+			nonce, err := service.RequestMagicLink(context.Background(), tc.email, tc.createAccount)
+			require.NoError(t, err)
+			require.NotEmpty(t, nonce)
+		})
+	}
+}
+
+func TestSigninWithMagicLink(t *testing.T) {
+	user := randomUser(t)
+	user.Status = model.StatusActive
+	suspended := *user
+	suspended.Status = model.StatusSuspended
+
+	const nonce = "nonce"
+
+	link := func(t *testing.T, email string, createAccount bool) string {
+		value, err := json.Marshal(magicLink{Email: email, NonceHash: hashNonce(nonce), CreateAccount: createAccount})
+		require.NoError(t, err)
+		return string(value)
+	}
+
+	testCases := []struct {
+		name               string
+		nonce              string
+		passwordlessSignup bool
+		buildStubs         func(t *testing.T, repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository)
+		checkResponse      func(t *testing.T, u *model.User, err error)
+	}{
+		{
+			name:  "OK",
+			nonce: nonce,
+			buildStubs: func(t *testing.T, repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), MagicLinkAction, "token").Times(1).Return(link(t, user.Email, false), nil)
+				repo.EXPECT().FindByEmail(gomock.Any(), user.Email).Times(1).Return(user, nil)
+			},
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.NoError(t, err)
+				require.Equal(t, user, u)
+			},
+		},
+		{
+			name:  "OtherBrowser",
+			nonce: "other nonce",
+			buildStubs: func(t *testing.T, repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), MagicLinkAction, "token").Times(1).Return(link(t, user.Email, false), nil)
+				repo.EXPECT().FindByEmail(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name:  "UsedLink",
+			nonce: nonce,
+			buildStubs: func(t *testing.T, repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), MagicLinkAction, "token").Times(1).Return("", model.NewNotFound("token", "token"))
+				repo.EXPECT().FindByEmail(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name:               "CreateAccount",
+			nonce:              nonce,
+			passwordlessSignup: true,
+			buildStubs: func(t *testing.T, repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), MagicLinkAction, "token").Times(1).Return(link(t, user.Email, true), nil)
+				repo.EXPECT().FindByEmail(gomock.Any(), user.Email).Times(1).Return(nil, model.NewNotFound("email", user.Email))
+				repo.EXPECT().Create(gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(ctx context.Context, u *model.User) (*model.User, error) {
+						require.Equal(t, user.Email, u.Email)
+						require.Empty(t, u.Password)
+						return user, nil
+					})
+			},
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.NoError(t, err)
+				require.Equal(t, user, u)
+			},
+		},
+		{
+			name:  "PasswordlessSignupTurnedOff",
+			nonce: nonce,
+			buildStubs: func(t *testing.T, repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), MagicLinkAction, "token").Times(1).Return(link(t, user.Email, true), nil)
+				repo.EXPECT().FindByEmail(gomock.Any(), user.Email).Times(1).Return(nil, model.NewNotFound("email", user.Email))
+				repo.EXPECT().Create(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name:               "AccountDeleted",
+			nonce:              nonce,
+			passwordlessSignup: true,
+			buildStubs: func(t *testing.T, repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), MagicLinkAction, "token").Times(1).Return(link(t, user.Email, false), nil)
+				repo.EXPECT().FindByEmail(gomock.Any(), user.Email).Times(1).Return(nil, model.NewNotFound("email", user.Email))
+				repo.EXPECT().Create(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name:  "Suspended",
+			nonce: nonce,
+			buildStubs: func(t *testing.T, repo *mocks.MockUserRepository, atr *mocks.MockActionTokenRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), MagicLinkAction, "token").Times(1).Return(link(t, user.Email, false), nil)
+				repo.EXPECT().FindByEmail(gomock.Any(), user.Email).Times(1).Return(&suspended, nil)
+			},
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.Equal(t, http.StatusForbidden, model.Status(err))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockUserRepository(ctrl)
+			atr := mocks.NewMockActionTokenRepository(ctrl)
+			tc.buildStubs(t, repo, atr)
+
+			service := NewUserService(&UserServiceConfig{
+				UserRepository:        repo,
+				ActionTokenRepository: atr,
+				PasswordlessSignup:    tc.passwordlessSignup,
+			})
+
+			u, err := service.SigninWithMagicLink(context.Background(), "token", tc.nonce)
+			tc.checkResponse(t, u, err)
+		})
+	}
+}
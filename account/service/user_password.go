@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/library"
+	"github.com/maxeth/go-account-api/model"
+)
+
+// action name of the token sent out to reset a password
+const PasswordResetAction = "passwordreset"
+
+// RequestPasswordReset mails a link to reset the password to the user with the email.
+// Unknown emails are ignored, so that the response doesn't tell whether an account exists
+func (us *userService) RequestPasswordReset(ctx context.Context, email string) error {
+	u, err := us.UserRepository.FindByEmail(ctx, email)
+	if err != nil {
+		if model.Status(err) == http.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+
+	return us.sendPasswordReset(ctx, u, "A password reset has been requested for your account. If this wasn't you, ignore this email.")
+}
+
+// ResetPassword sets the password of the user the token has been issued for
+func (us *userService) ResetPassword(ctx context.Context, token string, password string) (*model.User, error) {
+	value, err := us.consumeActionToken(ctx, PasswordResetAction, token)
+	if err != nil {
+		return nil, err
+	}
+
+	uid, err := uuid.Parse(value)
+	if err != nil {
+		return nil, model.NewInternal()
+	}
+
+	u, err := us.UserRepository.FindByID(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := us.checkPassword(ctx, password, u); err != nil {
+		return nil, err
+	}
+
+	hashedPw, err := us.PasswordHasher.Hash(password)
+	if err != nil {
+		return nil, model.NewInternal()
+	}
+
+	if err := us.UserRepository.UpdatePassword(ctx, uid, hashedPw); err != nil {
+		return nil, err
+	}
+
+	recordAudit(ctx, us.AuditService, model.AuditPasswordReset, &uid, nil)
+
+	return u, nil
+}
+
+// ChangePassword replaces the password of a signed in user, who has to confirm the change with the current password.
+// Users without a password have to set one with a password reset instead
+func (us *userService) ChangePassword(ctx context.Context, uid uuid.UUID, currentPassword, password string) error {
+	u, err := us.UserRepository.FindByID(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	if err := us.reauthenticate(u, currentPassword); err != nil {
+		return err
+	}
+
+	if err := us.checkPassword(ctx, password, u); err != nil {
+		return err
+	}
+
+	hashedPw, err := us.PasswordHasher.Hash(password)
+	if err != nil {
+		return model.NewInternal()
+	}
+
+	if err := us.UserRepository.UpdatePassword(ctx, uid, hashedPw); err != nil {
+		return err
+	}
+
+	recordAudit(ctx, us.AuditService, model.AuditPasswordChanged, &uid, nil)
+
+	return nil
+}
+
+// reauthenticate checks the password of a signed in user before a sensitive change. Accounts created with a sign in link
+// have no password to check, they have to set one through a password reset first, which proves access to the email again
+func (us *userService) reauthenticate(u *model.User, password string) error {
+	if u.Password == "" {
+		return model.NewBadRequest("Your account has no password yet. Set one with a password reset first.")
+	}
+
+	if _, err := us.PasswordHasher.Verify(u.Password, password); err != nil {
+		return model.NewAuthorization("Invalid password.")
+	}
+
+	return nil
+}
+
+// rehashPassword replaces an outdated hash of the users password with one of the current algorithm and parameters.
+// Failures are only logged, the old hash keeps working
+func (us *userService) rehashPassword(ctx context.Context, u *model.User, password string) {
+	hashedPw, err := us.PasswordHasher.Hash(password)
+	if err != nil {
+		log.Printf("Failed to rehash password of uid: %v. Error: %v\n", u.UID, err)
+		return
+	}
+
+	if err := us.UserRepository.UpdatePassword(ctx, u.UID, hashedPw); err != nil {
+		log.Printf("Failed to store rehashed password of uid: %v. Error: %v\n", u.UID, err)
+		return
+	}
+
+	u.Password = hashedPw
+}
+
+// checkPassword checks a new password of the user against the password policy
+func (us *userService) checkPassword(ctx context.Context, password string, u *model.User) error {
+	if us.PasswordPolicyService == nil {
+		return nil
+	}
+
+	return us.PasswordPolicyService.Check(ctx, password, u)
+}
+
+// ForcePasswordReset replaces the users password with a random one on behalf of an admin
+func (us *userService) ForcePasswordReset(ctx context.Context, uid uuid.UUID) error {
+	u, err := us.UserRepository.FindByID(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	return us.replacePassword(ctx, u, "Your password has been reset by an administrator. You have to choose a new password to sign in again.")
+}
+
+// replacePassword replaces the users password with a random one, so that the current password stops working,
+// and mails a link to choose a new password along with the reason
+func (us *userService) replacePassword(ctx context.Context, u *model.User, reason string) error {
+	random, err := library.SecureToken(32)
+	if err != nil {
+		return model.NewInternal()
+	}
+
+	hashedPw, err := us.PasswordHasher.Hash(random)
+	if err != nil {
+		return model.NewInternal()
+	}
+
+	if err := us.UserRepository.UpdatePassword(ctx, u.UID, hashedPw); err != nil {
+		return err
+	}
+
+	return us.sendPasswordReset(ctx, u, reason)
+}
+
+func (us *userService) sendPasswordReset(ctx context.Context, u *model.User, reason string) error {
+	token, err := us.newActionToken(ctx, PasswordResetAction, u.UID.String(), time.Duration(us.EmailTokenExpSecs)*time.Second)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("%s\n\nChoose a new password by opening the following link:\n\n%s/password/reset?token=%s", reason, us.AppURL, token)
+	if err := us.Mailer.Send(ctx, u.Email, "Reset your password", body); err != nil {
+		log.Printf("Failed to send password reset link to uid: %v. Error: %v\n", u.UID, err)
+		return model.NewInternal()
+	}
+
+	return nil
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var weakPasswordErr = model.NewInvalidArguments([]model.InvalidArgument{{Field: "password", Tag: model.PasswordRuleMinLength}})
+
+func TestSignupPasswordPolicy(t *testing.T) {
+	testCases := []struct {
+		name       string
+		buildStubs func(repo *mocks.MockUserRepository, policy *mocks.MockPasswordPolicyService)
+		check      func(t *testing.T, err error)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(repo *mocks.MockUserRepository, policy *mocks.MockPasswordPolicyService) {
+				policy.EXPECT().Check(gomock.Any(), "password", &model.User{Email: email}).Times(1).Return(nil)
+				repo.EXPECT().Create(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(func(ctx context.Context, u *model.User) (*model.User, error) {
+					require.NoError(t, ComparePassword(u.Password, "password"))
+					return u, nil
+				})
+			},
+			check: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "WeakPassword",
+			buildStubs: func(repo *mocks.MockUserRepository, policy *mocks.MockPasswordPolicyService) {
+				policy.EXPECT().Check(gomock.Any(), "password", gomock.Any()).Times(1).Return(weakPasswordErr)
+				repo.EXPECT().Create(gomock.Any(), gomock.Any()).Times(0)
+			},
+			check: func(t *testing.T, err error) {
+				require.Equal(t, weakPasswordErr, err)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockUserRepository(ctrl)
+			policy := mocks.NewMockPasswordPolicyService(ctrl)
+			tc.buildStubs(repo, policy)
+
+			us := NewUserService(&UserServiceConfig{
+				UserRepository:        repo,
+				PasswordPolicyService: policy,
+			})
+
+			_, err := us.Signup(context.Background(), email, "password")
+			tc.check(t, err)
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	current := "current password"
+	hashedPw, err := HashPassword(current)
+	require.NoError(t, err)
+
+	user := &model.User{UID: uuid.New(), Email: email, Password: hashedPw}
+
+	testCases := []struct {
+		name            string
+		currentPassword string
+		passwordless    bool // the account has been created with a sign in link
+		buildStubs      func(repo *mocks.MockUserRepository, policy *mocks.MockPasswordPolicyService)
+		check           func(t *testing.T, err error)
+	}{
+		{
+			name:            "OK",
+			currentPassword: current,
+			buildStubs: func(repo *mocks.MockUserRepository, policy *mocks.MockPasswordPolicyService) {
+				policy.EXPECT().Check(gomock.Any(), "new password", user).Times(1).Return(nil)
+				repo.EXPECT().UpdatePassword(gomock.Any(), user.UID, gomock.Any()).Times(1).DoAndReturn(func(ctx context.Context, uid uuid.UUID, password string) error {
+					require.NoError(t, ComparePassword(password, "new password"))
+					return nil
+				})
+			},
+			check: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:            "WrongCurrentPassword",
+			currentPassword: "wrong password",
+			buildStubs: func(repo *mocks.MockUserRepository, policy *mocks.MockPasswordPolicyService) {
+				policy.EXPECT().Check(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				repo.EXPECT().UpdatePassword(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			check: func(t *testing.T, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name:            "WeakPassword",
+			currentPassword: current,
+			buildStubs: func(repo *mocks.MockUserRepository, policy *mocks.MockPasswordPolicyService) {
+				policy.EXPECT().Check(gomock.Any(), "new password", user).Times(1).Return(weakPasswordErr)
+				repo.EXPECT().UpdatePassword(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			check: func(t *testing.T, err error) {
+				require.Equal(t, weakPasswordErr, err)
+			},
+		},
+		{
+			// a password can only be set with a password reset, which proves access to the email
+			name:         "NoPassword",
+			passwordless: true,
+			buildStubs: func(repo *mocks.MockUserRepository, policy *mocks.MockPasswordPolicyService) {
+				policy.EXPECT().Check(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				repo.EXPECT().UpdatePassword(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			check: func(t *testing.T, err error) {
+				require.Equal(t, http.StatusBadRequest, model.Status(err))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockUserRepository(ctrl)
+			policy := mocks.NewMockPasswordPolicyService(ctrl)
+			stored := user
+			if tc.passwordless {
+				stored = &model.User{UID: user.UID, Email: user.Email}
+			}
+			repo.EXPECT().FindByID(gomock.Any(), user.UID).Times(1).Return(stored, nil)
+			tc.buildStubs(repo, policy)
+
+			us := NewUserService(&UserServiceConfig{
+				UserRepository:        repo,
+				PasswordPolicyService: policy,
+			})
+
+			err := us.ChangePassword(context.Background(), user.UID, tc.currentPassword, "new password")
+			tc.check(t, err)
+		})
+	}
+}
+
+func TestSigninRehash(t *testing.T) {
+	hasher := NewPasswordHasher(&PasswordHasherConfig{Argon2: testArgon2Params})
+
+	currentHash, err := hasher.Hash("password")
+	require.NoError(t, err)
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		hash       string
+		buildStubs func(repo *mocks.MockUserRepository, uid uuid.UUID)
+	}{
+		{
+			name: "Current",
+			hash: currentHash,
+			buildStubs: func(repo *mocks.MockUserRepository, uid uuid.UUID) {
+				repo.EXPECT().UpdatePassword(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+		{
+			name: "Outdated",
+			hash: string(bcryptHash),
+			buildStubs: func(repo *mocks.MockUserRepository, uid uuid.UUID) {
+				repo.EXPECT().UpdatePassword(gomock.Any(), uid, gomock.Any()).Times(1).DoAndReturn(func(ctx context.Context, uid uuid.UUID, hash string) error {
+					require.True(t, strings.HasPrefix(hash, "$argon2id$"))
+					outdated, err := hasher.Verify(hash, "password")
+					require.NoError(t, err)
+					require.False(t, outdated)
+					return nil
+				})
+			},
+		},
+		{
+			// the old hash keeps working, so the user is signed in anyway
+			name: "RehashFailed",
+			hash: string(bcryptHash),
+			buildStubs: func(repo *mocks.MockUserRepository, uid uuid.UUID) {
+				repo.EXPECT().UpdatePassword(gomock.Any(), uid, gomock.Any()).Times(1).Return(errors.New("connection refused"))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			user := &model.User{UID: uuid.New(), Email: email, Password: tc.hash, Status: model.StatusActive}
+
+			repo := mocks.NewMockUserRepository(ctrl)
+			repo.EXPECT().FindByEmail(gomock.Any(), email).Times(1).Return(user, nil)
+			tc.buildStubs(repo, user.UID)
+
+			us := NewUserService(&UserServiceConfig{
+				UserRepository: repo,
+				PasswordHasher: hasher,
+			})
+
+			u, err := us.Signin(context.Background(), email, "password")
+			require.NoError(t, err)
+			require.Equal(t, user.UID, u.UID)
+		})
+	}
+}
@@ -2,22 +2,70 @@ package service
 
 import (
 	"context"
+	"log"
+	"net/http"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/library"
 	"github.com/maxeth/go-account-api/model"
 )
 
 type userService struct {
-	UserRepository model.UserRepository
+	UserRepository          model.UserRepository
+	ActionTokenRepository   model.ActionTokenRepository
+	UserEventRepository     model.UserEventRepository
+	Mailer                  model.Mailer
+	PasswordPolicyService   model.PasswordPolicyService
+	PasswordHasher          model.PasswordHasher
+	AuditService            model.AuditService
+	KnownDeviceRepository   model.KnownDeviceRepository
+	AppURL                  string
+	EmailTokenExpSecs       int64
+	DeletionGracePeriodSecs int64
+	MagicLinkExpSecs        int64
+	PasswordlessSignup      bool
+	Lockout                 model.LockoutPolicy
 }
 
 type UserServiceConfig struct {
-	UserRepository model.UserRepository
+	UserRepository          model.UserRepository
+	ActionTokenRepository   model.ActionTokenRepository
+	UserEventRepository     model.UserEventRepository // notifies the connected clients of a user about changes of the profile
+	Mailer                  model.Mailer
+	PasswordPolicyService   model.PasswordPolicyService // checks passwords chosen at sign up, reset and change. Without it, any password is accepted
+	PasswordHasher          model.PasswordHasher        // defaults to argon2id with DefaultArgon2Params
+	AuditService            model.AuditService          // records sign ins, sign ups and password changes, optional
+	KnownDeviceRepository   model.KnownDeviceRepository // notifies users about sign ins from new devices. Without it, nobody is notified
+	AppURL                  string                      // base url of the frontend, used to build the links sent in emails
+	EmailTokenExpSecs       int64                       // how long links sent in emails stay valid
+	DeletionGracePeriodSecs int64                       // how long a deleted account can be restored before it is purged
+	MagicLinkExpSecs        int64                       // how long a sign in link stays valid
+	PasswordlessSignup      bool                        // lets sign in links create accounts without a password for unknown emails
+	Lockout                 model.LockoutPolicy
 }
 
 func NewUserService(c *UserServiceConfig) model.UserService {
+	hasher := c.PasswordHasher
+	if hasher == nil {
+		hasher = defaultPasswordHasher
+	}
+
 	return &userService{
-		UserRepository: c.UserRepository,
+		UserRepository:          c.UserRepository,
+		ActionTokenRepository:   c.ActionTokenRepository,
+		UserEventRepository:     c.UserEventRepository,
+		Mailer:                  c.Mailer,
+		PasswordPolicyService:   c.PasswordPolicyService,
+		PasswordHasher:          hasher,
+		AuditService:            c.AuditService,
+		KnownDeviceRepository:   c.KnownDeviceRepository,
+		AppURL:                  c.AppURL,
+		EmailTokenExpSecs:       c.EmailTokenExpSecs,
+		DeletionGracePeriodSecs: c.DeletionGracePeriodSecs,
+		MagicLinkExpSecs:        c.MagicLinkExpSecs,
+		PasswordlessSignup:      c.PasswordlessSignup,
+		Lockout:                 c.Lockout,
 	}
 }
 
@@ -26,42 +74,125 @@ func (us *userService) Get(ctx context.Context, uid uuid.UUID) (*model.User, err
 	return u, err
 }
 
+// GetMany returns the users with the uids that exist, in no particular order
+func (us *userService) GetMany(ctx context.Context, uids []uuid.UUID) ([]*model.User, error) {
+	if len(uids) == 0 {
+		return []*model.User{}, nil
+	}
+
+	return us.UserRepository.FindByIDs(ctx, uids)
+}
+
 func (us *userService) Signup(ctx context.Context, email, password string) (*model.User, error) {
 	empty := &model.User{}
 
-	hashedPw, err := HashPassword(password)
+	// create a user struct with the passed email and hashed password to be stored in the db
+	u := &model.User{
+		Email: email,
+	}
+	if err := us.checkPassword(ctx, password, u); err != nil {
+		return empty, err
+	}
+
+	hashedPw, err := us.PasswordHasher.Hash(password)
 	if err != nil {
 		return empty, model.NewInternal()
 	}
+	u.Password = hashedPw
 
-	// create a user struct with the passed email and hashed password to be stored in the db
-	u := &model.User{
-		Email:    email,
-		Password: hashedPw,
-	}
 	user, err := us.UserRepository.Create(ctx, u)
 	if err != nil {
 		return empty, err
 	}
 
+	recordAudit(ctx, us.AuditService, model.AuditSignup, &user.UID, nil)
+
 	return user, err
 }
 
+// EmailAvailable checks whether a new account could be created with the email
+func (us *userService) EmailAvailable(ctx context.Context, email string) (bool, error) {
+	exists, err := us.UserRepository.EmailExists(ctx, email)
+	if err != nil {
+		return false, err
+	}
+
+	return !exists, nil
+}
+
 func (us *userService) Signin(ctx context.Context, email, password string) (*model.User, error) {
 	empty := &model.User{}
 
 	user, err := us.UserRepository.FindByEmail(ctx, email)
 	if err != nil {
+		if model.Status(err) == http.StatusNotFound {
+			recordAudit(ctx, us.AuditService, model.AuditSigninFailed, nil, model.AuditDetails{"email": email, "reason": "unknown_email"})
+			return empty, err
+		}
 		return empty, model.NewInternal()
 	}
 
-	if user == nil {
-		return empty, model.NewNotFound("user", email)
+	// locked accounts are rejected before comparing the password, so that guesses can't be checked during the lock
+	if err := us.claimLoginAttempt(ctx, user); err != nil {
+		if model.Status(err) == http.StatusTooManyRequests {
+			recordAudit(ctx, us.AuditService, model.AuditSigninFailed, &user.UID, model.AuditDetails{"reason": "locked"})
+		}
+		return empty, err
 	}
 
-	if err := ComparePassword(user.Password, password); err != nil {
+	outdated, err := us.PasswordHasher.Verify(user.Password, password)
+	if err != nil {
+		us.recordFailedLogin(ctx, user)
+		recordAudit(ctx, us.AuditService, model.AuditSigninFailed, &user.UID, model.AuditDetails{"reason": "invalid_password"})
 		return empty, model.NewAuthorization("password and email do not match")
 	}
 
+	us.resetFailedLogins(ctx, user)
+
+	if outdated {
+		us.rehashPassword(ctx, user, password)
+	}
+
+	// only tell suspended users about the suspension once they proved to own the account
+	if err := user.CheckActive(); err != nil {
+		recordAudit(ctx, us.AuditService, model.AuditSigninFailed, &user.UID, model.AuditDetails{"reason": "suspended"})
+		return empty, err
+	}
+
 	return user, nil
 }
+
+// SigninCompleted records the sign in of the user once tokens have been issued, after any second factor, and checks
+// the device it came from. method is one of the SigninMethod or MFAMethod constants
+func (us *userService) SigninCompleted(ctx context.Context, u *model.User, method string) {
+	recordAudit(ctx, us.AuditService, model.AuditSigninSucceeded, &u.UID, model.AuditDetails{"method": method})
+	us.checkDevice(ctx, u)
+}
+
+// newActionToken creates a random token for the action and stores it along with value
+func (us *userService) newActionToken(ctx context.Context, action, value string, exp time.Duration) (string, error) {
+	token, err := library.SecureToken(32)
+	if err != nil {
+		log.Printf("Failed to generate %s token: %v\n", action, err)
+		return "", model.NewInternal()
+	}
+
+	if err := us.ActionTokenRepository.SetActionToken(ctx, action, token, value, exp); err != nil {
+		return "", model.NewInternal()
+	}
+
+	return token, nil
+}
+
+// consumeActionToken returns the value the token has been issued with and invalidates the token
+func (us *userService) consumeActionToken(ctx context.Context, action, token string) (string, error) {
+	value, err := us.ActionTokenRepository.ConsumeActionToken(ctx, action, token)
+	if err != nil {
+		if model.Status(err) == http.StatusNotFound {
+			return "", model.NewAuthorization("The link is invalid or has expired.")
+		}
+		return "", model.NewInternal()
+	}
+
+	return value, nil
+}
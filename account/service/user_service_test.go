@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"net/http"
 	"testing"
 
 	"github.com/golang/mock/gomock"
@@ -12,6 +13,8 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+const email = "somemail@gmail.com"
+
 func randomUser(t *testing.T) (user *model.User) {
 	user = &model.User{
 		UID:      uuid.New(),
@@ -78,3 +81,134 @@ func TestGetUser(t *testing.T) {
 
 	}
 }
+
+func TestGetManyUsers(t *testing.T) {
+	user := randomUser(t)
+
+	testCases := []struct {
+		name          string
+		uids          []uuid.UUID
+		buildStubs    func(repo *mocks.MockUserRepository)
+		checkResponse func(t *testing.T, gotUsers []*model.User, gotError error)
+	}{
+		{
+			name: "OK",
+			uids: []uuid.UUID{user.UID},
+			buildStubs: func(repo *mocks.MockUserRepository) {
+				repo.EXPECT().FindByIDs(gomock.Any(), []uuid.UUID{user.UID}).Times(1).Return([]*model.User{user}, nil)
+			},
+			checkResponse: func(t *testing.T, gotUsers []*model.User, gotError error) {
+				require.NoError(t, gotError)
+				require.Equal(t, []*model.User{user}, gotUsers)
+			},
+		},
+		{
+			name: "NoUIDs",
+			uids: []uuid.UUID{},
+			buildStubs: func(repo *mocks.MockUserRepository) {
+				repo.EXPECT().FindByIDs(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, gotUsers []*model.User, gotError error) {
+				require.NoError(t, gotError)
+				require.Empty(t, gotUsers)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockUserRepository(ctrl)
+			service := NewUserService(&UserServiceConfig{
+				UserRepository: repo,
+			})
+			tc.buildStubs(repo)
+
+			users, err := service.GetMany(context.Background(), tc.uids)
+			tc.checkResponse(t, users, err)
+		})
+	}
+}
+
+func TestSignin(t *testing.T) {
+	pw := library.RandomString(10)
+	hashedPw, err := HashPassword(pw)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		password      string
+		status        string
+		checkResponse func(t *testing.T, gotUser *model.User, gotError error)
+	}{
+		{
+			name:     "OK",
+			password: pw,
+			status:   model.StatusActive,
+			checkResponse: func(t *testing.T, gotUser *model.User, gotError error) {
+				require.NoError(t, gotError)
+				require.Equal(t, email, gotUser.Email)
+			},
+		},
+		{
+			name:     "WrongPassword",
+			password: "wrong password",
+			status:   model.StatusActive,
+			checkResponse: func(t *testing.T, gotUser *model.User, gotError error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(gotError))
+			},
+		},
+		{
+			name:     "Suspended",
+			password: pw,
+			status:   model.StatusSuspended,
+			checkResponse: func(t *testing.T, gotUser *model.User, gotError error) {
+				require.Equal(t, http.StatusForbidden, model.Status(gotError))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockUserRepository(ctrl)
+			repo.EXPECT().
+				FindByEmail(gomock.Any(), email).
+				Return(&model.User{UID: uuid.New(), Email: email, Password: hashedPw, Status: tc.status}, nil)
+
+			service := NewUserService(&UserServiceConfig{
+				UserRepository: repo,
+			})
+
+			u, err := service.Signin(context.Background(), email, tc.password)
+			tc.checkResponse(t, u, err)
+		})
+	}
+}
+
+func TestSigninCompleted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	as := mocks.NewMockAuditService(ctrl)
+	service := NewUserService(&UserServiceConfig{
+		AuditService: as,
+	})
+
+	user := &model.User{UID: uuid.New(), Email: email}
+	as.EXPECT().Record(gomock.Any(), &model.AuditEvent{
+		Type:       model.AuditSigninSucceeded,
+		SubjectUID: &user.UID,
+		Details:    model.AuditDetails{"method": model.MFAMethodTOTP},
+	}).Times(1)
+
+	service.SigninCompleted(context.Background(), user, model.MFAMethodTOTP)
+}
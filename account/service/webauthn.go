@@ -0,0 +1,318 @@
+package service
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/maxeth/go-account-api/library"
+	"github.com/maxeth/go-account-api/model"
+)
+
+// COSE algorithms of the credential keys accepted during registration, in order of preference
+const (
+	coseAlgES256 = -7
+	coseAlgRS256 = -257
+)
+
+// flags of the authenticator data
+const (
+	authDataUserPresent  = 0x01
+	authDataUserVerified = 0x04
+	authDataAttested     = 0x40
+)
+
+// WebAuthn user verification requirements
+const (
+	userVerificationRequired  = "required"
+	userVerificationPreferred = "preferred"
+)
+
+// collectedClientData is the JSON the browser passes to the authenticator along with the challenge
+type collectedClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// authenticatorData is the data signed by the authenticator
+type authenticatorData struct {
+	raw          []byte
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte // only present during registration
+	publicKey    []byte // COSE encoded, only present during registration
+}
+
+// parseClientData decodes the client data of a ceremony and returns it along with its raw bytes
+func parseClientData(encoded string) (*collectedClientData, []byte, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding client data: %w", err)
+	}
+
+	var cd collectedClientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return nil, nil, fmt.Errorf("parsing client data: %w", err)
+	}
+
+	return &cd, raw, nil
+}
+
+// verifyClientData checks that the client data belongs to a ceremony of the type and challenge, run on one of the origins of the relying party
+func verifyClientData(rp model.RelyingParty, cd *collectedClientData, ceremony string, challenge string) error {
+	if cd.Type != ceremony {
+		return fmt.Errorf("unexpected ceremony %q", cd.Type)
+	}
+	if cd.Challenge != challenge {
+		return errors.New("challenge mismatch")
+	}
+
+	for _, origin := range rp.Origins {
+		if cd.Origin == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin %q is not allowed", cd.Origin)
+}
+
+func parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, errors.New("authenticator data too short")
+	}
+
+	ad := &authenticatorData{
+		raw:       raw,
+		rpIDHash:  raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+
+	if ad.flags&authDataAttested == 0 {
+		return ad, nil
+	}
+
+	// attested credential data: aaguid (16 bytes), credential id length (2 bytes), credential id, COSE key
+	rest := raw[37:]
+	if len(rest) < 18 {
+		return nil, errors.New("attested credential data too short")
+	}
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLen {
+		return nil, errors.New("credential id too short")
+	}
+	ad.credentialID = rest[:idLen]
+	rest = rest[idLen:]
+
+	_, extensions, err := library.DecodeCBOR(rest)
+	if err != nil {
+		return nil, fmt.Errorf("parsing credential public key: %w", err)
+	}
+	ad.publicKey = rest[:len(rest)-len(extensions)]
+
+	return ad, nil
+}
+
+// verifyAuthenticatorData checks that the authenticator data has been created for the relying party with the user present
+func verifyAuthenticatorData(rp model.RelyingParty, ad *authenticatorData, requireUV bool) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(ad.rpIDHash, rpIDHash[:]) {
+		return errors.New("rp id mismatch")
+	}
+	if ad.flags&authDataUserPresent == 0 {
+		return errors.New("user not present")
+	}
+	if requireUV && ad.flags&authDataUserVerified == 0 {
+		return errors.New("user not verified")
+	}
+
+	return nil
+}
+
+// verifyRegistration verifies the response of an authenticator to creation options with the challenge
+// and returns the new credential. Attestation statements aren't verified, since registrations request no attestation
+func verifyRegistration(rp model.RelyingParty, challenge string, att *model.WebAuthnAttestation, requireUV bool) (*model.WebAuthnCredential, error) {
+	cd, _, err := parseClientData(att.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyClientData(rp, cd, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	rawAttObj, err := base64.RawURLEncoding.DecodeString(att.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("decoding attestation object: %w", err)
+	}
+	attObj, _, err := library.DecodeCBOR(rawAttObj)
+	if err != nil {
+		return nil, fmt.Errorf("parsing attestation object: %w", err)
+	}
+	m, ok := attObj.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("attestation object is not a map")
+	}
+	rawAuthData, ok := m["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("attestation object without authenticator data")
+	}
+
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyAuthenticatorData(rp, ad, requireUV); err != nil {
+		return nil, err
+	}
+	if ad.credentialID == nil {
+		return nil, errors.New("no attested credential data")
+	}
+
+	// make sure the key can be used to verify assertions before storing it
+	if _, _, err := parseCOSEKey(ad.publicKey); err != nil {
+		return nil, err
+	}
+
+	return &model.WebAuthnCredential{
+		CredentialID: ad.credentialID,
+		PublicKey:    ad.publicKey,
+		SignCount:    int64(ad.signCount),
+		Transports:   att.Transports,
+	}, nil
+}
+
+// verifyAssertion verifies the response of the authenticator of the credential to request options with the challenge
+// and returns the new signature counter
+func verifyAssertion(rp model.RelyingParty, challenge string, cred *model.WebAuthnCredential, a *model.WebAuthnAssertion, requireUV bool) (int64, error) {
+	cd, rawClientData, err := parseClientData(a.ClientDataJSON)
+	if err != nil {
+		return 0, err
+	}
+	if err := verifyClientData(rp, cd, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	rawAuthData, err := base64.RawURLEncoding.DecodeString(a.AuthenticatorData)
+	if err != nil {
+		return 0, fmt.Errorf("decoding authenticator data: %w", err)
+	}
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+	if err := verifyAuthenticatorData(rp, ad, requireUV); err != nil {
+		return 0, err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(a.Signature)
+	if err != nil {
+		return 0, fmt.Errorf("decoding signature: %w", err)
+	}
+
+	clientDataHash := sha256.Sum256(rawClientData)
+	if err := verifyCOSESignature(cred.PublicKey, append(rawAuthData, clientDataHash[:]...), sig); err != nil {
+		return 0, err
+	}
+
+	// authenticators without a counter always report 0, anything else has to increase with every assertion.
+	// A counter that didn't increase indicates a cloned authenticator
+	signCount := int64(ad.signCount)
+	if (signCount != 0 || cred.SignCount != 0) && signCount <= cred.SignCount {
+		return 0, fmt.Errorf("sign count %d did not increase from %d", signCount, cred.SignCount)
+	}
+
+	return signCount, nil
+}
+
+// parseCOSEKey returns the public key and algorithm of a COSE encoded ES256 or RS256 key
+func parseCOSEKey(raw []byte) (crypto.PublicKey, int64, error) {
+	decoded, _, err := library.DecodeCBOR(raw)
+	if err != nil {
+		return nil, 0, fmt.Errorf("parsing COSE key: %w", err)
+	}
+	m, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, 0, errors.New("COSE key is not a map")
+	}
+
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+
+	switch {
+	case kty == 2 && alg == coseAlgES256:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, 0, errors.New("invalid P-256 key")
+		}
+
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, 0, errors.New("point is not on P-256")
+		}
+		return key, alg, nil
+	case kty == 3 && alg == coseAlgRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, 0, errors.New("invalid RSA key")
+		}
+
+		var exp int
+		for _, b := range e {
+			exp = exp<<8 | int(b)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}, alg, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported COSE key type %d with algorithm %d", kty, alg)
+	}
+}
+
+// verifyCOSESignature verifies the signature of data with a COSE encoded key
+func verifyCOSESignature(rawKey []byte, data []byte, sig []byte) error {
+	key, _, err := parseCOSEKey(rawKey)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256(data)
+
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest[:], sig) {
+			return errors.New("invalid signature")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig); err != nil {
+			return errors.New("invalid signature")
+		}
+	}
+
+	return nil
+}
+
+// credentialDescriptors lists the credentials for the allow and exclude lists of the ceremony options
+func credentialDescriptors(creds []*model.WebAuthnCredential) []model.WebAuthnCredentialDescriptor {
+	descriptors := make([]model.WebAuthnCredentialDescriptor, len(creds))
+	for i, c := range creds {
+		descriptors[i] = model.WebAuthnCredentialDescriptor{
+			Type:       "public-key",
+			ID:         base64.RawURLEncoding.EncodeToString(c.CredentialID),
+			Transports: c.Transports,
+		}
+	}
+
+	return descriptors
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/stretchr/testify/require"
+)
+
+var testRelyingParty = model.RelyingParty{
+	ID:      "example.com",
+	Name:    "Example",
+	Origins: []string{"https://app.example.com"},
+}
+
+// softAuthenticator is a WebAuthn authenticator implemented in software, holding a single ES256 credential.
+// It behaves like a browser along with a platform authenticator, so that the ceremonies can be tested without hardware
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+	rpID         string
+	origin       string
+	flags        byte
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	credentialID := make([]byte, 16)
+	_, err = rand.Read(credentialID)
+	require.NoError(t, err)
+
+	return &softAuthenticator{
+		key:          key,
+		credentialID: credentialID,
+		rpID:         testRelyingParty.ID,
+		origin:       testRelyingParty.Origins[0],
+		flags:        authDataUserPresent | authDataUserVerified,
+	}
+}
+
+// create responds to creation options like navigator.credentials.create
+func (a *softAuthenticator) create(t *testing.T, options *model.WebAuthnCreationOptions) *model.WebAuthnAttestation {
+	userHandle, err := base64.RawURLEncoding.DecodeString(options.User.ID)
+	require.NoError(t, err)
+	a.userHandle = userHandle
+
+	// attested credential data: aaguid, credential id length, credential id, COSE key
+	attested := make([]byte, 18)
+	binary.BigEndian.PutUint16(attested[16:], uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, a.publicKey()...)
+
+	attObj := cborEncode(map[interface{}]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[interface{}]interface{}{},
+		"authData": append(a.authData(a.flags|authDataAttested), attested...),
+	})
+
+	return &model.WebAuthnAttestation{
+		ID:                base64.RawURLEncoding.EncodeToString(a.credentialID),
+		ClientDataJSON:    base64.RawURLEncoding.EncodeToString(a.clientData(t, "webauthn.create", options.Challenge)),
+		AttestationObject: base64.RawURLEncoding.EncodeToString(attObj),
+		Transports:        []string{"internal"},
+	}
+}
+
+// get responds to a challenge like navigator.credentials.get
+func (a *softAuthenticator) get(t *testing.T, challenge string) *model.WebAuthnAssertion {
+	a.signCount++
+
+	authData := a.authData(a.flags)
+	clientData := a.clientData(t, "webauthn.get", challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	require.NoError(t, err)
+
+	return &model.WebAuthnAssertion{
+		ID:                base64.RawURLEncoding.EncodeToString(a.credentialID),
+		ClientDataJSON:    base64.RawURLEncoding.EncodeToString(clientData),
+		AuthenticatorData: base64.RawURLEncoding.EncodeToString(authData),
+		Signature:         base64.RawURLEncoding.EncodeToString(sig),
+		UserHandle:        base64.RawURLEncoding.EncodeToString(a.userHandle),
+	}
+}
+
+// credential returns the credential as it has been stored after registering it for the user
+func (a *softAuthenticator) credential(uid uuid.UUID) *model.WebAuthnCredential {
+	a.userHandle = uid[:]
+
+	return &model.WebAuthnCredential{
+		ID:           uuid.New(),
+		UID:          uid,
+		CredentialID: a.credentialID,
+		PublicKey:    a.publicKey(),
+		SignCount:    int64(a.signCount),
+	}
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, ceremony string, challenge string) []byte {
+	b, err := json.Marshal(map[string]interface{}{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      a.origin,
+		"crossOrigin": false,
+	})
+	require.NoError(t, err)
+	return b
+}
+
+func (a *softAuthenticator) authData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+
+	b := append(rpIDHash[:], flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(b[33:], a.signCount)
+	return b
+}
+
+func (a *softAuthenticator) publicKey() []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.key.X.FillBytes(x)
+	a.key.Y.FillBytes(y)
+
+	return cborEncode(map[interface{}]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: x,
+		-3: y,
+	})
+}
+
+// cborEncode encodes the subset of CBOR produced by authenticators
+func cborEncode(v interface{}) []byte {
+	switch v := v.(type) {
+	case int:
+		if v >= 0 {
+			return cborHead(0, uint64(v))
+		}
+		return cborHead(1, uint64(-1-v))
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case map[interface{}]interface{}:
+		b := cborHead(5, uint64(len(v)))
+		for key, value := range v {
+			b = append(b, cborEncode(key)...)
+			b = append(b, cborEncode(value)...)
+		}
+		return b
+	default:
+		panic(fmt.Sprintf("cannot encode %T", v))
+	}
+}
+
+func cborHead(major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return []byte{major<<5 | byte(arg)}
+	case arg <= 0xff:
+		return []byte{major<<5 | 24, byte(arg)}
+	case arg <= 0xffff:
+		return []byte{major<<5 | 25, byte(arg >> 8), byte(arg)}
+	default:
+		b := []byte{major<<5 | 26, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[1:], uint32(arg))
+		return b
+	}
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/library"
+	"github.com/maxeth/go-account-api/model"
+)
+
+// action names of the challenges of the WebAuthn ceremonies, which are stored under the challenge itself
+const (
+	WebAuthnRegisterAction = "webauthnregister"
+	WebAuthnLoginAction    = "webauthnlogin"
+)
+
+type webAuthnService struct {
+	WebAuthnCredentialRepository model.WebAuthnCredentialRepository
+	RecoveryCodeRepository       model.RecoveryCodeRepository
+	UserRepository               model.UserRepository
+	ActionTokenRepository        model.ActionTokenRepository
+	AuditService                 model.AuditService
+	RelyingParty                 model.RelyingParty
+	ChallengeExpSecs             int64
+}
+
+type WebAuthnServiceConfig struct {
+	WebAuthnCredentialRepository model.WebAuthnCredentialRepository
+	RecoveryCodeRepository       model.RecoveryCodeRepository
+	UserRepository               model.UserRepository
+	ActionTokenRepository        model.ActionTokenRepository
+	AuditService                 model.AuditService // records failed passkey sign ins, nothing is recorded if nil
+	RelyingParty                 model.RelyingParty
+	ChallengeExpSecs             int64 // how long a ceremony can be completed after it has been started
+}
+
+func NewWebAuthnService(c *WebAuthnServiceConfig) model.WebAuthnService {
+	return &webAuthnService{
+		WebAuthnCredentialRepository: c.WebAuthnCredentialRepository,
+		RecoveryCodeRepository:       c.RecoveryCodeRepository,
+		UserRepository:               c.UserRepository,
+		ActionTokenRepository:        c.ActionTokenRepository,
+		AuditService:                 c.AuditService,
+		RelyingParty:                 c.RelyingParty,
+		ChallengeExpSecs:             c.ChallengeExpSecs,
+	}
+}
+
+// BeginRegistration returns the options to create a new credential for the user with.
+// Credentials are created as discoverable when possible, so that they can be used for passwordless sign in
+func (s *webAuthnService) BeginRegistration(ctx context.Context, u *model.User) (*model.WebAuthnCreationOptions, error) {
+	creds, err := s.WebAuthnCredentialRepository.FindByUID(ctx, u.UID)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := s.newChallenge(ctx, WebAuthnRegisterAction, u.UID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	displayName := u.Name
+	if displayName == "" {
+		displayName = u.Email
+	}
+
+	return &model.WebAuthnCreationOptions{
+		Challenge: challenge,
+		RP: model.WebAuthnRPEntity{
+			ID:   s.RelyingParty.ID,
+			Name: s.RelyingParty.Name,
+		},
+		User: model.WebAuthnUserEntity{
+			ID:          base64.RawURLEncoding.EncodeToString(u.UID[:]),
+			Name:        u.Email,
+			DisplayName: displayName,
+		},
+		PubKeyCredParams: []model.WebAuthnCredentialParameter{
+			{Type: "public-key", Alg: coseAlgES256},
+			{Type: "public-key", Alg: coseAlgRS256},
+		},
+		Timeout:            s.ChallengeExpSecs * 1000,
+		ExcludeCredentials: credentialDescriptors(creds),
+		AuthenticatorSelection: model.WebAuthnAuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: userVerificationPreferred,
+		},
+		Attestation: "none",
+	}, nil
+}
+
+// FinishRegistration verifies the response of the authenticator to the options of BeginRegistration and stores the new credential.
+// Since passkeys enable 2FA, a new set of recovery codes is returned unless the user still has unused ones
+func (s *webAuthnService) FinishRegistration(ctx context.Context, u *model.User, nickname string, att *model.WebAuthnAttestation) (*model.WebAuthnCredential, []string, error) {
+	challenge, err := s.consumeChallenge(ctx, WebAuthnRegisterAction, att.ClientDataJSON)
+	if err != nil {
+		return nil, nil, err
+	}
+	if challenge.value != u.UID.String() {
+		return nil, nil, model.NewAuthorization("The passkey could not be verified.")
+	}
+
+	cred, err := verifyRegistration(s.RelyingParty, challenge.challenge, att, false)
+	if err != nil {
+		log.Printf("Failed to verify webauthn registration of uid: %v. Error: %v\n", u.UID, err)
+		return nil, nil, model.NewAuthorization("The passkey could not be verified.")
+	}
+
+	cred.UID = u.UID
+	cred.Nickname = nickname
+	cred, err = s.WebAuthnCredentialRepository.Create(ctx, cred)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	codes, err := ensureRecoveryCodes(ctx, s.RecoveryCodeRepository, u.UID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cred, codes, nil
+}
+
+// BeginLogin returns the options for a passwordless sign in with a discoverable credential
+func (s *webAuthnService) BeginLogin(ctx context.Context) (*model.WebAuthnRequestOptions, error) {
+	challenge, err := s.newChallenge(ctx, WebAuthnLoginAction, WebAuthnLoginAction)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.WebAuthnRequestOptions{
+		Challenge:        challenge,
+		Timeout:          s.ChallengeExpSecs * 1000,
+		RPID:             s.RelyingParty.ID,
+		AllowCredentials: []model.WebAuthnCredentialDescriptor{},
+		UserVerification: userVerificationRequired,
+	}, nil
+}
+
+// FinishLogin verifies the response of the authenticator to the options of BeginLogin and returns the signed in user.
+// The authenticator has to verify the user, since the credential replaces both the password and the second factor
+func (s *webAuthnService) FinishLogin(ctx context.Context, a *model.WebAuthnAssertion) (*model.User, error) {
+	challenge, err := s.consumeChallenge(ctx, WebAuthnLoginAction, a.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	credentialID, err := base64.RawURLEncoding.DecodeString(a.ID)
+	if err != nil {
+		return nil, model.NewAuthorization("The passkey could not be verified.")
+	}
+
+	cred, err := s.WebAuthnCredentialRepository.FindByCredentialID(ctx, credentialID)
+	if err != nil {
+		if model.Status(err) == http.StatusNotFound {
+			recordAudit(ctx, s.AuditService, model.AuditSigninFailed, nil, model.AuditDetails{"method": model.SigninMethodPasskey, "reason": "unknown_passkey"})
+			return nil, model.NewAuthorization("The passkey is not registered.")
+		}
+		return nil, err
+	}
+
+	// discoverable credentials return the user id they have been created for
+	if a.UserHandle != "" {
+		userHandle, err := base64.RawURLEncoding.DecodeString(a.UserHandle)
+		if err != nil || string(userHandle) != string(cred.UID[:]) {
+			recordAudit(ctx, s.AuditService, model.AuditSigninFailed, &cred.UID, model.AuditDetails{"method": model.SigninMethodPasskey, "reason": "invalid_passkey"})
+			return nil, model.NewAuthorization("The passkey could not be verified.")
+		}
+	}
+
+	if err := verifyCredentialUse(ctx, s.WebAuthnCredentialRepository, s.RelyingParty, challenge.challenge, cred, a, true); err != nil {
+		if model.Status(err) == http.StatusUnauthorized {
+			recordAudit(ctx, s.AuditService, model.AuditSigninFailed, &cred.UID, model.AuditDetails{"method": model.SigninMethodPasskey, "reason": "invalid_passkey"})
+		}
+		return nil, err
+	}
+
+	user, err := s.UserRepository.FindByID(ctx, cred.UID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := user.CheckActive(); err != nil {
+		recordAudit(ctx, s.AuditService, model.AuditSigninFailed, &user.UID, model.AuditDetails{"method": model.SigninMethodPasskey, "reason": "suspended"})
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *webAuthnService) ListCredentials(ctx context.Context, uid uuid.UUID) ([]*model.WebAuthnCredential, error) {
+	return s.WebAuthnCredentialRepository.FindByUID(ctx, uid)
+}
+
+func (s *webAuthnService) DeleteCredential(ctx context.Context, uid uuid.UUID, id uuid.UUID) error {
+	return s.WebAuthnCredentialRepository.Delete(ctx, uid, id)
+}
+
+// webAuthnChallenge is a consumed challenge along with the value it has been stored with
+type webAuthnChallenge struct {
+	challenge string
+	value     string
+}
+
+// newChallenge creates a random challenge for the ceremony and stores it along with value until the ceremony times out
+func (s *webAuthnService) newChallenge(ctx context.Context, action, value string) (string, error) {
+	challenge, err := library.SecureToken(32)
+	if err != nil {
+		log.Printf("Failed to generate %s challenge: %v\n", action, err)
+		return "", model.NewInternal()
+	}
+
+	if err := s.ActionTokenRepository.SetActionToken(ctx, action, challenge, value, time.Duration(s.ChallengeExpSecs)*time.Second); err != nil {
+		return "", model.NewInternal()
+	}
+
+	return challenge, nil
+}
+
+// consumeChallenge invalidates the challenge the client data has been created for and returns it along with its value
+func (s *webAuthnService) consumeChallenge(ctx context.Context, action, clientDataJSON string) (*webAuthnChallenge, error) {
+	cd, _, err := parseClientData(clientDataJSON)
+	if err != nil {
+		return nil, model.NewBadRequest("Invalid client data.")
+	}
+
+	value, err := s.ActionTokenRepository.ConsumeActionToken(ctx, action, cd.Challenge)
+	if err != nil {
+		if model.Status(err) == http.StatusNotFound {
+			return nil, model.NewAuthorization("The challenge is invalid or has expired. Try again.")
+		}
+		return nil, model.NewInternal()
+	}
+
+	return &webAuthnChallenge{challenge: cd.Challenge, value: value}, nil
+}
+
+// verifyCredentialUse verifies an assertion of the credential and stores its new signature counter
+func verifyCredentialUse(ctx context.Context, r model.WebAuthnCredentialRepository, rp model.RelyingParty, challenge string, cred *model.WebAuthnCredential, a *model.WebAuthnAssertion, requireUV bool) error {
+	signCount, err := verifyAssertion(rp, challenge, cred, a, requireUV)
+	if err != nil {
+		log.Printf("Failed to verify webauthn assertion of uid: %v. Error: %v\n", cred.UID, err)
+		return model.NewAuthorization("The passkey could not be verified.")
+	}
+
+	return r.UpdateSignCount(ctx, cred.ID, signCount)
+}
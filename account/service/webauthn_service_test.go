@@ -0,0 +1,414 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/maxeth/go-account-api/model"
+	"github.com/maxeth/go-account-api/model/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestWebAuthnService(ctrl *gomock.Controller) (model.WebAuthnService, *mocks.MockWebAuthnCredentialRepository, *mocks.MockUserRepository, *mocks.MockActionTokenRepository, *mocks.MockRecoveryCodeRepository) {
+	credRepo := mocks.NewMockWebAuthnCredentialRepository(ctrl)
+	userRepo := mocks.NewMockUserRepository(ctrl)
+	atr := mocks.NewMockActionTokenRepository(ctrl)
+	codeRepo := mocks.NewMockRecoveryCodeRepository(ctrl)
+
+	s := NewWebAuthnService(&WebAuthnServiceConfig{
+		WebAuthnCredentialRepository: credRepo,
+		RecoveryCodeRepository:       codeRepo,
+		UserRepository:               userRepo,
+		ActionTokenRepository:        atr,
+		RelyingParty:                 testRelyingParty,
+		ChallengeExpSecs:             300,
+	})
+
+	return s, credRepo, userRepo, atr, codeRepo
+}
+
+// storeChallenge captures the challenge of a ceremony when it is stored
+func storeChallenge(challenge *string) func(ctx context.Context, action, token, value string, exp time.Duration) error {
+	return func(ctx context.Context, action, token, value string, exp time.Duration) error {
+		*challenge = token
+		return nil
+	}
+}
+
+func TestWebAuthnRegistration(t *testing.T) {
+	user := randomUser(t)
+
+	testCases := []struct {
+		name          string
+		modify        func(a *softAuthenticator)
+		buildStubs    func(a *softAuthenticator, challenge *string, credRepo *mocks.MockWebAuthnCredentialRepository, atr *mocks.MockActionTokenRepository, codeRepo *mocks.MockRecoveryCodeRepository)
+		checkResponse func(t *testing.T, a *softAuthenticator, cred *model.WebAuthnCredential, codes []string, err error)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(a *softAuthenticator, challenge *string, credRepo *mocks.MockWebAuthnCredentialRepository, atr *mocks.MockActionTokenRepository, codeRepo *mocks.MockRecoveryCodeRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), WebAuthnRegisterAction, gomock.Any()).Times(1).
+					DoAndReturn(func(ctx context.Context, action, token string) (string, error) {
+						require.Equal(t, *challenge, token)
+						return user.UID.String(), nil
+					})
+				credRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(ctx context.Context, c *model.WebAuthnCredential) (*model.WebAuthnCredential, error) {
+						return c, nil
+					})
+				codeRepo.EXPECT().CountUnused(gomock.Any(), user.UID).Times(1).Return(0, nil)
+				codeRepo.EXPECT().Replace(gomock.Any(), user.UID, gomock.Len(recoveryCodeCount)).Times(1).Return(nil)
+			},
+			checkResponse: func(t *testing.T, a *softAuthenticator, cred *model.WebAuthnCredential, codes []string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, user.UID, cred.UID)
+				require.Equal(t, "laptop", cred.Nickname)
+				require.Equal(t, a.credentialID, cred.CredentialID)
+				require.Equal(t, model.Transports{"internal"}, cred.Transports)
+
+				key, alg, err := parseCOSEKey(cred.PublicKey)
+				require.NoError(t, err)
+				require.Equal(t, int64(coseAlgES256), alg)
+				require.True(t, a.key.PublicKey.Equal(key.(*ecdsa.PublicKey)))
+
+				// the first passkey enables 2FA
+				require.Len(t, codes, recoveryCodeCount)
+			},
+		},
+		{
+			name: "KeepsRecoveryCodes",
+			buildStubs: func(a *softAuthenticator, challenge *string, credRepo *mocks.MockWebAuthnCredentialRepository, atr *mocks.MockActionTokenRepository, codeRepo *mocks.MockRecoveryCodeRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), WebAuthnRegisterAction, gomock.Any()).Times(1).Return(user.UID.String(), nil)
+				credRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(ctx context.Context, c *model.WebAuthnCredential) (*model.WebAuthnCredential, error) {
+						return c, nil
+					})
+				codeRepo.EXPECT().CountUnused(gomock.Any(), user.UID).Times(1).Return(4, nil)
+				codeRepo.EXPECT().Replace(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, a *softAuthenticator, cred *model.WebAuthnCredential, codes []string, err error) {
+				require.NoError(t, err)
+				require.Nil(t, codes)
+			},
+		},
+		{
+			name: "WrongOrigin",
+			modify: func(a *softAuthenticator) {
+				a.origin = "https://phishing.example.net"
+			},
+			buildStubs: func(a *softAuthenticator, challenge *string, credRepo *mocks.MockWebAuthnCredentialRepository, atr *mocks.MockActionTokenRepository, codeRepo *mocks.MockRecoveryCodeRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), WebAuthnRegisterAction, gomock.Any()).Times(1).Return(user.UID.String(), nil)
+				credRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, a *softAuthenticator, cred *model.WebAuthnCredential, codes []string, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name: "WrongRelyingParty",
+			modify: func(a *softAuthenticator) {
+				a.rpID = "example.net"
+			},
+			buildStubs: func(a *softAuthenticator, challenge *string, credRepo *mocks.MockWebAuthnCredentialRepository, atr *mocks.MockActionTokenRepository, codeRepo *mocks.MockRecoveryCodeRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), WebAuthnRegisterAction, gomock.Any()).Times(1).Return(user.UID.String(), nil)
+				credRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, a *softAuthenticator, cred *model.WebAuthnCredential, codes []string, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name: "UserNotPresent",
+			modify: func(a *softAuthenticator) {
+				a.flags = 0
+			},
+			buildStubs: func(a *softAuthenticator, challenge *string, credRepo *mocks.MockWebAuthnCredentialRepository, atr *mocks.MockActionTokenRepository, codeRepo *mocks.MockRecoveryCodeRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), WebAuthnRegisterAction, gomock.Any()).Times(1).Return(user.UID.String(), nil)
+				credRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, a *softAuthenticator, cred *model.WebAuthnCredential, codes []string, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name: "ChallengeOfOtherUser",
+			buildStubs: func(a *softAuthenticator, challenge *string, credRepo *mocks.MockWebAuthnCredentialRepository, atr *mocks.MockActionTokenRepository, codeRepo *mocks.MockRecoveryCodeRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), WebAuthnRegisterAction, gomock.Any()).Times(1).Return(uuid.New().String(), nil)
+				credRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, a *softAuthenticator, cred *model.WebAuthnCredential, codes []string, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name: "ExpiredChallenge",
+			buildStubs: func(a *softAuthenticator, challenge *string, credRepo *mocks.MockWebAuthnCredentialRepository, atr *mocks.MockActionTokenRepository, codeRepo *mocks.MockRecoveryCodeRepository) {
+				atr.EXPECT().ConsumeActionToken(gomock.Any(), WebAuthnRegisterAction, gomock.Any()).Times(1).Return("", model.NewNotFound("token", ""))
+				credRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, a *softAuthenticator, cred *model.WebAuthnCredential, codes []string, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			s, credRepo, _, atr, codeRepo := newTestWebAuthnService(ctrl)
+			a := newSoftAuthenticator(t)
+			if tc.modify != nil {
+				tc.modify(a)
+			}
+
+			var challenge string
+			credRepo.EXPECT().FindByUID(gomock.Any(), user.UID).Times(1).Return([]*model.WebAuthnCredential{}, nil)
+			atr.EXPECT().SetActionToken(gomock.Any(), WebAuthnRegisterAction, gomock.Any(), user.UID.String(), 300*time.Second).Times(1).
+				DoAndReturn(storeChallenge(&challenge))
+			tc.buildStubs(a, &challenge, credRepo, atr, codeRepo)
+
+			options, err := s.BeginRegistration(context.Background(), user)
+			require.NoError(t, err)
+			require.Equal(t, challenge, options.Challenge)
+			require.Equal(t, testRelyingParty.ID, options.RP.ID)
+			require.Equal(t, base64.RawURLEncoding.EncodeToString(user.UID[:]), options.User.ID)
+
+			cred, codes, err := s.FinishRegistration(context.Background(), user, "laptop", a.create(t, options))
+			tc.checkResponse(t, a, cred, codes, err)
+		})
+	}
+}
+
+func TestWebAuthnLogin(t *testing.T) {
+	user := randomUser(t)
+	user.Status = model.StatusActive
+
+	testCases := []struct {
+		name          string
+		modify        func(t *testing.T, a *softAuthenticator, cred *model.WebAuthnCredential, assertion *model.WebAuthnAssertion)
+		buildStubs    func(cred *model.WebAuthnCredential, credRepo *mocks.MockWebAuthnCredentialRepository, userRepo *mocks.MockUserRepository)
+		failure       string // reason of the failed sign in recorded in the audit log
+		checkResponse func(t *testing.T, u *model.User, err error)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(cred *model.WebAuthnCredential, credRepo *mocks.MockWebAuthnCredentialRepository, userRepo *mocks.MockUserRepository) {
+				credRepo.EXPECT().FindByCredentialID(gomock.Any(), cred.CredentialID).Times(1).Return(cred, nil)
+				credRepo.EXPECT().UpdateSignCount(gomock.Any(), cred.ID, int64(1)).Times(1).Return(nil)
+				userRepo.EXPECT().FindByID(gomock.Any(), user.UID).Times(1).Return(user, nil)
+			},
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.NoError(t, err)
+				require.Equal(t, user, u)
+			},
+		},
+		{
+			name: "InvalidSignature",
+			modify: func(t *testing.T, a *softAuthenticator, cred *model.WebAuthnCredential, assertion *model.WebAuthnAssertion) {
+				// the assertion is signed by a different key than the registered one
+				cred.PublicKey = newSoftAuthenticator(t).publicKey()
+			},
+			buildStubs: func(cred *model.WebAuthnCredential, credRepo *mocks.MockWebAuthnCredentialRepository, userRepo *mocks.MockUserRepository) {
+				credRepo.EXPECT().FindByCredentialID(gomock.Any(), cred.CredentialID).Times(1).Return(cred, nil)
+				credRepo.EXPECT().UpdateSignCount(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				userRepo.EXPECT().FindByID(gomock.Any(), gomock.Any()).Times(0)
+			},
+			failure: "invalid_passkey",
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name: "ClonedAuthenticator",
+			modify: func(t *testing.T, a *softAuthenticator, cred *model.WebAuthnCredential, assertion *model.WebAuthnAssertion) {
+				// the original authenticator has been used more often than the one the assertion comes from
+				cred.SignCount = 5
+			},
+			buildStubs: func(cred *model.WebAuthnCredential, credRepo *mocks.MockWebAuthnCredentialRepository, userRepo *mocks.MockUserRepository) {
+				credRepo.EXPECT().FindByCredentialID(gomock.Any(), cred.CredentialID).Times(1).Return(cred, nil)
+				credRepo.EXPECT().UpdateSignCount(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			failure: "invalid_passkey",
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name: "UserNotVerified",
+			modify: func(t *testing.T, a *softAuthenticator, cred *model.WebAuthnCredential, assertion *model.WebAuthnAssertion) {
+				*assertion = *resign(t, a, assertion, authDataUserPresent)
+			},
+			buildStubs: func(cred *model.WebAuthnCredential, credRepo *mocks.MockWebAuthnCredentialRepository, userRepo *mocks.MockUserRepository) {
+				credRepo.EXPECT().FindByCredentialID(gomock.Any(), cred.CredentialID).Times(1).Return(cred, nil)
+				credRepo.EXPECT().UpdateSignCount(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			failure: "invalid_passkey",
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name: "UserHandleMismatch",
+			modify: func(t *testing.T, a *softAuthenticator, cred *model.WebAuthnCredential, assertion *model.WebAuthnAssertion) {
+				other := uuid.New()
+				assertion.UserHandle = base64.RawURLEncoding.EncodeToString(other[:])
+			},
+			buildStubs: func(cred *model.WebAuthnCredential, credRepo *mocks.MockWebAuthnCredentialRepository, userRepo *mocks.MockUserRepository) {
+				credRepo.EXPECT().FindByCredentialID(gomock.Any(), cred.CredentialID).Times(1).Return(cred, nil)
+				credRepo.EXPECT().UpdateSignCount(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			failure: "invalid_passkey",
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+		{
+			name: "UnregisteredCredential",
+			buildStubs: func(cred *model.WebAuthnCredential, credRepo *mocks.MockWebAuthnCredentialRepository, userRepo *mocks.MockUserRepository) {
+				credRepo.EXPECT().FindByCredentialID(gomock.Any(), cred.CredentialID).Times(1).Return(nil, model.NewNotFound("credential", ""))
+			},
+			failure: "unknown_passkey",
+			checkResponse: func(t *testing.T, u *model.User, err error) {
+				require.Equal(t, http.StatusUnauthorized, model.Status(err))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			s, credRepo, userRepo, atr, _ := newTestWebAuthnService(ctrl)
+			a := newSoftAuthenticator(t)
+			cred := a.credential(user.UID)
+
+			as := mocks.NewMockAuditService(ctrl)
+			s.(*webAuthnService).AuditService = as
+			if tc.failure == "" {
+				as.EXPECT().Record(gomock.Any(), gomock.Any()).Times(0)
+			} else {
+				as.EXPECT().Record(gomock.Any(), gomock.Any()).Times(1).
+					Do(func(ctx context.Context, e *model.AuditEvent) {
+						require.Equal(t, model.AuditSigninFailed, e.Type)
+						require.Equal(t, tc.failure, e.Details["reason"])
+					})
+			}
+
+			var challenge string
+			atr.EXPECT().SetActionToken(gomock.Any(), WebAuthnLoginAction, gomock.Any(), gomock.Any(), 300*time.Second).Times(1).
+				DoAndReturn(storeChallenge(&challenge))
+
+			options, err := s.BeginLogin(context.Background())
+			require.NoError(t, err)
+			require.Empty(t, options.AllowCredentials)
+			require.Equal(t, userVerificationRequired, options.UserVerification)
+
+			assertion := a.get(t, options.Challenge)
+			if tc.modify != nil {
+				tc.modify(t, a, cred, assertion)
+			}
+
+			atr.EXPECT().ConsumeActionToken(gomock.Any(), WebAuthnLoginAction, challenge).Times(1).Return(WebAuthnLoginAction, nil)
+			tc.buildStubs(cred, credRepo, userRepo)
+
+			u, err := s.FinishLogin(context.Background(), assertion)
+			tc.checkResponse(t, u, err)
+		})
+	}
+}
+
+// resign returns the assertion signed again with different flags
+func resign(t *testing.T, a *softAuthenticator, assertion *model.WebAuthnAssertion, flags byte) *model.WebAuthnAssertion {
+	clientData, err := base64.RawURLEncoding.DecodeString(assertion.ClientDataJSON)
+	require.NoError(t, err)
+
+	var cd collectedClientData
+	require.NoError(t, json.Unmarshal(clientData, &cd))
+
+	a.flags = flags
+	a.signCount--
+	return a.get(t, cd.Challenge)
+}
+
+func TestVerifyWebAuthn(t *testing.T) {
+	user := randomUser(t)
+	user.Status = model.StatusActive
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, m := newTestMFAService(ctrl)
+	a := newSoftAuthenticator(t)
+	// passkeys used as second factor only have to prove the presence of the user
+	a.flags = authDataUserPresent
+	cred := a.credential(user.UID)
+
+	// the state of the challenge as stored in redis
+	var stored string
+	m.atr.EXPECT().SetActionToken(gomock.Any(), MFAChallengeAction, "challenge", gomock.Any(), gomock.Any()).AnyTimes().
+		DoAndReturn(func(ctx context.Context, action, token, value string, exp time.Duration) error {
+			stored = value
+			return nil
+		})
+	m.atr.EXPECT().ConsumeActionToken(gomock.Any(), MFAChallengeAction, "challenge").AnyTimes().
+		DoAndReturn(func(ctx context.Context, action, token string) (string, error) {
+			if stored == "" {
+				return "", model.NewNotFound("token", token)
+			}
+			value := stored
+			stored = ""
+			return value, nil
+		})
+
+	b, err := json.Marshal(&mfaChallenge{UID: user.UID, ExpiresAt: time.Now().Add(time.Minute)})
+	require.NoError(t, err)
+	stored = string(b)
+
+	// the passkey has to be requested before it can be verified
+	_, err = s.VerifyWebAuthn(context.Background(), "challenge", a.get(t, "made up challenge"))
+	require.Equal(t, http.StatusBadRequest, model.Status(err))
+
+	m.credRepo.EXPECT().FindByUID(gomock.Any(), user.UID).Times(2).Return([]*model.WebAuthnCredential{cred}, nil)
+
+	// passkeys of other users are rejected, which fails the attempt
+	options, err := s.BeginWebAuthn(context.Background(), "challenge")
+	require.NoError(t, err)
+	require.Len(t, options.AllowCredentials, 1)
+
+	otherCred := *cred
+	otherCred.UID = uuid.New()
+	m.credRepo.EXPECT().FindByCredentialID(gomock.Any(), cred.CredentialID).Times(1).Return(&otherCred, nil)
+	m.audit.EXPECT().Record(gomock.Any(), &model.AuditEvent{
+		Type:       model.AuditSigninFailed,
+		SubjectUID: &user.UID,
+		Details:    model.AuditDetails{"method": model.MFAMethodWebAuthn, "reason": "invalid_passkey"},
+	}).Times(1)
+
+	_, err = s.VerifyWebAuthn(context.Background(), "challenge", a.get(t, options.Challenge))
+	require.Equal(t, http.StatusUnauthorized, model.Status(err))
+
+	options, err = s.BeginWebAuthn(context.Background(), "challenge")
+	require.NoError(t, err)
+
+	m.credRepo.EXPECT().FindByCredentialID(gomock.Any(), cred.CredentialID).Times(1).Return(cred, nil)
+	m.credRepo.EXPECT().UpdateSignCount(gomock.Any(), cred.ID, gomock.Any()).Times(1).Return(nil)
+	m.userRepo.EXPECT().FindByID(gomock.Any(), user.UID).Times(1).Return(user, nil)
+
+	u, err := s.VerifyWebAuthn(context.Background(), "challenge", a.get(t, options.Challenge))
+	require.NoError(t, err)
+	require.Equal(t, user, u)
+}